@@ -46,11 +46,13 @@ func getLockName(namespace string, name string) string {
 }
 
 func LaunchClusterApplication(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, name string, environmentSlice []interface{}, size int, replicationControllerExtraJsonMap map[string]interface{}) error {
-	if lock.AcquireLock(LockKind, getLockName(namespace, name), 0) == false {
+	clusterLock, err := lock.AcquireLock(LockKind, getLockName(namespace, name), 0)
+	if err != nil {
+		log.Error(err)
 		return errors.New("Template is under deployment")
 	}
 
-	defer lock.ReleaseLock(LockKind, getLockName(namespace, name))
+	defer clusterLock.Release()
 
 	cluster, err := GetStorage().LoadClusterApplication(name)
 	if err != nil {
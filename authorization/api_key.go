@@ -0,0 +1,449 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"github.com/coreos/etcd/client"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiKeyPrefix   = "apikey-"
+	apiKeyCacheTTL = time.Minute
+	apiKeyIDLength = 8
+	// Only the hash of the secret is stored
+	apiKeySecretLength = 32
+	apiKeyAllNamespace = "*"
+)
+
+// The long-lived credential for the automation. The key is only returned once when created.
+type APIKey struct {
+	ID            string
+	Name          string
+	Username      string
+	EncodedSecret string
+	// Scope. Empty means all permissions of the user.
+	PermissionSlice []*rbac.Permission
+	// Scope. Empty means all namespaces of the user and * means all namespaces.
+	NamespaceSlice []string
+	CreatedTime    time.Time
+	ExpiredTime    *time.Time
+	// Updated at most once per apiKeyCacheTTL in each instance. Only written when the key still exists so the revoked key is never recreated.
+	LastUsedTime *time.Time
+}
+
+type apiKeyCache struct {
+	apiKeyID    string
+	user        *rbac.User
+	expiredTime time.Time
+}
+
+// The scoped users of the recently used keys so the storage is not accessed for every request
+var apiKeyCacheMutex = &sync.RWMutex{}
+var apiKeyCacheMap = make(map[string]apiKeyCache)
+
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+func generateAPIKey() (string, string, error) {
+	idByteSlice := make([]byte, apiKeyIDLength)
+	if _, err := rand.Read(idByteSlice); err != nil {
+		return "", "", err
+	}
+	secretByteSlice := make([]byte, apiKeySecretLength)
+	if _, err := rand.Read(secretByteSlice); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(idByteSlice), hex.EncodeToString(secretByteSlice), nil
+}
+
+func formatAPIKey(id string, secret string) string {
+	return apiKeyPrefix + id + "-" + secret
+}
+
+func parseAPIKey(key string) (string, string, error) {
+	if isAPIKey(key) == false {
+		return "", "", errors.New("Invalid API key format")
+	}
+	splitSlice := strings.Split(strings.TrimPrefix(key, apiKeyPrefix), "-")
+	if len(splitSlice) != 2 || len(splitSlice[0]) != apiKeyIDLength*2 || len(splitSlice[1]) != apiKeySecretLength*2 {
+		return "", "", errors.New("Invalid API key format")
+	}
+	return splitSlice[0], splitSlice[1], nil
+}
+
+func encodeAPIKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func (apiKey *APIKey) checkSecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(apiKey.EncodedSecret), []byte(encodeAPIKeySecret(secret))) == 1
+}
+
+func (apiKey *APIKey) isExpired() bool {
+	return apiKey.ExpiredTime != nil && apiKey.ExpiredTime.Before(time.Now())
+}
+
+// Without the secret hash
+func (apiKey *APIKey) copyWithoutSecret() APIKey {
+	copiedAPIKey := *apiKey
+	copiedAPIKey.EncodedSecret = ""
+	return copiedAPIKey
+}
+
+func getAPIKeyNamespaceResource(namespace string) *rbac.Resource {
+	if namespace == apiKeyAllNamespace {
+		return &rbac.Resource{"all", "*", "*"}
+	} else {
+		return &rbac.Resource{namespace, "*", "/namespaces/" + namespace}
+	}
+}
+
+// The user restricted to the scope of the key. The scope beyond the current permissions of the user is dropped so the key never has more than the user.
+func getAPIKeyScopedUser(user *rbac.User, apiKey *APIKey) *rbac.User {
+	scopedUser := *user
+
+	if len(apiKey.PermissionSlice) > 0 {
+		permissionSlice := make([]*rbac.Permission, 0)
+		for _, permission := range apiKey.PermissionSlice {
+			if user.HasPermission(permission.Component, permission.Method, permission.Path) {
+				permissionSlice = append(permissionSlice, permission)
+			}
+		}
+		scopedUser.RoleSlice = []*rbac.Role{&rbac.Role{"apikey-" + apiKey.Name, permissionSlice, "API key " + apiKey.ID}}
+	}
+
+	if len(apiKey.NamespaceSlice) > 0 {
+		resourceSlice := make([]*rbac.Resource, 0)
+		for _, namespace := range apiKey.NamespaceSlice {
+			resource := getAPIKeyNamespaceResource(namespace)
+			if user.HasResource(resource.Component, resource.Path) {
+				resourceSlice = append(resourceSlice, resource)
+			}
+		}
+		scopedUser.ResourceSlice = resourceSlice
+	}
+
+	return &scopedUser
+}
+
+// Convert the resource to the namespace of the key. The resource not about the namespace is not supported.
+func getAPIKeyNamespace(resource *rbac.Resource) string {
+	if resource.Path == "*" {
+		return apiKeyAllNamespace
+	}
+	if strings.HasPrefix(resource.Path, "/namespaces/") {
+		return strings.TrimPrefix(resource.Path, "/namespaces/")
+	}
+	return ""
+}
+
+func getAllPermission(user *rbac.User) []*rbac.Permission {
+	permissionSlice := make([]*rbac.Permission, 0)
+	for _, role := range user.RoleSlice {
+		permissionSlice = append(permissionSlice, role.PermissionSlice...)
+	}
+	return permissionSlice
+}
+
+// The empty scope means all of the user. If the creator doesn't have all of them, the scope is the permissions both the creator and the user have.
+// Return false if the creator doesn't have all of them.
+func getAPIKeyPermissionScope(creator *rbac.User, user *rbac.User) ([]*rbac.Permission, bool) {
+	userPermissionSlice := getAllPermission(user)
+	scopedPermissionSlice := make([]*rbac.Permission, 0)
+	coveredByCreator := true
+	for _, permission := range userPermissionSlice {
+		if creator.HasPermission(permission.Component, permission.Method, permission.Path) {
+			scopedPermissionSlice = append(scopedPermissionSlice, permission)
+		} else {
+			coveredByCreator = false
+		}
+	}
+	if coveredByCreator {
+		return make([]*rbac.Permission, 0), true
+	}
+
+	for _, permission := range getAllPermission(creator) {
+		if user.HasPermission(permission.Component, permission.Method, permission.Path) {
+			scopedPermissionSlice = append(scopedPermissionSlice, permission)
+		}
+	}
+	return scopedPermissionSlice, false
+}
+
+// The empty scope means all namespaces of the user. If the creator doesn't have all of them, the scope is the namespaces both the creator and the user have.
+// Return false if the creator doesn't have all of them.
+func getAPIKeyNamespaceScope(creator *rbac.User, user *rbac.User) ([]string, bool) {
+	namespaceSlice := make([]string, 0)
+	coveredByCreator := true
+	for _, resource := range user.ResourceSlice {
+		if creator.HasResource(resource.Component, resource.Path) {
+			if namespace := getAPIKeyNamespace(resource); namespace != "" && isStringInSlice(namespace, namespaceSlice) == false {
+				namespaceSlice = append(namespaceSlice, namespace)
+			}
+		} else {
+			coveredByCreator = false
+		}
+	}
+	if coveredByCreator {
+		return make([]string, 0), true
+	}
+
+	for _, resource := range creator.ResourceSlice {
+		if user.HasResource(resource.Component, resource.Path) {
+			if namespace := getAPIKeyNamespace(resource); namespace != "" && isStringInSlice(namespace, namespaceSlice) == false {
+				namespaceSlice = append(namespaceSlice, namespace)
+			}
+		}
+	}
+	return namespaceSlice, false
+}
+
+// Return the key which is only available here and the record.
+// The creator is the user sending the request which could be the scoped user of the other key so the scope of the key never exceeds the creator.
+func CreateAPIKey(creator *rbac.User, username string, name string, permissionSlice []*rbac.Permission, namespaceSlice []string, expiredTime *time.Time) (string, *APIKey, error) {
+	if name == "" {
+		return "", nil, errors.New("Name can't be empty")
+	}
+	if expiredTime != nil && expiredTime.Before(time.Now()) {
+		return "", nil, errors.New("Expired time is in the past")
+	}
+
+	user, err := GetStorage().LoadUser(username)
+	if err != nil {
+		log.Error("Load user %s error: %s", username, err)
+		return "", nil, err
+	}
+	if user.Disabled {
+		return "", nil, errors.New("User is disabled")
+	}
+
+	// The scope must be a subset of both the user and the creator
+	for _, permission := range permissionSlice {
+		if user.HasPermission(permission.Component, permission.Method, permission.Path) == false {
+			return "", nil, errors.New("User doesn't have the permission " + permission.Name)
+		}
+		if creator.HasPermission(permission.Component, permission.Method, permission.Path) == false {
+			return "", nil, errors.New("Creator doesn't have the permission " + permission.Name)
+		}
+	}
+	for _, namespace := range namespaceSlice {
+		resource := getAPIKeyNamespaceResource(namespace)
+		if user.HasResource(resource.Component, resource.Path) == false {
+			return "", nil, errors.New("User doesn't have the namespace " + namespace)
+		}
+		if creator.HasResource(resource.Component, resource.Path) == false {
+			return "", nil, errors.New("Creator doesn't have the namespace " + namespace)
+		}
+	}
+
+	// The empty scope can't be kept if the creator has less than the user since it means all of the user
+	if len(permissionSlice) == 0 {
+		scopedPermissionSlice, coveredByCreator := getAPIKeyPermissionScope(creator, user)
+		if coveredByCreator == false && len(scopedPermissionSlice) == 0 {
+			return "", nil, errors.New("Creator and user have no permission in common")
+		}
+		permissionSlice = scopedPermissionSlice
+	}
+	if len(namespaceSlice) == 0 {
+		scopedNamespaceSlice, coveredByCreator := getAPIKeyNamespaceScope(creator, user)
+		if coveredByCreator == false && len(scopedNamespaceSlice) == 0 {
+			return "", nil, errors.New("Creator and user have no namespace in common")
+		}
+		namespaceSlice = scopedNamespaceSlice
+	}
+
+	id, secret, err := generateAPIKey()
+	if err != nil {
+		log.Error(err)
+		return "", nil, err
+	}
+
+	if permissionSlice == nil {
+		permissionSlice = make([]*rbac.Permission, 0)
+	}
+	if namespaceSlice == nil {
+		namespaceSlice = make([]string, 0)
+	}
+	apiKey := &APIKey{
+		id,
+		name,
+		username,
+		encodeAPIKeySecret(secret),
+		permissionSlice,
+		namespaceSlice,
+		time.Now(),
+		expiredTime,
+		nil,
+	}
+
+	if err := GetStorage().SaveAPIKey(apiKey); err != nil {
+		log.Error(err)
+		return "", nil, err
+	}
+
+	copiedAPIKey := apiKey.copyWithoutSecret()
+	return formatAPIKey(id, secret), &copiedAPIKey, nil
+}
+
+func getUserFromAPIKey(key string) (*rbac.User, error) {
+	apiKeyCacheMutex.RLock()
+	cache, ok := apiKeyCacheMap[key]
+	apiKeyCacheMutex.RUnlock()
+	if ok && cache.expiredTime.After(time.Now()) {
+		return cache.user, nil
+	}
+
+	id, secret, err := parseAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := GetStorage().LoadAPIKey(id)
+	if err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code == client.ErrorCodeKeyNotFound {
+			return nil, errors.New("API key is revoked")
+		}
+		log.Error(err)
+		return nil, err
+	}
+	if apiKey.checkSecret(secret) == false {
+		log.Error("Incorrect secret of API key %s", id)
+		return nil, errors.New("Incorrect API key")
+	}
+	if apiKey.isExpired() {
+		return nil, errors.New("API key is expired")
+	}
+
+	user, err := GetStorage().LoadUser(apiKey.Username)
+	if err != nil {
+		log.Error("Load user %s of API key %s error: %s", apiKey.Username, id, err)
+		return nil, err
+	}
+	if user.ExpiredTime != nil && time.Now().After(*user.ExpiredTime) {
+		return nil, errors.New("User is expired")
+	}
+	if user.Disabled {
+		return nil, errors.New("User is disabled")
+	}
+
+	scopedUser := getAPIKeyScopedUser(user, apiKey)
+
+	now := time.Now()
+	apiKey.LastUsedTime = &now
+	if err := GetStorage().UpdateAPIKey(apiKey); err != nil {
+		// Still usable
+		log.Error("Update last used time of API key %s error: %s", id, err)
+	}
+
+	cacheExpiredTime := now.Add(apiKeyCacheTTL)
+	if apiKey.ExpiredTime != nil && apiKey.ExpiredTime.Before(cacheExpiredTime) {
+		cacheExpiredTime = *apiKey.ExpiredTime
+	}
+	apiKeyCacheMutex.Lock()
+	apiKeyCacheMap[key] = apiKeyCache{id, scopedUser, cacheExpiredTime}
+	apiKeyCacheMutex.Unlock()
+
+	return scopedUser, nil
+}
+
+func cleanAPIKeyCache() {
+	apiKeyCacheMutex.Lock()
+	defer apiKeyCacheMutex.Unlock()
+	for key, cache := range apiKeyCacheMap {
+		if cache.expiredTime.Before(time.Now()) {
+			delete(apiKeyCacheMap, key)
+		}
+	}
+}
+
+func removeAPIKeyCache(id string) {
+	apiKeyCacheMutex.Lock()
+	defer apiKeyCacheMutex.Unlock()
+	for key, cache := range apiKeyCacheMap {
+		if cache.apiKeyID == id {
+			delete(apiKeyCacheMap, key)
+		}
+	}
+}
+
+func GetAllAPIKeyForUser(username string) ([]APIKey, error) {
+	apiKeySlice, err := GetStorage().LoadAllAPIKey()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	filteredAPIKeySlice := make([]APIKey, 0)
+	for _, apiKey := range apiKeySlice {
+		if apiKey.Username == username {
+			filteredAPIKeySlice = append(filteredAPIKeySlice, apiKey.copyWithoutSecret())
+		}
+	}
+	return filteredAPIKeySlice, nil
+}
+
+// The other instances stop accepting the key after their cache expires
+func RevokeAPIKey(username string, id string) error {
+	apiKey, err := GetStorage().LoadAPIKey(id)
+	if err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code == client.ErrorCodeKeyNotFound {
+			return errors.New("API key doesn't exist")
+		}
+		log.Error(err)
+		return err
+	}
+	if apiKey.Username != username {
+		return errors.New("API key doesn't exist")
+	}
+
+	if err := GetStorage().DeleteAPIKey(id); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	removeAPIKeyCache(id)
+
+	return nil
+}
+
+func RevokeAllAPIKeyForUser(username string) error {
+	apiKeySlice, err := GetAllAPIKeyForUser(username)
+	if err != nil {
+		return err
+	}
+
+	for _, apiKey := range apiKeySlice {
+		if err := GetStorage().DeleteAPIKey(apiKey.ID); err != nil {
+			log.Error(err)
+			return err
+		}
+		removeAPIKeyCache(apiKey.ID)
+	}
+
+	return nil
+}
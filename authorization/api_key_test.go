@@ -0,0 +1,94 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyFormatAndSecret(t *testing.T) {
+	id, secret, err := generateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := formatAPIKey(id, secret)
+	if isAPIKey(key) == false {
+		t.Errorf("Key %s should be recognized as the API key", key)
+	}
+
+	parsedID, parsedSecret, err := parseAPIKey(key)
+	if err != nil {
+		t.Fatalf("Parse API key error %s", err)
+	}
+	if parsedID != id || parsedSecret != secret {
+		t.Errorf("Expect %s %s but get %s %s", id, secret, parsedID, parsedSecret)
+	}
+
+	for _, invalidKey := range []string{"", "eyJhbGciOiJIUzUxMiJ9.e30.sig", apiKeyPrefix + id, apiKeyPrefix + id + "-short", apiKeyPrefix + id + "-" + secret + "-extra"} {
+		if _, _, err := parseAPIKey(invalidKey); err == nil {
+			t.Errorf("Key %s should be invalid", invalidKey)
+		}
+	}
+
+	apiKey := &APIKey{ID: id, EncodedSecret: encodeAPIKeySecret(secret)}
+	if apiKey.EncodedSecret == secret {
+		t.Error("Secret should not be stored as it is")
+	}
+	if apiKey.checkSecret(secret) == false {
+		t.Error("Secret should match")
+	}
+	_, otherSecret, _ := generateAPIKey()
+	if apiKey.checkSecret(otherSecret) {
+		t.Error("Other secret should not match")
+	}
+
+	if copiedAPIKey := apiKey.copyWithoutSecret(); copiedAPIKey.EncodedSecret != "" || apiKey.EncodedSecret == "" {
+		t.Error("Only the copy should be without the secret")
+	}
+}
+
+func TestAPIKeyExpired(t *testing.T) {
+	apiKey := &APIKey{}
+	if apiKey.isExpired() {
+		t.Error("Key without the expired time should never expire")
+	}
+	past := time.Now().Add(-time.Minute)
+	apiKey.ExpiredTime = &past
+	if apiKey.isExpired() == false {
+		t.Error("Key should be expired")
+	}
+}
+
+func TestGetAPIKeyNamespaceResource(t *testing.T) {
+	if resource := getAPIKeyNamespaceResource("dev"); resource.Path != "/namespaces/dev" {
+		t.Errorf("Unexpected resource %v", resource)
+	}
+	if resource := getAPIKeyNamespaceResource(apiKeyAllNamespace); resource.Path != "*" {
+		t.Errorf("Unexpected resource %v", resource)
+	}
+}
+
+func TestGetAPIKeyNamespace(t *testing.T) {
+	for _, namespace := range []string{"dev", apiKeyAllNamespace} {
+		if converted := getAPIKeyNamespace(getAPIKeyNamespaceResource(namespace)); converted != namespace {
+			t.Errorf("Namespace %s is converted to %s", namespace, converted)
+		}
+	}
+	if namespace := getAPIKeyNamespace(&rbac.Resource{"image", "*", "/imageinformations/test"}); namespace != "" {
+		t.Errorf("Resource not about the namespace is converted to %s", namespace)
+	}
+}
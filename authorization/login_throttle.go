@@ -0,0 +1,243 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/coreos/etcd/client"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Retry when the other instance updates the same failure at the same time
+	loginFailureUpdateRetryAmount = 5
+)
+
+// Loaded from the configuration key loginThrottle
+type LoginThrottlePolicy struct {
+	MaximumFailureAmountPerUser int
+	MaximumFailureAmountPerIP   int
+	// The failures older than the window are forgotten
+	FailureWindowInSecond int
+	LockoutInSecond       int
+}
+
+func GetLoginThrottlePolicy() *LoginThrottlePolicy {
+	loginThrottlePolicy := &LoginThrottlePolicy{}
+	if value := configuration.LocalConfiguration.GetNative("loginThrottle"); value != nil {
+		// Convert the generic json value to the structure
+		byteSlice, err := json.Marshal(value)
+		if err == nil {
+			err = json.Unmarshal(byteSlice, loginThrottlePolicy)
+		}
+		if err != nil {
+			log.Error("Fail to parse configuration loginThrottle error: %s", err)
+		}
+	}
+
+	if loginThrottlePolicy.MaximumFailureAmountPerUser <= 0 {
+		loginThrottlePolicy.MaximumFailureAmountPerUser = 5
+	}
+	if loginThrottlePolicy.MaximumFailureAmountPerIP <= 0 {
+		loginThrottlePolicy.MaximumFailureAmountPerIP = 20
+	}
+	if loginThrottlePolicy.FailureWindowInSecond <= 0 {
+		loginThrottlePolicy.FailureWindowInSecond = 900
+	}
+	if loginThrottlePolicy.LockoutInSecond <= 0 {
+		loginThrottlePolicy.LockoutInSecond = 900
+	}
+	return loginThrottlePolicy
+}
+
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (loginLockedError *LoginLockedError) Error() string {
+	return fmt.Sprintf("Too many failed logins. Retry after %d seconds.", int(loginLockedError.RetryAfter.Seconds())+1)
+}
+
+// Persisted so all instances share the failures and the lockout
+type LoginFailure struct {
+	Amount           int
+	FirstFailureTime time.Time
+	LockedUntil      time.Time
+}
+
+// The remaining time of the lockout. Zero if not locked.
+func (loginFailure *LoginFailure) getLockedDuration(now time.Time) time.Duration {
+	if loginFailure == nil || loginFailure.LockedUntil.After(now) == false {
+		return 0
+	}
+	return loginFailure.LockedUntil.Sub(now)
+}
+
+// Return the failure after adding one more. The given failure is not modified.
+func increaseLoginFailure(loginFailure *LoginFailure, maximumAmount int, window time.Duration, lockout time.Duration, now time.Time) *LoginFailure {
+	increasedLoginFailure := &LoginFailure{0, now, time.Time{}}
+	if loginFailure != nil && now.Sub(loginFailure.FirstFailureTime) <= window {
+		*increasedLoginFailure = *loginFailure
+	}
+
+	increasedLoginFailure.Amount++
+	if increasedLoginFailure.Amount >= maximumAmount {
+		increasedLoginFailure.LockedUntil = now.Add(lockout)
+		// Start counting again after the lockout
+		increasedLoginFailure.Amount = 0
+		increasedLoginFailure.FirstFailureTime = increasedLoginFailure.LockedUntil
+	}
+	return increasedLoginFailure
+}
+
+// Only used when the storage is not available so the login is still throttled in this instance
+type loginThrottle struct {
+	mutex           *sync.Mutex
+	loginFailureMap map[string]*LoginFailure
+}
+
+func createLoginThrottle() *loginThrottle {
+	return &loginThrottle{&sync.Mutex{}, make(map[string]*LoginFailure)}
+}
+
+var localLoginThrottle = createLoginThrottle()
+
+func (loginThrottle *loginThrottle) getLockedDuration(key string, now time.Time) time.Duration {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+	return loginThrottle.loginFailureMap[key].getLockedDuration(now)
+}
+
+func (loginThrottle *loginThrottle) addFailure(key string, maximumAmount int, window time.Duration, lockout time.Duration, now time.Time) {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+	loginThrottle.loginFailureMap[key] = increaseLoginFailure(loginThrottle.loginFailureMap[key], maximumAmount, window, lockout, now)
+}
+
+func (loginThrottle *loginThrottle) reset(key string) {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+	delete(loginThrottle.loginFailureMap, key)
+}
+
+func (loginThrottle *loginThrottle) clean(window time.Duration, now time.Time) {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+	for key, loginFailure := range loginThrottle.loginFailureMap {
+		if loginFailure.LockedUntil.After(now) == false && now.Sub(loginFailure.FirstFailureTime) > window {
+			delete(loginThrottle.loginFailureMap, key)
+		}
+	}
+}
+
+func getLoginThrottleUserKey(name string) string {
+	return "user:" + name
+}
+
+func getLoginThrottleIPKey(remoteAddress string) string {
+	host, _, err := net.SplitHostPort(remoteAddress)
+	if err != nil {
+		host = remoteAddress
+	}
+	return "ip:" + host
+}
+
+func getLockedDuration(key string, now time.Time) time.Duration {
+	loginFailure, _, err := GetStorage().LoadLoginFailure(key)
+	if err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code != client.ErrorCodeKeyNotFound {
+			log.Error("Load login failure %s error: %s", key, err)
+		}
+		// Still check the failures counted locally when the storage is not available
+		return localLoginThrottle.getLockedDuration(key, now)
+	}
+	return loginFailure.getLockedDuration(now)
+}
+
+// Compare and swap so the failures from the instances at the same time are all counted
+func addFailure(key string, maximumAmount int, window time.Duration, lockout time.Duration, now time.Time) {
+	// Expire after both the lockout and the window end
+	ttl := lockout + window
+	for i := 0; i < loginFailureUpdateRetryAmount; i++ {
+		loginFailure, index, err := GetStorage().LoadLoginFailure(key)
+		if err != nil {
+			etcdError, _ := err.(client.Error)
+			if etcdError.Code != client.ErrorCodeKeyNotFound {
+				log.Error("Load login failure %s error: %s", key, err)
+				break
+			}
+			loginFailure = nil
+			index = 0
+		}
+
+		err = GetStorage().SaveLoginFailure(key, increaseLoginFailure(loginFailure, maximumAmount, window, lockout, now), index, ttl)
+		if err == nil {
+			return
+		}
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code != client.ErrorCodeTestFailed && etcdError.Code != client.ErrorCodeNodeExist {
+			log.Error("Save login failure %s error: %s", key, err)
+			break
+		}
+	}
+
+	log.Error("Fail to save login failure %s so it is only counted in this instance", key)
+	localLoginThrottle.addFailure(key, maximumAmount, window, lockout, now)
+}
+
+func resetFailure(key string) {
+	localLoginThrottle.reset(key)
+	if err := GetStorage().DeleteLoginFailure(key); err != nil {
+		log.Error("Delete login failure %s error: %s", key, err)
+	}
+}
+
+func checkLoginAllowed(name string, remoteAddress string) error {
+	now := time.Now()
+	lockedDuration := getLockedDuration(getLoginThrottleUserKey(name), now)
+	if ipLockedDuration := getLockedDuration(getLoginThrottleIPKey(remoteAddress), now); ipLockedDuration > lockedDuration {
+		lockedDuration = ipLockedDuration
+	}
+	if lockedDuration > 0 {
+		log.Error("Login of user %s from %s is locked for %s", name, remoteAddress, lockedDuration)
+		return &LoginLockedError{lockedDuration}
+	}
+	return nil
+}
+
+func recordLoginFailure(name string, remoteAddress string) {
+	loginThrottlePolicy := GetLoginThrottlePolicy()
+	window := time.Duration(loginThrottlePolicy.FailureWindowInSecond) * time.Second
+	lockout := time.Duration(loginThrottlePolicy.LockoutInSecond) * time.Second
+	now := time.Now()
+	addFailure(getLoginThrottleUserKey(name), loginThrottlePolicy.MaximumFailureAmountPerUser, window, lockout, now)
+	addFailure(getLoginThrottleIPKey(remoteAddress), loginThrottlePolicy.MaximumFailureAmountPerIP, window, lockout, now)
+}
+
+// The address failures are kept until they expire. Otherwise one valid account could clear them between the guesses of the other accounts.
+func recordLoginSuccess(name string) {
+	resetFailure(getLoginThrottleUserKey(name))
+}
+
+// The persisted failures expire with the TTL so only the local ones are cleaned
+func cleanLoginFailure() {
+	loginThrottlePolicy := GetLoginThrottlePolicy()
+	localLoginThrottle.clean(time.Duration(loginThrottlePolicy.FailureWindowInSecond)*time.Second, time.Now())
+}
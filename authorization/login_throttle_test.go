@@ -0,0 +1,98 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	loginThrottle := createLoginThrottle()
+	key := getLoginThrottleUserKey("alice")
+	window := time.Minute * 15
+	lockout := time.Minute * 5
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		loginThrottle.addFailure(key, 3, window, lockout, now)
+	}
+	if duration := loginThrottle.getLockedDuration(key, now); duration != 0 {
+		t.Errorf("Should not be locked before reaching the maximum but locked for %s", duration)
+	}
+
+	loginThrottle.addFailure(key, 3, window, lockout, now)
+	if duration := loginThrottle.getLockedDuration(key, now); duration != lockout {
+		t.Errorf("Expect locked for %s but get %s", lockout, duration)
+	}
+	if duration := loginThrottle.getLockedDuration(key, now.Add(lockout)); duration != 0 {
+		t.Errorf("Lockout should end but locked for %s", duration)
+	}
+
+	// The failures out of the window are forgotten
+	otherKey := getLoginThrottleUserKey("bob")
+	loginThrottle.addFailure(otherKey, 2, window, lockout, now)
+	loginThrottle.addFailure(otherKey, 2, window, lockout, now.Add(window+time.Second))
+	if duration := loginThrottle.getLockedDuration(otherKey, now.Add(window+time.Second)); duration != 0 {
+		t.Errorf("Old failure should be forgotten but locked for %s", duration)
+	}
+
+	loginThrottle.reset(otherKey)
+	if _, ok := loginThrottle.loginFailureMap[otherKey]; ok {
+		t.Error("Failure should be reset")
+	}
+
+	// The locked one is kept until the lockout ends
+	loginThrottle.clean(window, now.Add(time.Minute))
+	if _, ok := loginThrottle.loginFailureMap[key]; ok == false {
+		t.Error("Locked failure should not be cleaned")
+	}
+	loginThrottle.clean(window, now.Add(lockout+window+time.Second))
+	if len(loginThrottle.loginFailureMap) != 0 {
+		t.Errorf("All failures should be cleaned but %d left", len(loginThrottle.loginFailureMap))
+	}
+}
+
+func TestGetLoginThrottleIPKey(t *testing.T) {
+	if key := getLoginThrottleIPKey("10.0.0.1:51234"); key != "ip:10.0.0.1" {
+		t.Errorf("Unexpected key %s", key)
+	}
+	if key := getLoginThrottleIPKey("[::1]:51234"); key != "ip:::1" {
+		t.Errorf("Unexpected key %s", key)
+	}
+	if key := getLoginThrottleIPKey("10.0.0.1"); key != "ip:10.0.0.1" {
+		t.Errorf("Unexpected key %s", key)
+	}
+}
+
+func TestIncreaseLoginFailure(t *testing.T) {
+	window := time.Minute * 15
+	lockout := time.Minute * 5
+	now := time.Now()
+
+	loginFailure := increaseLoginFailure(nil, 2, window, lockout, now)
+	if loginFailure.Amount != 1 || loginFailure.getLockedDuration(now) != 0 {
+		t.Errorf("Unexpected failure %v", loginFailure)
+	}
+
+	// The loaded failure is kept as it is so the compare and swap could be retried with it
+	increasedLoginFailure := increaseLoginFailure(loginFailure, 2, window, lockout, now)
+	if loginFailure.Amount != 1 {
+		t.Errorf("Given failure should not be modified but get %v", loginFailure)
+	}
+	if increasedLoginFailure.getLockedDuration(now) != lockout {
+		t.Errorf("Expect locked for %s but get %v", lockout, increasedLoginFailure)
+	}
+}
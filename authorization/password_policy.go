@@ -0,0 +1,157 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The key in the user meta data requiring the user to change the password before login
+const metaDataKeyPasswordChangeRequired = "passwordChangeRequired"
+
+// Loaded from the configuration key passwordPolicy
+type PasswordPolicy struct {
+	MinimumLength    int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+}
+
+func GetPasswordPolicy() *PasswordPolicy {
+	passwordPolicy := &PasswordPolicy{}
+	if value := configuration.LocalConfiguration.GetNative("passwordPolicy"); value != nil {
+		// Convert the generic json value to the structure
+		byteSlice, err := json.Marshal(value)
+		if err == nil {
+			err = json.Unmarshal(byteSlice, passwordPolicy)
+		}
+		if err != nil {
+			log.Error("Fail to parse configuration passwordPolicy error: %s", err)
+		}
+	}
+
+	if passwordPolicy.MinimumLength <= 0 {
+		passwordPolicy.MinimumLength = 8
+	}
+	return passwordPolicy
+}
+
+func CheckPasswordPolicy(name string, password string) error {
+	return checkPasswordWithPolicy(GetPasswordPolicy(), name, password)
+}
+
+func checkPasswordWithPolicy(passwordPolicy *PasswordPolicy, name string, password string) error {
+	if len([]rune(password)) < passwordPolicy.MinimumLength {
+		return errors.New("Password must have at least " + strconv.Itoa(passwordPolicy.MinimumLength) + " characters")
+	}
+	if name != "" && strings.Contains(strings.ToLower(password), strings.ToLower(name)) {
+		return errors.New("Password can't contain the user name")
+	}
+
+	hasUppercase := false
+	hasLowercase := false
+	hasDigit := false
+	hasSymbol := false
+	for _, character := range password {
+		switch {
+		case unicode.IsUpper(character):
+			hasUppercase = true
+		case unicode.IsLower(character):
+			hasLowercase = true
+		case unicode.IsDigit(character):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+
+	if passwordPolicy.RequireUppercase && hasUppercase == false {
+		return errors.New("Password must have an uppercase letter")
+	}
+	if passwordPolicy.RequireLowercase && hasLowercase == false {
+		return errors.New("Password must have a lowercase letter")
+	}
+	if passwordPolicy.RequireDigit && hasDigit == false {
+		return errors.New("Password must have a digit")
+	}
+	if passwordPolicy.RequireSymbol && hasSymbol == false {
+		return errors.New("Password must have a symbol")
+	}
+	return nil
+}
+
+func isPasswordChangeRequired(user *rbac.User) bool {
+	return user.MetaDataMap[metaDataKeyPasswordChangeRequired] == "true"
+}
+
+type PasswordChangeRequiredError struct {
+}
+
+func (passwordChangeRequiredError *PasswordChangeRequiredError) Error() string {
+	return "Password change is required before login"
+}
+
+// Change the password of the local user with the current one. Used when the password change is required since no token could be issued.
+func ChangePassword(name string, oldPassword string, newPassword string, remoteAddress string) error {
+	if err := checkLoginAllowed(name, remoteAddress); err != nil {
+		return err
+	}
+
+	localAuthenticationProvider := &LocalAuthenticationProvider{}
+	user, err := localAuthenticationProvider.Authenticate(name, oldPassword)
+	if err != nil {
+		if err == errorIncorrectCredential {
+			recordLoginFailure(name, remoteAddress)
+		}
+		return err
+	}
+	recordLoginSuccess(name)
+
+	if providerName := user.MetaDataMap[metaDataKeyAuthenticationProvider]; providerName != "" && providerName != AuthenticationProviderLocal {
+		return errors.New("Password of the user from " + providerName + " can't be changed")
+	}
+	if newPassword == oldPassword {
+		return errors.New("New password must be different from the current one")
+	}
+	if err := CheckPasswordPolicy(name, newPassword); err != nil {
+		return err
+	}
+
+	metaDataMap := make(map[string]string)
+	for key, value := range user.MetaDataMap {
+		if key != metaDataKeyPasswordChangeRequired {
+			metaDataMap[key] = value
+		}
+	}
+	changedUser := rbac.CreateUser(user.Name, newPassword, user.RoleSlice, user.ResourceSlice, user.Description, metaDataMap, user.ExpiredTime, user.Disabled)
+	if err := GetStorage().SaveUser(changedUser); err != nil {
+		log.Error("Save user %s error: %s", name, err)
+		return err
+	}
+
+	// The sessions using the old password are ended
+	if err := RevokeAllTokenForUser(name); err != nil {
+		log.Error("Revoke all token of user %s error: %s", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"testing"
+)
+
+func TestCheckPasswordWithPolicy(t *testing.T) {
+	passwordPolicy := &PasswordPolicy{8, true, true, true, true}
+
+	if err := checkPasswordWithPolicy(passwordPolicy, "alice", "Secr3t!pass"); err != nil {
+		t.Errorf("Password should be accepted but get %s", err)
+	}
+
+	invalidPasswordSlice := []string{
+		"S3t!a",       // Too short
+		"Alice-1234!", // Contains the user name
+		"secr3t!pass", // No uppercase
+		"SECR3T!PASS", // No lowercase
+		"Secret!pass", // No digit
+		"Secr3tpass",  // No symbol
+		"",
+	}
+	for _, password := range invalidPasswordSlice {
+		if err := checkPasswordWithPolicy(passwordPolicy, "alice", password); err == nil {
+			t.Errorf("Password %s should be rejected", password)
+		}
+	}
+
+	// Only the length by default
+	if err := checkPasswordWithPolicy(&PasswordPolicy{MinimumLength: 8}, "alice", "abcdefgh"); err != nil {
+		t.Errorf("Password should be accepted but get %s", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"github.com/coreos/etcd/client"
+	"strings"
+)
+
+const (
+	AuthenticationProviderLocal = "local"
+	AuthenticationProviderLDAP  = "ldap"
+	AuthenticationProviderOIDC  = "oidc"
+)
+
+// The key in the user meta data recording which provider the user is created by
+const metaDataKeyAuthenticationProvider = "authenticationProvider"
+
+// The unique identity in the provider which the user is bound to
+const metaDataKeyExternalIdentity = "externalIdentity"
+
+// The built-in account always uses the local provider so it is still able to login when the directory is unavailable
+const defaultUsername = "admin"
+
+// The same error for the unknown user and the wrong password so the user names can't be probed
+var errorIncorrectCredential = errors.New("Incorrect user or password")
+
+type AuthenticationProvider interface {
+	GetName() string
+	// Return the user with the roles and resources used for the token
+	Authenticate(name string, password string) (*rbac.User, error)
+	// Whether the user returned is stored and could be loaded by the other instances
+	IsUserPersistent() bool
+}
+
+type LocalAuthenticationProvider struct {
+}
+
+func (localAuthenticationProvider *LocalAuthenticationProvider) GetName() string {
+	return AuthenticationProviderLocal
+}
+
+func (localAuthenticationProvider *LocalAuthenticationProvider) Authenticate(name string, password string) (*rbac.User, error) {
+	user, err := GetStorage().LoadUser(name)
+	if err != nil {
+		if strings.Contains(err.Error(), "Key not found") {
+			log.Error("User %s doesn't exist", name)
+			return nil, errorIncorrectCredential
+		} else {
+			log.Error(err)
+			return nil, err
+		}
+	}
+
+	if user.CheckPassword(password) == false {
+		log.Error("Incorrect password for user %s", name)
+		return nil, errorIncorrectCredential
+	}
+
+	return user, nil
+}
+
+func (localAuthenticationProvider *LocalAuthenticationProvider) IsUserPersistent() bool {
+	return true
+}
+
+// Reloaded from the configuration every time so the change is applied without restart
+func GetAuthenticationProvider(name string) (AuthenticationProvider, error) {
+	if name == defaultUsername {
+		return &LocalAuthenticationProvider{}, nil
+	}
+
+	providerName, ok := configuration.LocalConfiguration.GetString("authenticationProvider")
+	if ok == false || providerName == "" {
+		providerName = AuthenticationProviderLocal
+	}
+
+	switch providerName {
+	case AuthenticationProviderLocal:
+		return &LocalAuthenticationProvider{}, nil
+	case AuthenticationProviderLDAP:
+		ldapConfiguration, err := GetLDAPConfiguration()
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		return CreateLDAPAuthenticationProvider(ldapConfiguration), nil
+	default:
+		log.Error("Not supported authentication provider %s", providerName)
+		return nil, errors.New("Not supported authentication provider " + providerName)
+	}
+}
+
+func loadRoleSlice(name string, roleNameSlice []string) ([]*rbac.Role, error) {
+	roleSlice := make([]*rbac.Role, 0)
+	for _, roleName := range roleNameSlice {
+		role, err := GetStorage().LoadRole(roleName)
+		if err != nil {
+			log.Error("Fail to load role %s mapped for user %s error: %s", roleName, name, err)
+			continue
+		}
+		roleSlice = append(roleSlice, role)
+	}
+	if len(roleSlice) == 0 {
+		log.Error("No role mapped for user %s exists", name)
+		return nil, errors.New("User has no role")
+	}
+	return roleSlice, nil
+}
+
+// Get the user authenticated by the external provider. The roles and resources follow the provider while the expiry and the disabled flag set locally are kept.
+// If the identity is not empty, the existing user must be bound to the same identity.
+func getExternalUser(providerName string, name string, identity string, roleSlice []*rbac.Role, resourceSlice []*rbac.Resource, persistent bool) (*rbac.User, error) {
+	existingUser, err := GetStorage().LoadUser(name)
+	if err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code != client.ErrorCodeKeyNotFound {
+			log.Error("Load user %s error: %s", name, err)
+			return nil, err
+		}
+		existingUser = nil
+	}
+
+	// Don't let the external provider take over the local account
+	if existingUser != nil && existingUser.MetaDataMap[metaDataKeyAuthenticationProvider] != providerName {
+		log.Error("User %s not created by %s exists so the login is rejected", name, providerName)
+		return nil, errors.New("Local user with the same name exists")
+	}
+
+	// Don't let the other account in the same provider take over the user by changing the user name
+	if existingUser != nil && identity != "" && existingUser.MetaDataMap[metaDataKeyExternalIdentity] != identity {
+		log.Error("User %s is bound to the other identity in %s so the login of %s is rejected", name, providerName, identity)
+		return nil, errors.New("User with the same name is bound to the other identity")
+	}
+
+	if existingUser != nil {
+		existingUser.RoleSlice = roleSlice
+		existingUser.ResourceSlice = resourceSlice
+		if persistent {
+			if err := GetStorage().SaveUser(existingUser); err != nil {
+				log.Error("Save %s user %s error: %s", providerName, name, err)
+				return nil, err
+			}
+		}
+		return existingUser, nil
+	}
+
+	// The password is never used since the login is always checked against the provider
+	passwordByteSlice := make([]byte, 32)
+	if _, err := rand.Read(passwordByteSlice); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	metaDataMap := make(map[string]string)
+	metaDataMap[metaDataKeyAuthenticationProvider] = providerName
+	if identity != "" {
+		metaDataMap[metaDataKeyExternalIdentity] = identity
+	}
+	user := rbac.CreateUser(name, hex.EncodeToString(passwordByteSlice), roleSlice, resourceSlice, providerName, metaDataMap, nil, false)
+
+	if persistent {
+		if err := GetStorage().SaveUser(user); err != nil {
+			log.Error("Create %s user %s error: %s", providerName, name, err)
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"gopkg.in/ldap.v2"
+	"strings"
+)
+
+const (
+	ldapDefaultPort           = 389
+	ldapDefaultTLSPort        = 636
+	ldapDefaultUserFilter     = "(uid=%s)"
+	ldapDefaultGroupAttribute = "memberOf"
+)
+
+// Loaded from the configuration key ldap
+type LDAPConfiguration struct {
+	Host               string
+	Port               int
+	UseTLS             bool
+	StartTLS           bool
+	InsecureSkipVerify bool
+	// The service account used to search the user. Anonymous search if empty.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// %s is replaced with the escaped login name
+	UserFilter     string
+	GroupAttribute string
+	// The key is either the group DN or the group CN and the value is the rbac role name
+	GroupRoleMap  map[string]string
+	ResourceSlice []*rbac.Resource
+	// Just-in-time user creation. If false, the user only exists in the instance issuing the token.
+	CreateUser bool
+}
+
+func GetLDAPConfiguration() (*LDAPConfiguration, error) {
+	value := configuration.LocalConfiguration.GetNative("ldap")
+	if value == nil {
+		return nil, errors.New("Fail to get configuration ldap")
+	}
+
+	// Convert the generic json value to the structure
+	byteSlice, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	ldapConfiguration := &LDAPConfiguration{}
+	if err := json.Unmarshal(byteSlice, ldapConfiguration); err != nil {
+		return nil, err
+	}
+
+	if ldapConfiguration.Host == "" {
+		return nil, errors.New("Configuration ldap Host can't be empty")
+	}
+	if ldapConfiguration.BaseDN == "" {
+		return nil, errors.New("Configuration ldap BaseDN can't be empty")
+	}
+	if ldapConfiguration.Port == 0 {
+		if ldapConfiguration.UseTLS {
+			ldapConfiguration.Port = ldapDefaultTLSPort
+		} else {
+			ldapConfiguration.Port = ldapDefaultPort
+		}
+	}
+	if ldapConfiguration.UserFilter == "" {
+		ldapConfiguration.UserFilter = ldapDefaultUserFilter
+	}
+	if ldapConfiguration.GroupAttribute == "" {
+		ldapConfiguration.GroupAttribute = ldapDefaultGroupAttribute
+	}
+	if ldapConfiguration.ResourceSlice == nil {
+		ldapConfiguration.ResourceSlice = make([]*rbac.Resource, 0)
+	}
+
+	return ldapConfiguration, nil
+}
+
+// The subset of ldap.Conn used so the directory could be replaced in the test
+type ldapConnection interface {
+	Bind(username string, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+type LDAPAuthenticationProvider struct {
+	ldapConfiguration *LDAPConfiguration
+	dial              func(ldapConfiguration *LDAPConfiguration) (ldapConnection, error)
+}
+
+func CreateLDAPAuthenticationProvider(ldapConfiguration *LDAPConfiguration) *LDAPAuthenticationProvider {
+	return &LDAPAuthenticationProvider{ldapConfiguration, dialLDAP}
+}
+
+func dialLDAP(ldapConfiguration *LDAPConfiguration) (ldapConnection, error) {
+	address := fmt.Sprintf("%s:%d", ldapConfiguration.Host, ldapConfiguration.Port)
+	tlsConfig := &tls.Config{
+		ServerName:         ldapConfiguration.Host,
+		InsecureSkipVerify: ldapConfiguration.InsecureSkipVerify,
+	}
+
+	if ldapConfiguration.UseTLS {
+		return ldap.DialTLS("tcp", address, tlsConfig)
+	}
+
+	conn, err := ldap.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if ldapConfiguration.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (ldapAuthenticationProvider *LDAPAuthenticationProvider) GetName() string {
+	return AuthenticationProviderLDAP
+}
+
+func (ldapAuthenticationProvider *LDAPAuthenticationProvider) IsUserPersistent() bool {
+	return ldapAuthenticationProvider.ldapConfiguration.CreateUser
+}
+
+func (ldapAuthenticationProvider *LDAPAuthenticationProvider) Authenticate(name string, password string) (*rbac.User, error) {
+	conn, err := ldapAuthenticationProvider.dial(ldapAuthenticationProvider.ldapConfiguration)
+	if err != nil {
+		log.Error("Fail to connect to ldap server %s:%d error: %s", ldapAuthenticationProvider.ldapConfiguration.Host, ldapAuthenticationProvider.ldapConfiguration.Port, err)
+		return nil, errors.New("Fail to connect to the ldap server")
+	}
+	defer conn.Close()
+
+	roleNameSlice, err := authenticateWithConnection(conn, ldapAuthenticationProvider.ldapConfiguration, name, password)
+	if err != nil {
+		return nil, err
+	}
+
+	roleSlice, err := loadRoleSlice(name, roleNameSlice)
+	if err != nil {
+		return nil, err
+	}
+
+	return getExternalUser(AuthenticationProviderLDAP, name, "", roleSlice, ldapAuthenticationProvider.ldapConfiguration.ResourceSlice, ldapAuthenticationProvider.ldapConfiguration.CreateUser)
+}
+
+// Bind as the user found and return the role names mapped from the groups
+func authenticateWithConnection(conn ldapConnection, ldapConfiguration *LDAPConfiguration, name string, password string) ([]string, error) {
+	// The empty password is an unauthenticated bind which most of the servers accept
+	if name == "" || password == "" {
+		return nil, errorIncorrectCredential
+	}
+
+	if ldapConfiguration.BindDN != "" {
+		if err := conn.Bind(ldapConfiguration.BindDN, ldapConfiguration.BindPassword); err != nil {
+			log.Error("Fail to bind ldap service account %s error: %s", ldapConfiguration.BindDN, err)
+			return nil, errors.New("Fail to bind the ldap service account")
+		}
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		ldapConfiguration.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		fmt.Sprintf(ldapConfiguration.UserFilter, ldap.EscapeFilter(name)),
+		[]string{"dn", ldapConfiguration.GroupAttribute},
+		nil,
+	)
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil {
+		log.Error("Fail to search ldap user %s error: %s", name, err)
+		return nil, errors.New("Fail to search the ldap user")
+	}
+	if len(searchResult.Entries) == 0 {
+		log.Error("Ldap user %s doesn't exist", name)
+		return nil, errorIncorrectCredential
+	}
+	if len(searchResult.Entries) > 1 {
+		log.Error("Multiple ldap entries found for user %s", name)
+		return nil, errors.New("Multiple users found")
+	}
+	entry := searchResult.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		log.Error("Incorrect password for ldap user %s", name)
+		return nil, errorIncorrectCredential
+	}
+
+	roleNameSlice := getRoleNameSlice(entry.GetAttributeValues(ldapConfiguration.GroupAttribute), ldapConfiguration.GroupRoleMap)
+	if len(roleNameSlice) == 0 {
+		log.Error("No group of ldap user %s is mapped to the role", name)
+		return nil, errors.New("User has no role")
+	}
+
+	return roleNameSlice, nil
+}
+
+// The group is matched with either the whole DN or the first CN ignoring the case
+func getRoleNameSlice(groupSlice []string, groupRoleMap map[string]string) []string {
+	roleNameSlice := make([]string, 0)
+	addedMap := make(map[string]bool)
+	for _, group := range groupSlice {
+		candidateSlice := []string{group}
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 {
+			for _, attribute := range dn.RDNs[0].Attributes {
+				if strings.EqualFold(attribute.Type, "cn") {
+					candidateSlice = append(candidateSlice, attribute.Value)
+				}
+			}
+		}
+
+		for key, roleName := range groupRoleMap {
+			for _, candidate := range candidateSlice {
+				if strings.EqualFold(key, candidate) && addedMap[roleName] == false {
+					roleNameSlice = append(roleNameSlice, roleName)
+					addedMap[roleName] = true
+				}
+			}
+		}
+	}
+	return roleNameSlice
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"errors"
+	"gopkg.in/ldap.v2"
+	"strings"
+	"testing"
+)
+
+// The local stand-in of the directory
+type fakeLDAPConnection struct {
+	passwordMap map[string]string
+	entrySlice  []*ldap.Entry
+	boundDN     string
+}
+
+func (fakeLDAPConnection *fakeLDAPConnection) Bind(username string, password string) error {
+	if password == "" || fakeLDAPConnection.passwordMap[username] != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("Invalid Credentials"))
+	}
+	fakeLDAPConnection.boundDN = username
+	return nil
+}
+
+func (fakeLDAPConnection *fakeLDAPConnection) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if fakeLDAPConnection.boundDN == "" {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("Anonymous search"))
+	}
+	entrySlice := make([]*ldap.Entry, 0)
+	for _, entry := range fakeLDAPConnection.entrySlice {
+		// Only the filter (uid=name) is supported
+		if searchRequest.Filter == "(uid="+entry.GetAttributeValue("uid")+")" && strings.HasSuffix(entry.DN, searchRequest.BaseDN) {
+			entrySlice = append(entrySlice, entry)
+		}
+	}
+	return &ldap.SearchResult{Entries: entrySlice}, nil
+}
+
+func (fakeLDAPConnection *fakeLDAPConnection) Close() {
+}
+
+func createFakeLDAPConnection() *fakeLDAPConnection {
+	return &fakeLDAPConnection{
+		map[string]string{
+			"cn=service,dc=example,dc=com":          "service-password",
+			"uid=alice,ou=people,dc=example,dc=com": "alice-password",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-password",
+		},
+		[]*ldap.Entry{
+			ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+				"uid":      []string{"alice"},
+				"memberOf": []string{"cn=Developers,ou=groups,dc=example,dc=com", "cn=Operators,ou=groups,dc=example,dc=com"},
+			}),
+			ldap.NewEntry("uid=bob,ou=people,dc=example,dc=com", map[string][]string{
+				"uid":      []string{"bob"},
+				"memberOf": []string{"cn=Sales,ou=groups,dc=example,dc=com"},
+			}),
+		},
+		"",
+	}
+}
+
+func createTestLDAPConfiguration() *LDAPConfiguration {
+	return &LDAPConfiguration{
+		Host:           "127.0.0.1",
+		Port:           ldapDefaultPort,
+		BindDN:         "cn=service,dc=example,dc=com",
+		BindPassword:   "service-password",
+		BaseDN:         "dc=example,dc=com",
+		UserFilter:     ldapDefaultUserFilter,
+		GroupAttribute: ldapDefaultGroupAttribute,
+		GroupRoleMap: map[string]string{
+			"developers": "developer",
+			"cn=Operators,ou=groups,dc=example,dc=com": "operator",
+		},
+	}
+}
+
+func TestAuthenticateWithConnection(t *testing.T) {
+	ldapConfiguration := createTestLDAPConfiguration()
+
+	roleNameSlice, err := authenticateWithConnection(createFakeLDAPConnection(), ldapConfiguration, "alice", "alice-password")
+	if err != nil {
+		t.Fatalf("Authenticate alice error %s", err)
+	}
+	if len(roleNameSlice) != 2 || roleNameSlice[0] != "developer" || roleNameSlice[1] != "operator" {
+		t.Errorf("Unexpected role names %v", roleNameSlice)
+	}
+
+	if _, err := authenticateWithConnection(createFakeLDAPConnection(), ldapConfiguration, "alice", "wrong"); err == nil {
+		t.Error("Wrong password should be rejected")
+	}
+
+	// The empty password would be an unauthenticated bind
+	if _, err := authenticateWithConnection(createFakeLDAPConnection(), ldapConfiguration, "alice", ""); err == nil {
+		t.Error("Empty password should be rejected")
+	}
+
+	if _, err := authenticateWithConnection(createFakeLDAPConnection(), ldapConfiguration, "carol", "carol-password"); err == nil {
+		t.Error("Unknown user should be rejected")
+	}
+
+	// No group is mapped to the role
+	if _, err := authenticateWithConnection(createFakeLDAPConnection(), ldapConfiguration, "bob", "bob-password"); err == nil {
+		t.Error("User without the mapped group should be rejected")
+	}
+
+	// The filter is escaped
+	if _, err := authenticateWithConnection(createFakeLDAPConnection(), ldapConfiguration, "*", "alice-password"); err == nil {
+		t.Error("Wildcard user name should be rejected")
+	}
+
+	ldapConfiguration.BindPassword = "wrong"
+	if _, err := authenticateWithConnection(createFakeLDAPConnection(), ldapConfiguration, "alice", "alice-password"); err == nil {
+		t.Error("Wrong service account password should be rejected")
+	}
+}
+
+func TestGetRoleNameSlice(t *testing.T) {
+	groupRoleMap := map[string]string{
+		"admins":                             "admin",
+		"cn=dev,ou=groups,dc=example,dc=com": "developer",
+	}
+
+	roleNameSlice := getRoleNameSlice([]string{"CN=Admins,OU=Groups,DC=example,DC=com", "cn=dev,ou=groups,dc=example,dc=com", "cn=admins,ou=other,dc=example,dc=com"}, groupRoleMap)
+	if len(roleNameSlice) != 2 || roleNameSlice[0] != "admin" || roleNameSlice[1] != "developer" {
+		t.Errorf("Unexpected role names %v", roleNameSlice)
+	}
+
+	if roleNameSlice := getRoleNameSlice([]string{"cn=unknown,dc=example,dc=com"}, groupRoleMap); len(roleNameSlice) != 0 {
+		t.Errorf("Unexpected role names %v", roleNameSlice)
+	}
+}
@@ -0,0 +1,697 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"github.com/coreos/etcd/client"
+	jwt "github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcDefaultUsernameClaim   = "preferred_username"
+	oidcDefaultGroupClaim      = "groups"
+	oidcStatePurpose           = "oidcState"
+	OIDCStateTTL               = time.Minute * 10
+	oidcKeyRefreshInterval     = time.Minute
+	oidcRequestTimeout         = time.Second * 10
+	oidcAllNamespace           = "*"
+	oidcClockSkewToleration    = time.Minute
+	oidcDiscoveryPathSuffix    = "/.well-known/openid-configuration"
+	oidcGrantAuthorizationCode = "authorization_code"
+)
+
+// Loaded from the configuration key oidc
+type OIDCConfiguration struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// The callback of the authorization code flow. It should route to /api/v1/authorizations/oidc/callback.
+	RedirectURL string
+	ScopeSlice  []string
+	// The claim used as the user name
+	UsernameClaim string
+	GroupClaim    string
+	// The key is the group and the value is the rbac role name
+	GroupRoleMap map[string]string
+	// The key is the group and the value is the namespaces the group could access. * means all namespaces.
+	GroupNamespaceMap map[string][]string
+	// Optional claim listing the namespaces directly
+	NamespaceClaim string
+	// Just-in-time user creation. If false, the user only exists in the instance issuing the token.
+	CreateUser bool
+}
+
+func GetOIDCConfiguration() (*OIDCConfiguration, error) {
+	value := configuration.LocalConfiguration.GetNative("oidc")
+	if value == nil {
+		return nil, errors.New("Fail to get configuration oidc")
+	}
+
+	// Convert the generic json value to the structure
+	byteSlice, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	oidcConfiguration := &OIDCConfiguration{}
+	if err := json.Unmarshal(byteSlice, oidcConfiguration); err != nil {
+		return nil, err
+	}
+
+	if oidcConfiguration.Issuer == "" {
+		return nil, errors.New("Configuration oidc Issuer can't be empty")
+	}
+	if oidcConfiguration.ClientID == "" {
+		return nil, errors.New("Configuration oidc ClientID can't be empty")
+	}
+	if len(oidcConfiguration.ScopeSlice) == 0 {
+		oidcConfiguration.ScopeSlice = []string{"openid", "profile", "email", "groups"}
+	}
+	if oidcConfiguration.UsernameClaim == "" {
+		oidcConfiguration.UsernameClaim = oidcDefaultUsernameClaim
+	}
+	if oidcConfiguration.GroupClaim == "" {
+		oidcConfiguration.GroupClaim = oidcDefaultGroupClaim
+	}
+
+	return oidcConfiguration, nil
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// The discovery document and the keys of the provider. Reloaded when the issuer is changed or the unknown key is used.
+var oidcMutex = &sync.Mutex{}
+var oidcDiscoveryCache *oidcDiscovery = nil
+var oidcKeyMap = make(map[string]interface{})
+var oidcKeyLoadedTime time.Time
+
+var oidcHTTPClient = &http.Client{Timeout: oidcRequestTimeout}
+
+func requestOIDCJson(request *http.Request, result interface{}) error {
+	response, err := oidcHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	byteSlice, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(byteSlice, result); err != nil {
+		return fmt.Errorf("Fail to parse the response of %s with status %d error: %s", request.URL.String(), response.StatusCode, err)
+	}
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("Request %s failure with status %d", request.URL.String(), response.StatusCode)
+	}
+	return nil
+}
+
+func getOIDCDiscovery(oidcConfiguration *OIDCConfiguration) (*oidcDiscovery, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if oidcDiscoveryCache != nil && oidcDiscoveryCache.Issuer == oidcConfiguration.Issuer {
+		return oidcDiscoveryCache, nil
+	}
+
+	request, err := http.NewRequest("GET", strings.TrimSuffix(oidcConfiguration.Issuer, "/")+oidcDiscoveryPathSuffix, nil)
+	if err != nil {
+		return nil, err
+	}
+	discovery := &oidcDiscovery{}
+	if err := requestOIDCJson(request, discovery); err != nil {
+		log.Error("Fail to get the oidc discovery of issuer %s error: %s", oidcConfiguration.Issuer, err)
+		return nil, err
+	}
+	// Required by the specification to prevent the impersonation
+	if discovery.Issuer != oidcConfiguration.Issuer {
+		log.Error("Issuer %s in the oidc discovery doesn't match the configured %s", discovery.Issuer, oidcConfiguration.Issuer)
+		return nil, errors.New("Issuer in the oidc discovery doesn't match")
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("No jwks_uri in the oidc discovery")
+	}
+
+	oidcDiscoveryCache = discovery
+	oidcKeyMap = make(map[string]interface{})
+	oidcKeyLoadedTime = time.Time{}
+	return discovery, nil
+}
+
+func getOIDCKey(discovery *oidcDiscovery, id string) (interface{}, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	key := findOIDCKey(id)
+	// Only reload periodically so the random key id can't flood the provider
+	if key == nil && time.Now().Sub(oidcKeyLoadedTime) > oidcKeyRefreshInterval {
+		request, err := http.NewRequest("GET", discovery.JWKSURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		keySet := &jsonWebKeySet{}
+		if err := requestOIDCJson(request, keySet); err != nil {
+			log.Error("Fail to get the oidc keys from %s error: %s", discovery.JWKSURI, err)
+			return nil, err
+		}
+		oidcKeyMap = parseJSONWebKeySet(keySet)
+		oidcKeyLoadedTime = time.Now()
+		key = findOIDCKey(id)
+	}
+
+	if key == nil {
+		return nil, errors.New("Unknown oidc signing key " + id)
+	}
+	return key, nil
+}
+
+func findOIDCKey(id string) interface{} {
+	if key, ok := oidcKeyMap[id]; ok {
+		return key
+	}
+	// The provider with the single key may not set the key id
+	if id == "" && len(oidcKeyMap) == 1 {
+		for _, key := range oidcKeyMap {
+			return key
+		}
+	}
+	return nil
+}
+
+func parseJSONWebKeySet(keySet *jsonWebKeySet) map[string]interface{} {
+	keyMap := make(map[string]interface{})
+	for _, key := range keySet.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := parseJSONWebKey(key)
+		if err != nil {
+			log.Error("Fail to parse oidc key %s error: %s", key.Kid, err)
+			continue
+		}
+		keyMap[key.Kid] = publicKey
+	}
+	return keyMap
+}
+
+func parseJSONWebKey(key jsonWebKey) (interface{}, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeBase64URLBigInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URLBigInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		if e.IsInt64() == false || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("Invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("Not supported curve " + key.Crv)
+		}
+		x, err := decodeBase64URLBigInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URLBigInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		if curve.IsOnCurve(x, y) == false {
+			return nil, errors.New("Point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errors.New("Not supported key type " + key.Kty)
+	}
+}
+
+func decodeBase64URLBigInt(text string) (*big.Int, error) {
+	byteSlice, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(text, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(byteSlice) == 0 {
+		return nil, errors.New("Empty value")
+	}
+	return new(big.Int).SetBytes(byteSlice), nil
+}
+
+// Verify the signature and the standard claims of the id token and return the claims
+func validateIDToken(idToken string, issuer string, clientID string, nonce string, getKey func(id string) (interface{}, error)) (map[string]interface{}, error) {
+	parsedToken, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		key, err := getKey(id)
+		if err != nil {
+			return nil, err
+		}
+		// The algorithm must match the key type so the public key can't be used as the HMAC secret
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); ok == false {
+				return nil, errors.New("Unexpected signing method " + token.Method.Alg())
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok == false {
+				return nil, errors.New("Unexpected signing method " + token.Method.Alg())
+			}
+		default:
+			return nil, errors.New("Unexpected key type")
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}(parsedToken.Claims)
+
+	if claimIssuer, _ := claims["iss"].(string); claimIssuer != issuer {
+		return nil, errors.New("Unexpected issuer " + claimIssuer)
+	}
+
+	audienceSlice := getClaimStringSlice(claims, "aud")
+	if isStringInSlice(clientID, audienceSlice) == false {
+		return nil, errors.New("Token is not issued for this client")
+	}
+	// The authorized party is required to be this client when there are multiple audiences
+	authorizedParty, hasAuthorizedParty := claims["azp"].(string)
+	if (len(audienceSlice) > 1 || hasAuthorizedParty) && authorizedParty != clientID {
+		return nil, errors.New("Token is not authorized for this client")
+	}
+
+	now := time.Now()
+	expiration, ok := claims["exp"].(float64)
+	if ok == false {
+		return nil, errors.New("Token has no expiration")
+	}
+	if now.Add(-oidcClockSkewToleration).After(time.Unix(int64(expiration), 0)) {
+		return nil, errors.New("Token is expired")
+	}
+	if issuedAt, ok := claims["iat"].(float64); ok && now.Add(oidcClockSkewToleration).Before(time.Unix(int64(issuedAt), 0)) {
+		return nil, errors.New("Token is issued in the future")
+	}
+
+	if nonce != "" {
+		if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+			return nil, errors.New("Unexpected nonce")
+		}
+	}
+
+	return claims, nil
+}
+
+// The claim could be either a string or an array of strings
+func getClaimStringSlice(claims map[string]interface{}, name string) []string {
+	valueSlice := make([]string, 0)
+	switch value := claims[name].(type) {
+	case string:
+		if value != "" {
+			valueSlice = append(valueSlice, value)
+		}
+	case []interface{}:
+		for _, element := range value {
+			if text, ok := element.(string); ok {
+				valueSlice = append(valueSlice, text)
+			}
+		}
+	case []string:
+		valueSlice = append(valueSlice, value...)
+	}
+	return valueSlice
+}
+
+func isStringInSlice(text string, textSlice []string) bool {
+	for _, value := range textSlice {
+		if value == text {
+			return true
+		}
+	}
+	return false
+}
+
+// The user name claim could be changed by the user in the provider so the user is bound to the issuer and the subject which never change
+func getOIDCIdentity(claims map[string]interface{}) (string, error) {
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+	if issuer == "" || subject == "" {
+		return "", errors.New("Token has no issuer or subject")
+	}
+	// The issuer has no fragment so the separator is unambiguous
+	return issuer + "#" + subject, nil
+}
+
+// Map the claims to the user name, the role names and the namespace resources
+func mapOIDCClaim(oidcConfiguration *OIDCConfiguration, claims map[string]interface{}) (string, []string, []*rbac.Resource, error) {
+	name, _ := claims[oidcConfiguration.UsernameClaim].(string)
+	if name == "" {
+		return "", nil, nil, errors.New("Token has no claim " + oidcConfiguration.UsernameClaim)
+	}
+	if name == defaultUsername || name == systemUsername {
+		return "", nil, nil, errors.New("Reserved user name " + name)
+	}
+
+	groupSlice := getClaimStringSlice(claims, oidcConfiguration.GroupClaim)
+
+	roleNameSlice := make([]string, 0)
+	namespaceSlice := make([]string, 0)
+	for _, group := range groupSlice {
+		if roleName, ok := oidcConfiguration.GroupRoleMap[group]; ok && isStringInSlice(roleName, roleNameSlice) == false {
+			roleNameSlice = append(roleNameSlice, roleName)
+		}
+		for _, namespace := range oidcConfiguration.GroupNamespaceMap[group] {
+			if isStringInSlice(namespace, namespaceSlice) == false {
+				namespaceSlice = append(namespaceSlice, namespace)
+			}
+		}
+	}
+	if oidcConfiguration.NamespaceClaim != "" {
+		for _, namespace := range getClaimStringSlice(claims, oidcConfiguration.NamespaceClaim) {
+			if isStringInSlice(namespace, namespaceSlice) == false {
+				namespaceSlice = append(namespaceSlice, namespace)
+			}
+		}
+	}
+
+	if len(roleNameSlice) == 0 {
+		return "", nil, nil, errors.New("User has no role")
+	}
+
+	resourceSlice := make([]*rbac.Resource, 0)
+	if isStringInSlice(oidcAllNamespace, namespaceSlice) {
+		resourceSlice = append(resourceSlice, &rbac.Resource{"all", "*", "*"})
+	} else {
+		for _, namespace := range namespaceSlice {
+			resourceSlice = append(resourceSlice, &rbac.Resource{namespace, "*", "/namespaces/" + namespace})
+		}
+	}
+
+	return name, roleNameSlice, resourceSlice, nil
+}
+
+// The state is signed with the token signing key so the callback could be handled by any instance.
+// The hash of the binding kept in the browser cookie is included so the state can't be used in the other browser.
+func signOIDCState(nonce string, binding string) (string, error) {
+	signingKey, err := getCurrentSigningKey()
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	token := jwt.New(jwt.GetSigningMethod(signingKey.signingKey.Algorithm))
+	token.Header["kid"] = signingKey.signingKey.ID
+	token.Claims["purpose"] = oidcStatePurpose
+	token.Claims["nonce"] = nonce
+	token.Claims["binding"] = hashOIDCBinding(binding)
+	token.Claims["expired"] = time.Now().Add(OIDCStateTTL).Format(time.RFC3339)
+	return token.SignedString(signingKey.signKey)
+}
+
+func hashOIDCBinding(binding string) string {
+	hash := sha256.Sum256([]byte(binding))
+	return hex.EncodeToString(hash[:])
+}
+
+func parseOIDCState(state string, binding string) (string, error) {
+	if binding == "" {
+		return "", errors.New("No state binding")
+	}
+
+	parsedToken, err := jwt.Parse(state, getVerifyKey)
+	if err != nil {
+		return "", err
+	}
+
+	if purpose, _ := parsedToken.Claims["purpose"].(string); purpose != oidcStatePurpose {
+		return "", errors.New("Invalid state")
+	}
+	expiredText, _ := parsedToken.Claims["expired"].(string)
+	expiredTime, err := time.Parse(time.RFC3339, expiredText)
+	if err != nil {
+		return "", err
+	}
+	if expiredTime.Before(time.Now()) {
+		return "", errors.New("State is expired")
+	}
+
+	bindingHash, _ := parsedToken.Claims["binding"].(string)
+	if subtle.ConstantTimeCompare([]byte(bindingHash), []byte(hashOIDCBinding(binding))) != 1 {
+		return "", errors.New("State is not issued to this browser")
+	}
+
+	nonce, _ := parsedToken.Claims["nonce"].(string)
+	if nonce == "" {
+		return "", errors.New("State has no nonce")
+	}
+	return nonce, nil
+}
+
+// The state is recorded until it expires so the same state can't be used again
+func useOIDCState(state string) error {
+	hash := sha256.Sum256([]byte(state))
+	if err := GetStorage().CreateUsedOIDCState(hex.EncodeToString(hash[:]), OIDCStateTTL); err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code == client.ErrorCodeNodeExist {
+			return errors.New("State is already used")
+		}
+		return err
+	}
+	return nil
+}
+
+func generateOIDCRandomText() (string, error) {
+	byteSlice := make([]byte, 16)
+	if _, err := rand.Read(byteSlice); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(byteSlice), nil
+}
+
+// The url of the provider the user is redirected to for the login and the binding which must be kept in the browser cookie
+func GetOIDCAuthorizationURL() (string, string, error) {
+	oidcConfiguration, err := GetOIDCConfiguration()
+	if err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	if oidcConfiguration.RedirectURL == "" {
+		return "", "", errors.New("Configuration oidc RedirectURL can't be empty")
+	}
+
+	discovery, err := getOIDCDiscovery(oidcConfiguration)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := generateOIDCRandomText()
+	if err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	binding, err := generateOIDCRandomText()
+	if err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+
+	state, err := signOIDCState(nonce, binding)
+	if err != nil {
+		return "", "", err
+	}
+
+	valueMap := url.Values{}
+	valueMap.Set("response_type", "code")
+	valueMap.Set("client_id", oidcConfiguration.ClientID)
+	valueMap.Set("redirect_uri", oidcConfiguration.RedirectURL)
+	valueMap.Set("scope", strings.Join(oidcConfiguration.ScopeSlice, " "))
+	valueMap.Set("state", state)
+	valueMap.Set("nonce", nonce)
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + valueMap.Encode(), binding, nil
+}
+
+// Exchange the authorization code returned to the callback for the cloudone token
+func CreateTokenWithOIDCAuthorizationCode(code string, state string, binding string) (string, error) {
+	nonce, err := parseOIDCState(state, binding)
+	if err != nil {
+		log.Error("Invalid oidc state error: %s", err)
+		return "", errors.New("Invalid state")
+	}
+	if err := useOIDCState(state); err != nil {
+		log.Error("Use oidc state error: %s", err)
+		return "", errors.New("Invalid state")
+	}
+
+	oidcConfiguration, err := GetOIDCConfiguration()
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	discovery, err := getOIDCDiscovery(oidcConfiguration)
+	if err != nil {
+		return "", err
+	}
+
+	valueMap := url.Values{}
+	valueMap.Set("grant_type", oidcGrantAuthorizationCode)
+	valueMap.Set("code", code)
+	valueMap.Set("redirect_uri", oidcConfiguration.RedirectURL)
+	request, err := http.NewRequest("POST", discovery.TokenEndpoint, strings.NewReader(valueMap.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(oidcConfiguration.ClientID), url.QueryEscape(oidcConfiguration.ClientSecret))
+
+	tokenResponse := &oidcTokenResponse{}
+	if err := requestOIDCJson(request, tokenResponse); err != nil {
+		log.Error("Fail to exchange the oidc authorization code error: %s %s %s", err, tokenResponse.Error, tokenResponse.ErrorDescription)
+		return "", errors.New("Fail to exchange the authorization code")
+	}
+	if tokenResponse.IDToken == "" {
+		return "", errors.New("No id token in the response")
+	}
+
+	return createTokenWithOIDCIDToken(oidcConfiguration, discovery, tokenResponse.IDToken, nonce)
+}
+
+// Exchange the id token obtained by the client directly for the cloudone token.
+// The client must request the id token with the state and the nonce of the login url so the nonce could be verified.
+func CreateTokenWithOIDCIDToken(idToken string, state string, binding string) (string, error) {
+	nonce, err := parseOIDCState(state, binding)
+	if err != nil {
+		log.Error("Invalid oidc state error: %s", err)
+		return "", errors.New("Invalid state")
+	}
+	if err := useOIDCState(state); err != nil {
+		log.Error("Use oidc state error: %s", err)
+		return "", errors.New("Invalid state")
+	}
+
+	oidcConfiguration, err := GetOIDCConfiguration()
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	discovery, err := getOIDCDiscovery(oidcConfiguration)
+	if err != nil {
+		return "", err
+	}
+
+	return createTokenWithOIDCIDToken(oidcConfiguration, discovery, idToken, nonce)
+}
+
+func createTokenWithOIDCIDToken(oidcConfiguration *OIDCConfiguration, discovery *oidcDiscovery, idToken string, nonce string) (string, error) {
+	if nonce == "" {
+		return "", errors.New("Nonce is required")
+	}
+
+	claims, err := validateIDToken(idToken, discovery.Issuer, oidcConfiguration.ClientID, nonce, func(id string) (interface{}, error) {
+		return getOIDCKey(discovery, id)
+	})
+	if err != nil {
+		log.Error("Invalid oidc id token error: %s", err)
+		return "", errors.New("Invalid id token")
+	}
+
+	identity, err := getOIDCIdentity(claims)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	name, roleNameSlice, resourceSlice, err := mapOIDCClaim(oidcConfiguration, claims)
+	if err != nil {
+		log.Error("Fail to map the oidc claims error: %s", err)
+		return "", err
+	}
+
+	roleSlice, err := loadRoleSlice(name, roleNameSlice)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := getExternalUser(AuthenticationProviderOIDC, name, identity, roleSlice, resourceSlice, oidcConfiguration.CreateUser)
+	if err != nil {
+		return "", err
+	}
+
+	return issueToken(user, oidcConfiguration.CreateUser)
+}
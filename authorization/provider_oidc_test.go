@@ -0,0 +1,247 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testOIDCIssuer   = "https://idp.example.com"
+	testOIDCClientID = "cloudone"
+)
+
+func encodeBase64URLBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func createTestIDToken(method jwt.SigningMethod, id string, key interface{}, claimMap map[string]interface{}) string {
+	token := jwt.New(method)
+	token.Header["kid"] = id
+	token.Claims["iss"] = testOIDCIssuer
+	token.Claims["aud"] = testOIDCClientID
+	token.Claims["exp"] = float64(time.Now().Add(time.Hour).Unix())
+	token.Claims["iat"] = float64(time.Now().Unix())
+	for key, value := range claimMap {
+		token.Claims[key] = value
+	}
+	signedToken, _ := token.SignedString(key)
+	return signedToken
+}
+
+func TestValidateIDToken(t *testing.T) {
+	rsaPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPrivateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keySet := &jsonWebKeySet{
+		[]jsonWebKey{
+			jsonWebKey{Kty: "RSA", Kid: "rsa", Use: "sig", N: encodeBase64URLBigInt(rsaPrivateKey.N), E: encodeBase64URLBigInt(big.NewInt(int64(rsaPrivateKey.E)))},
+			jsonWebKey{Kty: "EC", Kid: "ec", Crv: "P-256", X: encodeBase64URLBigInt(ecdsaPrivateKey.X), Y: encodeBase64URLBigInt(ecdsaPrivateKey.Y)},
+			jsonWebKey{Kty: "RSA", Kid: "encryption", Use: "enc", N: encodeBase64URLBigInt(rsaPrivateKey.N), E: "AQAB"},
+		},
+	}
+	keyMap := parseJSONWebKeySet(keySet)
+	if len(keyMap) != 2 {
+		t.Fatalf("Expect 2 signing keys but get %d", len(keyMap))
+	}
+	getKey := func(id string) (interface{}, error) {
+		if key, ok := keyMap[id]; ok {
+			return key, nil
+		}
+		return nil, errors.New("Unknown key " + id)
+	}
+
+	idToken := createTestIDToken(jwt.SigningMethodRS256, "rsa", rsaPrivateKey, map[string]interface{}{"nonce": "abc", "preferred_username": "alice"})
+	claims, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "abc", getKey)
+	if err != nil {
+		t.Fatalf("Validate RS256 id token error %s", err)
+	}
+	if claims["preferred_username"] != "alice" {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+
+	idToken = createTestIDToken(jwt.SigningMethodES256, "ec", ecdsaPrivateKey, nil)
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "", getKey); err != nil {
+		t.Errorf("Validate ES256 id token error %s", err)
+	}
+
+	// The nonce from the state must match
+	idToken = createTestIDToken(jwt.SigningMethodRS256, "rsa", rsaPrivateKey, map[string]interface{}{"nonce": "abc"})
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "other", getKey); err == nil {
+		t.Error("Token with the unexpected nonce should be rejected")
+	}
+
+	idToken = createTestIDToken(jwt.SigningMethodRS256, "rsa", rsaPrivateKey, map[string]interface{}{"aud": "other"})
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "", getKey); err == nil {
+		t.Error("Token for the other client should be rejected")
+	}
+
+	idToken = createTestIDToken(jwt.SigningMethodRS256, "rsa", rsaPrivateKey, map[string]interface{}{"iss": "https://evil.example.com"})
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "", getKey); err == nil {
+		t.Error("Token from the other issuer should be rejected")
+	}
+
+	idToken = createTestIDToken(jwt.SigningMethodRS256, "rsa", rsaPrivateKey, map[string]interface{}{"exp": float64(time.Now().Add(-time.Hour).Unix())})
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "", getKey); err == nil {
+		t.Error("Expired token should be rejected")
+	}
+
+	// The key id and the key type must match
+	idToken = createTestIDToken(jwt.SigningMethodES256, "rsa", ecdsaPrivateKey, nil)
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "", getKey); err == nil {
+		t.Error("Token signed with the mismatched key should be rejected")
+	}
+
+	// The public key can't be used as the HMAC secret
+	idToken = createTestIDToken(jwt.SigningMethodHS256, "rsa", rsaPrivateKey.N.Bytes(), nil)
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "", getKey); err == nil {
+		t.Error("HMAC token should be rejected")
+	}
+
+	otherPrivateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idToken = createTestIDToken(jwt.SigningMethodRS256, "rsa", otherPrivateKey, nil)
+	if _, err := validateIDToken(idToken, testOIDCIssuer, testOIDCClientID, "", getKey); err == nil {
+		t.Error("Token with the invalid signature should be rejected")
+	}
+}
+
+func TestMapOIDCClaim(t *testing.T) {
+	oidcConfiguration := &OIDCConfiguration{
+		UsernameClaim: oidcDefaultUsernameClaim,
+		GroupClaim:    oidcDefaultGroupClaim,
+		GroupRoleMap: map[string]string{
+			"developers": "developer",
+			"operators":  "operator",
+		},
+		GroupNamespaceMap: map[string][]string{
+			"developers": []string{"dev", "test"},
+			"operators":  []string{"test", "production"},
+		},
+		NamespaceClaim: "namespaces",
+	}
+
+	claims := map[string]interface{}{
+		"preferred_username": "alice",
+		"groups":             []interface{}{"developers", "operators", "unknown"},
+		"namespaces":         "sandbox",
+	}
+	name, roleNameSlice, resourceSlice, err := mapOIDCClaim(oidcConfiguration, claims)
+	if err != nil {
+		t.Fatalf("Map claims error %s", err)
+	}
+	if name != "alice" {
+		t.Errorf("Unexpected name %s", name)
+	}
+	if len(roleNameSlice) != 2 || roleNameSlice[0] != "developer" || roleNameSlice[1] != "operator" {
+		t.Errorf("Unexpected role names %v", roleNameSlice)
+	}
+	pathSlice := make([]string, 0)
+	for _, resource := range resourceSlice {
+		pathSlice = append(pathSlice, resource.Path)
+	}
+	if len(pathSlice) != 4 || pathSlice[0] != "/namespaces/dev" || pathSlice[1] != "/namespaces/test" || pathSlice[2] != "/namespaces/production" || pathSlice[3] != "/namespaces/sandbox" {
+		t.Errorf("Unexpected resources %v", pathSlice)
+	}
+
+	oidcConfiguration.GroupNamespaceMap["operators"] = []string{oidcAllNamespace}
+	_, _, resourceSlice, _ = mapOIDCClaim(oidcConfiguration, claims)
+	if len(resourceSlice) != 1 || resourceSlice[0].Path != "*" {
+		t.Errorf("Expect all namespaces but get %v", resourceSlice)
+	}
+
+	if _, _, _, err := mapOIDCClaim(oidcConfiguration, map[string]interface{}{"preferred_username": "bob", "groups": "unknown"}); err == nil {
+		t.Error("User without the mapped group should be rejected")
+	}
+
+	if _, _, _, err := mapOIDCClaim(oidcConfiguration, map[string]interface{}{"preferred_username": "admin", "groups": "developers"}); err == nil {
+		t.Error("Built-in admin should not be taken over")
+	}
+
+	if _, _, _, err := mapOIDCClaim(oidcConfiguration, map[string]interface{}{"groups": "developers"}); err == nil {
+		t.Error("Token without the user name should be rejected")
+	}
+}
+
+func TestOIDCStateBinding(t *testing.T) {
+	signingKey, err := generateSigningKey(SigningAlgorithmHS512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedSigningKey, err := loadSigningKey(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingKeyMutex.Lock()
+	previousSigningKeyID := currentSigningKeyID
+	loadedSigningKeyMap[signingKey.ID] = loadedSigningKey
+	currentSigningKeyID = signingKey.ID
+	signingKeyMutex.Unlock()
+	defer func() {
+		signingKeyMutex.Lock()
+		currentSigningKeyID = previousSigningKeyID
+		signingKeyMutex.Unlock()
+	}()
+
+	state, err := signOIDCState("nonce", "binding")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce, err := parseOIDCState(state, "binding")
+	if err != nil {
+		t.Fatalf("Parse state error %s", err)
+	}
+	if nonce != "nonce" {
+		t.Errorf("Unexpected nonce %s", nonce)
+	}
+
+	// The state started in the other browser is rejected
+	if _, err := parseOIDCState(state, "other"); err == nil {
+		t.Error("State with the other binding should be rejected")
+	}
+	if _, err := parseOIDCState(state, ""); err == nil {
+		t.Error("State without the binding should be rejected")
+	}
+}
+
+func TestGetOIDCIdentity(t *testing.T) {
+	identity, err := getOIDCIdentity(map[string]interface{}{"iss": testOIDCIssuer, "sub": "123", "preferred_username": "alice"})
+	if err != nil {
+		t.Fatalf("Get identity error %s", err)
+	}
+	if identity != testOIDCIssuer+"#123" {
+		t.Errorf("Unexpected identity %s", identity)
+	}
+
+	if _, err := getOIDCIdentity(map[string]interface{}{"iss": testOIDCIssuer, "preferred_username": "alice"}); err == nil {
+		t.Error("Token without the subject should be rejected")
+	}
+}
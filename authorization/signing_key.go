@@ -0,0 +1,443 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone/utility/secret"
+	jwt "github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SigningAlgorithmHS512 = "HS512"
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmES256 = "ES256"
+)
+
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	PrivateKey  string // The secret for HS512 or the PEM private key for RS256 and ES256
+	PublicKey   string // The PEM public key for RS256 and ES256
+	CreatedTime time.Time
+	ExpiredTime *time.Time // Nil for the key in use. The retired key is kept to verify the issued tokens until expired.
+}
+
+// Return a copy with the private key encrypted for the storage
+func getEncryptedSigningKey(signingKey *SigningKey) (*SigningKey, error) {
+	encryptedSigningKey := *signingKey
+	privateKey, err := secret.Encrypt(signingKey.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptedSigningKey.PrivateKey = privateKey
+	return &encryptedSigningKey, nil
+}
+
+func decryptSigningKey(signingKey *SigningKey) error {
+	privateKey, err := secret.Decrypt(signingKey.PrivateKey)
+	if err != nil {
+		return err
+	}
+	signingKey.PrivateKey = privateKey
+	return nil
+}
+
+type loadedSigningKey struct {
+	signingKey SigningKey
+	signKey    interface{}
+	verifyKey  interface{}
+}
+
+var signingKeyMutex = &sync.RWMutex{}
+var loadedSigningKeyMap = make(map[string]*loadedSigningKey)
+var currentSigningKeyID = ""
+
+func initializeSigningKey() {
+	configuredSigningKey, err := loadSigningKeyFromConfiguration()
+	if err != nil {
+		log.Critical(err)
+	}
+
+	signingKeySlice, err := GetStorage().LoadAllSigningKey()
+	if err != nil {
+		log.Error("Load all signing key error: %s", err)
+	}
+
+	if configuredSigningKey != nil {
+		// The changed key in the configuration is used as the rotation
+		if isSigningKeyInSlice(configuredSigningKey.ID, signingKeySlice) == false {
+			if _, err := rotateSigningKey(configuredSigningKey); err != nil {
+				log.Critical(err)
+				useSigningKeyInMemory(configuredSigningKey)
+			}
+			return
+		}
+	} else if getCurrentSigningKeyInSlice(signingKeySlice) == nil {
+		signingKey, err := generateSigningKey(SigningAlgorithmHS512)
+		if err != nil {
+			log.Critical(err)
+			return
+		}
+		if _, err := rotateSigningKey(signingKey); err != nil {
+			log.Critical(err)
+			useSigningKeyInMemory(signingKey)
+		}
+		return
+	}
+
+	if err := reloadSigningKey(); err != nil {
+		log.Critical(err)
+	}
+}
+
+// Used only if the storage is not available so the tokens are valid only in this process
+func useSigningKeyInMemory(signingKey *SigningKey) {
+	loadedSigningKey, err := loadSigningKey(signingKey)
+	if err != nil {
+		log.Critical(err)
+		return
+	}
+
+	signingKeyMutex.Lock()
+	defer signingKeyMutex.Unlock()
+	loadedSigningKeyMap[signingKey.ID] = loadedSigningKey
+	currentSigningKeyID = signingKey.ID
+}
+
+// Configuration tokenSigningAlgorithm and tokenSigningKeyPath are optional
+func loadSigningKeyFromConfiguration() (*SigningKey, error) {
+	signingKeyPath, ok := configuration.LocalConfiguration.GetString("tokenSigningKeyPath")
+	if ok == false || signingKeyPath == "" {
+		return nil, nil
+	}
+	algorithm, ok := configuration.LocalConfiguration.GetString("tokenSigningAlgorithm")
+	if ok == false || algorithm == "" {
+		algorithm = SigningAlgorithmHS512
+	}
+
+	byteSlice, err := ioutil.ReadFile(signingKeyPath)
+	if err != nil {
+		log.Error("Fail to read the signing key file %s error: %s", signingKeyPath, err)
+		return nil, err
+	}
+
+	signingKey, err := createSigningKey(algorithm, strings.TrimSpace(string(byteSlice)))
+	if err != nil {
+		return nil, err
+	}
+
+	// The same content has the same id so all the instances agree on it
+	hashByteSlice := sha256.Sum256(byteSlice)
+	signingKey.ID = "configuration-" + hex.EncodeToString(hashByteSlice[:8])
+
+	return signingKey, nil
+}
+
+func generateSigningKey(algorithm string) (*SigningKey, error) {
+	switch algorithm {
+	case SigningAlgorithmHS512:
+		byteSlice := make([]byte, 64)
+		if _, err := rand.Read(byteSlice); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		return createSigningKey(algorithm, base64.StdEncoding.EncodeToString(byteSlice))
+	case SigningAlgorithmRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		privateKeyText := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+		return createSigningKey(algorithm, privateKeyText)
+	case SigningAlgorithmES256:
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		byteSlice, err := x509.MarshalECPrivateKey(privateKey)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		privateKeyText := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: byteSlice}))
+		return createSigningKey(algorithm, privateKeyText)
+	default:
+		return nil, errors.New("Not supported signing algorithm " + algorithm)
+	}
+}
+
+func createSigningKey(algorithm string, privateKey string) (*SigningKey, error) {
+	idByteSlice := make([]byte, 8)
+	if _, err := rand.Read(idByteSlice); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	signingKey := &SigningKey{
+		hex.EncodeToString(idByteSlice),
+		algorithm,
+		privateKey,
+		"",
+		time.Now(),
+		nil,
+	}
+
+	loadedSigningKey, err := loadSigningKey(signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithm != SigningAlgorithmHS512 {
+		byteSlice, err := x509.MarshalPKIXPublicKey(loadedSigningKey.verifyKey)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		signingKey.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: byteSlice}))
+	}
+
+	return signingKey, nil
+}
+
+func loadSigningKey(signingKey *SigningKey) (*loadedSigningKey, error) {
+	switch signingKey.Algorithm {
+	case SigningAlgorithmHS512:
+		if len(signingKey.PrivateKey) < 32 {
+			return nil, errors.New("The HS512 secret needs at least 32 characters")
+		}
+		return &loadedSigningKey{*signingKey, []byte(signingKey.PrivateKey), []byte(signingKey.PrivateKey)}, nil
+	case SigningAlgorithmRS256:
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(signingKey.PrivateKey))
+		if err != nil {
+			log.Error("Parse RSA private key of signing key %s error: %s", signingKey.ID, err)
+			return nil, err
+		}
+		return &loadedSigningKey{*signingKey, privateKey, &privateKey.PublicKey}, nil
+	case SigningAlgorithmES256:
+		privateKey, err := jwt.ParseECPrivateKeyFromPEM([]byte(signingKey.PrivateKey))
+		if err != nil {
+			log.Error("Parse EC private key of signing key %s error: %s", signingKey.ID, err)
+			return nil, err
+		}
+		if privateKey.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 requires the P-256 curve")
+		}
+		return &loadedSigningKey{*signingKey, privateKey, &privateKey.PublicKey}, nil
+	default:
+		return nil, errors.New("Not supported signing algorithm " + signingKey.Algorithm)
+	}
+}
+
+// Load the keys from the storage so the rotation by the other instances is applied
+func reloadSigningKey() error {
+	signingKeySlice, err := GetStorage().LoadAllSigningKey()
+	if err != nil {
+		log.Error("Load all signing key error: %s", err)
+		return err
+	}
+
+	currentSigningKey := getCurrentSigningKeyInSlice(signingKeySlice)
+	if currentSigningKey == nil {
+		return errors.New("No signing key in use")
+	}
+
+	newLoadedSigningKeyMap := make(map[string]*loadedSigningKey)
+	for i := range signingKeySlice {
+		signingKey := &signingKeySlice[i]
+		if signingKey.ExpiredTime != nil && signingKey.ExpiredTime.Before(time.Now()) {
+			// Remove the expired key
+			if err := GetStorage().DeleteSigningKey(signingKey.ID); err != nil {
+				log.Error(err)
+			}
+			continue
+		}
+		loadedSigningKey, err := loadSigningKey(signingKey)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		newLoadedSigningKeyMap[signingKey.ID] = loadedSigningKey
+	}
+
+	if newLoadedSigningKeyMap[currentSigningKey.ID] == nil {
+		return errors.New("Fail to load the signing key in use " + currentSigningKey.ID)
+	}
+
+	signingKeyMutex.Lock()
+	currentSigningKeyChanged := currentSigningKeyID != currentSigningKey.ID
+	loadedSigningKeyMap = newLoadedSigningKeyMap
+	currentSigningKeyID = currentSigningKey.ID
+	signingKeyMutex.Unlock()
+
+	// The system token needs to be signed by the key in use before the old one expires
+	if currentSigningKeyChanged && GetSystemAdminToken() != "" {
+		createSystemUserInMemory()
+	}
+
+	return nil
+}
+
+// Multiple keys in use could happen if instances start at the same time. The newest one wins.
+func getCurrentSigningKeyInSlice(signingKeySlice []SigningKey) *SigningKey {
+	var currentSigningKey *SigningKey = nil
+	for i := range signingKeySlice {
+		if signingKeySlice[i].ExpiredTime == nil {
+			if currentSigningKey == nil || signingKeySlice[i].CreatedTime.After(currentSigningKey.CreatedTime) {
+				currentSigningKey = &signingKeySlice[i]
+			}
+		}
+	}
+	return currentSigningKey
+}
+
+func isSigningKeyInSlice(id string, signingKeySlice []SigningKey) bool {
+	for _, signingKey := range signingKeySlice {
+		if signingKey.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty private key means generating a new key
+func RotateSigningKey(algorithm string, privateKey string) (*SigningKey, error) {
+	var signingKey *SigningKey
+	var err error
+	if privateKey == "" {
+		signingKey, err = generateSigningKey(algorithm)
+	} else {
+		signingKey, err = createSigningKey(algorithm, privateKey)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return rotateSigningKey(signingKey)
+}
+
+func rotateSigningKey(signingKey *SigningKey) (*SigningKey, error) {
+	signingKeySlice, err := GetStorage().LoadAllSigningKey()
+	if err != nil {
+		log.Error("Load all signing key error: %s", err)
+		return nil, err
+	}
+
+	if err := GetStorage().SaveSigningKey(signingKey); err != nil {
+		log.Error("Save signing key %s error: %s", signingKey.ID, err)
+		return nil, err
+	}
+
+	// The tokens signed by the old key are still valid until they expire
+	expiredTime := time.Now().Add(cacheTTL)
+	for _, oldSigningKey := range signingKeySlice {
+		if oldSigningKey.ExpiredTime == nil {
+			oldSigningKey.ExpiredTime = &expiredTime
+			if err := GetStorage().SaveSigningKey(&oldSigningKey); err != nil {
+				log.Error("Save signing key %s error: %s", oldSigningKey.ID, err)
+			}
+		}
+	}
+
+	if err := reloadSigningKey(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return getSigningKeyWithoutPrivateKey(signingKey), nil
+}
+
+// The key in use can't be deleted. Deleting the retired key invalidates the tokens signed by it immediately.
+func DeleteSigningKey(id string) error {
+	signingKeyMutex.RLock()
+	isCurrent := id == currentSigningKeyID
+	signingKeyMutex.RUnlock()
+	if isCurrent {
+		return errors.New("The signing key in use can't be deleted")
+	}
+
+	if err := GetStorage().DeleteSigningKey(id); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return reloadSigningKey()
+}
+
+func GetAllSigningKey() []SigningKey {
+	signingKeyMutex.RLock()
+	defer signingKeyMutex.RUnlock()
+
+	signingKeySlice := make([]SigningKey, 0)
+	for _, loadedSigningKey := range loadedSigningKeyMap {
+		signingKeySlice = append(signingKeySlice, *getSigningKeyWithoutPrivateKey(&loadedSigningKey.signingKey))
+	}
+	return signingKeySlice
+}
+
+func getSigningKeyWithoutPrivateKey(signingKey *SigningKey) *SigningKey {
+	copiedSigningKey := *signingKey
+	copiedSigningKey.PrivateKey = ""
+	return &copiedSigningKey
+}
+
+func getCurrentSigningKey() (*loadedSigningKey, error) {
+	signingKeyMutex.RLock()
+	defer signingKeyMutex.RUnlock()
+
+	loadedSigningKey := loadedSigningKeyMap[currentSigningKeyID]
+	if loadedSigningKey == nil {
+		return nil, errors.New("No signing key in use")
+	}
+	return loadedSigningKey, nil
+}
+
+func getVerifyKey(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+
+	signingKeyMutex.RLock()
+	loadedSigningKey := loadedSigningKeyMap[id]
+	signingKeyMutex.RUnlock()
+
+	if loadedSigningKey == nil {
+		return nil, errors.New("Unknown signing key " + id)
+	}
+	// Don't forget to validate the alg is what you expect
+	if token.Method.Alg() != loadedSigningKey.signingKey.Algorithm {
+		return nil, errors.New("Unexpected signing method")
+	}
+	if loadedSigningKey.signingKey.ExpiredTime != nil && loadedSigningKey.signingKey.ExpiredTime.Before(time.Now()) {
+		return nil, errors.New("Signing key is expired")
+	}
+
+	return loadedSigningKey.verifyKey, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	jwt "github.com/dgrijalva/jwt-go"
+	"testing"
+)
+
+func TestSigningKeySignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{SigningAlgorithmHS512, SigningAlgorithmRS256, SigningAlgorithmES256} {
+		signingKey, err := generateSigningKey(algorithm)
+		if err != nil {
+			t.Errorf("Generate %s signing key error %s", algorithm, err)
+			continue
+		}
+		loadedSigningKey, err := loadSigningKey(signingKey)
+		if err != nil {
+			t.Errorf("Load %s signing key error %s", algorithm, err)
+			continue
+		}
+
+		signingKeyMutex.Lock()
+		loadedSigningKeyMap[signingKey.ID] = loadedSigningKey
+		signingKeyMutex.Unlock()
+
+		token := jwt.New(jwt.GetSigningMethod(algorithm))
+		token.Header["kid"] = signingKey.ID
+		token.Claims["username"] = "test"
+		signedToken, err := token.SignedString(loadedSigningKey.signKey)
+		if err != nil {
+			t.Errorf("Sign with %s signing key error %s", algorithm, err)
+			continue
+		}
+
+		if _, err := jwt.Parse(signedToken, getVerifyKey); err != nil {
+			t.Errorf("Verify with %s signing key error %s", algorithm, err)
+		}
+
+		// The token with the unknown kid is rejected
+		token.Header["kid"] = "unknown"
+		signedToken, _ = token.SignedString(loadedSigningKey.signKey)
+		if _, err := jwt.Parse(signedToken, getVerifyKey); err == nil {
+			t.Errorf("Token with the unknown %s signing key should be rejected", algorithm)
+		}
+	}
+}
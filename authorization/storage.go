@@ -18,6 +18,7 @@ import (
 	"errors"
 	"github.com/cloudawan/cloudone/utility/configuration"
 	"github.com/cloudawan/cloudone_utility/rbac"
+	"time"
 )
 
 var storage Storage = nil
@@ -87,4 +88,27 @@ type Storage interface {
 	SaveRole(role *rbac.Role) error
 	LoadRole(name string) (*rbac.Role, error)
 	LoadAllRole() ([]rbac.Role, error)
+	DeleteSigningKey(id string) error
+	SaveSigningKey(signingKey *SigningKey) error
+	LoadSigningKey(id string) (*SigningKey, error)
+	LoadAllSigningKey() ([]SigningKey, error)
+	DeleteTokenRecord(id string) error
+	SaveTokenRecord(tokenRecord *TokenRecord) error
+	LoadTokenRecord(id string) (*TokenRecord, error)
+	LoadAllTokenRecord() ([]TokenRecord, error)
+	DeleteAPIKey(id string) error
+	SaveAPIKey(apiKey *APIKey) error
+	UpdateAPIKey(apiKey *APIKey) error
+	LoadAPIKey(id string) (*APIKey, error)
+	LoadAllAPIKey() ([]APIKey, error)
+	DeleteLoginFailure(key string) error
+	// Previous index 0 means the failure must not exist
+	SaveLoginFailure(key string, loginFailure *LoginFailure, previousIndex uint64, ttl time.Duration) error
+	// Return the index used to save with the compare and swap
+	LoadLoginFailure(key string) (*LoginFailure, uint64, error)
+	SaveStreamTicket(key string, encryptedToken string, ttl time.Duration) error
+	// Return the encrypted token of the deleted ticket so the ticket is used only once
+	DeleteStreamTicket(key string) (string, error)
+	// Fail if the state is already used so the state is used only once
+	CreateUsedOIDCState(key string, ttl time.Duration) error
 }
@@ -82,3 +82,79 @@ func (storageDummy *StorageDummy) LoadRole(name string) (*rbac.Role, error) {
 func (storageDummy *StorageDummy) LoadAllRole() ([]rbac.Role, error) {
 	return nil, &storageDummy.dummyError
 }
+
+func (storageDummy *StorageDummy) DeleteSigningKey(id string) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveSigningKey(signingKey *SigningKey) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadSigningKey(id string) (*SigningKey, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadAllSigningKey() ([]SigningKey, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) DeleteTokenRecord(id string) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveTokenRecord(tokenRecord *TokenRecord) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadTokenRecord(id string) (*TokenRecord, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadAllTokenRecord() ([]TokenRecord, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) DeleteAPIKey(id string) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveAPIKey(apiKey *APIKey) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) UpdateAPIKey(apiKey *APIKey) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadAPIKey(id string) (*APIKey, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadAllAPIKey() ([]APIKey, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) DeleteLoginFailure(key string) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveLoginFailure(key string, loginFailure *LoginFailure, previousIndex uint64, ttl time.Duration) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadLoginFailure(key string) (*LoginFailure, uint64, error) {
+	return nil, 0, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveStreamTicket(key string, encryptedToken string, ttl time.Duration) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) DeleteStreamTicket(key string) (string, error) {
+	return "", &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) CreateUsedOIDCState(key string, ttl time.Duration) error {
+	return &storageDummy.dummyError
+}
@@ -16,10 +16,13 @@ package authorization
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/cloudawan/cloudone/utility/database/etcd"
 	"github.com/cloudawan/cloudone_utility/rbac"
 	"github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
+	"net/url"
+	"time"
 )
 
 type StorageEtcd struct {
@@ -36,6 +39,26 @@ func (storageEtcd *StorageEtcd) initialize() error {
 		return err
 	}
 
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/token_signing_key"); err != nil {
+		log.Error("Create if not existing token signing key directory error: %s", err)
+		return err
+	}
+
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/token_record"); err != nil {
+		log.Error("Create if not existing token record directory error: %s", err)
+		return err
+	}
+
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/api_key"); err != nil {
+		log.Error("Create if not existing API key directory error: %s", err)
+		return err
+	}
+
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/login_failure"); err != nil {
+		log.Error("Create if not existing login failure directory error: %s", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -89,13 +112,13 @@ func (storageEtcd *StorageEtcd) SaveUser(user *rbac.User) error {
 
 	byteSlice, err := json.Marshal(savedUser)
 	if err != nil {
-		log.Error("Marshal user %v error %s", user, err)
+		log.Error("Marshal user %s error %s", user.Name, err)
 		return err
 	}
 
 	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/user/"+user.Name, string(byteSlice), nil)
 	if err != nil {
-		log.Error("Save user %v error: %s", user, err)
+		log.Error("Save user %s error: %s", user.Name, err)
 		log.Error(response)
 		return err
 	}
@@ -124,7 +147,7 @@ func (storageEtcd *StorageEtcd) LoadUser(name string) (*rbac.User, error) {
 	user := new(rbac.User)
 	err = json.Unmarshal([]byte(response.Node.Value), &user)
 	if err != nil {
-		log.Error("Unmarshal user %v error %s", response.Node.Value, err)
+		log.Error("Unmarshal user %s error %s", response.Node.Key, err)
 		return nil, err
 	}
 
@@ -162,7 +185,7 @@ func (storageEtcd *StorageEtcd) LoadAllUser() ([]rbac.User, error) {
 		user := rbac.User{}
 		err := json.Unmarshal([]byte(node.Value), &user)
 		if err != nil {
-			log.Error("Unmarshal user %v error %s", node.Value, err)
+			log.Error("Unmarshal user %s error %s", node.Key, err)
 			return nil, err
 		}
 
@@ -285,3 +308,495 @@ func (storageEtcd *StorageEtcd) LoadAllRole() ([]rbac.Role, error) {
 
 	return roleSlice, nil
 }
+
+func (storageEtcd *StorageEtcd) DeleteSigningKey(id string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_signing_key/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		log.Debug(response)
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete signing key with id %s error: %s", id, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveSigningKey(signingKey *SigningKey) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	encryptedSigningKey, err := getEncryptedSigningKey(signingKey)
+	if err != nil {
+		log.Error("Encrypt signing key %s error %s", signingKey.ID, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedSigningKey)
+	if err != nil {
+		log.Error("Marshal signing key %s error %s", signingKey.ID, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_signing_key/"+signingKey.ID, string(byteSlice), nil)
+	if err != nil {
+		log.Error("Save signing key %s error: %s", signingKey.ID, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadSigningKey(id string) (*SigningKey, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_signing_key/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, etcdError
+	}
+	if err != nil {
+		log.Error("Load signing key with id %s error: %s", id, err)
+		log.Error(response)
+		return nil, err
+	}
+
+	signingKey := new(SigningKey)
+	err = json.Unmarshal([]byte(response.Node.Value), &signingKey)
+	if err != nil {
+		log.Error("Unmarshal signing key %s error %s", id, err)
+		return nil, err
+	}
+	err = decryptSigningKey(signingKey)
+	if err != nil {
+		log.Error("Decrypt signing key %s error %s", id, err)
+		return nil, err
+	}
+
+	return signingKey, nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAllSigningKey() ([]SigningKey, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_signing_key", nil)
+	if err != nil {
+		log.Error("Load all signing key error: %s", err)
+		log.Error(response)
+		return nil, err
+	}
+
+	signingKeySlice := make([]SigningKey, 0)
+	for _, node := range response.Node.Nodes {
+		signingKey := SigningKey{}
+		err := json.Unmarshal([]byte(node.Value), &signingKey)
+		if err != nil {
+			log.Error("Unmarshal signing key %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptSigningKey(&signingKey)
+		if err != nil {
+			log.Error("Decrypt signing key %s error %s", node.Key, err)
+			return nil, err
+		}
+		signingKeySlice = append(signingKeySlice, signingKey)
+	}
+
+	return signingKeySlice, nil
+}
+
+func (storageEtcd *StorageEtcd) DeleteTokenRecord(id string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_record/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		log.Debug(response)
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete token record with id %s error: %s", id, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveTokenRecord(tokenRecord *TokenRecord) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(tokenRecord)
+	if err != nil {
+		log.Error("Marshal token record %v error %s", tokenRecord, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_record/"+tokenRecord.ID, string(byteSlice), &client.SetOptions{TTL: tokenRecord.ExpiredTime.Sub(time.Now())})
+	if err != nil {
+		log.Error("Save token record %v error: %s", tokenRecord, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadTokenRecord(id string) (*TokenRecord, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_record/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, etcdError
+	}
+	if err != nil {
+		log.Error("Load token record with id %s error: %s", id, err)
+		log.Error(response)
+		return nil, err
+	}
+
+	tokenRecord := new(TokenRecord)
+	err = json.Unmarshal([]byte(response.Node.Value), &tokenRecord)
+	if err != nil {
+		log.Error("Unmarshal token record %v error %s", response.Node.Value, err)
+		return nil, err
+	}
+
+	return tokenRecord, nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAllTokenRecord() ([]TokenRecord, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/token_record", nil)
+	if err != nil {
+		log.Error("Load all token record error: %s", err)
+		log.Error(response)
+		return nil, err
+	}
+
+	tokenRecordSlice := make([]TokenRecord, 0)
+	for _, node := range response.Node.Nodes {
+		tokenRecord := TokenRecord{}
+		err := json.Unmarshal([]byte(node.Value), &tokenRecord)
+		if err != nil {
+			log.Error("Unmarshal token record %v error %s", node.Value, err)
+			return nil, err
+		}
+		tokenRecordSlice = append(tokenRecordSlice, tokenRecord)
+	}
+
+	return tokenRecordSlice, nil
+}
+
+func (storageEtcd *StorageEtcd) DeleteAPIKey(id string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/api_key/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		log.Debug(response)
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete API key with id %s error: %s", id, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveAPIKey(apiKey *APIKey) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(apiKey)
+	if err != nil {
+		log.Error("Marshal API key %s error %s", apiKey.ID, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/api_key/"+apiKey.ID, string(byteSlice), nil)
+	if err != nil {
+		log.Error("Save API key %s error: %s", apiKey.ID, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+// Fail if the key doesn't exist so the revoked key is not recreated
+func (storageEtcd *StorageEtcd) UpdateAPIKey(apiKey *APIKey) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(apiKey)
+	if err != nil {
+		log.Error("Marshal API key %s error %s", apiKey.ID, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/api_key/"+apiKey.ID, string(byteSlice), &client.SetOptions{PrevExist: client.PrevExist})
+	if err != nil {
+		log.Error("Update API key %s error: %s", apiKey.ID, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAPIKey(id string) (*APIKey, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/api_key/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, etcdError
+	}
+	if err != nil {
+		log.Error("Load API key with id %s error: %s", id, err)
+		log.Error(response)
+		return nil, err
+	}
+
+	apiKey := new(APIKey)
+	err = json.Unmarshal([]byte(response.Node.Value), &apiKey)
+	if err != nil {
+		log.Error("Unmarshal API key %v error %s", response.Node.Value, err)
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAllAPIKey() ([]APIKey, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/api_key", nil)
+	if err != nil {
+		log.Error("Load all API key error: %s", err)
+		log.Error(response)
+		return nil, err
+	}
+
+	apiKeySlice := make([]APIKey, 0)
+	for _, node := range response.Node.Nodes {
+		apiKey := APIKey{}
+		err := json.Unmarshal([]byte(node.Value), &apiKey)
+		if err != nil {
+			log.Error("Unmarshal API key %v error %s", node.Value, err)
+			return nil, err
+		}
+		apiKeySlice = append(apiKeySlice, apiKey)
+	}
+
+	return apiKeySlice, nil
+}
+
+// The key has the user name or the address so it is escaped to be one node
+func getLoginFailurePath(key string) string {
+	return etcd.EtcdClient.EtcdBasePath + "/login_failure/" + url.QueryEscape(key)
+}
+
+func (storageEtcd *StorageEtcd) DeleteLoginFailure(key string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), getLoginFailurePath(key), nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete login failure %s error: %s", key, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveLoginFailure(key string, loginFailure *LoginFailure, previousIndex uint64, ttl time.Duration) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(loginFailure)
+	if err != nil {
+		log.Error("Marshal login failure %v error %s", loginFailure, err)
+		return err
+	}
+
+	setOptions := &client.SetOptions{TTL: ttl, PrevIndex: previousIndex}
+	if previousIndex == 0 {
+		setOptions.PrevExist = client.PrevNoExist
+	}
+
+	response, err := keysAPI.Set(context.Background(), getLoginFailurePath(key), string(byteSlice), setOptions)
+	if err != nil {
+		// The conflict is retried by the caller
+		log.Debug("Save login failure %s error: %s", key, err)
+		log.Debug(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadLoginFailure(key string) (*LoginFailure, uint64, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, 0, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), getLoginFailurePath(key), nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, 0, etcdError
+	}
+	if err != nil {
+		log.Error("Load login failure %s error: %s", key, err)
+		log.Error(response)
+		return nil, 0, err
+	}
+
+	loginFailure := new(LoginFailure)
+	err = json.Unmarshal([]byte(response.Node.Value), &loginFailure)
+	if err != nil {
+		log.Error("Unmarshal login failure %v error %s", response.Node.Value, err)
+		return nil, 0, err
+	}
+
+	return loginFailure, response.Node.ModifiedIndex, nil
+}
+
+func getStreamTicketPath(key string) string {
+	return etcd.EtcdClient.EtcdBasePath + "/stream_ticket/" + key
+}
+
+func (storageEtcd *StorageEtcd) SaveStreamTicket(key string, encryptedToken string, ttl time.Duration) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), getStreamTicketPath(key), encryptedToken, &client.SetOptions{TTL: ttl, PrevExist: client.PrevNoExist})
+	if err != nil {
+		log.Error("Save stream ticket error: %s", err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) DeleteStreamTicket(key string) (string, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return "", err
+	}
+
+	// Only one of the concurrent deletes gets the previous node
+	response, err := keysAPI.Delete(context.Background(), getStreamTicketPath(key), nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return "", etcdError
+	}
+	if err != nil {
+		log.Error("Delete stream ticket error: %s", err)
+		log.Error(response)
+		return "", err
+	}
+	if response.PrevNode == nil {
+		return "", errors.New("No previous node of the deleted stream ticket")
+	}
+
+	return response.PrevNode.Value, nil
+}
+
+func (storageEtcd *StorageEtcd) CreateUsedOIDCState(key string, ttl time.Duration) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/used_oidc_state/"+key, "", &client.SetOptions{TTL: ttl, PrevExist: client.PrevNoExist})
+	if err != nil {
+		log.Error("Create used oidc state error: %s", err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
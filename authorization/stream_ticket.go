@@ -0,0 +1,90 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/secret"
+	"time"
+)
+
+const (
+	// Only long enough for the browser to open the stream after getting the ticket
+	StreamTicketTTL    = 30 * time.Second
+	streamTicketLength = 32
+)
+
+// Used once in the query of the stream which the browser can't set the header for
+type StreamTicket struct {
+	Ticket      string
+	ExpiredTime time.Time
+}
+
+func getStreamTicketKey(ticket string) string {
+	hash := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(hash[:])
+}
+
+// The ticket stands for the token so the stream keeps checking the token after the ticket is used
+func CreateStreamTicket(token string) (*StreamTicket, error) {
+	if _, err := GetUserFromToken(token); err != nil {
+		return nil, err
+	}
+
+	ticketByteSlice := make([]byte, streamTicketLength)
+	if _, err := rand.Read(ticketByteSlice); err != nil {
+		return nil, err
+	}
+	ticket := hex.EncodeToString(ticketByteSlice)
+
+	// The token is stored encrypted like the other secrets
+	encryptedToken, err := secret.Encrypt(token)
+	if err != nil {
+		log.Error("Encrypt token of stream ticket error: %s", err)
+		return nil, err
+	}
+
+	err = GetStorage().SaveStreamTicket(getStreamTicketKey(ticket), encryptedToken, StreamTicketTTL)
+	if err != nil {
+		log.Error("Save stream ticket error: %s", err)
+		return nil, err
+	}
+
+	return &StreamTicket{ticket, time.Now().Add(StreamTicketTTL)}, nil
+}
+
+// Return the token the ticket stands for. The ticket is removed so it can't be used again.
+func RedeemStreamTicket(ticket string) (string, error) {
+	if ticket == "" {
+		return "", errors.New("Empty stream ticket")
+	}
+
+	encryptedToken, err := GetStorage().DeleteStreamTicket(getStreamTicketKey(ticket))
+	if err != nil {
+		log.Debug("Redeem stream ticket error: %s", err)
+		return "", errors.New("Stream ticket is incorrect, used or expired")
+	}
+
+	token, err := secret.Decrypt(encryptedToken)
+	if err != nil {
+		log.Error("Decrypt token of stream ticket error: %s", err)
+		return "", err
+	}
+
+	return token, nil
+}
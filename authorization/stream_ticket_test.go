@@ -0,0 +1,33 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"testing"
+)
+
+func TestRedeemStreamTicket(t *testing.T) {
+	if _, err := RedeemStreamTicket(""); err == nil {
+		t.Error("The empty ticket should be rejected")
+	}
+
+	key := getStreamTicketKey("ticket")
+	if key == "ticket" || key != getStreamTicketKey("ticket") {
+		t.Errorf("The ticket should be stored as its hash but get %s", key)
+	}
+	if key == getStreamTicketKey("other") {
+		t.Error("The different tickets should have the different keys")
+	}
+}
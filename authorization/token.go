@@ -15,29 +15,41 @@
 package authorization
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"github.com/cloudawan/cloudone_utility/rbac"
 	jwt "github.com/dgrijalva/jwt-go"
-	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	signingKey         = "userTokenKey"
+	systemUsername     = "system"
+	defaultPassword    = "password"
 	cacheCheckInterval = time.Minute
 	cacheTTL           = cacheCheckInterval * 60
 )
 
-var SystemAdminToken string = ""
+// The system token is replaced when the signing key changes so it is read with GetSystemAdminToken
+var systemAdminToken string = ""
+var systemAdminTokenMutex = &sync.RWMutex{}
+
+func GetSystemAdminToken() string {
+	systemAdminTokenMutex.RLock()
+	defer systemAdminTokenMutex.RUnlock()
+	return systemAdminToken
+}
 
 func init() {
 	createDefaultUser()
+	initializeSigningKey()
 	createSystemUserInMemory()
 	periodicallyCleanCache()
 }
 
 func createDefaultUser() {
-	user, _ := GetStorage().LoadUser("admin")
+	user, _ := GetStorage().LoadUser(defaultUsername)
 	if user == nil {
 		permission := &rbac.Permission{"all", "*", "*", "*"}
 		permissionSlice := make([]*rbac.Permission, 0)
@@ -49,12 +61,23 @@ func createDefaultUser() {
 		resourceSlice := make([]*rbac.Resource, 0)
 		resourceSlice = append(resourceSlice, resource)
 		metaDataMap := make(map[string]string)
-		user := rbac.CreateUser("admin", "password", roleSlice, resourceSlice, "admin", metaDataMap, nil, false)
+		// The seeded password is well known so it has to be changed before the first login
+		metaDataMap[metaDataKeyPasswordChangeRequired] = "true"
+		user := rbac.CreateUser(defaultUsername, defaultPassword, roleSlice, resourceSlice, "admin", metaDataMap, nil, false)
 
 		if err := GetStorage().SaveRole(role); err != nil {
 			log.Critical(err)
 		}
 
+		if err := GetStorage().SaveUser(user); err != nil {
+			log.Critical(err)
+		}
+	} else if user.CheckPassword(defaultPassword) && isPasswordChangeRequired(user) == false {
+		// Seeded before the change is forced
+		if user.MetaDataMap == nil {
+			user.MetaDataMap = make(map[string]string)
+		}
+		user.MetaDataMap[metaDataKeyPasswordChangeRequired] = "true"
 		if err := GetStorage().SaveUser(user); err != nil {
 			log.Critical(err)
 		}
@@ -73,19 +96,21 @@ func createSystemUserInMemory() {
 	resourceSlice = append(resourceSlice, resource)
 	metaDataMap := make(map[string]string)
 	// Use time as password and have it encrypted so no one other than system could use
-	user := rbac.CreateUser("system", time.Now().String(), roleSlice, resourceSlice, "system-admin", metaDataMap, nil, false)
+	user := rbac.CreateUser(systemUsername, time.Now().String(), roleSlice, resourceSlice, "system-admin", metaDataMap, nil, false)
 
 	// Set the duration to 100 years
 	duration := time.Duration(time.Hour * 24 * 365 * 100)
 
-	token, err := generateToken(user, duration)
+	// The system token is used only by this instance so it is not persisted
+	token, err := signToken(user, duration, false)
 	if err != nil {
 		log.Critical(err)
 		return
 	}
 
-	rbac.SetCache(token, user, duration)
-	SystemAdminToken = token
+	systemAdminTokenMutex.Lock()
+	systemAdminToken = token
+	systemAdminTokenMutex.Unlock()
 }
 
 var closed bool = false
@@ -103,18 +128,36 @@ func periodicallyCleanCache() {
 
 			rbac.CheckCacheTimeout()
 
+			if err := reloadSigningKey(); err != nil {
+				log.Error(err)
+			}
+
+			if err := synchronizeAcceptedToken(); err != nil {
+				log.Error(err)
+			}
+
+			cleanAPIKeyCache()
+
+			cleanLoginFailure()
+
 			time.Sleep(cacheCheckInterval)
 		}
 	}()
 }
 
 func GetUserFromToken(token string) (*rbac.User, error) {
-	_, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("Unexpected signing method")
+	if isAPIKey(token) {
+		return getUserFromAPIKey(token)
+	}
+
+	if isTokenAccepted(token) {
+		user := rbac.GetCache(token)
+		if user != nil {
+			return user, nil
 		}
+	}
 
+	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		expiredText, _ := token.Claims["expired"].(string)
 
 		expiredTime, err := time.Parse(time.RFC3339, expiredText)
@@ -127,65 +170,116 @@ func GetUserFromToken(token string) (*rbac.User, error) {
 			log.Debug("Token is expired. Token %v ", token)
 			return nil, errors.New("Token is expired")
 		}
-		return []byte(signingKey), nil
+
+		// The key is selected with the kid header and the alg is validated
+		return getVerifyKey(token)
 	})
 
 	if err != nil {
 		return nil, err
-	} else {
-		user := rbac.GetCache(token)
-		if user != nil {
-			return user, nil
-		} else {
-			log.Error("User not in the cache. Token %v", token)
-			return nil, errors.New("User not in the cache")
-		}
 	}
+
+	// Not in the cache so look up the token record in the storage
+	id, _ := parsedToken.Claims["jti"].(string)
+	return loadUserWithTokenRecord(token, id)
 }
 
-func CreateToken(name string, password string) (string, error) {
-	user, err := GetStorage().LoadUser(name)
+func CreateToken(name string, password string, remoteAddress string) (string, error) {
+	if err := checkLoginAllowed(name, remoteAddress); err != nil {
+		return "", err
+	}
+
+	authenticationProvider, err := GetAuthenticationProvider(name)
 	if err != nil {
-		if strings.Contains(err.Error(), "Key not found") {
-			return "", errors.New("User doesn't exist")
-		} else {
-			log.Error(err)
-			return "", err
+		return "", err
+	}
+
+	user, err := authenticationProvider.Authenticate(name, password)
+	if err != nil {
+		if err == errorIncorrectCredential {
+			recordLoginFailure(name, remoteAddress)
 		}
+		return "", err
 	}
+	recordLoginSuccess(name)
 
-	if user.CheckPassword(password) == false {
-		log.Error("Incorrect User %s or Password %s", name, password)
-		return "", errors.New("Incorrect Password")
+	if isPasswordChangeRequired(user) {
+		log.Error("User %s is required to change the password", name)
+		return "", &PasswordChangeRequiredError{}
 	}
 
+	return issueToken(user, authenticationProvider.IsUserPersistent())
+}
+
+func issueToken(user *rbac.User, persistent bool) (string, error) {
 	if user.ExpiredTime != nil && time.Now().After(*user.ExpiredTime) {
-		log.Error("User %s is expired", name)
+		log.Error("User %s is expired", user.Name)
 		return "", errors.New("User is expired")
 	}
 
 	if user.Disabled {
-		log.Error("User %s is disabled", name)
+		log.Error("User %s is disabled", user.Name)
 		return "", errors.New("User is disabled")
 	}
 
-	return generateToken(user, cacheTTL)
+	if persistent {
+		return generateToken(user, cacheTTL)
+	} else {
+		// The user only exists in this instance so the token is not accepted by the others
+		return signToken(user, cacheTTL, false)
+	}
 }
 
 func generateToken(user *rbac.User, duration time.Duration) (string, error) {
+	return signToken(user, duration, true)
+}
+
+func signToken(user *rbac.User, duration time.Duration, persistent bool) (string, error) {
+	signingKey, err := getCurrentSigningKey()
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	idByteSlice := make([]byte, 16)
+	if _, err := rand.Read(idByteSlice); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	currentTime := time.Now()
+	tokenRecord := &TokenRecord{
+		hex.EncodeToString(idByteSlice),
+		user.Name,
+		currentTime,
+		currentTime.Add(duration),
+	}
+
 	// Create the token
-	token := jwt.New(jwt.SigningMethodHS512)
+	token := jwt.New(jwt.GetSigningMethod(signingKey.signingKey.Algorithm))
+	token.Header["kid"] = signingKey.signingKey.ID
 	// Set some claims
+	token.Claims["jti"] = tokenRecord.ID
 	token.Claims["username"] = user.Name
-	token.Claims["expired"] = time.Now().Add(duration).Format(time.RFC3339)
+	token.Claims["expired"] = tokenRecord.ExpiredTime.Format(time.RFC3339)
 	// Sign
-	signedToken, err := token.SignedString([]byte(signingKey))
+	signedToken, err := token.SignedString(signingKey.signKey)
 	if err != nil {
 		log.Error(err)
 		return "", err
 	}
 
-	rbac.SetCache(signedToken, user, cacheTTL)
+	inMemoryOnly := true
+	if persistent {
+		if err := GetStorage().SaveTokenRecord(tokenRecord); err != nil {
+			// Still usable in this instance
+			log.Error("Save token record %s of user %s error: %s", tokenRecord.ID, user.Name, err)
+		} else {
+			inMemoryOnly = false
+		}
+	}
+
+	rbac.SetCache(signedToken, user, duration)
+	addAcceptedToken(signedToken, tokenRecord, inMemoryOnly)
 
 	// Sign and get the complete encoded token as a string
 	return signedToken, nil
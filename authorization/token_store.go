@@ -0,0 +1,199 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"github.com/coreos/etcd/client"
+	"sync"
+	"time"
+)
+
+// Persisted so the token issued by one instance is accepted by the others and survives the restart
+type TokenRecord struct {
+	ID          string // The jti claim
+	Username    string
+	CreatedTime time.Time
+	ExpiredTime time.Time
+}
+
+type acceptedToken struct {
+	tokenRecord  TokenRecord
+	inMemoryOnly bool
+}
+
+// The tokens accepted by this instance. The token removed from here is revoked even if it is still in the rbac cache.
+var acceptedTokenMutex = &sync.RWMutex{}
+var acceptedTokenMap = make(map[string]acceptedToken)
+
+func addAcceptedToken(token string, tokenRecord *TokenRecord, inMemoryOnly bool) {
+	acceptedTokenMutex.Lock()
+	defer acceptedTokenMutex.Unlock()
+	acceptedTokenMap[token] = acceptedToken{*tokenRecord, inMemoryOnly}
+}
+
+func isTokenAccepted(token string) bool {
+	acceptedTokenMutex.RLock()
+	defer acceptedTokenMutex.RUnlock()
+	acceptedToken, ok := acceptedTokenMap[token]
+	return ok && acceptedToken.tokenRecord.ExpiredTime.After(time.Now())
+}
+
+func removeAcceptedToken(token string) {
+	acceptedTokenMutex.Lock()
+	defer acceptedTokenMutex.Unlock()
+	delete(acceptedTokenMap, token)
+}
+
+// Load the token issued by the other instance or before the restart
+func loadUserWithTokenRecord(token string, id string) (*rbac.User, error) {
+	if id == "" {
+		return nil, errors.New("Token has no id")
+	}
+
+	tokenRecord, err := GetStorage().LoadTokenRecord(id)
+	if err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code == client.ErrorCodeKeyNotFound {
+			return nil, errors.New("Token is revoked or expired")
+		}
+		log.Error(err)
+		return nil, err
+	}
+	if tokenRecord.ExpiredTime.Before(time.Now()) {
+		return nil, errors.New("Token is expired")
+	}
+
+	user, err := GetStorage().LoadUser(tokenRecord.Username)
+	if err != nil {
+		log.Error("Load user %s of token %s error: %s", tokenRecord.Username, id, err)
+		return nil, err
+	}
+	if user.ExpiredTime != nil && time.Now().After(*user.ExpiredTime) {
+		return nil, errors.New("User is expired")
+	}
+	if user.Disabled {
+		return nil, errors.New("User is disabled")
+	}
+
+	rbac.SetCache(token, user, tokenRecord.ExpiredTime.Sub(time.Now()))
+	addAcceptedToken(token, tokenRecord, false)
+
+	return user, nil
+}
+
+// Drop the local tokens revoked by the other instances
+func synchronizeAcceptedToken() error {
+	tokenRecordSlice, err := GetStorage().LoadAllTokenRecord()
+	if err != nil {
+		log.Error("Load all token record error: %s", err)
+		return err
+	}
+
+	existingIDMap := make(map[string]bool)
+	for _, tokenRecord := range tokenRecordSlice {
+		existingIDMap[tokenRecord.ID] = true
+	}
+
+	acceptedTokenMutex.Lock()
+	defer acceptedTokenMutex.Unlock()
+	for token, acceptedToken := range acceptedTokenMap {
+		if acceptedToken.tokenRecord.ExpiredTime.Before(time.Now()) {
+			delete(acceptedTokenMap, token)
+		} else if acceptedToken.inMemoryOnly == false && existingIDMap[acceptedToken.tokenRecord.ID] == false {
+			delete(acceptedTokenMap, token)
+		}
+	}
+
+	return nil
+}
+
+// Logout
+func RevokeToken(token string) error {
+	if isAPIKey(token) {
+		return errors.New("API key can't be used to logout")
+	}
+
+	// Load the token issued by the other instance
+	if _, err := GetUserFromToken(token); err != nil {
+		return err
+	}
+
+	acceptedTokenMutex.RLock()
+	acceptedToken, ok := acceptedTokenMap[token]
+	acceptedTokenMutex.RUnlock()
+	if ok == false {
+		return errors.New("Token doesn't exist")
+	}
+	if acceptedToken.inMemoryOnly && acceptedToken.tokenRecord.Username == systemUsername {
+		return errors.New("System token can't be revoked")
+	}
+
+	removeAcceptedToken(token)
+
+	if err := GetStorage().DeleteTokenRecord(acceptedToken.tokenRecord.ID); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// The local tokens including the ones failed to be persisted are revoked first so they are gone even if the storage fails
+func RevokeAllTokenForUser(username string) error {
+	acceptedTokenMutex.Lock()
+	for token, acceptedToken := range acceptedTokenMap {
+		if acceptedToken.inMemoryOnly && acceptedToken.tokenRecord.Username == systemUsername {
+			// System token can't be revoked
+			continue
+		}
+		if acceptedToken.tokenRecord.Username == username {
+			delete(acceptedTokenMap, token)
+		}
+	}
+	acceptedTokenMutex.Unlock()
+
+	tokenRecordSlice, err := GetAllTokenRecordForUser(username)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for _, tokenRecord := range tokenRecordSlice {
+		if err := GetStorage().DeleteTokenRecord(tokenRecord.ID); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetAllTokenRecordForUser(username string) ([]TokenRecord, error) {
+	tokenRecordSlice, err := GetStorage().LoadAllTokenRecord()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	filteredTokenRecordSlice := make([]TokenRecord, 0)
+	for _, tokenRecord := range tokenRecordSlice {
+		if tokenRecord.Username == username {
+			filteredTokenRecordSlice = append(filteredTokenRecordSlice, tokenRecord)
+		}
+	}
+	return filteredTokenRecordSlice, nil
+}
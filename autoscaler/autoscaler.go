@@ -19,7 +19,9 @@ import (
 	"errors"
 	"github.com/cloudawan/cloudone/control"
 	"github.com/cloudawan/cloudone/deploy"
+	"github.com/cloudawan/cloudone/event"
 	"github.com/cloudawan/cloudone/monitor"
+	"strconv"
 	"time"
 )
 
@@ -113,6 +115,7 @@ func CheckAndExecuteAutoScalerOnReplicationController(replicationControllerAutoS
 
 		// Change deployment data
 		if resized {
+			publishAutoScalerResize(replicationControllerAutoScaler, replicationControllerName, size)
 			if err := deploy.ChangeDeployInformationReplicaAmount(replicationControllerAutoScaler.Namespace, replicationControllerName, size); err != nil {
 				log.Error(err)
 			}
@@ -127,6 +130,7 @@ func CheckAndExecuteAutoScalerOnReplicationController(replicationControllerAutoS
 
 		// Change deployment data
 		if resized {
+			publishAutoScalerResize(replicationControllerAutoScaler, replicationControllerName, size)
 			if err := deploy.ChangeDeployInformationReplicaAmount(replicationControllerAutoScaler.Namespace, replicationControllerName, size); err != nil {
 				log.Error(err)
 			}
@@ -145,9 +149,18 @@ func CheckAndExecuteAutoScalerOnDeployImageInformation(replicationControllerAuto
 		return false, -1, err
 	}
 
-	replicationControllerName := deployInformation.ImageInformationName + deployInformation.CurrentVersion
+	podOwnerName, err := deploy.GetPodOwnerName(replicationControllerAutoScaler.KubeApiServerEndPoint, replicationControllerAutoScaler.KubeApiServerToken, deployInformation)
+	if err != nil {
+		log.Error("Get pod owner name failure: %s where replicationControllerAutoScaler %v", err.Error(), replicationControllerAutoScaler)
+		return false, -1, err
+	}
 
-	replicationControllerMetric, err := monitor.MonitorReplicationController(replicationControllerAutoScaler.KubeApiServerEndPoint, replicationControllerAutoScaler.KubeApiServerToken, replicationControllerAutoScaler.Namespace, replicationControllerName)
+	var replicationControllerMetric *monitor.ReplicationControllerMetric
+	if deployInformation.GetWorkloadKind() == deploy.WorkloadKindDeployment {
+		replicationControllerMetric, err = monitor.MonitorReplicaSet(replicationControllerAutoScaler.KubeApiServerEndPoint, replicationControllerAutoScaler.KubeApiServerToken, replicationControllerAutoScaler.Namespace, podOwnerName)
+	} else {
+		replicationControllerMetric, err = monitor.MonitorReplicationController(replicationControllerAutoScaler.KubeApiServerEndPoint, replicationControllerAutoScaler.KubeApiServerToken, replicationControllerAutoScaler.Namespace, podOwnerName)
+	}
 	if err != nil {
 		log.Error("Get ReplicationController data failure: %s where replicationControllerAutoScaler %v", err.Error(), replicationControllerAutoScaler)
 	}
@@ -179,6 +192,7 @@ func CheckAndExecuteAutoScalerOnDeployImageInformation(replicationControllerAuto
 		if err != nil {
 			return false, deployInformation.ReplicaAmount, err
 		} else {
+			publishAutoScalerResize(replicationControllerAutoScaler, replicationControllerAutoScaler.Name, newSize)
 			return true, newSize, err
 		}
 	} else if toDecrease && deployInformation.ReplicaAmount > replicationControllerAutoScaler.MinimumReplica {
@@ -193,9 +207,18 @@ func CheckAndExecuteAutoScalerOnDeployImageInformation(replicationControllerAuto
 		if err != nil {
 			return false, deployInformation.ReplicaAmount, err
 		} else {
+			publishAutoScalerResize(replicationControllerAutoScaler, replicationControllerAutoScaler.Name, newSize)
 			return true, newSize, err
 		}
 	} else {
 		return false, deployInformation.ReplicaAmount, nil
 	}
 }
+
+func publishAutoScalerResize(replicationControllerAutoScaler *ReplicationControllerAutoScaler, name string, size int) {
+	dataMap := make(map[string]interface{})
+	dataMap["Kind"] = replicationControllerAutoScaler.Kind
+	dataMap["Size"] = size
+	event.Publish(event.KindAutoScalerResize, replicationControllerAutoScaler.Namespace, name,
+		"Auto scaler resizes "+name+" to "+strconv.Itoa(size), dataMap)
+}
@@ -0,0 +1,482 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_utility/deepcopy"
+	"github.com/cloudawan/cloudone_utility/jsonparse"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"github.com/cloudawan/cloudone_utility/restclient"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// The label telling the pods of the deployments from the ones of the replication controllers with the same name label
+	WorkloadLabelName       = "workload"
+	WorkloadLabelDeployment = "deployment"
+)
+
+const (
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	// The label added by Kubernetes to the pod template of each replica set
+	podTemplateHashLabelName = "pod-template-hash"
+)
+
+type Deployment struct {
+	Name           string
+	ReplicaAmount  int
+	Selector       ReplicationControllerSelector // The pods are selected by the name. The version is only the label of the pods.
+	ContainerSlice []ReplicationControllerContainer
+	ExtraJsonMap   map[string]interface{}
+}
+
+type DeploymentStatus struct {
+	Name                   string
+	Image                  string
+	Version                string
+	Revision               int
+	ReplicaAmount          int
+	UpdatedReplicaAmount   int
+	ReadyReplicaAmount     int
+	AvailableReplicaAmount int
+	Complete               bool // All the pods run the latest pod template and are available
+	Failed                 bool // The progress deadline is exceeded
+	Message                string
+}
+
+type DeploymentRevision struct {
+	Revision       int
+	ReplicaSetName string
+	Image          string
+	Version        string
+	ReplicaAmount  int
+	CreatedTime    time.Time
+}
+
+type deploymentRevisionSorter []DeploymentRevision
+
+func (deploymentRevisionSlice deploymentRevisionSorter) Len() int {
+	return len(deploymentRevisionSlice)
+}
+
+// The latest revision first
+func (deploymentRevisionSlice deploymentRevisionSorter) Less(i, j int) bool {
+	return deploymentRevisionSlice[i].Revision > deploymentRevisionSlice[j].Revision
+}
+
+func (deploymentRevisionSlice deploymentRevisionSorter) Swap(i, j int) {
+	deploymentRevisionSlice[i], deploymentRevisionSlice[j] = deploymentRevisionSlice[j], deploymentRevisionSlice[i]
+}
+
+func getDeploymentURL(kubeApiServerEndPoint string, namespace string) string {
+	return kubeApiServerEndPoint + "/apis/apps/v1/namespaces/" + namespace + "/deployments/"
+}
+
+func CreateDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deployment Deployment) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("CreateDeployment Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	selectorJsonMap := make(map[string]interface{})
+	selectorJsonMap["name"] = deployment.Selector.Name
+	selectorJsonMap[WorkloadLabelName] = WorkloadLabelDeployment
+
+	podLabelJsonMap := make(map[string]interface{})
+	podLabelJsonMap["name"] = deployment.Selector.Name
+	podLabelJsonMap["version"] = deployment.Selector.Version
+	podLabelJsonMap[WorkloadLabelName] = WorkloadLabelDeployment
+
+	bodyJsonMap := make(map[string]interface{})
+	bodyJsonMap["kind"] = "Deployment"
+	bodyJsonMap["apiVersion"] = "apps/v1"
+	bodyJsonMap["metadata"] = make(map[string]interface{})
+	bodyJsonMap["metadata"].(map[string]interface{})["name"] = deployment.Name
+	bodyJsonMap["metadata"].(map[string]interface{})["labels"] = make(map[string]interface{})
+	bodyJsonMap["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["name"] = deployment.Name
+	bodyJsonMap["spec"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["replicas"] = deployment.ReplicaAmount
+	bodyJsonMap["spec"].(map[string]interface{})["selector"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["selector"].(map[string]interface{})["matchLabels"] = selectorJsonMap
+	bodyJsonMap["spec"].(map[string]interface{})["template"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"] = podLabelJsonMap
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"] = getPodSpecJsonMap(deployment.ContainerSlice)
+
+	// Configure extra json body
+	// It is used for user to input any configuration
+	if deployment.ExtraJsonMap != nil {
+		deepcopy.DeepOverwriteJsonMap(deployment.ExtraJsonMap, bodyJsonMap)
+	}
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	_, err := restclient.RequestPost(getDeploymentURL(kubeApiServerEndPoint, namespace), bodyJsonMap, headerMap, true)
+	return err
+}
+
+// The replica sets and the pods are deleted by Kubernetes before the deployment
+func DeleteDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deploymentName string) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("DeleteDeployment Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	bodyJsonMap := make(map[string]interface{})
+	bodyJsonMap["kind"] = "DeleteOptions"
+	bodyJsonMap["apiVersion"] = "v1"
+	bodyJsonMap["propagationPolicy"] = "Foreground"
+
+	_, err := restclient.RequestDelete(getDeploymentURL(kubeApiServerEndPoint, namespace)+deploymentName, bodyJsonMap, headerMap, true)
+	return err
+}
+
+func GetAllDeploymentName(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string) (returnedNameSlice []string, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetAllDeploymentName Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedNameSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	result, err := restclient.RequestGet(getDeploymentURL(kubeApiServerEndPoint, namespace), headerMap, true)
+	if err != nil {
+		return nil, err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+
+	nameSlice := make([]string, 0)
+	itemSlice, _ := jsonMap["items"].([]interface{})
+	for _, item := range itemSlice {
+		itemJsonMap, _ := item.(map[string]interface{})
+		metadataJsonMap, _ := itemJsonMap["metadata"].(map[string]interface{})
+		name, ok := metadataJsonMap["name"].(string)
+		if ok {
+			nameSlice = append(nameSlice, name)
+		}
+	}
+	return nameSlice, nil
+}
+
+func GetDeploymentStatus(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deploymentName string) (returnedDeploymentStatus *DeploymentStatus, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetDeploymentStatus Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedDeploymentStatus = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	result, err := restclient.RequestGet(getDeploymentURL(kubeApiServerEndPoint, namespace)+deploymentName, headerMap, true)
+	if err != nil {
+		return nil, err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+
+	return parseDeploymentStatus(jsonMap), nil
+}
+
+func parseDeploymentStatus(jsonMap map[string]interface{}) *DeploymentStatus {
+	metadataJsonMap, _ := jsonMap["metadata"].(map[string]interface{})
+	annotationJsonMap, _ := metadataJsonMap["annotations"].(map[string]interface{})
+	specJsonMap, _ := jsonMap["spec"].(map[string]interface{})
+	statusJsonMap, _ := jsonMap["status"].(map[string]interface{})
+
+	deploymentStatus := &DeploymentStatus{}
+	deploymentStatus.Name, _ = metadataJsonMap["name"].(string)
+	revisionText, _ := annotationJsonMap[deploymentRevisionAnnotation].(string)
+	deploymentStatus.Revision, _ = strconv.Atoi(revisionText)
+
+	deploymentStatus.Image, deploymentStatus.Version = getPodTemplateImageAndVersion(specJsonMap)
+
+	replicas, _ := jsonparse.ConvertToInt64(specJsonMap["replicas"])
+	deploymentStatus.ReplicaAmount = int(replicas)
+	currentReplicas, _ := jsonparse.ConvertToInt64(statusJsonMap["replicas"])
+	updatedReplicas, _ := jsonparse.ConvertToInt64(statusJsonMap["updatedReplicas"])
+	deploymentStatus.UpdatedReplicaAmount = int(updatedReplicas)
+	readyReplicas, _ := jsonparse.ConvertToInt64(statusJsonMap["readyReplicas"])
+	deploymentStatus.ReadyReplicaAmount = int(readyReplicas)
+	availableReplicas, _ := jsonparse.ConvertToInt64(statusJsonMap["availableReplicas"])
+	deploymentStatus.AvailableReplicaAmount = int(availableReplicas)
+
+	generation, _ := jsonparse.ConvertToInt64(metadataJsonMap["generation"])
+	observedGeneration, _ := jsonparse.ConvertToInt64(statusJsonMap["observedGeneration"])
+
+	// The same as kubectl rollout status
+	deploymentStatus.Complete = observedGeneration >= generation &&
+		updatedReplicas == replicas && currentReplicas == replicas && availableReplicas == replicas
+
+	conditionSlice, _ := statusJsonMap["conditions"].([]interface{})
+	for _, condition := range conditionSlice {
+		conditionJsonMap, _ := condition.(map[string]interface{})
+		conditionType, _ := conditionJsonMap["type"].(string)
+		reason, _ := conditionJsonMap["reason"].(string)
+		if conditionType == "Progressing" {
+			deploymentStatus.Message, _ = conditionJsonMap["message"].(string)
+			deploymentStatus.Failed = reason == "ProgressDeadlineExceeded"
+		}
+	}
+
+	return deploymentStatus
+}
+
+// The image of the first container and the version label of the pod template
+func getPodTemplateImageAndVersion(specJsonMap map[string]interface{}) (string, string) {
+	templateJsonMap, _ := specJsonMap["template"].(map[string]interface{})
+	templateMetadataJsonMap, _ := templateJsonMap["metadata"].(map[string]interface{})
+	labelJsonMap, _ := templateMetadataJsonMap["labels"].(map[string]interface{})
+	version, _ := labelJsonMap["version"].(string)
+
+	templateSpecJsonMap, _ := templateJsonMap["spec"].(map[string]interface{})
+	containerSlice, _ := templateSpecJsonMap["containers"].([]interface{})
+	image := ""
+	if len(containerSlice) > 0 {
+		containerJsonMap, _ := containerSlice[0].(map[string]interface{})
+		image, _ = containerJsonMap["image"].(string)
+	}
+	return image, version
+}
+
+func UpdateDeploymentSize(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deploymentName string, size int) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("UpdateDeploymentSize Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := getDeploymentURL(kubeApiServerEndPoint, namespace) + deploymentName
+	result, err := restclient.RequestGet(url, headerMap, true)
+	jsonMap, _ := result.(map[string]interface{})
+	if err != nil {
+		log.Error("Get deployment information failure where size: %d, endpoint: %s, namespace: %s, deploymentName: %s, err: %s", size, kubeApiServerEndPoint, namespace, deploymentName, err.Error())
+		return err
+	}
+
+	jsonMap["spec"].(map[string]interface{})["replicas"] = float64(size)
+	_, err = restclient.RequestPut(url, jsonMap, headerMap, true)
+	return err
+}
+
+// Change the image and the version of the only container so Kubernetes replaces the pods with the rolling update
+func RollingUpdateDeploymentWithSingleContainer(
+	kubeApiServerEndPoint string, kubeApiServerToken string,
+	namespace string, deploymentName string, newImage string, newVersion string,
+	environmentSlice []ReplicationControllerContainerEnvironment) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("RollingUpdateDeploymentWithSingleContainer Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := getDeploymentURL(kubeApiServerEndPoint, namespace) + deploymentName
+	result, err := restclient.RequestGet(url, headerMap, true)
+	jsonMap, _ := result.(map[string]interface{})
+	if err != nil {
+		log.Error("Get deployment endpoint: %s, namespace: %s, deploymentName: %s, error: %s", kubeApiServerEndPoint, namespace, deploymentName, err)
+		return err
+	}
+
+	templateJsonMap := jsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})
+	templateJsonMap["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["version"] = newVersion
+
+	containerJsonMap := templateJsonMap["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	containerJsonMap["image"] = newImage
+	environmentJsonMapSlice := make([]interface{}, 0)
+	for _, environment := range environmentSlice {
+		environmentJsonMap := make(map[string]interface{})
+		environmentJsonMap["name"] = environment.Name
+		environmentJsonMap["value"] = environment.Value
+		environmentJsonMapSlice = append(environmentJsonMapSlice, environmentJsonMap)
+	}
+	containerJsonMap["env"] = environmentJsonMapSlice
+
+	_, err = restclient.RequestPut(url, jsonMap, headerMap, true)
+	return err
+}
+
+// Wait until all the pods run the latest pod template and are available
+func WaitDeploymentRollout(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deploymentName string, waitingDuration time.Duration, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		deploymentStatus, err := GetDeploymentStatus(kubeApiServerEndPoint, kubeApiServerToken, namespace, deploymentName)
+		if err != nil {
+			log.Error("Get deployment %s status in namespace %s error: %s", deploymentName, namespace, err)
+			return err
+		}
+		if deploymentStatus.Complete {
+			return nil
+		}
+		if deploymentStatus.Failed {
+			return errors.New("Deployment " + deploymentName + " rollout failed: " + deploymentStatus.Message)
+		}
+		if time.Now().After(deadline) {
+			return errors.New("Deployment " + deploymentName + " rollout is not complete in " + timeout.String())
+		}
+		time.Sleep(waitingDuration)
+	}
+}
+
+// The replica sets owned by the deployment with the latest revision first
+func GetDeploymentRevisionSlice(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deploymentName string) (returnedDeploymentRevisionSlice []DeploymentRevision, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetDeploymentRevisionSlice Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedDeploymentRevisionSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	replicaSetJsonMapSlice, err := getDeploymentReplicaSetJsonMapSlice(kubeApiServerEndPoint, kubeApiServerToken, namespace, deploymentName)
+	if err != nil {
+		return nil, err
+	}
+
+	deploymentRevisionSlice := make([]DeploymentRevision, 0)
+	for _, replicaSetJsonMap := range replicaSetJsonMapSlice {
+		metadataJsonMap, _ := replicaSetJsonMap["metadata"].(map[string]interface{})
+		annotationJsonMap, _ := metadataJsonMap["annotations"].(map[string]interface{})
+		specJsonMap, _ := replicaSetJsonMap["spec"].(map[string]interface{})
+
+		deploymentRevision := DeploymentRevision{}
+		revisionText, _ := annotationJsonMap[deploymentRevisionAnnotation].(string)
+		deploymentRevision.Revision, _ = strconv.Atoi(revisionText)
+		deploymentRevision.ReplicaSetName, _ = metadataJsonMap["name"].(string)
+		deploymentRevision.Image, deploymentRevision.Version = getPodTemplateImageAndVersion(specJsonMap)
+		replicas, _ := jsonparse.ConvertToInt64(specJsonMap["replicas"])
+		deploymentRevision.ReplicaAmount = int(replicas)
+		creationTimestamp, _ := metadataJsonMap["creationTimestamp"].(string)
+		deploymentRevision.CreatedTime, _ = time.Parse(time.RFC3339, creationTimestamp)
+
+		deploymentRevisionSlice = append(deploymentRevisionSlice, deploymentRevision)
+	}
+	sort.Sort(deploymentRevisionSorter(deploymentRevisionSlice))
+
+	return deploymentRevisionSlice, nil
+}
+
+func getDeploymentReplicaSetJsonMapSlice(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deploymentName string) ([]map[string]interface{}, error) {
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/apis/apps/v1/namespaces/" + namespace + "/replicasets/"
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		log.Error("Get replica sets in namespace %s error: %s", namespace, err)
+		return nil, err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+
+	replicaSetJsonMapSlice := make([]map[string]interface{}, 0)
+	itemSlice, _ := jsonMap["items"].([]interface{})
+	for _, item := range itemSlice {
+		itemJsonMap, _ := item.(map[string]interface{})
+		metadataJsonMap, _ := itemJsonMap["metadata"].(map[string]interface{})
+		ownerReferenceSlice, _ := metadataJsonMap["ownerReferences"].([]interface{})
+		for _, ownerReference := range ownerReferenceSlice {
+			ownerReferenceJsonMap, _ := ownerReference.(map[string]interface{})
+			kind, _ := ownerReferenceJsonMap["kind"].(string)
+			name, _ := ownerReferenceJsonMap["name"].(string)
+			if kind == "Deployment" && name == deploymentName {
+				replicaSetJsonMapSlice = append(replicaSetJsonMapSlice, itemJsonMap)
+				break
+			}
+		}
+	}
+	return replicaSetJsonMapSlice, nil
+}
+
+// Use the pod template of the revision again as kubectl rollout undo does. It becomes the latest revision.
+func RollbackDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, deploymentName string, revision int) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("RollbackDeployment Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	replicaSetJsonMapSlice, err := getDeploymentReplicaSetJsonMapSlice(kubeApiServerEndPoint, kubeApiServerToken, namespace, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	var templateJsonMap map[string]interface{} = nil
+	for _, replicaSetJsonMap := range replicaSetJsonMapSlice {
+		metadataJsonMap, _ := replicaSetJsonMap["metadata"].(map[string]interface{})
+		annotationJsonMap, _ := metadataJsonMap["annotations"].(map[string]interface{})
+		revisionText, _ := annotationJsonMap[deploymentRevisionAnnotation].(string)
+		if revisionText == strconv.Itoa(revision) {
+			specJsonMap, _ := replicaSetJsonMap["spec"].(map[string]interface{})
+			templateJsonMap, _ = specJsonMap["template"].(map[string]interface{})
+			break
+		}
+	}
+	if templateJsonMap == nil {
+		return errors.New("No such revision " + strconv.Itoa(revision) + " of deployment " + deploymentName)
+	}
+
+	// The hash is added by Kubernetes to the replica set and not part of the deployment
+	templateMetadataJsonMap, _ := templateJsonMap["metadata"].(map[string]interface{})
+	labelJsonMap, _ := templateMetadataJsonMap["labels"].(map[string]interface{})
+	delete(labelJsonMap, podTemplateHashLabelName)
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := getDeploymentURL(kubeApiServerEndPoint, namespace) + deploymentName
+	result, err := restclient.RequestGet(url, headerMap, true)
+	jsonMap, _ := result.(map[string]interface{})
+	if err != nil {
+		log.Error("Get deployment endpoint: %s, namespace: %s, deploymentName: %s, error: %s", kubeApiServerEndPoint, namespace, deploymentName, err)
+		return err
+	}
+
+	jsonMap["spec"].(map[string]interface{})["template"] = templateJsonMap
+	_, err = restclient.RequestPut(url, jsonMap, headerMap, true)
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+func TestParseDeploymentStatus(t *testing.T) {
+	text := `{
+		"metadata": {"name": "web", "generation": 3, "annotations": {"deployment.kubernetes.io/revision": "2"}},
+		"spec": {
+			"replicas": 2,
+			"template": {
+				"metadata": {"labels": {"name": "web", "version": "v2", "workload": "deployment"}},
+				"spec": {"containers": [{"name": "web", "image": "registry/web:v2"}]}
+			}
+		},
+		"status": {
+			"observedGeneration": 3, "replicas": 2, "updatedReplicas": 2, "readyReplicas": 2, "availableReplicas": 2,
+			"conditions": [{"type": "Progressing", "reason": "NewReplicaSetAvailable", "message": "Rolled out"}]
+		}
+	}`
+	jsonMap := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(text), &jsonMap); err != nil {
+		t.Fatal(err)
+	}
+
+	deploymentStatus := parseDeploymentStatus(jsonMap)
+	if deploymentStatus.Name != "web" || deploymentStatus.Revision != 2 ||
+		deploymentStatus.Image != "registry/web:v2" || deploymentStatus.Version != "v2" ||
+		deploymentStatus.ReplicaAmount != 2 || deploymentStatus.AvailableReplicaAmount != 2 {
+		t.Errorf("Incorrect deployment status %v", deploymentStatus)
+	}
+	if deploymentStatus.Complete == false || deploymentStatus.Failed {
+		t.Errorf("The deployment with all the replicas updated and available should be complete but get %v", deploymentStatus)
+	}
+
+	// The old replica set is still scaling down
+	statusJsonMap := jsonMap["status"].(map[string]interface{})
+	statusJsonMap["replicas"] = 3
+	conditionJsonMap := statusJsonMap["conditions"].([]interface{})[0].(map[string]interface{})
+	conditionJsonMap["reason"] = "ProgressDeadlineExceeded"
+	deploymentStatus = parseDeploymentStatus(jsonMap)
+	if deploymentStatus.Complete || deploymentStatus.Failed == false {
+		t.Errorf("The deployment exceeding the progress deadline should be failed but get %v", deploymentStatus)
+	}
+}
+
+func TestDeploymentRevisionSorter(t *testing.T) {
+	deploymentRevisionSlice := []DeploymentRevision{
+		DeploymentRevision{Revision: 1, ReplicaSetName: "web-1"},
+		DeploymentRevision{Revision: 3, ReplicaSetName: "web-3"},
+		DeploymentRevision{Revision: 2, ReplicaSetName: "web-2"},
+	}
+	sort.Sort(deploymentRevisionSorter(deploymentRevisionSlice))
+
+	if deploymentRevisionSlice[0].ReplicaSetName != "web-3" || deploymentRevisionSlice[2].ReplicaSetName != "web-1" {
+		t.Errorf("The latest revision should be the first but get %v", deploymentRevisionSlice)
+	}
+}
@@ -0,0 +1,482 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"github.com/cloudawan/cloudone_utility/restclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	InformerResourcePod                   = "pods"
+	InformerResourceReplicationController = "replicationcontrollers"
+	InformerResourceService               = "services"
+	InformerResourceNode                  = "nodes"
+)
+
+const (
+	KubernetesEventTypeAdded    = "ADDED"
+	KubernetesEventTypeModified = "MODIFIED"
+	KubernetesEventTypeDeleted  = "DELETED"
+)
+
+const (
+	// The watch is closed by the Kubernetes API after this and opened again from the last resource version
+	informerWatchTimeoutInSecond = 300
+	informerRetryInterval        = time.Second * 5
+)
+
+type KubernetesEvent struct {
+	Resource  string
+	Type      string
+	Namespace string // Empty for the resources not in any namespace such as nodes
+	Name      string
+	Object    map[string]interface{} // A copy owned by the listener
+}
+
+// Called in the goroutine of the informer so it should return quickly
+type KubernetesEventListener func(kubernetesEvent KubernetesEvent)
+
+// Keep the objects of one resource in all namespaces by listing once and then watching the changes.
+// The cache is only used by the callers with the same endpoint and token as the informer
+// so the callers with the other credentials get what the Kubernetes API allows them.
+type informer struct {
+	resource              string
+	namespaced            bool
+	mutex                 *sync.RWMutex
+	synced                bool // False until listed and after the watch fails so the callers ask the Kubernetes API instead
+	resourceVersion       string
+	objectMap             map[string]map[string]interface{} // Nil until listed the first time
+	kubeApiServerEndPoint string                            // The endpoint and token of the latest list
+	kubeApiServerToken    string
+}
+
+var informerSlice = []*informer{
+	newInformer(InformerResourcePod, true),
+	newInformer(InformerResourceReplicationController, true),
+	newInformer(InformerResourceService, true),
+	newInformer(InformerResourceNode, false),
+}
+
+var informerHTTPClient = &http.Client{
+	// The same as the other requests to the Kubernetes API which accept the self-signed certificate
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
+var informerStartOnce = &sync.Once{}
+var informerStopOnce = &sync.Once{}
+var informerQuitChannel = make(chan struct{})
+
+var kubernetesEventListenerMutex = &sync.Mutex{}
+var kubernetesEventListenerSlice = make([]KubernetesEventListener, 0)
+
+func newInformer(resource string, namespaced bool) *informer {
+	return &informer{
+		resource,
+		namespaced,
+		&sync.RWMutex{},
+		false,
+		"",
+		nil,
+		"",
+		"",
+	}
+}
+
+func getInformer(resource string) *informer {
+	for _, informer := range informerSlice {
+		if informer.resource == resource {
+			return informer
+		}
+	}
+	return nil
+}
+
+func AddKubernetesEventListener(listener KubernetesEventListener) {
+	kubernetesEventListenerMutex.Lock()
+	defer kubernetesEventListenerMutex.Unlock()
+
+	kubernetesEventListenerSlice = append(kubernetesEventListenerSlice, listener)
+}
+
+func publishKubernetesEvent(kubernetesEvent KubernetesEvent) {
+	kubernetesEventListenerMutex.Lock()
+	listenerSlice := make([]KubernetesEventListener, len(kubernetesEventListenerSlice))
+	copy(listenerSlice, kubernetesEventListenerSlice)
+	kubernetesEventListenerMutex.Unlock()
+
+	for _, listener := range listenerSlice {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					log.Error("Kubernetes event listener error: %s", err)
+					log.Error(logger.GetStackTrace(4096, false))
+				}
+			}()
+
+			copiedKubernetesEvent := kubernetesEvent
+			copiedKubernetesEvent.Object, _ = copyJsonValue(kubernetesEvent.Object).(map[string]interface{})
+			listener(copiedKubernetesEvent)
+		}()
+	}
+}
+
+func StartInformer() {
+	informerStartOnce.Do(func() {
+		for _, informer := range informerSlice {
+			go informer.run()
+		}
+	})
+}
+
+func StopInformer() {
+	informerStopOnce.Do(func() {
+		close(informerQuitChannel)
+	})
+}
+
+// Only the synced informer listing with the same endpoint and token could be used
+func (informer *informer) isUsable(kubeApiServerEndPoint string, kubeApiServerToken string) bool {
+	return informer.synced &&
+		informer.kubeApiServerEndPoint == kubeApiServerEndPoint &&
+		informer.kubeApiServerToken == kubeApiServerToken
+}
+
+// Return the cached objects in the same form as the list from the Kubernetes API. The namespace is ignored if empty for the resources not in any namespace.
+// False if the informer can't be used and the Kubernetes API should be asked instead.
+// The list across all the namespaces is always asked to the Kubernetes API so it applies the access of the token.
+func GetInformerList(kubeApiServerEndPoint string, kubeApiServerToken string, resource string, namespace string) (map[string]interface{}, bool) {
+	informer := getInformer(resource)
+	if informer == nil {
+		return nil, false
+	}
+
+	informer.mutex.RLock()
+	defer informer.mutex.RUnlock()
+
+	if informer.isUsable(kubeApiServerEndPoint, kubeApiServerToken) == false {
+		return nil, false
+	}
+	if informer.namespaced && namespace == "" {
+		return nil, false
+	}
+
+	keySlice := make([]string, 0)
+	for key, object := range informer.objectMap {
+		objectNamespace, _, _ := getObjectMetadata(object)
+		if namespace == "" || namespace == objectNamespace {
+			keySlice = append(keySlice, key)
+		}
+	}
+	sort.Strings(keySlice)
+
+	itemSlice := make([]interface{}, 0)
+	for _, key := range keySlice {
+		itemSlice = append(itemSlice, copyJsonValue(informer.objectMap[key]))
+	}
+
+	jsonMap := make(map[string]interface{})
+	jsonMap["items"] = itemSlice
+	jsonMap["metadata"] = map[string]interface{}{"resourceVersion": informer.resourceVersion}
+	return jsonMap, true
+}
+
+// False if the informer can't be used or the object is not cached yet
+func GetInformerObject(kubeApiServerEndPoint string, kubeApiServerToken string, resource string, namespace string, name string) (map[string]interface{}, bool) {
+	informer := getInformer(resource)
+	if informer == nil {
+		return nil, false
+	}
+
+	informer.mutex.RLock()
+	defer informer.mutex.RUnlock()
+
+	if informer.isUsable(kubeApiServerEndPoint, kubeApiServerToken) == false {
+		return nil, false
+	}
+
+	object, ok := informer.objectMap[getObjectKey(namespace, name)]
+	if ok == false {
+		return nil, false
+	}
+	jsonMap, _ := copyJsonValue(object).(map[string]interface{})
+	return jsonMap, true
+}
+
+// Get the list from the informer if synced or from the Kubernetes API. The namespace is ignored if empty.
+func GetResourceList(kubeApiServerEndPoint string, kubeApiServerToken string, resource string, namespace string) (map[string]interface{}, error) {
+	if jsonMap, ok := GetInformerList(kubeApiServerEndPoint, kubeApiServerToken, resource, namespace); ok {
+		return jsonMap, nil
+	}
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/"
+	if namespace != "" {
+		url += "namespaces/" + namespace + "/"
+	}
+	url += resource + "/"
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		return nil, err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+	return jsonMap, nil
+}
+
+// Get the object from the informer if cached or from the Kubernetes API
+func GetResourceObject(kubeApiServerEndPoint string, kubeApiServerToken string, resource string, namespace string, name string) (map[string]interface{}, error) {
+	if jsonMap, ok := GetInformerObject(kubeApiServerEndPoint, kubeApiServerToken, resource, namespace, name); ok {
+		return jsonMap, nil
+	}
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/"
+	if namespace != "" {
+		url += "namespaces/" + namespace + "/"
+	}
+	url += resource + "/" + name
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		return nil, err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+	return jsonMap, nil
+}
+
+func getObjectKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+func getObjectMetadata(object map[string]interface{}) (string, string, string) {
+	metadataJsonMap, _ := object["metadata"].(map[string]interface{})
+	namespace, _ := metadataJsonMap["namespace"].(string)
+	name, _ := metadataJsonMap["name"].(string)
+	resourceVersion, _ := metadataJsonMap["resourceVersion"].(string)
+	return namespace, name, resourceVersion
+}
+
+func copyJsonValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		jsonMap := make(map[string]interface{})
+		for key, element := range typedValue {
+			jsonMap[key] = copyJsonValue(element)
+		}
+		return jsonMap
+	case []interface{}:
+		jsonSlice := make([]interface{}, len(typedValue))
+		for i, element := range typedValue {
+			jsonSlice[i] = copyJsonValue(element)
+		}
+		return jsonSlice
+	default:
+		return value
+	}
+}
+
+func (informer *informer) run() {
+	for {
+		err := informer.listAndWatch()
+		if err != nil {
+			log.Error("Informer %s error: %s", informer.resource, err)
+		}
+
+		informer.mutex.Lock()
+		informer.synced = false
+		informer.mutex.Unlock()
+
+		select {
+		case <-informerQuitChannel:
+			log.Info("Informer %s quit", informer.resource)
+			return
+		case <-time.After(informerRetryInterval):
+		}
+	}
+}
+
+func (informer *informer) listAndWatch() (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("Informer %s listAndWatch Error: %s", informer.resource, err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = errors.New("Informer panic")
+		}
+	}()
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		return err
+	}
+
+	err = informer.list(kubeApiServerEndPoint, kubeApiServerToken)
+	if err != nil {
+		return err
+	}
+
+	for {
+		err := informer.watch(kubeApiServerEndPoint, kubeApiServerToken)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-informerQuitChannel:
+			return nil
+		default:
+		}
+	}
+}
+
+// Replace the cache with the list. The changes missed while not watching are published except for the first list.
+func (informer *informer) list(kubeApiServerEndPoint string, kubeApiServerToken string) error {
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/"+informer.resource+"/", headerMap, true)
+	if err != nil {
+		return err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+	metadataJsonMap, _ := jsonMap["metadata"].(map[string]interface{})
+	resourceVersion, _ := metadataJsonMap["resourceVersion"].(string)
+	itemSlice, _ := jsonMap["items"].([]interface{})
+
+	objectMap := make(map[string]map[string]interface{})
+	for _, item := range itemSlice {
+		object, ok := item.(map[string]interface{})
+		if ok {
+			namespace, name, _ := getObjectMetadata(object)
+			objectMap[getObjectKey(namespace, name)] = object
+		}
+	}
+
+	informer.mutex.Lock()
+	oldObjectMap := informer.objectMap
+	informer.objectMap = objectMap
+	informer.resourceVersion = resourceVersion
+	informer.kubeApiServerEndPoint = kubeApiServerEndPoint
+	informer.kubeApiServerToken = kubeApiServerToken
+	informer.synced = true
+	informer.mutex.Unlock()
+
+	if oldObjectMap == nil {
+		return nil
+	}
+
+	for key, object := range objectMap {
+		namespace, name, resourceVersion := getObjectMetadata(object)
+		oldObject, ok := oldObjectMap[key]
+		if ok == false {
+			publishKubernetesEvent(KubernetesEvent{informer.resource, KubernetesEventTypeAdded, namespace, name, object})
+		} else if _, _, oldResourceVersion := getObjectMetadata(oldObject); oldResourceVersion != resourceVersion {
+			publishKubernetesEvent(KubernetesEvent{informer.resource, KubernetesEventTypeModified, namespace, name, object})
+		}
+	}
+	for key, oldObject := range oldObjectMap {
+		if _, ok := objectMap[key]; ok == false {
+			namespace, name, _ := getObjectMetadata(oldObject)
+			publishKubernetesEvent(KubernetesEvent{informer.resource, KubernetesEventTypeDeleted, namespace, name, oldObject})
+		}
+	}
+
+	return nil
+}
+
+// Apply the changes until the watch is closed. Nil is returned if it is closed normally and could be opened again.
+func (informer *informer) watch(kubeApiServerEndPoint string, kubeApiServerToken string) error {
+	informer.mutex.RLock()
+	resourceVersion := informer.resourceVersion
+	informer.mutex.RUnlock()
+
+	url := kubeApiServerEndPoint + "/api/v1/" + informer.resource + "?watch=true&resourceVersion=" + resourceVersion +
+		"&timeoutSeconds=" + strconv.Itoa(informerWatchTimeoutInSecond)
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", kubeApiServerToken)
+	request.Cancel = informerQuitChannel
+
+	response, err := informerHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return errors.New("Watch " + informer.resource + " status " + response.Status + " body " + string(body))
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	decoder.UseNumber()
+	for {
+		watchEvent := struct {
+			Type   string
+			Object map[string]interface{}
+		}{}
+		err := decoder.Decode(&watchEvent)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch watchEvent.Type {
+		case KubernetesEventTypeAdded, KubernetesEventTypeModified, KubernetesEventTypeDeleted:
+			namespace, name, resourceVersion := getObjectMetadata(watchEvent.Object)
+			key := getObjectKey(namespace, name)
+
+			informer.mutex.Lock()
+			if watchEvent.Type == KubernetesEventTypeDeleted {
+				delete(informer.objectMap, key)
+			} else {
+				informer.objectMap[key] = watchEvent.Object
+			}
+			informer.resourceVersion = resourceVersion
+			informer.mutex.Unlock()
+
+			publishKubernetesEvent(KubernetesEvent{informer.resource, watchEvent.Type, namespace, name, watchEvent.Object})
+		case "ERROR":
+			// Such as the resource version is too old so it has to be listed again
+			message, _ := watchEvent.Object["message"].(string)
+			return errors.New("Watch " + informer.resource + " error " + message)
+		default:
+			// Bookmark only moves the resource version
+			_, _, resourceVersion := getObjectMetadata(watchEvent.Object)
+			if resourceVersion != "" {
+				informer.mutex.Lock()
+				informer.resourceVersion = resourceVersion
+				informer.mutex.Unlock()
+			}
+		}
+	}
+}
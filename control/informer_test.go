@@ -0,0 +1,115 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInformerListAndWatch(t *testing.T) {
+	listBody := `{"metadata":{"resourceVersion":"10"},"items":[` +
+		`{"metadata":{"namespace":"default","name":"a","resourceVersion":"1"}},` +
+		`{"metadata":{"namespace":"default","name":"b","resourceVersion":"2"}}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Set("Content-Type", "application/json")
+		if request.URL.Query().Get("watch") == "true" {
+			if request.URL.Query().Get("resourceVersion") != "20" {
+				t.Errorf("Watch from resource version %s", request.URL.Query().Get("resourceVersion"))
+			}
+			fmt.Fprintln(responseWriter, `{"type":"ADDED","object":{"metadata":{"namespace":"other","name":"c","resourceVersion":"21"}}}`)
+			fmt.Fprintln(responseWriter, `{"type":"DELETED","object":{"metadata":{"namespace":"default","name":"b","resourceVersion":"22"}}}`)
+			return
+		}
+		fmt.Fprint(responseWriter, listBody)
+	}))
+	defer server.Close()
+
+	eventSlice := make([]KubernetesEvent, 0)
+	kubernetesEventListenerSlice = []KubernetesEventListener{func(kubernetesEvent KubernetesEvent) {
+		eventSlice = append(eventSlice, kubernetesEvent)
+	}}
+	defer func() {
+		kubernetesEventListenerSlice = make([]KubernetesEventListener, 0)
+	}()
+
+	testInformer := newInformer(InformerResourcePod, true)
+	oldInformerSlice := informerSlice
+	informerSlice = []*informer{testInformer}
+	defer func() {
+		informerSlice = oldInformerSlice
+	}()
+
+	if err := testInformer.list(server.URL, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(eventSlice) != 0 {
+		t.Errorf("The first list should not publish events but get %v", eventSlice)
+	}
+
+	// a is modified and b is deleted while not watching
+	listBody = `{"metadata":{"resourceVersion":"20"},"items":[` +
+		`{"metadata":{"namespace":"default","name":"a","resourceVersion":"3"}}]}`
+	if err := testInformer.list(server.URL, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(eventSlice) != 2 || eventSlice[0].Type != KubernetesEventTypeModified || eventSlice[0].Name != "a" ||
+		eventSlice[1].Type != KubernetesEventTypeDeleted || eventSlice[1].Name != "b" {
+		t.Errorf("Unexpected events after list again %v", eventSlice)
+	}
+
+	// The watch publishes what it receives even if b is already removed from the cache
+	if err := testInformer.watch(server.URL, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(eventSlice) != 4 || eventSlice[2].Type != KubernetesEventTypeAdded || eventSlice[2].Namespace != "other" {
+		t.Errorf("Unexpected events after watch %v", eventSlice)
+	}
+
+	jsonMap, ok := GetInformerList(server.URL, "", InformerResourcePod, "default")
+	if ok == false {
+		t.Fatal("The informer should be synced")
+	}
+	itemSlice, _ := jsonMap["items"].([]interface{})
+	if len(itemSlice) != 1 {
+		t.Errorf("Expect 1 pod in default but get %v", itemSlice)
+	}
+	if _, ok := GetInformerList(server.URL, "", InformerResourcePod, ""); ok {
+		t.Error("The pods in all namespaces should be asked to the Kubernetes API")
+	}
+	if _, ok := GetInformerList(server.URL, "Bearer other", InformerResourcePod, "default"); ok {
+		t.Error("The informer should not be used with the other token")
+	}
+	if _, ok := GetInformerObject("http://other", "", InformerResourcePod, "default", "a"); ok {
+		t.Error("The informer should not be used with the other endpoint")
+	}
+
+	// The caller owns the copy
+	object, ok := GetInformerObject(server.URL, "", InformerResourcePod, "default", "a")
+	if ok == false {
+		t.Fatal("Pod a should be cached")
+	}
+	object["metadata"].(map[string]interface{})["name"] = "changed"
+	if _, ok := GetInformerObject(server.URL, "", InformerResourcePod, "default", "a"); ok == false {
+		t.Error("The cache should not be changed by the caller")
+	}
+
+	testInformer.synced = false
+	if _, ok := GetInformerList(server.URL, "", InformerResourcePod, "default"); ok {
+		t.Error("The informer not synced should not be used")
+	}
+}
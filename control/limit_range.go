@@ -0,0 +1,213 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"github.com/cloudawan/cloudone_utility/logger"
+	"github.com/cloudawan/cloudone_utility/restclient"
+)
+
+// The name used for the limit range managed with the namespace
+const DefaultLimitRangeName = "cloudone-limit-range"
+
+const (
+	LimitRangeTypeContainer = "Container"
+	LimitRangeTypePod       = "Pod"
+)
+
+type LimitRange struct {
+	Name                string
+	Namespace           string
+	LimitRangeItemSlice []LimitRangeItem
+}
+
+type LimitRangeItem struct {
+	Type                    string            // Container or Pod
+	MaxMap                  map[string]string // Resource name like cpu or memory to the quantity
+	MinMap                  map[string]string
+	DefaultMap              map[string]string // The default limits for the container without them
+	DefaultRequestMap       map[string]string // The default requests for the container without them
+	MaxLimitRequestRatioMap map[string]string
+}
+
+func GetAllLimitRange(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string) (returnedLimitRangeSlice []LimitRange, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetAllLimitRange Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedLimitRangeSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/limitranges/"
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		log.Error("Fail to get all limit range with endpoint: %s, namespace: %s, error: %s", kubeApiServerEndPoint, namespace, err.Error())
+		return nil, err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+
+	limitRangeSlice := make([]LimitRange, 0)
+	itemSlice, _ := jsonMap["items"].([]interface{})
+	for _, item := range itemSlice {
+		limitRangeSlice = append(limitRangeSlice, *parseLimitRange(item.(map[string]interface{})))
+	}
+
+	return limitRangeSlice, nil
+}
+
+func parseLimitRange(jsonMap map[string]interface{}) *LimitRange {
+	limitRange := new(LimitRange)
+	metadataJsonMap, _ := jsonMap["metadata"].(map[string]interface{})
+	limitRange.Name, _ = metadataJsonMap["name"].(string)
+	limitRange.Namespace, _ = metadataJsonMap["namespace"].(string)
+	limitRange.LimitRangeItemSlice = make([]LimitRangeItem, 0)
+	specJsonMap, _ := jsonMap["spec"].(map[string]interface{})
+	limitSlice, _ := specJsonMap["limits"].([]interface{})
+	for _, limit := range limitSlice {
+		limitJsonMap, _ := limit.(map[string]interface{})
+		limitRangeItem := LimitRangeItem{}
+		limitRangeItem.Type, _ = limitJsonMap["type"].(string)
+		limitRangeItem.MaxMap = GetQuantityStringMap(limitJsonMap["max"])
+		limitRangeItem.MinMap = GetQuantityStringMap(limitJsonMap["min"])
+		limitRangeItem.DefaultMap = GetQuantityStringMap(limitJsonMap["default"])
+		limitRangeItem.DefaultRequestMap = GetQuantityStringMap(limitJsonMap["defaultRequest"])
+		limitRangeItem.MaxLimitRequestRatioMap = GetQuantityStringMap(limitJsonMap["maxLimitRequestRatio"])
+		limitRange.LimitRangeItemSlice = append(limitRange.LimitRangeItemSlice, limitRangeItem)
+	}
+	return limitRange
+}
+
+func getLimitRangeItemJsonMapSlice(limitRangeItemSlice []LimitRangeItem) []map[string]interface{} {
+	limitJsonMapSlice := make([]map[string]interface{}, 0)
+	for _, limitRangeItem := range limitRangeItemSlice {
+		limitJsonMap := make(map[string]interface{})
+		limitJsonMap["type"] = limitRangeItem.Type
+		if len(limitRangeItem.MaxMap) > 0 {
+			limitJsonMap["max"] = limitRangeItem.MaxMap
+		}
+		if len(limitRangeItem.MinMap) > 0 {
+			limitJsonMap["min"] = limitRangeItem.MinMap
+		}
+		if len(limitRangeItem.DefaultMap) > 0 {
+			limitJsonMap["default"] = limitRangeItem.DefaultMap
+		}
+		if len(limitRangeItem.DefaultRequestMap) > 0 {
+			limitJsonMap["defaultRequest"] = limitRangeItem.DefaultRequestMap
+		}
+		if len(limitRangeItem.MaxLimitRequestRatioMap) > 0 {
+			limitJsonMap["maxLimitRequestRatio"] = limitRangeItem.MaxLimitRequestRatioMap
+		}
+		limitJsonMapSlice = append(limitJsonMapSlice, limitJsonMap)
+	}
+	return limitJsonMapSlice
+}
+
+// Create the limit range or replace the limits of the existing one
+func SaveLimitRange(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, name string, limitRangeItemSlice []LimitRangeItem) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("SaveLimitRange Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/limitranges/"
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		log.Error("Fail to get all limit range with endpoint: %s, namespace: %s, error: %s", kubeApiServerEndPoint, namespace, err.Error())
+		return err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+
+	itemSlice, _ := jsonMap["items"].([]interface{})
+	for _, item := range itemSlice {
+		itemJsonMap := item.(map[string]interface{})
+		itemName, _ := itemJsonMap["metadata"].(map[string]interface{})["name"].(string)
+		if itemName == name {
+			// Keep the resource version from the current one
+			itemJsonMap["spec"] = map[string]interface{}{"limits": getLimitRangeItemJsonMapSlice(limitRangeItemSlice)}
+			_, err := restclient.RequestPut(url+name, itemJsonMap, headerMap, true)
+			if err != nil {
+				log.Error("Fail to update limit range with endpoint: %s, namespace: %s, name: %s, error: %s", kubeApiServerEndPoint, namespace, name, err.Error())
+			}
+			return err
+		}
+	}
+
+	bodyJsonMap := make(map[string]interface{})
+	bodyJsonMap["kind"] = "LimitRange"
+	bodyJsonMap["apiVersion"] = "v1"
+	bodyJsonMap["metadata"] = make(map[string]interface{})
+	bodyJsonMap["metadata"].(map[string]interface{})["name"] = name
+	bodyJsonMap["spec"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["limits"] = getLimitRangeItemJsonMapSlice(limitRangeItemSlice)
+
+	_, err = restclient.RequestPost(url, bodyJsonMap, headerMap, true)
+	if err != nil {
+		log.Error("Fail to create limit range with endpoint: %s, namespace: %s, name: %s, error: %s", kubeApiServerEndPoint, namespace, name, err.Error())
+	}
+	return err
+}
+
+func DeleteLimitRange(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, name string) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("DeleteLimitRange Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/limitranges/" + name
+	_, err := restclient.RequestDelete(url, nil, headerMap, true)
+	if err != nil {
+		log.Error("Fail to delete limit range with endpoint: %s, namespace: %s, name: %s, error: %s", kubeApiServerEndPoint, namespace, name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// The default requests and limits applied by kubernetes to the container without them
+func GetContainerDefaultResource(limitRangeSlice []LimitRange) (map[string]string, map[string]string) {
+	defaultRequestMap := make(map[string]string)
+	defaultLimitMap := make(map[string]string)
+	for _, limitRange := range limitRangeSlice {
+		for _, limitRangeItem := range limitRange.LimitRangeItemSlice {
+			if limitRangeItem.Type != LimitRangeTypeContainer {
+				continue
+			}
+			for resourceName, quantity := range limitRangeItem.DefaultMap {
+				defaultLimitMap[resourceName] = quantity
+			}
+			for resourceName, quantity := range limitRangeItem.DefaultRequestMap {
+				defaultRequestMap[resourceName] = quantity
+			}
+		}
+	}
+	return defaultRequestMap, defaultLimitMap
+}
@@ -16,7 +16,6 @@ package control
 
 import (
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 )
 
 type Region struct {
@@ -52,13 +51,7 @@ func GetAllNodeIP(kubeApiServerEndPoint string, kubeApiServerToken string) (retu
 		}
 	}()
 
-	jsonMap := make(map[string]interface{})
-
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	url := kubeApiServerEndPoint + "/api/v1/nodes/"
-	_, err := restclient.RequestGetWithStructure(url, &jsonMap, headerMap)
+	jsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourceNode, "")
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -100,13 +93,7 @@ func GetNodeTopology(kubeApiServerEndPoint string, kubeApiServerToken string) (r
 		}
 	}()
 
-	jsonMap := make(map[string]interface{})
-
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	url := kubeApiServerEndPoint + "/api/v1/nodes/"
-	_, err := restclient.RequestGetWithStructure(url, &jsonMap, headerMap)
+	jsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourceNode, "")
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -79,15 +79,11 @@ func GetAllPodNameBelongToReplicationController(kubeApiServerEndPoint string, ku
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/", headerMap, true)
+	jsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourcePod, namespace)
 	if err != nil {
 		log.Error("Fail to get replication controller inofrmation with endpoint %s, token: %s, namespace: %s, replication controller name: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName, err.Error())
 		return nil, err
 	}
-	jsonMap, _ := result.(map[string]interface{})
 
 	generateName := replicationControllerName + "-"
 	podNameSlice := make([]string, 0)
@@ -118,11 +114,7 @@ func GetAllPodBelongToReplicationController(kubeApiServerEndPoint string, kubeAp
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/", headerMap, true)
-	jsonMap, _ := result.(map[string]interface{})
+	jsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourcePod, namespace)
 	if err != nil {
 		log.Error("Fail to get all pod inofrmation with endpoint %s, token: %s, namespace: %s, replication controller name: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName, err.Error())
 		return nil, err
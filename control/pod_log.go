@@ -15,10 +15,30 @@
 package control
 
 import (
+	"crypto/tls"
+	"errors"
 	"github.com/cloudawan/cloudone_utility/logger"
 	"github.com/cloudawan/cloudone_utility/restclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
 )
 
+type PodLogOption struct {
+	ContainerName string // Could be empty if the pod has only one container
+	Follow        bool
+	SinceSeconds  int // All the log if not positive
+	TailLines     int // All the lines if negative
+	Previous      bool
+}
+
+var podLogHTTPClient = &http.Client{
+	// The same as the other requests to the Kubernetes API which accept the self-signed certificate
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
 func GetPodLog(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, podName string) (returnedLog map[string]interface{}, returnedError error) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -64,3 +84,80 @@ func GetPodLog(kubeApiServerEndPoint string, kubeApiServerToken string, namespac
 
 	return logJsonMap, nil
 }
+
+func getPodLogQueryValues(podLogOption PodLogOption) url.Values {
+	queryValues := url.Values{}
+	if podLogOption.ContainerName != "" {
+		queryValues.Set("container", podLogOption.ContainerName)
+	}
+	if podLogOption.Follow {
+		queryValues.Set("follow", "true")
+	}
+	if podLogOption.SinceSeconds > 0 {
+		queryValues.Set("sinceSeconds", strconv.Itoa(podLogOption.SinceSeconds))
+	}
+	if podLogOption.TailLines >= 0 {
+		queryValues.Set("tailLines", strconv.Itoa(podLogOption.TailLines))
+	}
+	if podLogOption.Previous {
+		queryValues.Set("previous", "true")
+	}
+	return queryValues
+}
+
+// Copy the log to the writer until the log ends or the cancel channel is closed. The log never ends when following.
+func StreamPodLog(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, podName string, podLogOption PodLogOption, writer io.Writer, cancelChannel <-chan struct{}) error {
+	podLog, err := OpenPodLog(kubeApiServerEndPoint, kubeApiServerToken, namespace, podName, podLogOption, cancelChannel)
+	if err != nil {
+		return err
+	}
+	defer podLog.Close()
+
+	return CopyPodLog(podLog, writer, cancelChannel)
+}
+
+// Open the log so the failure is known before anything is written to the client. The caller closes it.
+func OpenPodLog(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, podName string, podLogOption PodLogOption, cancelChannel <-chan struct{}) (returnedPodLog io.ReadCloser, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("OpenPodLog Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedPodLog = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/pods/" + podName + "/log?" + getPodLogQueryValues(podLogOption).Encode()
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", kubeApiServerToken)
+	request.Cancel = cancelChannel
+
+	response, err := podLogHTTPClient.Do(request)
+	if err != nil {
+		log.Error("Fail to get log with namespace %s pod %s container %s endpoint: %s, error: %s", namespace, podName, podLogOption.ContainerName, kubeApiServerEndPoint, err)
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, errors.New("Get log status " + response.Status + " body " + string(body))
+	}
+
+	return response.Body, nil
+}
+
+// Copy the opened log to the writer until the log ends or the cancel channel is closed
+func CopyPodLog(podLog io.Reader, writer io.Writer, cancelChannel <-chan struct{}) error {
+	_, err := io.Copy(writer, podLog)
+	select {
+	case <-cancelChannel:
+		// Closed by the receiver
+		return nil
+	default:
+		return err
+	}
+}
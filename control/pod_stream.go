@@ -0,0 +1,195 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/net/websocket"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The channel is the first byte of each websocket message of the exec and the port forward
+const (
+	PodStreamChannelStdin  = 0
+	PodStreamChannelStdout = 1
+	PodStreamChannelStderr = 2
+	PodStreamChannelError  = 3
+	PodStreamChannelResize = 4
+)
+
+const (
+	podStreamProtocol = "v4.channel.k8s.io"
+	// The data and the error channel of the only port forwarded
+	podPortForwardChannelData  = 0
+	podPortForwardChannelError = 1
+)
+
+// The websocket connection to the exec or the port forward of a pod in Kubernetes
+type PodStreamConnection struct {
+	connection *websocket.Conn
+	writeMutex *sync.Mutex
+}
+
+func dialPodStream(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, podName string, subresource string, queryValues url.Values) (*PodStreamConnection, error) {
+	server := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/pods/" + podName + "/" + subresource + "?" + queryValues.Encode()
+	if strings.HasPrefix(server, "https://") {
+		server = "wss://" + strings.TrimPrefix(server, "https://")
+	} else {
+		server = "ws://" + strings.TrimPrefix(server, "http://")
+	}
+
+	config, err := websocket.NewConfig(server, kubeApiServerEndPoint)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{podStreamProtocol}
+	config.Header.Set("Authorization", kubeApiServerToken)
+	// The same as the other requests to the Kubernetes API which accept the self-signed certificate
+	config.TlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+	connection, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &PodStreamConnection{connection, &sync.Mutex{}}, nil
+}
+
+func getPodExecQueryValues(containerName string, commandSlice []string, tty bool) url.Values {
+	queryValues := url.Values{}
+	if containerName != "" {
+		queryValues.Set("container", containerName)
+	}
+	for _, command := range commandSlice {
+		queryValues.Add("command", command)
+	}
+	queryValues.Set("stdin", "true")
+	queryValues.Set("stdout", "true")
+	// The terminal merges the stderr into the stdout
+	queryValues.Set("stderr", strconv.FormatBool(tty == false))
+	queryValues.Set("tty", strconv.FormatBool(tty))
+	return queryValues
+}
+
+// The container could be empty if the pod has only one container
+func DialPodExec(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, podName string, containerName string, commandSlice []string, tty bool) (*PodStreamConnection, error) {
+	if len(commandSlice) == 0 {
+		return nil, errors.New("Command is required")
+	}
+
+	podStreamConnection, err := dialPodStream(kubeApiServerEndPoint, kubeApiServerToken, namespace, podName, "exec", getPodExecQueryValues(containerName, commandSlice, tty))
+	if err != nil {
+		log.Error("Fail to exec with namespace %s pod %s container %s endpoint: %s, error: %s", namespace, podName, containerName, kubeApiServerEndPoint, err)
+		return nil, err
+	}
+	return podStreamConnection, nil
+}
+
+// Return the channel and the data of the next message
+func (podStreamConnection *PodStreamConnection) ReadChannel() (byte, []byte, error) {
+	for {
+		byteSlice := make([]byte, 0)
+		if err := websocket.Message.Receive(podStreamConnection.connection, &byteSlice); err != nil {
+			return 0, nil, err
+		}
+		// Skip the empty message which has no channel
+		if len(byteSlice) > 0 {
+			return byteSlice[0], byteSlice[1:], nil
+		}
+	}
+}
+
+func (podStreamConnection *PodStreamConnection) WriteChannel(channel byte, byteSlice []byte) error {
+	message := make([]byte, 0, len(byteSlice)+1)
+	message = append(message, channel)
+	message = append(message, byteSlice...)
+
+	podStreamConnection.writeMutex.Lock()
+	defer podStreamConnection.writeMutex.Unlock()
+	return websocket.Message.Send(podStreamConnection.connection, message)
+}
+
+func (podStreamConnection *PodStreamConnection) Close() error {
+	return podStreamConnection.connection.Close()
+}
+
+// The stream of a port of the pod. The port prefixes of the channels are removed and the error channel is returned as the error.
+type PodPortForwardConnection struct {
+	podStreamConnection *PodStreamConnection
+	port                int
+	prefixReadMap       map[byte]bool
+	remainingByteSlice  []byte
+}
+
+func DialPodPortForward(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, podName string, port int) (*PodPortForwardConnection, error) {
+	queryValues := url.Values{}
+	queryValues.Set("ports", strconv.Itoa(port))
+
+	podStreamConnection, err := dialPodStream(kubeApiServerEndPoint, kubeApiServerToken, namespace, podName, "portforward", queryValues)
+	if err != nil {
+		log.Error("Fail to port forward with namespace %s pod %s port %d endpoint: %s, error: %s", namespace, podName, port, kubeApiServerEndPoint, err)
+		return nil, err
+	}
+	return &PodPortForwardConnection{podStreamConnection, port, make(map[byte]bool), nil}, nil
+}
+
+func (podPortForwardConnection *PodPortForwardConnection) Read(byteSlice []byte) (int, error) {
+	for len(podPortForwardConnection.remainingByteSlice) == 0 {
+		channel, data, err := podPortForwardConnection.podStreamConnection.ReadChannel()
+		if err != nil {
+			return 0, err
+		}
+
+		// The first message of each channel begins with the port in little endian
+		if podPortForwardConnection.prefixReadMap[channel] == false {
+			if len(data) < 2 {
+				return 0, errors.New("The port prefix is incomplete")
+			}
+			if int(binary.LittleEndian.Uint16(data)) != podPortForwardConnection.port {
+				return 0, errors.New("Unexpected port " + strconv.Itoa(int(binary.LittleEndian.Uint16(data))))
+			}
+			podPortForwardConnection.prefixReadMap[channel] = true
+			data = data[2:]
+		}
+
+		switch channel {
+		case podPortForwardChannelData:
+			podPortForwardConnection.remainingByteSlice = data
+		case podPortForwardChannelError:
+			if len(data) > 0 {
+				return 0, errors.New(string(data))
+			}
+		}
+	}
+
+	length := copy(byteSlice, podPortForwardConnection.remainingByteSlice)
+	podPortForwardConnection.remainingByteSlice = podPortForwardConnection.remainingByteSlice[length:]
+	return length, nil
+}
+
+func (podPortForwardConnection *PodPortForwardConnection) Write(byteSlice []byte) (int, error) {
+	if err := podPortForwardConnection.podStreamConnection.WriteChannel(podPortForwardChannelData, byteSlice); err != nil {
+		return 0, err
+	}
+	return len(byteSlice), nil
+}
+
+func (podPortForwardConnection *PodPortForwardConnection) Close() error {
+	return podPortForwardConnection.podStreamConnection.Close()
+}
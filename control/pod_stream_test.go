@@ -0,0 +1,141 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"bytes"
+	"golang.org/x/net/websocket"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetPodExecQueryValues(t *testing.T) {
+	queryValues := getPodExecQueryValues("web", []string{"ls", "-l"}, true)
+	if queryValues.Get("container") != "web" || strings.Join(queryValues["command"], " ") != "ls -l" ||
+		queryValues.Get("stdin") != "true" || queryValues.Get("stderr") != "false" || queryValues.Get("tty") != "true" {
+		t.Errorf("Incorrect exec query %s", queryValues.Encode())
+	}
+
+	queryValues = getPodExecQueryValues("", []string{"ls"}, false)
+	if _, ok := queryValues["container"]; ok || queryValues.Get("stderr") != "true" {
+		t.Errorf("Incorrect exec query without the terminal %s", queryValues.Encode())
+	}
+}
+
+func TestPodStreamConnection(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(connection *websocket.Conn) {
+		if connection.Request().URL.Query().Get("command") != "sh" {
+			return
+		}
+		byteSlice := make([]byte, 0)
+		websocket.Message.Receive(connection, &byteSlice)
+		// Echo the stdin to the stdout
+		websocket.Message.Send(connection, append([]byte{PodStreamChannelStdout}, byteSlice[1:]...))
+	}))
+	defer server.Close()
+
+	podStreamConnection, err := DialPodExec(server.URL, "token", "default", "web", "", []string{"sh"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer podStreamConnection.Close()
+
+	if err := podStreamConnection.WriteChannel(PodStreamChannelStdin, []byte("ls\n")); err != nil {
+		t.Fatal(err)
+	}
+	channel, byteSlice, err := podStreamConnection.ReadChannel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel != PodStreamChannelStdout || string(byteSlice) != "ls\n" {
+		t.Errorf("Expect ls on the stdout but get %q on the channel %d", byteSlice, channel)
+	}
+}
+
+func TestPodPortForwardConnection(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(connection *websocket.Conn) {
+		// Port 8080 in little endian begins each channel
+		websocket.Message.Send(connection, []byte{podPortForwardChannelData, 0x90, 0x1f})
+		websocket.Message.Send(connection, []byte{podPortForwardChannelError, 0x90, 0x1f})
+		byteSlice := make([]byte, 0)
+		websocket.Message.Receive(connection, &byteSlice)
+		websocket.Message.Send(connection, append([]byte{podPortForwardChannelData}, byteSlice[1:]...))
+		websocket.Message.Send(connection, append([]byte{podPortForwardChannelError}, []byte("connection refused")...))
+	}))
+	defer server.Close()
+
+	podPortForwardConnection, err := DialPodPortForward(server.URL, "token", "default", "web", 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer podPortForwardConnection.Close()
+
+	if _, err := podPortForwardConnection.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	byteSlice := make([]byte, 2)
+	buffer := bytes.Buffer{}
+	for buffer.Len() < 4 {
+		length, err := podPortForwardConnection.Read(byteSlice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer.Write(byteSlice[:length])
+	}
+	if buffer.String() != "ping" {
+		t.Errorf("Expect ping without the port prefix but get %q", buffer.String())
+	}
+
+	if _, err := podPortForwardConnection.Read(byteSlice); err == nil || err.Error() != "connection refused" {
+		t.Errorf("Expect the error channel as the error but get %v", err)
+	}
+}
+
+func TestStreamPodLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/v1/namespaces/default/pods/web/log" || request.Header.Get("Authorization") != "token" {
+			responseWriter.WriteHeader(http.StatusNotFound)
+			return
+		}
+		responseWriter.Write([]byte(request.URL.RawQuery))
+	}))
+	defer server.Close()
+
+	buffer := &bytes.Buffer{}
+	podLogOption := PodLogOption{"app", true, 60, 0, true}
+	if err := StreamPodLog(server.URL, "token", "default", "web", podLogOption, buffer, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != "container=app&follow=true&previous=true&sinceSeconds=60&tailLines=0" {
+		t.Errorf("Incorrect log query %s", buffer.String())
+	}
+
+	buffer.Reset()
+	podLogOption = PodLogOption{"", false, 0, -1, false}
+	if err := StreamPodLog(server.URL, "token", "default", "web", podLogOption, buffer, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("The default option should have no query but get %s", buffer.String())
+	}
+
+	err := StreamPodLog(server.URL, "token", "default", "other", podLogOption, ioutil.Discard, make(chan struct{}))
+	if err == nil {
+		t.Errorf("The failed status should be returned as the error")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var quantitySuffixMap = map[string]*big.Rat{
+	"n":  big.NewRat(1, 1000000000),
+	"u":  big.NewRat(1, 1000000),
+	"m":  big.NewRat(1, 1000),
+	"":   big.NewRat(1, 1),
+	"k":  big.NewRat(1000, 1),
+	"M":  big.NewRat(1000000, 1),
+	"G":  big.NewRat(1000000000, 1),
+	"T":  big.NewRat(1000000000000, 1),
+	"P":  big.NewRat(1000000000000000, 1),
+	"E":  big.NewRat(1000000000000000000, 1),
+	"Ki": big.NewRat(1<<10, 1),
+	"Mi": big.NewRat(1<<20, 1),
+	"Gi": big.NewRat(1<<30, 1),
+	"Ti": big.NewRat(1<<40, 1),
+	"Pi": big.NewRat(1<<50, 1),
+	"Ei": big.NewRat(1<<60, 1),
+}
+
+// Parse the kubernetes quantity like 100m, 0.5, 128Mi or 1e3 to the milli value rounded up as kubernetes does
+func ParseQuantityToMilli(text string) (int64, error) {
+	text = strings.TrimSpace(text)
+	index := strings.IndexFunc(text, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '+' && r != '-'
+	})
+	number := text
+	suffix := ""
+	if index >= 0 {
+		number = text[:index]
+		suffix = text[index:]
+	}
+
+	value, ok := new(big.Rat).SetString(number)
+	if ok == false || number == "" {
+		return 0, errors.New("Invalid quantity " + text)
+	}
+
+	multiplier, ok := quantitySuffixMap[suffix]
+	if ok == false {
+		// Decimal exponent like 1e3
+		if len(suffix) < 2 || (suffix[0] != 'e' && suffix[0] != 'E') {
+			return 0, errors.New("Invalid quantity suffix " + text)
+		}
+		exponent, err := strconv.Atoi(suffix[1:])
+		if err != nil || exponent > 18 || exponent < -18 {
+			return 0, errors.New("Invalid quantity exponent " + text)
+		}
+		multiplier = new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(absInt(exponent))), nil))
+		if exponent < 0 {
+			multiplier.Inv(multiplier)
+		}
+	}
+
+	value.Mul(value, multiplier)
+	value.Mul(value, big.NewRat(1000, 1))
+
+	// Round up
+	milli := new(big.Int).Quo(value.Num(), value.Denom())
+	if new(big.Rat).SetInt(milli).Cmp(value) < 0 {
+		milli.Add(milli, big.NewInt(1))
+	}
+	if milli.IsInt64() == false {
+		return 0, errors.New("Quantity is too large " + text)
+	}
+	return milli.Int64(), nil
+}
+
+// Format the milli value with the binary suffix for the memory and storage and the decimal one for the others
+func FormatMilliQuantity(resourceName string, milli int64) string {
+	if milli%1000 != 0 {
+		return strconv.FormatInt(milli, 10) + "m"
+	}
+	value := milli / 1000
+	if strings.Contains(resourceName, "memory") || strings.Contains(resourceName, "storage") {
+		for _, suffix := range []string{"Ei", "Pi", "Ti", "Gi", "Mi", "Ki"} {
+			unit := quantitySuffixMap[suffix].Num().Int64()
+			if value != 0 && value%unit == 0 {
+				return strconv.FormatInt(value/unit, 10) + suffix
+			}
+		}
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// The quantity values are strings in the kubernetes json but the numbers are accepted as well
+func GetQuantityStringMap(value interface{}) map[string]string {
+	quantityMap := make(map[string]string)
+	jsonMap, _ := value.(map[string]interface{})
+	for key, value := range jsonMap {
+		switch knownTypeValue := value.(type) {
+		case json.Number:
+			quantityMap[key] = knownTypeValue.String()
+		case string:
+			quantityMap[key] = knownTypeValue
+		case float64:
+			quantityMap[key] = strconv.FormatFloat(knownTypeValue, 'f', -1, 64)
+		case int64:
+			quantityMap[key] = strconv.FormatInt(knownTypeValue, 10)
+		case int:
+			quantityMap[key] = strconv.Itoa(knownTypeValue)
+		}
+	}
+	return quantityMap
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"testing"
+)
+
+func TestParseQuantityToMilli(t *testing.T) {
+	expectedMap := map[string]int64{
+		"100m":  100,
+		"0.5":   500,
+		"2":     2000,
+		"1k":    1000000,
+		"128Mi": 128 * 1024 * 1024 * 1000,
+		"1e3":   1000000,
+		"1e-3":  1,
+		"1u":    1,
+	}
+	for text, expected := range expectedMap {
+		milli, err := ParseQuantityToMilli(text)
+		if err != nil {
+			t.Errorf("Parse quantity %s get error %s", text, err)
+		} else if milli != expected {
+			t.Errorf("Parse quantity %s expect %d but get %d", text, expected, milli)
+		}
+	}
+
+	for _, text := range []string{"", "abc", "1Xi", "1e"} {
+		if _, err := ParseQuantityToMilli(text); err == nil {
+			t.Errorf("Parse invalid quantity %s should fail", text)
+		}
+	}
+}
+
+func TestFormatMilliQuantity(t *testing.T) {
+	if text := FormatMilliQuantity("cpu", 250); text != "250m" {
+		t.Errorf("Expect 250m but get %s", text)
+	}
+	if text := FormatMilliQuantity("requests.cpu", 2000); text != "2" {
+		t.Errorf("Expect 2 but get %s", text)
+	}
+	if text := FormatMilliQuantity("limits.memory", 512*1024*1024*1000); text != "512Mi" {
+		t.Errorf("Expect 512Mi but get %s", text)
+	}
+	if text := FormatMilliQuantity("memory", 1000*1000); text != "1000" {
+		t.Errorf("Expect 1000 but get %s", text)
+	}
+}
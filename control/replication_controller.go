@@ -67,8 +67,48 @@ func CreateReplicationController(kubeApiServerEndPoint string, kubeApiServerToke
 		}
 	}()
 
+	bodyJsonMap := make(map[string]interface{})
+	bodyJsonMap["kind"] = "ReplicationController"
+	bodyJsonMap["apiVersion"] = "v1"
+	bodyJsonMap["metadata"] = make(map[string]interface{})
+	bodyJsonMap["metadata"].(map[string]interface{})["name"] = replicationController.Name
+	bodyJsonMap["metadata"].(map[string]interface{})["labels"] = make(map[string]interface{})
+	bodyJsonMap["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["name"] = replicationController.Label.Name
+	bodyJsonMap["spec"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["replicas"] = replicationController.ReplicaAmount
+	bodyJsonMap["spec"].(map[string]interface{})["selector"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["selector"].(map[string]interface{})["name"] = replicationController.Selector.Name
+	bodyJsonMap["spec"].(map[string]interface{})["selector"].(map[string]interface{})["version"] = replicationController.Selector.Version
+	bodyJsonMap["spec"].(map[string]interface{})["template"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["name"] = replicationController.Selector.Name
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["version"] = replicationController.Selector.Version
+	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"] = getPodSpecJsonMap(replicationController.ContainerSlice)
+
+	// Configure extra json body
+	// It is used for user to input any configuration
+	if replicationController.ExtraJsonMap != nil {
+		deepcopy.DeepOverwriteJsonMap(replicationController.ExtraJsonMap, bodyJsonMap)
+	}
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/replicationcontrollers/"
+	_, err := restclient.RequestPost(url, bodyJsonMap, headerMap, true)
+
+	if err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// The pod spec shared by the replication controllers and the deployments
+func getPodSpecJsonMap(containerSlice []ReplicationControllerContainer) map[string]interface{} {
 	containerJsonMapSlice := make([]interface{}, 0)
-	for _, replicationControllerContainer := range replicationController.ContainerSlice {
+	for _, replicationControllerContainer := range containerSlice {
 		containerJsonMap := make(map[string]interface{})
 		containerJsonMap["name"] = replicationControllerContainer.Name
 		containerJsonMap["image"] = replicationControllerContainer.Image
@@ -104,25 +144,8 @@ func CreateReplicationController(kubeApiServerEndPoint string, kubeApiServerToke
 		containerJsonMapSlice = append(containerJsonMapSlice, containerJsonMap)
 	}
 
-	bodyJsonMap := make(map[string]interface{})
-	bodyJsonMap["kind"] = "ReplicationController"
-	bodyJsonMap["apiVersion"] = "v1"
-	bodyJsonMap["metadata"] = make(map[string]interface{})
-	bodyJsonMap["metadata"].(map[string]interface{})["name"] = replicationController.Name
-	bodyJsonMap["metadata"].(map[string]interface{})["labels"] = make(map[string]interface{})
-	bodyJsonMap["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["name"] = replicationController.Label.Name
-	bodyJsonMap["spec"] = make(map[string]interface{})
-	bodyJsonMap["spec"].(map[string]interface{})["replicas"] = replicationController.ReplicaAmount
-	bodyJsonMap["spec"].(map[string]interface{})["selector"] = make(map[string]interface{})
-	bodyJsonMap["spec"].(map[string]interface{})["selector"].(map[string]interface{})["name"] = replicationController.Selector.Name
-	bodyJsonMap["spec"].(map[string]interface{})["selector"].(map[string]interface{})["version"] = replicationController.Selector.Version
-	bodyJsonMap["spec"].(map[string]interface{})["template"] = make(map[string]interface{})
-	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"] = make(map[string]interface{})
-	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"] = make(map[string]interface{})
-	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["name"] = replicationController.Selector.Name
-	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["version"] = replicationController.Selector.Version
-	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"] = make(map[string]interface{})
-	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"] = containerJsonMapSlice
+	podSpecJsonMap := make(map[string]interface{})
+	podSpecJsonMap["containers"] = containerJsonMapSlice
 
 	// FIXME temporarily to use nested docker
 	volumeJsonMap := make(map[string]interface{})
@@ -131,25 +154,9 @@ func CreateReplicationController(kubeApiServerEndPoint string, kubeApiServerToke
 	volumeJsonMap["hostPath"].(map[string]interface{})["path"] = "/var/run/docker.sock"
 	volumeJsonMapSlice := make([]interface{}, 0)
 	volumeJsonMapSlice = append(volumeJsonMapSlice, volumeJsonMap)
-	bodyJsonMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["volumes"] = volumeJsonMapSlice
-
-	// Configure extra json body
-	// It is used for user to input any configuration
-	if replicationController.ExtraJsonMap != nil {
-		deepcopy.DeepOverwriteJsonMap(replicationController.ExtraJsonMap, bodyJsonMap)
-	}
-
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
+	podSpecJsonMap["volumes"] = volumeJsonMapSlice
 
-	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/replicationcontrollers/"
-	_, err := restclient.RequestPost(url, bodyJsonMap, headerMap, true)
-
-	if err != nil {
-		return err
-	} else {
-		return nil
-	}
+	return podSpecJsonMap
 }
 
 func DeleteReplicationController(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, replicationControllerName string) (returnedError error) {
@@ -276,12 +283,7 @@ func GetAllReplicationControllerName(kubeApiServerEndPoint string, kubeApiServer
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/replicationcontrollers/"
-	result, err := restclient.RequestGet(url, headerMap, true)
-	jsonMap, _ := result.(map[string]interface{})
+	jsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourceReplicationController, namespace)
 	if err != nil {
 		return nil, err
 	} else {
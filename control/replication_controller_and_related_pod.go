@@ -17,7 +17,6 @@ package control
 import (
 	"github.com/cloudawan/cloudone_utility/jsonparse"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 )
 
 type ReplicationControllerAndRelatedPod struct {
@@ -41,17 +40,12 @@ func GetAllReplicationControllerAndRelatedPodSlice(kubeApiServerEndPoint string,
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/replicationcontrollers/", headerMap, true)
-	replicationControllerJsonMap, _ := result.(map[string]interface{})
+	replicationControllerJsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourceReplicationController, namespace)
 	if err != nil {
 		log.Error("Fail to get all replication controller inofrmation with endpoint %s, token: %s, namespace: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, err.Error())
 		return nil, err
 	} else {
-		result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/", headerMap, true)
-		podJsonMap, _ := result.(map[string]interface{})
+		podJsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourcePod, namespace)
 		if err != nil {
 			log.Error("Fail to get all pod information with endpoint %s, token: %s, namespace: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, err.Error())
 			return nil, err
@@ -0,0 +1,204 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"github.com/cloudawan/cloudone_utility/restclient"
+	"sort"
+)
+
+// The name used for the quota managed with the namespace
+const DefaultResourceQuotaName = "cloudone-resource-quota"
+
+type ResourceQuota struct {
+	Name      string
+	Namespace string
+	HardMap   map[string]string // Resource name like pods, requests.cpu or limits.memory to the quantity
+	UsedMap   map[string]string
+}
+
+type ResourceQuotaUsage struct {
+	Name           string
+	Hard           string
+	Used           string
+	Remaining      string
+	UsedPercentage float64
+}
+
+func GetAllResourceQuota(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string) (returnedResourceQuotaSlice []ResourceQuota, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetAllResourceQuota Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedResourceQuotaSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/resourcequotas/"
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		log.Error("Fail to get all resource quota with endpoint: %s, namespace: %s, error: %s", kubeApiServerEndPoint, namespace, err.Error())
+		return nil, err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+
+	resourceQuotaSlice := make([]ResourceQuota, 0)
+	itemSlice, _ := jsonMap["items"].([]interface{})
+	for _, item := range itemSlice {
+		resourceQuotaSlice = append(resourceQuotaSlice, *parseResourceQuota(item.(map[string]interface{})))
+	}
+
+	return resourceQuotaSlice, nil
+}
+
+func parseResourceQuota(jsonMap map[string]interface{}) *ResourceQuota {
+	resourceQuota := new(ResourceQuota)
+	metadataJsonMap, _ := jsonMap["metadata"].(map[string]interface{})
+	resourceQuota.Name, _ = metadataJsonMap["name"].(string)
+	resourceQuota.Namespace, _ = metadataJsonMap["namespace"].(string)
+	specJsonMap, _ := jsonMap["spec"].(map[string]interface{})
+	resourceQuota.HardMap = GetQuantityStringMap(specJsonMap["hard"])
+	statusJsonMap, _ := jsonMap["status"].(map[string]interface{})
+	resourceQuota.UsedMap = GetQuantityStringMap(statusJsonMap["used"])
+	return resourceQuota
+}
+
+func ValidateResourceQuotaHardMap(hardMap map[string]string) error {
+	for resourceName, quantity := range hardMap {
+		if _, err := ParseQuantityToMilli(quantity); err != nil {
+			return errors.New("Invalid quota of " + resourceName + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Create the quota or replace the hard limits of the existing one
+func SaveResourceQuota(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, name string, hardMap map[string]string) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("SaveResourceQuota Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	if err := ValidateResourceQuotaHardMap(hardMap); err != nil {
+		return err
+	}
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/resourcequotas/"
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		log.Error("Fail to get all resource quota with endpoint: %s, namespace: %s, error: %s", kubeApiServerEndPoint, namespace, err.Error())
+		return err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+
+	itemSlice, _ := jsonMap["items"].([]interface{})
+	for _, item := range itemSlice {
+		itemJsonMap := item.(map[string]interface{})
+		itemName, _ := itemJsonMap["metadata"].(map[string]interface{})["name"].(string)
+		if itemName == name {
+			// Keep the resource version from the current one
+			itemJsonMap["spec"] = map[string]interface{}{"hard": hardMap}
+			delete(itemJsonMap, "status")
+			_, err := restclient.RequestPut(url+name, itemJsonMap, headerMap, true)
+			if err != nil {
+				log.Error("Fail to update resource quota with endpoint: %s, namespace: %s, name: %s, error: %s", kubeApiServerEndPoint, namespace, name, err.Error())
+			}
+			return err
+		}
+	}
+
+	bodyJsonMap := make(map[string]interface{})
+	bodyJsonMap["kind"] = "ResourceQuota"
+	bodyJsonMap["apiVersion"] = "v1"
+	bodyJsonMap["metadata"] = make(map[string]interface{})
+	bodyJsonMap["metadata"].(map[string]interface{})["name"] = name
+	bodyJsonMap["spec"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["hard"] = hardMap
+
+	_, err = restclient.RequestPost(url, bodyJsonMap, headerMap, true)
+	if err != nil {
+		log.Error("Fail to create resource quota with endpoint: %s, namespace: %s, name: %s, error: %s", kubeApiServerEndPoint, namespace, name, err.Error())
+	}
+	return err
+}
+
+func DeleteResourceQuota(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, name string) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("DeleteResourceQuota Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/resourcequotas/" + name
+	_, err := restclient.RequestDelete(url, nil, headerMap, true)
+	if err != nil {
+		log.Error("Fail to delete resource quota with endpoint: %s, namespace: %s, name: %s, error: %s", kubeApiServerEndPoint, namespace, name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Usage of each resource with the hard limit
+func (resourceQuota *ResourceQuota) GetUsageSlice() []ResourceQuotaUsage {
+	resourceNameSlice := make([]string, 0)
+	for resourceName := range resourceQuota.HardMap {
+		resourceNameSlice = append(resourceNameSlice, resourceName)
+	}
+	sort.Strings(resourceNameSlice)
+
+	usageSlice := make([]ResourceQuotaUsage, 0)
+	for _, resourceName := range resourceNameSlice {
+		hard := resourceQuota.HardMap[resourceName]
+		used, ok := resourceQuota.UsedMap[resourceName]
+		if ok == false {
+			used = "0"
+		}
+		usage := ResourceQuotaUsage{resourceName, hard, used, "", 0}
+		hardMilli, hardErr := ParseQuantityToMilli(hard)
+		usedMilli, usedErr := ParseQuantityToMilli(used)
+		if hardErr == nil && usedErr == nil {
+			remainingMilli := hardMilli - usedMilli
+			if remainingMilli < 0 {
+				remainingMilli = 0
+			}
+			usage.Remaining = FormatMilliQuantity(resourceName, remainingMilli)
+			if hardMilli > 0 {
+				usage.UsedPercentage = float64(usedMilli) * 100 / float64(hardMilli)
+			} else if usedMilli > 0 {
+				usage.UsedPercentage = 100
+			}
+		}
+		usageSlice = append(usageSlice, usage)
+	}
+	return usageSlice
+}
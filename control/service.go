@@ -16,6 +16,8 @@ package control
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/cloudawan/cloudone_utility/logger"
 	"github.com/cloudawan/cloudone_utility/restclient"
 	"strconv"
@@ -48,10 +50,45 @@ func CreateService(kubeApiServerEndPoint string, kubeApiServerToken string, name
 		}
 	}()
 
+	portJsonMapSlice, hasNodePort := getServicePortJsonMapSlice(service.PortSlice)
+
+	bodyJsonMap := make(map[string]interface{})
+	bodyJsonMap["kind"] = "Service"
+	bodyJsonMap["apiVersion"] = "v1"
+	bodyJsonMap["metadata"] = make(map[string]interface{})
+	bodyJsonMap["metadata"].(map[string]interface{})["name"] = service.Name
+	bodyJsonMap["metadata"].(map[string]interface{})["labels"] = service.LabelMap
+	bodyJsonMap["spec"] = make(map[string]interface{})
+	bodyJsonMap["spec"].(map[string]interface{})["ports"] = portJsonMapSlice
+	bodyJsonMap["spec"].(map[string]interface{})["selector"] = service.Selector
+
+	// Use sticky session so the same client will be forwarded to the same pod
+	if service.SessionAffinity != "" {
+		bodyJsonMap["spec"].(map[string]interface{})["sessionAffinity"] = service.SessionAffinity
+	}
+
+	if hasNodePort {
+		bodyJsonMap["spec"].(map[string]interface{})["type"] = "NodePort"
+	}
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/services/"
+	_, err := restclient.RequestPost(url, bodyJsonMap, headerMap, true)
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	return err
+}
+
+func getServicePortJsonMapSlice(portSlice []ServicePort) ([]map[string]interface{}, bool) {
 	hasNodePort := false
 
 	portJsonMapSlice := make([]map[string]interface{}, 0)
-	for _, port := range service.PortSlice {
+	for _, port := range portSlice {
 		portJsonMap := make(map[string]interface{})
 		portJsonMap["name"] = port.Name
 		portJsonMap["protocol"] = port.Protocol
@@ -74,31 +111,60 @@ func CreateService(kubeApiServerEndPoint string, kubeApiServerToken string, name
 		portJsonMapSlice = append(portJsonMapSlice, portJsonMap)
 	}
 
-	bodyJsonMap := make(map[string]interface{})
-	bodyJsonMap["kind"] = "Service"
-	bodyJsonMap["apiVersion"] = "v1"
-	bodyJsonMap["metadata"] = make(map[string]interface{})
-	bodyJsonMap["metadata"].(map[string]interface{})["name"] = service.Name
-	bodyJsonMap["metadata"].(map[string]interface{})["labels"] = service.LabelMap
-	bodyJsonMap["spec"] = make(map[string]interface{})
-	bodyJsonMap["spec"].(map[string]interface{})["ports"] = portJsonMapSlice
-	bodyJsonMap["spec"].(map[string]interface{})["selector"] = service.Selector
+	return portJsonMapSlice, hasNodePort
+}
 
-	// Use sticky session so the same client will be forwarded to the same pod
-	if service.SessionAffinity != "" {
-		bodyJsonMap["spec"].(map[string]interface{})["sessionAffinity"] = service.SessionAffinity
+// Replace the ports of the existing service in place so the cluster ip and the other node ports are kept.
+// The port with the auto-generated node port keeps the node port already allocated for the same target port.
+func UpdateServicePort(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, serviceName string, portSlice []ServicePort) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("UpdateServicePort Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/services/" + serviceName
+	result, err := restclient.RequestGet(url, headerMap, true)
+	if err != nil {
+		log.Error("Fail to get service with endpoint: %s, namespace: %s, service name: %s, error: %s", kubeApiServerEndPoint, namespace, serviceName, err.Error())
+		return err
+	}
+	jsonMap, _ := result.(map[string]interface{})
+	specJsonMap, _ := jsonMap["spec"].(map[string]interface{})
+	if specJsonMap == nil {
+		return errors.New("No spec in the service " + serviceName)
 	}
 
-	if hasNodePort {
-		bodyJsonMap["spec"].(map[string]interface{})["type"] = "NodePort"
+	allocatedNodePortMap := make(map[string]interface{})
+	oldPortJsonSlice, _ := specJsonMap["ports"].([]interface{})
+	for _, oldPortJson := range oldPortJsonSlice {
+		oldPortJsonMap, _ := oldPortJson.(map[string]interface{})
+		if nodePort, ok := oldPortJsonMap["nodePort"]; ok {
+			allocatedNodePortMap[fmt.Sprint(oldPortJsonMap["targetPort"])] = nodePort
+		}
 	}
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
+	portJsonMapSlice, hasNodePort := getServicePortJsonMapSlice(portSlice)
+	for i, port := range portSlice {
+		if port.NodePort == 0 {
+			if nodePort, ok := allocatedNodePortMap[port.TargetPort]; ok {
+				portJsonMapSlice[i]["nodePort"] = nodePort
+			}
+		}
+	}
 
-	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/services/"
-	_, err := restclient.RequestPost(url, bodyJsonMap, headerMap, true)
+	specJsonMap["ports"] = portJsonMapSlice
+	if hasNodePort {
+		specJsonMap["type"] = "NodePort"
+	}
 
+	// The resource version in the body rejects the update if the service is changed after the get
+	_, err = restclient.RequestPut(url, jsonMap, headerMap, true)
 	if err != nil {
 		log.Error(err)
 	}
@@ -214,12 +280,7 @@ func GetAllService(kubeApiServerEndPoint string, kubeApiServerToken string, name
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	url := kubeApiServerEndPoint + "/api/v1/namespaces/" + namespace + "/services/"
-	result, err := restclient.RequestGet(url, headerMap, true)
-	jsonMap, _ := result.(map[string]interface{})
+	jsonMap, err := GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, InformerResourceService, namespace)
 	if err != nil {
 		return nil, err
 	} else {
@@ -33,10 +33,11 @@ const (
 )
 
 type DeployContainerPort struct {
-	Name          string
-	ContainerPort int
-	NodePort      int
-	Protocol      string
+	Name            string
+	ContainerPort   int
+	NodePort        int
+	Protocol        string
+	CertificateName string // For https. The slb certificate to terminate TLS. If empty, TLS is passed through as TCP.
 }
 
 type DeployInformation struct {
@@ -52,6 +53,9 @@ type DeployInformation struct {
 	ExtraJsonMap              map[string]interface{}
 	CreatedTime               time.Time
 	AutoUpdateForNewBuild     bool
+	HostNameSlice             []string         // The virtual hosts routed to the deployment by the slb
+	PathRuleSlice             []DeployPathRule // If empty, all paths of the virtual hosts go to the first http or https port
+	WorkloadKind              string           // If empty, the pods are run by the replication controller
 }
 
 func GetDeployInformationInNamespace(namespace string) ([]DeployInformation, error) {
@@ -82,12 +86,21 @@ func DeployCreate(
 	replicationControllerContainerEnvironmentSlice []control.ReplicationControllerContainerEnvironment,
 	resourceMap map[string]interface{},
 	extraJsonMap map[string]interface{},
-	autoUpdateForNewBuild bool) error {
-	if lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), 0) == false {
+	autoUpdateForNewBuild bool,
+	workloadKind string) (returnedError error) {
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), 0)
+	if err != nil {
+		log.Error(err)
 		return errors.New("Deployment is controlled by the other command")
 	}
 
-	defer lock.ReleaseLock(LockKind, getLockName(namespace, imageInformationName))
+	defer deployLock.Release()
+	// Even a partial failure may change the services
+	defer notifyDeploymentChange()
+	publishDeployProgress(namespace, imageInformationName, DeployOperationCreate, DeployStepStarted, nil)
+	defer func() {
+		publishDeployResult(namespace, imageInformationName, DeployOperationCreate, returnedError)
+	}()
 
 	imageRecord, err := image.GetStorage().LoadImageRecord(imageInformationName, version)
 	if err != nil {
@@ -96,20 +109,81 @@ func DeployCreate(
 	}
 
 	// Check whether the image in the private-registry
-	privateRegistry, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
+	privateRegistry, repositoryName, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
 	if err != nil {
 		log.Error("Get private registry access error: " + err.Error())
 		return err
 	}
-	if privateRegistry.IsImageTagAvailable(imageRecord.ImageInformation, imageRecord.Version) == false {
+	if privateRegistry.IsImageTagAvailable(repositoryName, imageRecord.Version) == false {
 		return errors.New("The image is not in the private-registry")
 	}
 
-	selectorName := imageInformationName
-	replicationControllerName := selectorName + version
-	image := imageRecord.Path
+	// Check whether the image is allowed by the policy of the namespace
+	err = checkImageRecordAllowedInNamespace(namespace, imageRecord)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
-	// Automatically generate the basic default service. For advanced configuration, it should be modified in the service
+	deployInformation := &DeployInformation{
+		namespace,
+		imageInformationName,
+		version,
+		imageRecord.Description,
+		description,
+		replicaAmount,
+		deployContainerPortSlice,
+		replicationControllerContainerEnvironmentSlice,
+		resourceMap,
+		extraJsonMap,
+		time.Now(),
+		autoUpdateForNewBuild,
+		nil,
+		nil,
+		workloadKind,
+	}
+
+	// Check before creating anything so the deployment is not left partially created
+	err = checkResourceQuota(kubeApiServerEndPoint, kubeApiServerToken, namespace, replicaAmount, resourceMap, deployInformation.GetWorkloadKind())
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	err = createDeployService(kubeApiServerEndPoint, kubeApiServerToken, namespace, imageInformationName, deployContainerPortSlice)
+	if err != nil {
+		log.Error("Create service error: %s", err)
+		return err
+	}
+	publishDeployProgress(namespace, imageInformationName, DeployOperationCreate, DeployStepServiceCreated, nil)
+
+	err = workload.create(kubeApiServerEndPoint, kubeApiServerToken, imageRecord.Path)
+	if err != nil {
+		log.Error("Create %s error: %s", deployInformation.GetWorkloadKind(), err)
+		return err
+	}
+	if deployInformation.GetWorkloadKind() == WorkloadKindDeployment {
+		publishDeployProgress(namespace, imageInformationName, DeployOperationCreate, DeployStepDeploymentCreated, nil)
+	} else {
+		publishDeployProgress(namespace, imageInformationName, DeployOperationCreate, DeployStepReplicationControllerCreated, nil)
+	}
+
+	err = GetStorage().saveDeployInformation(deployInformation)
+	if err != nil {
+		log.Error("Save deploy information error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func getDeployServicePortSlice(deployContainerPortSlice []DeployContainerPort) []control.ServicePort {
 	servicePortSlice := make([]control.ServicePort, 0)
 	for _, deployContainerPort := range deployContainerPortSlice {
 		containerPort := strconv.Itoa(deployContainerPort.ContainerPort)
@@ -122,6 +196,13 @@ func DeployCreate(
 		}
 		servicePortSlice = append(servicePortSlice, servicePort)
 	}
+	return servicePortSlice
+}
+
+// Automatically generate the basic default service. For advanced configuration, it should be modified in the service
+func createDeployService(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformationName string, deployContainerPortSlice []DeployContainerPort) error {
+	selectorName := imageInformationName
+	servicePortSlice := getDeployServicePortSlice(deployContainerPortSlice)
 	selectorLabelMap := make(map[string]interface{})
 	selectorLabelMap["name"] = selectorName
 	serviceLabelMap := make(map[string]interface{})
@@ -135,13 +216,22 @@ func DeployCreate(
 		serviceLabelMap,
 		"",
 	}
-	err = control.CreateService(kubeApiServerEndPoint, kubeApiServerToken, namespace, service)
-	if err != nil {
-		log.Error("Create service error: %s", err)
-		return err
-	}
+	return control.CreateService(kubeApiServerEndPoint, kubeApiServerToken, namespace, service)
+}
+
+// Used by both the repair and the heal so the service is fixed in place without the downtime of recreating it
+func repairDeployServicePort(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformationName string, deployContainerPortSlice []DeployContainerPort) error {
+	return control.UpdateServicePort(kubeApiServerEndPoint, kubeApiServerToken, namespace, imageInformationName, getDeployServicePortSlice(deployContainerPortSlice))
+}
 
-	// Replication controller
+func createDeployReplicationController(
+	kubeApiServerEndPoint string, kubeApiServerToken string,
+	namespace string, selectorName string, replicationControllerName string,
+	version string, image string, replicaAmount int,
+	deployContainerPortSlice []DeployContainerPort,
+	replicationControllerContainerEnvironmentSlice []control.ReplicationControllerContainerEnvironment,
+	resourceMap map[string]interface{},
+	extraJsonMap map[string]interface{}) error {
 	replicationControllerContainerPortSlice := make([]control.ReplicationControllerContainerPort, 0)
 	for _, deployContainerPort := range deployContainerPortSlice {
 		replicationControllerContainerPortSlice = append(replicationControllerContainerPortSlice,
@@ -173,46 +263,29 @@ func DeployCreate(
 		extraJsonMap,
 	}
 
-	err = control.CreateReplicationController(kubeApiServerEndPoint, kubeApiServerToken,
+	return control.CreateReplicationController(kubeApiServerEndPoint, kubeApiServerToken,
 		namespace, replicationController)
-	if err != nil {
-		log.Error("Create replication controller error: %s", err)
-		return err
-	}
-
-	deployInformation := &DeployInformation{
-		namespace,
-		imageInformationName,
-		version,
-		imageRecord.Description,
-		description,
-		replicaAmount,
-		deployContainerPortSlice,
-		replicationControllerContainerEnvironmentSlice,
-		resourceMap,
-		extraJsonMap,
-		time.Now(),
-		autoUpdateForNewBuild,
-	}
-
-	err = GetStorage().saveDeployInformation(deployInformation)
-	if err != nil {
-		log.Error("Save deploy information error: %s", err)
-		return err
-	}
-
-	return nil
 }
 
 func DeployUpdate(
 	kubeApiServerEndPoint string, kubeApiServerToken string, namespace string,
 	imageInformationName string, version string, description string,
-	environmentSlice []control.ReplicationControllerContainerEnvironment) error {
-	if lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), 0) == false {
+	environmentSlice []control.ReplicationControllerContainerEnvironment) (returnedError error) {
+	// Rolling update may take long so keep the lease short and renew it
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), lock.LockDefaultRenewalTimeout)
+	if err != nil {
+		log.Error(err)
 		return errors.New("Deployment is controlled by the other command")
 	}
 
-	defer lock.ReleaseLock(LockKind, getLockName(namespace, imageInformationName))
+	defer deployLock.Release()
+	deployLock.StartRenewal()
+	// Even a partial failure may change the services
+	defer notifyDeploymentChange()
+	publishDeployProgress(namespace, imageInformationName, DeployOperationUpdate, DeployStepStarted, nil)
+	defer func() {
+		publishDeployResult(namespace, imageInformationName, DeployOperationUpdate, returnedError)
+	}()
 
 	imageRecord, err := image.GetStorage().LoadImageRecord(imageInformationName, version)
 	if err != nil {
@@ -221,36 +294,51 @@ func DeployUpdate(
 	}
 
 	// Check whether the image in the private-registry
-	privateRegistry, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
+	privateRegistry, repositoryName, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
 	if err != nil {
 		log.Error("Get private registry access error: " + err.Error())
 		return err
 	}
-	if privateRegistry.IsImageTagAvailable(imageRecord.ImageInformation, imageRecord.Version) == false {
+	if privateRegistry.IsImageTagAvailable(repositoryName, imageRecord.Version) == false {
 		return errors.New("The image is not in the private-registry")
 	}
 
+	// Check whether the image is allowed by the policy of the namespace
+	err = checkImageRecordAllowedInNamespace(namespace, imageRecord)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
 	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformationName)
 	if err != nil {
 		log.Error("Load deploy information error: %s imageInformationName %s version %s", err, imageInformationName, version)
 		return err
 	}
 
-	oldVersion := deployInformation.CurrentVersion
+	// The replication controller is named with the version before the update
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
 	deployInformation.CurrentVersion = version
 	deployInformation.Description = description
 
 	deployInformation.CurrentVersionDescription = imageRecord.Description
 
-	oldReplicationControllerName := deployInformation.ImageInformationName + oldVersion
-	newReplicationControllerName := deployInformation.ImageInformationName + version
+	publishDeployProgress(namespace, imageInformationName, DeployOperationUpdate, DeployStepRollingUpdate, nil)
+	err = workload.rollingUpdate(kubeApiServerEndPoint, kubeApiServerToken, imageRecord.Version, imageRecord.Path, environmentSlice)
+	if err != nil {
+		log.Error("Rollingupdate %s error: %s", deployInformation.GetWorkloadKind(), err)
+		return err
+	}
 
-	err = control.RollingUpdateReplicationControllerWithSingleContainer(
-		kubeApiServerEndPoint, kubeApiServerToken, namespace,
-		oldReplicationControllerName, newReplicationControllerName,
-		imageRecord.Path, imageRecord.Version, waitingDuration, environmentSlice)
+	// Not to overwrite the deploy information saved by the one acquiring the lock after it is lost
+	err = deployLock.Validate()
 	if err != nil {
-		log.Error("Rollingupdate replication controller error: %s", err)
+		log.Error(err)
 		return err
 	}
 
@@ -263,12 +351,20 @@ func DeployUpdate(
 	return nil
 }
 
-func DeployDelete(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformation string) error {
-	if lock.AcquireLock(LockKind, getLockName(namespace, imageInformation), 0) == false {
+func DeployDelete(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformation string) (returnedError error) {
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformation), 0)
+	if err != nil {
+		log.Error(err)
 		return errors.New("Deployment is controlled by the other command")
 	}
 
-	defer lock.ReleaseLock(LockKind, getLockName(namespace, imageInformation))
+	defer deployLock.Release()
+	// Even a partial failure may change the services
+	defer notifyDeploymentChange()
+	publishDeployProgress(namespace, imageInformation, DeployOperationDelete, DeployStepStarted, nil)
+	defer func() {
+		publishDeployResult(namespace, imageInformation, DeployOperationDelete, returnedError)
+	}()
 
 	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformation)
 	if err != nil {
@@ -276,15 +372,19 @@ func DeployDelete(kubeApiServerEndPoint string, kubeApiServerToken string, names
 		return err
 	}
 
-	err = GetStorage().DeleteDeployInformation(namespace, imageInformation)
+	workload, err := newWorkload(deployInformation)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	replicationControllerName := deployInformation.ImageInformationName + deployInformation.CurrentVersion
+	err = GetStorage().DeleteDeployInformation(namespace, imageInformation)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
-	err = control.DeleteReplicationControllerAndRelatedPod(kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName)
+	err = workload.delete(kubeApiServerEndPoint, kubeApiServerToken)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -299,12 +399,18 @@ func DeployDelete(kubeApiServerEndPoint string, kubeApiServerToken string, names
 	return nil
 }
 
-func DeployResize(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformation string, size int) error {
-	if lock.AcquireLock(LockKind, getLockName(namespace, imageInformation), 0) == false {
+func DeployResize(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformation string, size int) (returnedError error) {
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformation), 0)
+	if err != nil {
+		log.Error(err)
 		return errors.New("Deployment is controlled by the other command")
 	}
 
-	defer lock.ReleaseLock(LockKind, getLockName(namespace, imageInformation))
+	defer deployLock.Release()
+	publishDeployProgress(namespace, imageInformation, DeployOperationResize, DeployStepStarted, nil)
+	defer func() {
+		publishDeployResult(namespace, imageInformation, DeployOperationResize, returnedError)
+	}()
 
 	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformation)
 	if err != nil {
@@ -312,11 +418,13 @@ func DeployResize(kubeApiServerEndPoint string, kubeApiServerToken string, names
 		return err
 	}
 
-	replicationControllerName := deployInformation.ImageInformationName + deployInformation.CurrentVersion
-
-	delta := size - deployInformation.ReplicaAmount
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
-	_, _, err = control.ResizeReplicationController(kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName, delta, deployInformation.ReplicaAmount+delta, 1)
+	err = workload.resize(kubeApiServerEndPoint, kubeApiServerToken, size)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -332,7 +440,14 @@ func DeployResize(kubeApiServerEndPoint string, kubeApiServerToken string, names
 	return nil
 }
 
+// The image is deleted from the private registry by digest so every version sharing the same image is checked
 func IsImageRecordUsed(imageInformationName string, imageRecordVersion string) (bool, error) {
+	versionSlice, err := image.GetImageRecordVersionSharingImage(imageInformationName, imageRecordVersion)
+	if err != nil {
+		log.Error(err)
+		return false, err
+	}
+
 	deployInformationSlice, err := GetStorage().LoadAllDeployInformation()
 	if err != nil {
 		log.Error(err)
@@ -340,8 +455,13 @@ func IsImageRecordUsed(imageInformationName string, imageRecordVersion string) (
 	}
 
 	for _, deployInformation := range deployInformationSlice {
-		if deployInformation.ImageInformationName == imageInformationName && deployInformation.CurrentVersion == imageRecordVersion {
-			return true, nil
+		if deployInformation.ImageInformationName != imageInformationName {
+			continue
+		}
+		for _, version := range versionSlice {
+			if deployInformation.CurrentVersion == version {
+				return true, nil
+			}
 		}
 	}
 	return false, nil
@@ -15,6 +15,7 @@
 package deploy
 
 import (
+	"errors"
 	"github.com/cloudawan/cloudone/control"
 	"strconv"
 )
@@ -40,6 +41,8 @@ func GetBlueGreenServiceName(imageInformation string) string {
 }
 
 func UpdateDeployBlueGreen(kubeApiServerEndPoint string, kubeApiServerToken string, deployBlueGreen *DeployBlueGreen) error {
+	defer notifyDeploymentChange()
+
 	deployInformation, err := GetStorage().LoadDeployInformation(
 		deployBlueGreen.Namespace, deployBlueGreen.ImageInformation)
 	if err != nil {
@@ -48,18 +51,29 @@ func UpdateDeployBlueGreen(kubeApiServerEndPoint string, kubeApiServerToken stri
 		return err
 	}
 
-	replicationController, err := control.GetReplicationController(
-		kubeApiServerEndPoint, kubeApiServerToken, deployBlueGreen.Namespace,
-		getBlueGreenReplicationControllerName(deployInformation.ImageInformationName, deployInformation.CurrentVersion))
-	if err != nil {
-		log.Error("Fail to load target replication controller information %s in namespace %s with error %s",
-			deployInformation.ImageInformationName+deployInformation.CurrentVersion, deployBlueGreen.Namespace, err)
-		return err
-	}
-
 	// TODO support multiple ports
-	portName := replicationController.ContainerSlice[0].PortSlice[0].Name
-	containerPort := replicationController.ContainerSlice[0].PortSlice[0].ContainerPort
+	portName := ""
+	containerPort := 0
+	if deployInformation.GetWorkloadKind() == WorkloadKindDeployment {
+		// The deployment is created from the deploy information and keeps the ports in the rolling updates
+		if len(deployInformation.ContainerPortSlice) == 0 {
+			return errors.New("Deployment " + deployInformation.ImageInformationName + " has no container port")
+		}
+		portName = deployInformation.ContainerPortSlice[0].Name
+		containerPort = deployInformation.ContainerPortSlice[0].ContainerPort
+	} else {
+		replicationController, err := control.GetReplicationController(
+			kubeApiServerEndPoint, kubeApiServerToken, deployBlueGreen.Namespace,
+			getBlueGreenReplicationControllerName(deployInformation.ImageInformationName, deployInformation.CurrentVersion))
+		if err != nil {
+			log.Error("Fail to load target replication controller information %s in namespace %s with error %s",
+				deployInformation.ImageInformationName+deployInformation.CurrentVersion, deployBlueGreen.Namespace, err)
+			return err
+		}
+
+		portName = replicationController.ContainerSlice[0].PortSlice[0].Name
+		containerPort = replicationController.ContainerSlice[0].PortSlice[0].ContainerPort
+	}
 
 	// Clean all the previous blue green deployment
 	CleanAllServiceUnderBlueGreenDeployment(kubeApiServerEndPoint, kubeApiServerToken, deployBlueGreen.ImageInformation)
@@ -102,6 +116,8 @@ func UpdateDeployBlueGreen(kubeApiServerEndPoint string, kubeApiServerToken stri
 }
 
 func CleanAllServiceUnderBlueGreenDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, imageInformationName string) error {
+	defer notifyDeploymentChange()
+
 	// Clean all service with this deployment name
 	namespaceSlice, err := control.GetAllNamespaceName(kubeApiServerEndPoint, kubeApiServerToken)
 	if err != nil {
@@ -0,0 +1,91 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"github.com/cloudawan/cloudone/event"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"sync"
+)
+
+const (
+	DeployOperationCreate  = "create"
+	DeployOperationUpdate  = "update"
+	DeployOperationDelete  = "delete"
+	DeployOperationResize  = "resize"
+	DeployOperationMigrate = "migrate"
+)
+
+const (
+	DeployStepStarted                      = "started"
+	DeployStepServiceCreated               = "serviceCreated"
+	DeployStepReplicationControllerCreated = "replicationControllerCreated"
+	DeployStepDeploymentCreated            = "deploymentCreated"
+	DeployStepRollingUpdate                = "rollingUpdate"
+	DeployStepSucceeded                    = "succeeded"
+	DeployStepFailed                       = "failed"
+)
+
+// The packages depending on the deployments like slb register here since deploy can't import them
+var deploymentChangeListenerSlice = make([]func(), 0)
+var deploymentChangeListenerMutex = &sync.Mutex{}
+
+// The listener is called after a deployment or a blue green deployment is changed so it should return quickly
+func AddDeploymentChangeListener(listener func()) {
+	deploymentChangeListenerMutex.Lock()
+	defer deploymentChangeListenerMutex.Unlock()
+
+	deploymentChangeListenerSlice = append(deploymentChangeListenerSlice, listener)
+}
+
+func notifyDeploymentChange() {
+	deploymentChangeListenerMutex.Lock()
+	listenerSlice := make([]func(), len(deploymentChangeListenerSlice))
+	copy(listenerSlice, deploymentChangeListenerSlice)
+	deploymentChangeListenerMutex.Unlock()
+
+	for _, listener := range listenerSlice {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					log.Error("Notify deployment change error: %s", err)
+					log.Error(logger.GetStackTrace(4096, false))
+				}
+			}()
+			listener()
+		}()
+	}
+}
+
+// Publish the progress of the operation on the deployment for the event stream
+func publishDeployProgress(namespace string, imageInformationName string, operation string, step string, err error) {
+	dataMap := make(map[string]interface{})
+	dataMap["Operation"] = operation
+	dataMap["Step"] = step
+	message := "Deployment " + operation + " " + step
+	if err != nil {
+		dataMap["Error"] = err.Error()
+		message += " error: " + err.Error()
+	}
+	event.Publish(event.KindDeployProgress, namespace, imageInformationName, message, dataMap)
+}
+
+func publishDeployResult(namespace string, imageInformationName string, operation string, err error) {
+	if err != nil {
+		publishDeployProgress(namespace, imageInformationName, operation, DeployStepFailed, err)
+	} else {
+		publishDeployProgress(namespace, imageInformationName, operation, DeployStepSucceeded, nil)
+	}
+}
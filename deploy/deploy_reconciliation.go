@@ -0,0 +1,402 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone/application"
+	"github.com/cloudawan/cloudone/control"
+	"github.com/cloudawan/cloudone/image"
+	"github.com/cloudawan/cloudone/utility/lock"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DriftOwnerKindDeployment         = "deployment"
+	DriftOwnerKindClusterApplication = "clusterApplication"
+)
+
+const (
+	DriftKindUnavailable                  = "unavailable"
+	DriftKindReplicationControllerMissing = "replicationControllerMissing"
+	DriftKindDeploymentMissing            = "deploymentMissing"
+	DriftKindImage                        = "image"
+	DriftKindReplicaAmount                = "replicaAmount"
+	DriftKindServiceMissing               = "serviceMissing"
+	DriftKindServicePort                  = "servicePort"
+)
+
+// The difference between the stored spec and the state in Kubernetes
+type DeployDrift struct {
+	OwnerKind string
+	Namespace string
+	Name      string // The image information of the deployment or the name of the cluster application
+	Kind      string
+	Expected  string
+	Actual    string
+	Healable  bool // Could be healed by applying the stored spec again
+	Healed    bool
+	HealError string
+}
+
+type ReconciliationStatus struct {
+	ReconciledTime time.Time
+	SelfHeal       bool
+	LastError      string
+	DriftSlice     []DeployDrift
+}
+
+var reconciliationMutex = &sync.Mutex{}
+var reconciliationStatus = ReconciliationStatus{}
+
+func GetReconciliationStatus() ReconciliationStatus {
+	reconciliationMutex.Lock()
+	defer reconciliationMutex.Unlock()
+
+	returnedReconciliationStatus := reconciliationStatus
+	returnedReconciliationStatus.DriftSlice = make([]DeployDrift, 0)
+	returnedReconciliationStatus.DriftSlice = append(returnedReconciliationStatus.DriftSlice, reconciliationStatus.DriftSlice...)
+	return returnedReconciliationStatus
+}
+
+// Compare all the deployments and the cluster applications with Kubernetes. The drifts are healed if selfHeal is set.
+// The deployments being changed by the other command are skipped since they are expected to differ for a while.
+func ReconcileAllDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, selfHeal bool) (ReconciliationStatus, error) {
+	status, err := reconcileAllDeployment(kubeApiServerEndPoint, kubeApiServerToken, selfHeal)
+	if err != nil {
+		log.Error(err)
+		status.LastError = err.Error()
+	}
+
+	reconciliationMutex.Lock()
+	reconciliationStatus = status
+	reconciliationMutex.Unlock()
+
+	return status, err
+}
+
+func reconcileAllDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, selfHeal bool) (ReconciliationStatus, error) {
+	status := ReconciliationStatus{
+		time.Now(),
+		selfHeal,
+		"",
+		make([]DeployDrift, 0),
+	}
+
+	deployInformationSlice, err := GetStorage().LoadAllDeployInformation()
+	if err != nil {
+		log.Error(err)
+		return status, err
+	}
+
+	deployClusterApplicationSlice, err := GetStorage().LoadAllDeployClusterApplication()
+	if err != nil {
+		log.Error(err)
+		return status, err
+	}
+
+	cache := newKubernetesCache(kubeApiServerEndPoint, kubeApiServerToken)
+	healed := false
+
+	for i, deployInformation := range deployInformationSlice {
+		if lock.LockAvailable(LockKind, getLockName(deployInformation.Namespace, deployInformation.ImageInformationName)) == false {
+			continue
+		}
+
+		driftSlice := compareDeployInformation(cache, &deployInformationSlice[i])
+		if selfHeal && isAnyDriftHealable(driftSlice) {
+			driftSlice = healDeployInformation(kubeApiServerEndPoint, kubeApiServerToken, deployInformation.Namespace, deployInformation.ImageInformationName, driftSlice)
+			healed = true
+		}
+		status.DriftSlice = append(status.DriftSlice, driftSlice...)
+	}
+
+	for i := range deployClusterApplicationSlice {
+		driftSlice := compareDeployClusterApplication(cache, &deployClusterApplicationSlice[i])
+		if selfHeal && isAnyDriftHealable(driftSlice) {
+			driftSlice = healDeployClusterApplication(kubeApiServerEndPoint, kubeApiServerToken, &deployClusterApplicationSlice[i], driftSlice)
+			healed = true
+		}
+		status.DriftSlice = append(status.DriftSlice, driftSlice...)
+	}
+
+	sort.Sort(deployDriftSorter(status.DriftSlice))
+
+	if healed {
+		notifyDeploymentChange()
+	}
+
+	return status, nil
+}
+
+func isAnyDriftHealable(driftSlice []DeployDrift) bool {
+	for _, drift := range driftSlice {
+		if drift.Healable {
+			return true
+		}
+	}
+	return false
+}
+
+func compareDeployInformation(cache *kubernetesCache, deployInformation *DeployInformation) []DeployDrift {
+	driftSlice := make([]DeployDrift, 0)
+	addDrift := func(kind string, expected string, actual string, healable bool) {
+		driftSlice = append(driftSlice, DeployDrift{
+			DriftOwnerKindDeployment,
+			deployInformation.Namespace,
+			deployInformation.ImageInformationName,
+			kind,
+			expected,
+			actual,
+			healable,
+			false,
+			"",
+		})
+	}
+
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		addDrift(DriftKindUnavailable, "", err.Error(), false)
+		return driftSlice
+	}
+
+	var workloadNameMap map[string]bool
+	missingDriftKind := DriftKindReplicationControllerMissing
+	if deployInformation.GetWorkloadKind() == WorkloadKindDeployment {
+		workloadNameMap, err = cache.getDeploymentNameMap(deployInformation.Namespace)
+		missingDriftKind = DriftKindDeploymentMissing
+	} else {
+		workloadNameMap, err = cache.getReplicationControllerNameMap(deployInformation.Namespace)
+	}
+	if err != nil {
+		addDrift(DriftKindUnavailable, "", err.Error(), false)
+		return driftSlice
+	}
+
+	if workloadNameMap[workload.getName()] == false {
+		addDrift(missingDriftKind, workload.getName(), "", true)
+	} else {
+		workloadStatus, err := workload.getStatus(cache.kubeApiServerEndPoint, cache.kubeApiServerToken)
+		if err != nil {
+			addDrift(DriftKindUnavailable, "", err.Error(), false)
+		} else {
+			imageRecord, err := image.GetStorage().LoadImageRecord(deployInformation.ImageInformationName, deployInformation.CurrentVersion)
+			if err != nil {
+				addDrift(DriftKindUnavailable, "", "Fail to load image record with error "+err.Error(), false)
+			} else if workloadStatus.Image != imageRecord.Path {
+				addDrift(DriftKindImage, imageRecord.Path, workloadStatus.Image, true)
+			}
+
+			if workloadStatus.ReplicaAmount != deployInformation.ReplicaAmount {
+				addDrift(DriftKindReplicaAmount, strconv.Itoa(deployInformation.ReplicaAmount), strconv.Itoa(workloadStatus.ReplicaAmount), true)
+			}
+		}
+	}
+
+	serviceMap, err := cache.getServiceMap(deployInformation.Namespace)
+	if err != nil {
+		addDrift(DriftKindUnavailable, "", err.Error(), false)
+		return driftSlice
+	}
+
+	service, ok := serviceMap[deployInformation.ImageInformationName]
+	if ok == false {
+		addDrift(DriftKindServiceMissing, deployInformation.ImageInformationName, "", true)
+	} else if description := checkDeployServicePort(deployInformation, &service); description != "" {
+		addDrift(DriftKindServicePort, "", description, true)
+	}
+
+	return driftSlice
+}
+
+// Compare again with the lock held so the drifts caused by the other command just finished are not healed
+func healDeployInformation(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformationName string, comparedDriftSlice []DeployDrift) []DeployDrift {
+	setHealError := func(err error) []DeployDrift {
+		for i := range comparedDriftSlice {
+			if comparedDriftSlice[i].Healable {
+				comparedDriftSlice[i].HealError = err.Error()
+			}
+		}
+		return comparedDriftSlice
+	}
+
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), 0)
+	if err != nil {
+		log.Error(err)
+		return setHealError(errors.New("Deployment is controlled by the other command"))
+	}
+	defer deployLock.Release()
+
+	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return setHealError(err)
+	}
+
+	driftSlice := compareDeployInformation(newKubernetesCache(kubeApiServerEndPoint, kubeApiServerToken), deployInformation)
+
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		log.Error(err)
+		return setHealError(err)
+	}
+
+	workloadCreated := false
+	for i, drift := range driftSlice {
+		if drift.Healable == false {
+			continue
+		}
+
+		var err error = nil
+		switch drift.Kind {
+		case DriftKindImage, DriftKindReplicationControllerMissing, DriftKindDeploymentMissing:
+			var imageRecord *image.ImageRecord
+			imageRecord, err = image.GetStorage().LoadImageRecord(deployInformation.ImageInformationName, deployInformation.CurrentVersion)
+			if err == nil {
+				if drift.Kind == DriftKindImage {
+					err = workload.repairImage(kubeApiServerEndPoint, kubeApiServerToken, imageRecord.Path)
+				} else {
+					err = workload.create(kubeApiServerEndPoint, kubeApiServerToken, imageRecord.Path)
+				}
+			}
+			workloadCreated = err == nil
+		case DriftKindReplicaAmount:
+			if workloadCreated == false {
+				err = workload.resize(kubeApiServerEndPoint, kubeApiServerToken, deployInformation.ReplicaAmount)
+			}
+		case DriftKindServicePort:
+			err = repairDeployServicePort(kubeApiServerEndPoint, kubeApiServerToken, namespace, imageInformationName, deployInformation.ContainerPortSlice)
+		case DriftKindServiceMissing:
+			err = createDeployService(kubeApiServerEndPoint, kubeApiServerToken, namespace, imageInformationName, deployInformation.ContainerPortSlice)
+		default:
+			err = errors.New("No such kind " + drift.Kind)
+		}
+
+		if err != nil {
+			log.Error("Heal drift %v error: %s", drift, err)
+			driftSlice[i].HealError = err.Error()
+		} else {
+			log.Info("Heal drift %v", drift)
+			driftSlice[i].Healed = true
+		}
+	}
+
+	return driftSlice
+}
+
+func compareDeployClusterApplication(cache *kubernetesCache, deployClusterApplication *DeployClusterApplication) []DeployDrift {
+	driftSlice := make([]DeployDrift, 0)
+	addDrift := func(kind string, expected string, actual string, healable bool) {
+		driftSlice = append(driftSlice, DeployDrift{
+			DriftOwnerKindClusterApplication,
+			deployClusterApplication.Namespace,
+			deployClusterApplication.Name,
+			kind,
+			expected,
+			actual,
+			healable,
+			false,
+			"",
+		})
+	}
+
+	serviceMap, err := cache.getServiceMap(deployClusterApplication.Namespace)
+	if err != nil {
+		addDrift(DriftKindUnavailable, "", err.Error(), false)
+		return driftSlice
+	}
+	// The service is created outside of cloudone so it couldn't be healed
+	if _, ok := serviceMap[deployClusterApplication.ServiceName]; ok == false {
+		addDrift(DriftKindServiceMissing, deployClusterApplication.ServiceName, "", false)
+	}
+
+	replicationControllerNameMap, err := cache.getReplicationControllerNameMap(deployClusterApplication.Namespace)
+	if err != nil {
+		addDrift(DriftKindUnavailable, "", err.Error(), false)
+		return driftSlice
+	}
+
+	cluster, err := application.GetStorage().LoadClusterApplication(deployClusterApplication.Name)
+	if err != nil {
+		addDrift(DriftKindUnavailable, "", "Fail to load cluster application with error "+err.Error(), false)
+		return driftSlice
+	}
+
+	for _, replicationControllerName := range deployClusterApplication.ReplicationControllerNameSlice {
+		if replicationControllerNameMap[replicationControllerName] == false {
+			// Only the script knows how to create the replication controllers
+			addDrift(DriftKindReplicationControllerMissing, replicationControllerName, "", cluster.ScriptType == "python")
+			continue
+		}
+
+		// The size means the replica amount of each replication controller only if there is no script
+		if cluster.ScriptType == "none" {
+			replicationController, err := control.GetReplicationController(cache.kubeApiServerEndPoint, cache.kubeApiServerToken,
+				deployClusterApplication.Namespace, replicationControllerName)
+			if err != nil {
+				addDrift(DriftKindUnavailable, "", err.Error(), false)
+			} else if replicationController.ReplicaAmount != deployClusterApplication.Size {
+				addDrift(DriftKindReplicaAmount, strconv.Itoa(deployClusterApplication.Size), strconv.Itoa(replicationController.ReplicaAmount), true)
+			}
+		}
+	}
+
+	return driftSlice
+}
+
+// Resize to the stored size so the script or the replication controllers apply it again
+func healDeployClusterApplication(kubeApiServerEndPoint string, kubeApiServerToken string, deployClusterApplication *DeployClusterApplication, driftSlice []DeployDrift) []DeployDrift {
+	err := ResizeDeployClusterApplication(kubeApiServerEndPoint, kubeApiServerToken, deployClusterApplication.Namespace,
+		deployClusterApplication.Name, deployClusterApplication.EnvironmentSlice, deployClusterApplication.Size)
+	for i, drift := range driftSlice {
+		if drift.Healable == false {
+			continue
+		}
+		if err != nil {
+			log.Error("Heal drift %v error: %s", drift, err)
+			driftSlice[i].HealError = err.Error()
+		} else {
+			log.Info("Heal drift %v", drift)
+			driftSlice[i].Healed = true
+		}
+	}
+	return driftSlice
+}
+
+type deployDriftSorter []DeployDrift
+
+func (deployDriftSlice deployDriftSorter) Len() int {
+	return len(deployDriftSlice)
+}
+
+func (deployDriftSlice deployDriftSorter) Less(i, j int) bool {
+	if deployDriftSlice[i].Namespace != deployDriftSlice[j].Namespace {
+		return deployDriftSlice[i].Namespace < deployDriftSlice[j].Namespace
+	}
+	if deployDriftSlice[i].OwnerKind != deployDriftSlice[j].OwnerKind {
+		return deployDriftSlice[i].OwnerKind < deployDriftSlice[j].OwnerKind
+	}
+	if deployDriftSlice[i].Name != deployDriftSlice[j].Name {
+		return deployDriftSlice[i].Name < deployDriftSlice[j].Name
+	}
+	return deployDriftSlice[i].Kind < deployDriftSlice[j].Kind
+}
+
+func (deployDriftSlice deployDriftSorter) Swap(i, j int) {
+	deployDriftSlice[i], deployDriftSlice[j] = deployDriftSlice[j], deployDriftSlice[i]
+}
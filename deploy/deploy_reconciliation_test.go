@@ -0,0 +1,51 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestIsAnyDriftHealable(t *testing.T) {
+	driftSlice := []DeployDrift{
+		DeployDrift{DriftOwnerKindDeployment, "qa", "test", DriftKindUnavailable, "", "timeout", false, false, ""},
+	}
+	if isAnyDriftHealable(driftSlice) {
+		t.Errorf("The drift which couldn't be healed should not trigger healing")
+	}
+
+	driftSlice = append(driftSlice, DeployDrift{DriftOwnerKindDeployment, "qa", "test", DriftKindReplicaAmount, "2", "1", true, false, ""})
+	if isAnyDriftHealable(driftSlice) == false {
+		t.Errorf("The healable drift should trigger healing")
+	}
+}
+
+func TestDeployDriftSorter(t *testing.T) {
+	driftSlice := []DeployDrift{
+		DeployDrift{DriftOwnerKindDeployment, "qa", "web", DriftKindServiceMissing, "web", "", true, false, ""},
+		DeployDrift{DriftOwnerKindDeployment, "qa", "web", DriftKindImage, "a", "b", true, false, ""},
+		DeployDrift{DriftOwnerKindClusterApplication, "qa", "redis", DriftKindReplicaAmount, "3", "2", true, false, ""},
+		DeployDrift{DriftOwnerKindDeployment, "dev", "web", DriftKindReplicaAmount, "1", "0", true, false, ""},
+	}
+	sort.Sort(deployDriftSorter(driftSlice))
+
+	if driftSlice[0].Namespace != "dev" ||
+		driftSlice[1].OwnerKind != DriftOwnerKindClusterApplication ||
+		driftSlice[2].Kind != DriftKindImage ||
+		driftSlice[3].Kind != DriftKindServiceMissing {
+		t.Errorf("The drifts should be sorted by namespace, owner kind, name and kind but get %v", driftSlice)
+	}
+}
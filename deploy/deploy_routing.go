@@ -0,0 +1,132 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone/utility/lock"
+	"strconv"
+	"strings"
+)
+
+// Route the requests of the virtual hosts with the path prefix to the container port
+type DeployPathRule struct {
+	PathPrefix    string
+	ContainerPort int
+}
+
+func UpdateDeployRouting(namespace string, imageInformationName string, hostNameSlice []string, pathRuleSlice []DeployPathRule) error {
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), 0)
+	if err != nil {
+		log.Error(err)
+		return errors.New("Deployment is controlled by the other command")
+	}
+
+	defer deployLock.Release()
+
+	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformationName)
+	if err != nil {
+		log.Error("Load deploy information error: %s namespace %s imageInformationName %s", err, namespace, imageInformationName)
+		return err
+	}
+
+	err = checkDeployRouting(deployInformation, hostNameSlice, pathRuleSlice)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	deployInformationSlice, err := GetStorage().LoadAllDeployInformation()
+	if err != nil {
+		log.Error("Load all deploy information error: %s", err)
+		return err
+	}
+
+	err = checkHostNameOwner(deployInformation, hostNameSlice, deployInformationSlice)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	deployInformation.HostNameSlice = hostNameSlice
+	deployInformation.PathRuleSlice = pathRuleSlice
+
+	err = GetStorage().saveDeployInformation(deployInformation)
+	if err != nil {
+		log.Error("Save deploy information error: %s", err)
+		return err
+	}
+
+	notifyDeploymentChange()
+
+	return nil
+}
+
+func checkDeployRouting(deployInformation *DeployInformation, hostNameSlice []string, pathRuleSlice []DeployPathRule) error {
+	for _, hostName := range hostNameSlice {
+		if hostName == "" || strings.ContainsAny(hostName, "/: ") {
+			return errors.New("Invalid host name " + hostName)
+		}
+	}
+
+	if len(pathRuleSlice) > 0 && len(hostNameSlice) == 0 {
+		return errors.New("The path rules need at least one host name")
+	}
+
+	pathPrefixMap := make(map[string]bool)
+	for _, pathRule := range pathRuleSlice {
+		if strings.HasPrefix(pathRule.PathPrefix, "/") == false {
+			return errors.New("Path prefix " + pathRule.PathPrefix + " doesn't start with /")
+		}
+		if pathPrefixMap[pathRule.PathPrefix] {
+			return errors.New("Duplicate path prefix " + pathRule.PathPrefix)
+		}
+		pathPrefixMap[pathRule.PathPrefix] = true
+
+		found := false
+		for _, containerPort := range deployInformation.ContainerPortSlice {
+			if containerPort.ContainerPort == pathRule.ContainerPort {
+				if containerPort.Protocol != ProtocolTypeHTTP && containerPort.Protocol != ProtocolTypeHTTPS {
+					return errors.New("Container port " + strconv.Itoa(pathRule.ContainerPort) + " of path prefix " + pathRule.PathPrefix + " is not http or https")
+				}
+				found = true
+			}
+		}
+		if found == false {
+			return errors.New("Container port " + strconv.Itoa(pathRule.ContainerPort) + " of path prefix " + pathRule.PathPrefix + " doesn't exist")
+		}
+	}
+
+	return nil
+}
+
+// The virtual host is routed to only one deployment so the other deployments or namespaces can't take its traffic
+func checkHostNameOwner(deployInformation *DeployInformation, hostNameSlice []string, deployInformationSlice []DeployInformation) error {
+	for _, otherDeployInformation := range deployInformationSlice {
+		if otherDeployInformation.Namespace == deployInformation.Namespace &&
+			otherDeployInformation.ImageInformationName == deployInformation.ImageInformationName {
+			continue
+		}
+		for _, hostName := range hostNameSlice {
+			for _, otherHostName := range otherDeployInformation.HostNameSlice {
+				if strings.EqualFold(hostName, otherHostName) {
+					return errors.New("Host name " + hostName + " is already routed to the deployment " +
+						otherDeployInformation.ImageInformationName + " in namespace " + otherDeployInformation.Namespace)
+				}
+			}
+		}
+	}
+	return nil
+}
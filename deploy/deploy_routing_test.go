@@ -0,0 +1,76 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"testing"
+)
+
+func TestCheckDeployRouting(t *testing.T) {
+	deployInformation := &DeployInformation{}
+	deployInformation.ContainerPortSlice = []DeployContainerPort{
+		DeployContainerPort{"web", 8080, 0, ProtocolTypeHTTP, ""},
+		DeployContainerPort{"tls", 8443, 0, ProtocolTypeHTTPS, "example"},
+		DeployContainerPort{"db", 5432, 0, ProtocolTypeOther, ""},
+	}
+
+	pathRuleSlice := []DeployPathRule{
+		DeployPathRule{"/", 8080},
+		DeployPathRule{"/secure", 8443},
+	}
+	if err := checkDeployRouting(deployInformation, []string{"www.example.com"}, pathRuleSlice); err != nil {
+		t.Errorf("The valid routing should be accepted but get error %s", err)
+	}
+
+	if checkDeployRouting(deployInformation, nil, pathRuleSlice) == nil {
+		t.Errorf("The path rules without host name should be rejected")
+	}
+	if checkDeployRouting(deployInformation, []string{"www.example.com/a"}, nil) == nil {
+		t.Errorf("The invalid host name should be rejected")
+	}
+	if checkDeployRouting(deployInformation, []string{"www.example.com"}, []DeployPathRule{DeployPathRule{"api", 8080}}) == nil {
+		t.Errorf("The path prefix without the leading slash should be rejected")
+	}
+	if checkDeployRouting(deployInformation, []string{"www.example.com"}, []DeployPathRule{DeployPathRule{"/", 8080}, DeployPathRule{"/", 8443}}) == nil {
+		t.Errorf("The duplicate path prefix should be rejected")
+	}
+	if checkDeployRouting(deployInformation, []string{"www.example.com"}, []DeployPathRule{DeployPathRule{"/db", 5432}}) == nil {
+		t.Errorf("The path rule to the tcp port should be rejected")
+	}
+	if checkDeployRouting(deployInformation, []string{"www.example.com"}, []DeployPathRule{DeployPathRule{"/none", 9090}}) == nil {
+		t.Errorf("The path rule to the non-existing port should be rejected")
+	}
+}
+
+func TestCheckHostNameOwner(t *testing.T) {
+	deployInformation := &DeployInformation{}
+	deployInformation.Namespace = "default"
+	deployInformation.ImageInformationName = "web"
+	deployInformation.HostNameSlice = []string{"www.example.com"}
+
+	otherDeployInformation := DeployInformation{}
+	otherDeployInformation.Namespace = "other"
+	otherDeployInformation.ImageInformationName = "web"
+	otherDeployInformation.HostNameSlice = []string{"api.example.com"}
+
+	deployInformationSlice := []DeployInformation{*deployInformation, otherDeployInformation}
+
+	if err := checkHostNameOwner(deployInformation, []string{"www.example.com", "shop.example.com"}, deployInformationSlice); err != nil {
+		t.Errorf("The host names not used by the other deployments should be accepted but get error %s", err)
+	}
+	if checkHostNameOwner(deployInformation, []string{"API.example.com"}, deployInformationSlice) == nil {
+		t.Errorf("The host name of the deployment in the other namespace should be rejected")
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone/control"
+	"github.com/cloudawan/cloudone/utility/lock"
+	"sort"
+	"strconv"
+)
+
+const (
+	InconsistencyKindNamespaceUnavailable              = "namespaceUnavailable"
+	InconsistencyKindServiceMissing                    = "serviceMissing"
+	InconsistencyKindServicePortMismatch               = "servicePortMismatch"
+	InconsistencyKindBlueGreenDeployInformationMissing = "blueGreenDeployInformationMissing"
+	InconsistencyKindBlueGreenServiceMissing           = "blueGreenServiceMissing"
+)
+
+// The difference between the deployments stored and the services in Kubernetes
+type DeployInconsistency struct {
+	Kind        string
+	Namespace   string
+	Name        string // The image information of the deployment
+	Description string
+	Repairable  bool
+	Repaired    bool
+	RepairError string
+}
+
+// The services, the replication controllers and the deployments in each namespace are listed once and the namespaces failing to list are remembered
+type kubernetesCache struct {
+	kubeApiServerEndPoint           string
+	kubeApiServerToken              string
+	serviceMapMap                   map[string]map[string]control.Service
+	replicationControllerNameMapMap map[string]map[string]bool
+	deploymentNameMapMap            map[string]map[string]bool
+	errorMap                        map[string]error
+}
+
+func newKubernetesCache(kubeApiServerEndPoint string, kubeApiServerToken string) *kubernetesCache {
+	return &kubernetesCache{
+		kubeApiServerEndPoint,
+		kubeApiServerToken,
+		make(map[string]map[string]control.Service),
+		make(map[string]map[string]bool),
+		make(map[string]map[string]bool),
+		make(map[string]error),
+	}
+}
+
+func (cache *kubernetesCache) getServiceMap(namespace string) (map[string]control.Service, error) {
+	if err, ok := cache.errorMap[namespace]; ok {
+		return nil, err
+	}
+	if serviceMap, ok := cache.serviceMapMap[namespace]; ok {
+		return serviceMap, nil
+	}
+
+	serviceSlice, err := control.GetAllService(cache.kubeApiServerEndPoint, cache.kubeApiServerToken, namespace)
+	if err != nil {
+		log.Error("Get all service in namespace %s error: %s", namespace, err)
+		cache.errorMap[namespace] = err
+		return nil, err
+	}
+
+	serviceMap := make(map[string]control.Service)
+	for _, service := range serviceSlice {
+		serviceMap[service.Name] = service
+	}
+	cache.serviceMapMap[namespace] = serviceMap
+	return serviceMap, nil
+}
+
+func (cache *kubernetesCache) getReplicationControllerNameMap(namespace string) (map[string]bool, error) {
+	if err, ok := cache.errorMap[namespace]; ok {
+		return nil, err
+	}
+	if replicationControllerNameMap, ok := cache.replicationControllerNameMapMap[namespace]; ok {
+		return replicationControllerNameMap, nil
+	}
+
+	replicationControllerNameSlice, err := control.GetAllReplicationControllerName(cache.kubeApiServerEndPoint, cache.kubeApiServerToken, namespace)
+	if err != nil {
+		log.Error("Get all replication controller name in namespace %s error: %s", namespace, err)
+		cache.errorMap[namespace] = err
+		return nil, err
+	}
+
+	replicationControllerNameMap := make(map[string]bool)
+	for _, replicationControllerName := range replicationControllerNameSlice {
+		replicationControllerNameMap[replicationControllerName] = true
+	}
+	cache.replicationControllerNameMapMap[namespace] = replicationControllerNameMap
+	return replicationControllerNameMap, nil
+}
+
+func (cache *kubernetesCache) getDeploymentNameMap(namespace string) (map[string]bool, error) {
+	if err, ok := cache.errorMap[namespace]; ok {
+		return nil, err
+	}
+	if deploymentNameMap, ok := cache.deploymentNameMapMap[namespace]; ok {
+		return deploymentNameMap, nil
+	}
+
+	deploymentNameSlice, err := control.GetAllDeploymentName(cache.kubeApiServerEndPoint, cache.kubeApiServerToken, namespace)
+	if err != nil {
+		log.Error("Get all deployment name in namespace %s error: %s", namespace, err)
+		cache.errorMap[namespace] = err
+		return nil, err
+	}
+
+	deploymentNameMap := make(map[string]bool)
+	for _, deploymentName := range deploymentNameSlice {
+		deploymentNameMap[deploymentName] = true
+	}
+	cache.deploymentNameMapMap[namespace] = deploymentNameMap
+	return deploymentNameMap, nil
+}
+
+// Return the description of the first difference or empty if the service serves all the container ports
+func checkDeployServicePort(deployInformation *DeployInformation, service *control.Service) string {
+	for _, deployContainerPort := range deployInformation.ContainerPortSlice {
+		targetPort := strconv.Itoa(deployContainerPort.ContainerPort)
+		var matchedServicePort *control.ServicePort = nil
+		for i, servicePort := range service.PortSlice {
+			if servicePort.TargetPort == targetPort {
+				matchedServicePort = &service.PortSlice[i]
+				break
+			}
+		}
+
+		if matchedServicePort == nil {
+			return "Service " + service.Name + " doesn't have the container port " + targetPort
+		}
+		if deployContainerPort.NodePort > 0 && deployContainerPort.NodePort != matchedServicePort.NodePort {
+			return "Service " + service.Name + " uses the node port " + strconv.Itoa(matchedServicePort.NodePort) +
+				" instead of " + strconv.Itoa(deployContainerPort.NodePort) + " for the container port " + targetPort
+		}
+	}
+	return ""
+}
+
+func ValidateDeployment(kubeApiServerEndPoint string, kubeApiServerToken string) ([]DeployInconsistency, error) {
+	deployInformationSlice, err := GetStorage().LoadAllDeployInformation()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	deployBlueGreenSlice, err := GetStorage().LoadAllDeployBlueGreen()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	cache := newKubernetesCache(kubeApiServerEndPoint, kubeApiServerToken)
+	inconsistencySlice := make([]DeployInconsistency, 0)
+	reportedNamespaceMap := make(map[string]bool)
+	checkNamespace := func(namespace string) map[string]control.Service {
+		serviceMap, err := cache.getServiceMap(namespace)
+		if err != nil {
+			if reportedNamespaceMap[namespace] == false {
+				reportedNamespaceMap[namespace] = true
+				inconsistencySlice = append(inconsistencySlice, DeployInconsistency{
+					InconsistencyKindNamespaceUnavailable,
+					namespace,
+					"",
+					"Fail to get the services with error " + err.Error(),
+					false,
+					false,
+					"",
+				})
+			}
+			return nil
+		}
+		return serviceMap
+	}
+
+	deployInformationMap := make(map[string]bool)
+	for i, deployInformation := range deployInformationSlice {
+		deployInformationMap[getLockName(deployInformation.Namespace, deployInformation.ImageInformationName)] = true
+
+		serviceMap := checkNamespace(deployInformation.Namespace)
+		if serviceMap == nil {
+			continue
+		}
+
+		service, ok := serviceMap[deployInformation.ImageInformationName]
+		if ok == false {
+			inconsistencySlice = append(inconsistencySlice, DeployInconsistency{
+				InconsistencyKindServiceMissing,
+				deployInformation.Namespace,
+				deployInformation.ImageInformationName,
+				"Service " + deployInformation.ImageInformationName + " doesn't exist",
+				true,
+				false,
+				"",
+			})
+			continue
+		}
+
+		description := checkDeployServicePort(&deployInformationSlice[i], &service)
+		if description != "" {
+			inconsistencySlice = append(inconsistencySlice, DeployInconsistency{
+				InconsistencyKindServicePortMismatch,
+				deployInformation.Namespace,
+				deployInformation.ImageInformationName,
+				description,
+				true,
+				false,
+				"",
+			})
+		}
+	}
+
+	for _, deployBlueGreen := range deployBlueGreenSlice {
+		if deployInformationMap[getLockName(deployBlueGreen.Namespace, deployBlueGreen.ImageInformation)] == false {
+			inconsistencySlice = append(inconsistencySlice, DeployInconsistency{
+				InconsistencyKindBlueGreenDeployInformationMissing,
+				deployBlueGreen.Namespace,
+				deployBlueGreen.ImageInformation,
+				"The blue green deployment targets the deployment which doesn't exist",
+				true,
+				false,
+				"",
+			})
+			continue
+		}
+
+		serviceMap := checkNamespace(deployBlueGreen.Namespace)
+		if serviceMap == nil {
+			continue
+		}
+
+		serviceName := GetBlueGreenServiceName(deployBlueGreen.ImageInformation)
+		if _, ok := serviceMap[serviceName]; ok == false {
+			inconsistencySlice = append(inconsistencySlice, DeployInconsistency{
+				InconsistencyKindBlueGreenServiceMissing,
+				deployBlueGreen.Namespace,
+				deployBlueGreen.ImageInformation,
+				"Service " + serviceName + " doesn't exist",
+				true,
+				false,
+				"",
+			})
+		}
+	}
+
+	sort.Sort(deployInconsistencySorter(inconsistencySlice))
+
+	return inconsistencySlice, nil
+}
+
+// Repair all the repairable inconsistencies in the namespaces allowed by the filter.
+// The result of each one is in the returned inconsistencies of the allowed namespaces.
+func RepairDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, isNamespaceAllowed func(namespace string) bool) ([]DeployInconsistency, error) {
+	allInconsistencySlice, err := ValidateDeployment(kubeApiServerEndPoint, kubeApiServerToken)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	inconsistencySlice := make([]DeployInconsistency, 0)
+	for _, inconsistency := range allInconsistencySlice {
+		if isNamespaceAllowed(inconsistency.Namespace) {
+			inconsistencySlice = append(inconsistencySlice, inconsistency)
+		}
+	}
+
+	repaired := false
+	for i, inconsistency := range inconsistencySlice {
+		if inconsistency.Repairable == false {
+			continue
+		}
+
+		err := repairDeployInconsistency(kubeApiServerEndPoint, kubeApiServerToken, &inconsistency)
+		if err != nil {
+			log.Error("Repair %v error: %s", inconsistency, err)
+			inconsistencySlice[i].RepairError = err.Error()
+		} else {
+			log.Info("Repair %v", inconsistency)
+			inconsistencySlice[i].Repaired = true
+		}
+		repaired = true
+	}
+
+	if repaired {
+		notifyDeploymentChange()
+	}
+
+	return inconsistencySlice, nil
+}
+
+func repairDeployInconsistency(kubeApiServerEndPoint string, kubeApiServerToken string, inconsistency *DeployInconsistency) error {
+	switch inconsistency.Kind {
+	case InconsistencyKindServiceMissing, InconsistencyKindServicePortMismatch:
+		deployLock, err := lock.AcquireLock(LockKind, getLockName(inconsistency.Namespace, inconsistency.Name), 0)
+		if err != nil {
+			log.Error(err)
+			return errors.New("Deployment is controlled by the other command")
+		}
+		defer deployLock.Release()
+
+		deployInformation, err := GetStorage().LoadDeployInformation(inconsistency.Namespace, inconsistency.Name)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+
+		if inconsistency.Kind == InconsistencyKindServicePortMismatch {
+			return repairDeployServicePort(kubeApiServerEndPoint, kubeApiServerToken, inconsistency.Namespace, inconsistency.Name, deployInformation.ContainerPortSlice)
+		}
+
+		return createDeployService(kubeApiServerEndPoint, kubeApiServerToken, inconsistency.Namespace, inconsistency.Name, deployInformation.ContainerPortSlice)
+	case InconsistencyKindBlueGreenDeployInformationMissing:
+		err := CleanAllServiceUnderBlueGreenDeployment(kubeApiServerEndPoint, kubeApiServerToken, inconsistency.Name)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		return GetStorage().DeleteDeployBlueGreen(inconsistency.Name)
+	case InconsistencyKindBlueGreenServiceMissing:
+		deployBlueGreen, err := GetStorage().LoadDeployBlueGreen(inconsistency.Name)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		return UpdateDeployBlueGreen(kubeApiServerEndPoint, kubeApiServerToken, deployBlueGreen)
+	default:
+		return errors.New("No such kind " + inconsistency.Kind)
+	}
+}
+
+type deployInconsistencySorter []DeployInconsistency
+
+func (deployInconsistencySlice deployInconsistencySorter) Len() int {
+	return len(deployInconsistencySlice)
+}
+
+func (deployInconsistencySlice deployInconsistencySorter) Less(i, j int) bool {
+	if deployInconsistencySlice[i].Namespace != deployInconsistencySlice[j].Namespace {
+		return deployInconsistencySlice[i].Namespace < deployInconsistencySlice[j].Namespace
+	}
+	if deployInconsistencySlice[i].Name != deployInconsistencySlice[j].Name {
+		return deployInconsistencySlice[i].Name < deployInconsistencySlice[j].Name
+	}
+	return deployInconsistencySlice[i].Kind < deployInconsistencySlice[j].Kind
+}
+
+func (deployInconsistencySlice deployInconsistencySorter) Swap(i, j int) {
+	deployInconsistencySlice[i], deployInconsistencySlice[j] = deployInconsistencySlice[j], deployInconsistencySlice[i]
+}
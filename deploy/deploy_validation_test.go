@@ -0,0 +1,62 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"github.com/cloudawan/cloudone/control"
+	"sort"
+	"testing"
+)
+
+func TestCheckDeployServicePort(t *testing.T) {
+	deployInformation := &DeployInformation{}
+	deployInformation.ContainerPortSlice = []DeployContainerPort{
+		DeployContainerPort{"web", 8080, 0, ProtocolTypeHTTP, ""},
+		DeployContainerPort{"db", 5432, 31000, ProtocolTypeOther, ""},
+	}
+
+	service := &control.Service{}
+	service.Name = "test"
+	service.PortSlice = []control.ServicePort{
+		control.ServicePort{"web", "TCP", 8080, "8080", 30123},
+		control.ServicePort{"db", "TCP", 5432, "5432", 31000},
+	}
+	if description := checkDeployServicePort(deployInformation, service); description != "" {
+		t.Errorf("The matched service should be accepted but get %s", description)
+	}
+
+	service.PortSlice[1].NodePort = 31001
+	if checkDeployServicePort(deployInformation, service) == "" {
+		t.Errorf("The service using the other node port should be reported")
+	}
+
+	service.PortSlice = service.PortSlice[:1]
+	if checkDeployServicePort(deployInformation, service) == "" {
+		t.Errorf("The service without the container port should be reported")
+	}
+}
+
+func TestDeployInconsistencySorter(t *testing.T) {
+	deployInconsistencySlice := []DeployInconsistency{
+		DeployInconsistency{InconsistencyKindServiceMissing, "qa", "b", "", true, false, ""},
+		DeployInconsistency{InconsistencyKindBlueGreenServiceMissing, "qa", "a", "", true, false, ""},
+		DeployInconsistency{InconsistencyKindNamespaceUnavailable, "dev", "", "", false, false, ""},
+	}
+	sort.Sort(deployInconsistencySorter(deployInconsistencySlice))
+
+	if deployInconsistencySlice[0].Namespace != "dev" || deployInconsistencySlice[1].Name != "a" || deployInconsistencySlice[2].Name != "b" {
+		t.Errorf("The inconsistencies should be sorted by namespace and name but get %v", deployInconsistencySlice)
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone/control"
+	"github.com/cloudawan/cloudone/image"
+	"github.com/cloudawan/cloudone/utility/lock"
+	"time"
+)
+
+const (
+	WorkloadKindReplicationController = "replicationController"
+	WorkloadKindDeployment            = "deployment"
+)
+
+// Rolling update of the deployment is done by Kubernetes and cloudone only waits for it
+const deploymentRolloutTimeout = 10 * time.Minute
+
+type WorkloadStatus struct {
+	Kind          string
+	Name          string
+	Image         string
+	ReplicaAmount int
+	Deployment    *control.DeploymentStatus    // Nil for the replication controller
+	RevisionSlice []control.DeploymentRevision // Empty for the replication controller
+}
+
+// The Kubernetes object running the pods of a deployment
+type workload interface {
+	getName() string
+	create(kubeApiServerEndPoint string, kubeApiServerToken string, image string) error
+	// Return after all the pods run the version
+	rollingUpdate(kubeApiServerEndPoint string, kubeApiServerToken string, version string, image string, environmentSlice []control.ReplicationControllerContainerEnvironment) error
+	// Replace the pods running the unexpected image with the current version
+	repairImage(kubeApiServerEndPoint string, kubeApiServerToken string, image string) error
+	resize(kubeApiServerEndPoint string, kubeApiServerToken string, size int) error
+	delete(kubeApiServerEndPoint string, kubeApiServerToken string) error
+	getStatus(kubeApiServerEndPoint string, kubeApiServerToken string) (*WorkloadStatus, error)
+	// The replication controller or the current replica set whose name is the prefix of the pod names
+	getPodOwnerName(kubeApiServerEndPoint string, kubeApiServerToken string) (string, error)
+}
+
+// The deployments saved before the workload kind is introduced run on the replication controllers
+func (deployInformation *DeployInformation) GetWorkloadKind() string {
+	if deployInformation.WorkloadKind == "" {
+		return WorkloadKindReplicationController
+	}
+	return deployInformation.WorkloadKind
+}
+
+// The workload keeps a copy so it still refers to the objects in Kubernetes after the deploy information is changed
+func newWorkload(deployInformation *DeployInformation) (workload, error) {
+	copiedDeployInformation := *deployInformation
+	switch deployInformation.GetWorkloadKind() {
+	case WorkloadKindReplicationController:
+		return &replicationControllerWorkload{&copiedDeployInformation}, nil
+	case WorkloadKindDeployment:
+		return &deploymentWorkload{&copiedDeployInformation}, nil
+	default:
+		return nil, errors.New("No such workload kind " + deployInformation.WorkloadKind)
+	}
+}
+
+func GetWorkloadStatus(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformationName string) (*WorkloadStatus, error) {
+	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return workload.getStatus(kubeApiServerEndPoint, kubeApiServerToken)
+}
+
+// The name used to find the pods and their metrics such as by monitor.MonitorReplicationController
+func GetPodOwnerName(kubeApiServerEndPoint string, kubeApiServerToken string, deployInformation *DeployInformation) (string, error) {
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	return workload.getPodOwnerName(kubeApiServerEndPoint, kubeApiServerToken)
+}
+
+type replicationControllerWorkload struct {
+	deployInformation *DeployInformation
+}
+
+func (workload *replicationControllerWorkload) getName() string {
+	return workload.deployInformation.ImageInformationName + workload.deployInformation.CurrentVersion
+}
+
+func (workload *replicationControllerWorkload) create(kubeApiServerEndPoint string, kubeApiServerToken string, image string) error {
+	deployInformation := workload.deployInformation
+	return createDeployReplicationController(kubeApiServerEndPoint, kubeApiServerToken, deployInformation.Namespace,
+		deployInformation.ImageInformationName, workload.getName(), deployInformation.CurrentVersion, image,
+		deployInformation.ReplicaAmount, deployInformation.ContainerPortSlice, deployInformation.EnvironmentSlice,
+		deployInformation.ResourceMap, deployInformation.ExtraJsonMap)
+}
+
+func (workload *replicationControllerWorkload) rollingUpdate(kubeApiServerEndPoint string, kubeApiServerToken string, version string, image string, environmentSlice []control.ReplicationControllerContainerEnvironment) error {
+	return control.RollingUpdateReplicationControllerWithSingleContainer(
+		kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace,
+		workload.getName(), workload.deployInformation.ImageInformationName+version,
+		image, version, waitingDuration, environmentSlice)
+}
+
+func (workload *replicationControllerWorkload) repairImage(kubeApiServerEndPoint string, kubeApiServerToken string, image string) error {
+	err := workload.delete(kubeApiServerEndPoint, kubeApiServerToken)
+	if err != nil {
+		return err
+	}
+	return workload.create(kubeApiServerEndPoint, kubeApiServerToken, image)
+}
+
+func (workload *replicationControllerWorkload) resize(kubeApiServerEndPoint string, kubeApiServerToken string, size int) error {
+	return control.UpdateReplicationControllerSize(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName(), size)
+}
+
+func (workload *replicationControllerWorkload) delete(kubeApiServerEndPoint string, kubeApiServerToken string) error {
+	return control.DeleteReplicationControllerAndRelatedPod(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName())
+}
+
+func (workload *replicationControllerWorkload) getStatus(kubeApiServerEndPoint string, kubeApiServerToken string) (*WorkloadStatus, error) {
+	replicationController, err := control.GetReplicationController(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName())
+	if err != nil {
+		return nil, err
+	}
+
+	image := ""
+	if len(replicationController.ContainerSlice) > 0 {
+		image = replicationController.ContainerSlice[0].Image
+	}
+	return &WorkloadStatus{
+		WorkloadKindReplicationController,
+		replicationController.Name,
+		image,
+		replicationController.ReplicaAmount,
+		nil,
+		make([]control.DeploymentRevision, 0),
+	}, nil
+}
+
+func (workload *replicationControllerWorkload) getPodOwnerName(kubeApiServerEndPoint string, kubeApiServerToken string) (string, error) {
+	return workload.getName(), nil
+}
+
+type deploymentWorkload struct {
+	deployInformation *DeployInformation
+}
+
+// The name doesn't change with the version so the revisions are kept by Kubernetes
+func (workload *deploymentWorkload) getName() string {
+	return workload.deployInformation.ImageInformationName
+}
+
+func (workload *deploymentWorkload) create(kubeApiServerEndPoint string, kubeApiServerToken string, image string) error {
+	deployInformation := workload.deployInformation
+
+	containerPortSlice := make([]control.ReplicationControllerContainerPort, 0)
+	for _, deployContainerPort := range deployInformation.ContainerPortSlice {
+		containerPortSlice = append(containerPortSlice,
+			control.ReplicationControllerContainerPort{deployContainerPort.Name, deployContainerPort.ContainerPort})
+	}
+
+	containerSlice := make([]control.ReplicationControllerContainer, 0)
+	containerSlice = append(containerSlice, control.ReplicationControllerContainer{
+		workload.getName(),
+		image,
+		containerPortSlice,
+		deployInformation.EnvironmentSlice,
+		deployInformation.ResourceMap,
+	})
+
+	deployment := control.Deployment{
+		workload.getName(),
+		deployInformation.ReplicaAmount,
+		control.ReplicationControllerSelector{
+			deployInformation.ImageInformationName,
+			deployInformation.CurrentVersion,
+		},
+		containerSlice,
+		deployInformation.ExtraJsonMap,
+	}
+
+	return control.CreateDeployment(kubeApiServerEndPoint, kubeApiServerToken, deployInformation.Namespace, deployment)
+}
+
+func (workload *deploymentWorkload) rollingUpdate(kubeApiServerEndPoint string, kubeApiServerToken string, version string, image string, environmentSlice []control.ReplicationControllerContainerEnvironment) error {
+	err := control.RollingUpdateDeploymentWithSingleContainer(kubeApiServerEndPoint, kubeApiServerToken,
+		workload.deployInformation.Namespace, workload.getName(), image, version, environmentSlice)
+	if err != nil {
+		return err
+	}
+
+	return control.WaitDeploymentRollout(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace,
+		workload.getName(), waitingDuration, deploymentRolloutTimeout)
+}
+
+// Kubernetes replaces the pods with the rolling update so it is not waited
+func (workload *deploymentWorkload) repairImage(kubeApiServerEndPoint string, kubeApiServerToken string, image string) error {
+	return control.RollingUpdateDeploymentWithSingleContainer(kubeApiServerEndPoint, kubeApiServerToken,
+		workload.deployInformation.Namespace, workload.getName(), image, workload.deployInformation.CurrentVersion,
+		workload.deployInformation.EnvironmentSlice)
+}
+
+func (workload *deploymentWorkload) resize(kubeApiServerEndPoint string, kubeApiServerToken string, size int) error {
+	return control.UpdateDeploymentSize(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName(), size)
+}
+
+func (workload *deploymentWorkload) delete(kubeApiServerEndPoint string, kubeApiServerToken string) error {
+	return control.DeleteDeployment(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName())
+}
+
+func (workload *deploymentWorkload) getStatus(kubeApiServerEndPoint string, kubeApiServerToken string) (*WorkloadStatus, error) {
+	deploymentStatus, err := control.GetDeploymentStatus(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName())
+	if err != nil {
+		return nil, err
+	}
+
+	deploymentRevisionSlice, err := control.GetDeploymentRevisionSlice(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &WorkloadStatus{
+		WorkloadKindDeployment,
+		deploymentStatus.Name,
+		deploymentStatus.Image,
+		deploymentStatus.ReplicaAmount,
+		deploymentStatus,
+		deploymentRevisionSlice,
+	}, nil
+}
+
+func (workload *deploymentWorkload) getPodOwnerName(kubeApiServerEndPoint string, kubeApiServerToken string) (string, error) {
+	deploymentRevisionSlice, err := control.GetDeploymentRevisionSlice(kubeApiServerEndPoint, kubeApiServerToken, workload.deployInformation.Namespace, workload.getName())
+	if err != nil {
+		return "", err
+	}
+	if len(deploymentRevisionSlice) == 0 {
+		return "", errors.New("No replica set of deployment " + workload.getName())
+	}
+	return deploymentRevisionSlice[0].ReplicaSetName, nil
+}
+
+// Roll the deployment back to the pod template of the revision and wait for it
+func DeployRollback(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformationName string, revision int) (returnedError error) {
+	// Rolling update may take long so keep the lease short and renew it
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), lock.LockDefaultRenewalTimeout)
+	if err != nil {
+		log.Error(err)
+		return errors.New("Deployment is controlled by the other command")
+	}
+
+	defer deployLock.Release()
+	deployLock.StartRenewal()
+	defer notifyDeploymentChange()
+	publishDeployProgress(namespace, imageInformationName, DeployOperationUpdate, DeployStepStarted, nil)
+	defer func() {
+		publishDeployResult(namespace, imageInformationName, DeployOperationUpdate, returnedError)
+	}()
+
+	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if deployInformation.GetWorkloadKind() != WorkloadKindDeployment {
+		return errors.New("Only the deployment workload keeps the revisions")
+	}
+
+	deploymentName := (&deploymentWorkload{deployInformation}).getName()
+	deploymentRevisionSlice, err := control.GetDeploymentRevisionSlice(kubeApiServerEndPoint, kubeApiServerToken, namespace, deploymentName)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	var targetDeploymentRevision *control.DeploymentRevision = nil
+	for i := range deploymentRevisionSlice {
+		if deploymentRevisionSlice[i].Revision == revision {
+			targetDeploymentRevision = &deploymentRevisionSlice[i]
+			break
+		}
+	}
+	if targetDeploymentRevision == nil {
+		return errors.New("No such revision")
+	}
+
+	imageRecord, err := image.GetStorage().LoadImageRecord(imageInformationName, targetDeploymentRevision.Version)
+	if err != nil {
+		log.Error("Load image record error: %s imageInformationName %s version %s", err, imageInformationName, targetDeploymentRevision.Version)
+		return err
+	}
+
+	// The image of the old revision could be disallowed by the policy changed after it was deployed
+	err = checkImageRecordAllowedInNamespace(namespace, imageRecord)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	publishDeployProgress(namespace, imageInformationName, DeployOperationUpdate, DeployStepRollingUpdate, nil)
+	err = control.RollbackDeployment(kubeApiServerEndPoint, kubeApiServerToken, namespace, deploymentName, revision)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	err = control.WaitDeploymentRollout(kubeApiServerEndPoint, kubeApiServerToken, namespace, deploymentName, waitingDuration, deploymentRolloutTimeout)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// Not to overwrite the deploy information saved by the one acquiring the lock after it is lost
+	err = deployLock.Validate()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	deployInformation.CurrentVersion = imageRecord.Version
+	deployInformation.CurrentVersionDescription = imageRecord.Description
+	err = GetStorage().saveDeployInformation(deployInformation)
+	if err != nil {
+		log.Error("Save deploy information error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// Move the deployment from the replication controller to the deployment workload without downtime.
+// The service selects the pods of both so the replication controller is deleted after the deployment is available.
+// The pods of the deployment are owned by its replica set so they are not adopted by the replication controller.
+func DeployMigrateToDeployment(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, imageInformationName string) (returnedError error) {
+	// Waiting for the rollout may take long so keep the lease short and renew it
+	deployLock, err := lock.AcquireLock(LockKind, getLockName(namespace, imageInformationName), lock.LockDefaultRenewalTimeout)
+	if err != nil {
+		log.Error(err)
+		return errors.New("Deployment is controlled by the other command")
+	}
+
+	defer deployLock.Release()
+	deployLock.StartRenewal()
+	defer notifyDeploymentChange()
+	publishDeployProgress(namespace, imageInformationName, DeployOperationMigrate, DeployStepStarted, nil)
+	defer func() {
+		publishDeployResult(namespace, imageInformationName, DeployOperationMigrate, returnedError)
+	}()
+
+	deployInformation, err := GetStorage().LoadDeployInformation(namespace, imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if deployInformation.GetWorkloadKind() != WorkloadKindReplicationController {
+		return errors.New("Only the deployment on the replication controller could be migrated")
+	}
+
+	imageRecord, err := image.GetStorage().LoadImageRecord(imageInformationName, deployInformation.CurrentVersion)
+	if err != nil {
+		log.Error("Load image record error: %s imageInformationName %s version %s", err, imageInformationName, deployInformation.CurrentVersion)
+		return err
+	}
+
+	oldWorkload := &replicationControllerWorkload{deployInformation}
+	migratedDeployInformation := *deployInformation
+	migratedDeployInformation.WorkloadKind = WorkloadKindDeployment
+	newWorkload := &deploymentWorkload{&migratedDeployInformation}
+
+	err = newWorkload.create(kubeApiServerEndPoint, kubeApiServerToken, imageRecord.Path)
+	if err != nil {
+		log.Error("Create deployment error: %s", err)
+		return err
+	}
+
+	err = control.WaitDeploymentRollout(kubeApiServerEndPoint, kubeApiServerToken, namespace, newWorkload.getName(), waitingDuration, deploymentRolloutTimeout)
+	if err != nil {
+		log.Error(err)
+		// The replication controller is still serving so remove the deployment to go back
+		if err := newWorkload.delete(kubeApiServerEndPoint, kubeApiServerToken); err != nil {
+			log.Error("Delete deployment not available error: %s", err)
+		}
+		return err
+	}
+
+	// Not to overwrite the deploy information saved by the one acquiring the lock after it is lost
+	err = deployLock.Validate()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	err = GetStorage().saveDeployInformation(&migratedDeployInformation)
+	if err != nil {
+		log.Error("Save deploy information error: %s", err)
+		return err
+	}
+
+	err = oldWorkload.delete(kubeApiServerEndPoint, kubeApiServerToken)
+	if err != nil {
+		log.Error("Delete migrated replication controller %s error: %s", oldWorkload.getName(), err)
+		return errors.New("Migrated but fail to delete the replication controller " + oldWorkload.getName() + " with error " + err.Error())
+	}
+
+	return nil
+}
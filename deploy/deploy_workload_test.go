@@ -0,0 +1,64 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"testing"
+)
+
+func TestNewWorkload(t *testing.T) {
+	deployInformation := &DeployInformation{}
+	deployInformation.ImageInformationName = "web"
+	deployInformation.CurrentVersion = "v1"
+
+	// The deployments saved before the workload kind is introduced
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployInformation.GetWorkloadKind() != WorkloadKindReplicationController || workload.getName() != "webv1" {
+		t.Errorf("The deployment without the workload kind should run on the replication controller webv1 but get %s", workload.getName())
+	}
+
+	deployInformation.WorkloadKind = WorkloadKindDeployment
+	workload, err = newWorkload(deployInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workload.getName() != "web" {
+		t.Errorf("The Kubernetes deployment should be named without the version but get %s", workload.getName())
+	}
+
+	deployInformation.WorkloadKind = "daemonSet"
+	if _, err := newWorkload(deployInformation); err == nil {
+		t.Errorf("The unknown workload kind should be rejected")
+	}
+}
+
+func TestNewWorkloadKeepName(t *testing.T) {
+	deployInformation := &DeployInformation{}
+	deployInformation.ImageInformationName = "web"
+	deployInformation.CurrentVersion = "v1"
+
+	workload, err := newWorkload(deployInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rolling update changes the version before the old replication controller is replaced
+	deployInformation.CurrentVersion = "v2"
+	if workload.getName() != "webv1" {
+		t.Errorf("The workload should still refer to the replication controller webv1 but get %s", workload.getName())
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone/image"
+	"github.com/coreos/etcd/client"
+)
+
+type ImagePolicy struct {
+	Namespace       string
+	MaximumSeverity string // The image with any finding above it is not allowed to deploy
+	RequireScan     bool   // The image without the successful scan is not allowed to deploy
+}
+
+func CheckImagePolicy(imagePolicy *ImagePolicy) error {
+	if imagePolicy.Namespace == "" {
+		return errors.New("Namespace can't be empty")
+	}
+	if image.IsValidSeverity(imagePolicy.MaximumSeverity) == false {
+		return errors.New("Invalid maximum severity " + imagePolicy.MaximumSeverity)
+	}
+	return nil
+}
+
+// No policy configured means all images are allowed
+func checkImageRecordAllowedInNamespace(namespace string, imageRecord *image.ImageRecord) error {
+	imagePolicy, err := GetStorage().LoadImagePolicy(namespace)
+	if err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code == client.ErrorCodeKeyNotFound {
+			return nil
+		}
+		log.Error("Load image policy of namespace %s error: %s", namespace, err)
+		return err
+	}
+
+	return checkImageRecordWithImagePolicy(imagePolicy, imageRecord)
+}
+
+func checkImageRecordWithImagePolicy(imagePolicy *ImagePolicy, imageRecord *image.ImageRecord) error {
+	scanResult := imageRecord.ScanResult
+	if scanResult == nil || scanResult.ErrorMessage != "" {
+		if imagePolicy.RequireScan {
+			return errors.New("The image " + imageRecord.Path + " is not scanned successfully but required by the policy of namespace " + imagePolicy.Namespace)
+		}
+		return nil
+	}
+
+	if image.GetSeverityLevel(scanResult.HighestSeverity) > image.GetSeverityLevel(imagePolicy.MaximumSeverity) {
+		return errors.New("The image " + imageRecord.Path + " has findings with severity " + scanResult.HighestSeverity + " above " + imagePolicy.MaximumSeverity + " allowed by the policy of namespace " + imagePolicy.Namespace)
+	}
+
+	return nil
+}
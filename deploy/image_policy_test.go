@@ -0,0 +1,46 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"github.com/cloudawan/cloudone/image"
+	"testing"
+)
+
+func TestCheckImageRecordWithImagePolicy(t *testing.T) {
+	imagePolicy := &ImagePolicy{"default", image.SeverityMedium, true}
+
+	imageRecord := &image.ImageRecord{}
+	if checkImageRecordWithImagePolicy(imagePolicy, imageRecord) == nil {
+		t.Errorf("The image without scan result should be blocked when scan is required")
+	}
+
+	imageRecord.ScanResult = &image.ScanResult{}
+	imageRecord.ScanResult.HighestSeverity = image.SeverityMedium
+	if err := checkImageRecordWithImagePolicy(imagePolicy, imageRecord); err != nil {
+		t.Errorf("The image with the maximum severity should be allowed but get error %s", err)
+	}
+
+	imageRecord.ScanResult.HighestSeverity = image.SeverityHigh
+	if checkImageRecordWithImagePolicy(imagePolicy, imageRecord) == nil {
+		t.Errorf("The image with the severity above the maximum should be blocked")
+	}
+
+	imagePolicy.RequireScan = false
+	imageRecord.ScanResult = nil
+	if err := checkImageRecordWithImagePolicy(imagePolicy, imageRecord); err != nil {
+		t.Errorf("The image without scan result should be allowed when scan is not required but get error %s", err)
+	}
+}
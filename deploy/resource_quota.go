@@ -0,0 +1,171 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"github.com/cloudawan/cloudone/control"
+	"sort"
+)
+
+// The deployment is rejected because it would exceed the resource quota of the namespace
+type ResourceQuotaExceededError struct {
+	text string
+}
+
+func (resourceQuotaExceededError *ResourceQuotaExceededError) Error() string {
+	return resourceQuotaExceededError.text
+}
+
+// The compute resources kubernetes requires every container to specify once they are in the quota
+var computeResourceNameSlice = []string{"cpu", "memory"}
+
+// No quota configured means no limitation.
+// Failing to get the quota is treated as no quota so the deployment works the same as before the quota is introduced
+// while kubernetes still enforces the quota on its own.
+func checkResourceQuota(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string,
+	replicaAmount int, resourceMap map[string]interface{}, workloadKind string) error {
+	resourceQuotaSlice, err := control.GetAllResourceQuota(kubeApiServerEndPoint, kubeApiServerToken, namespace)
+	if err != nil {
+		log.Error("Get resource quota of namespace %s error: %s so the quota is not checked", namespace, err)
+		return nil
+	}
+	if len(resourceQuotaSlice) == 0 {
+		return nil
+	}
+
+	limitRangeSlice, err := control.GetAllLimitRange(kubeApiServerEndPoint, kubeApiServerToken, namespace)
+	if err != nil {
+		log.Error("Get limit range of namespace %s error: %s", namespace, err)
+		return err
+	}
+
+	requiredMap, err := getDeploymentRequiredResource(replicaAmount, resourceMap, limitRangeSlice, workloadKind)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return checkRequiredResourceWithResourceQuota(namespace, requiredMap, resourceQuotaSlice)
+}
+
+// The milli value of each quota resource name the deployment takes with its service and workload.
+// The replica sets of the Deployment are not counted by the replicationcontrollers quota.
+func getDeploymentRequiredResource(replicaAmount int, resourceMap map[string]interface{},
+	limitRangeSlice []control.LimitRange, workloadKind string) (map[string]int64, error) {
+	defaultRequestMap, defaultLimitMap := control.GetContainerDefaultResource(limitRangeSlice)
+	requestMap := control.GetQuantityStringMap(resourceMap["requests"])
+	limitMap := control.GetQuantityStringMap(resourceMap["limits"])
+
+	requiredMap := make(map[string]int64)
+	requiredMap["pods"] = int64(replicaAmount) * 1000
+	if workloadKind == WorkloadKindReplicationController {
+		requiredMap["replicationcontrollers"] = 1000
+	}
+	requiredMap["services"] = 1000
+
+	for _, resourceName := range computeResourceNameSlice {
+		// Apply the defaults the same way as kubernetes
+		limit, hasLimit := limitMap[resourceName]
+		if hasLimit == false {
+			limit, hasLimit = defaultLimitMap[resourceName]
+		}
+		request, hasRequest := requestMap[resourceName]
+		if hasRequest == false {
+			request, hasRequest = defaultRequestMap[resourceName]
+		}
+		if hasRequest == false && hasLimit {
+			request, hasRequest = limit, true
+		}
+
+		if hasRequest {
+			requestMilli, err := control.ParseQuantityToMilli(request)
+			if err != nil {
+				return nil, err
+			}
+			requiredMap[resourceName] = int64(replicaAmount) * requestMilli
+			requiredMap["requests."+resourceName] = int64(replicaAmount) * requestMilli
+		}
+		if hasLimit {
+			limitMilli, err := control.ParseQuantityToMilli(limit)
+			if err != nil {
+				return nil, err
+			}
+			requiredMap["limits."+resourceName] = int64(replicaAmount) * limitMilli
+		}
+	}
+
+	return requiredMap, nil
+}
+
+func isComputeResourceName(resourceName string) bool {
+	for _, computeResourceName := range computeResourceNameSlice {
+		if resourceName == computeResourceName ||
+			resourceName == "requests."+computeResourceName ||
+			resourceName == "limits."+computeResourceName {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRequiredResourceWithResourceQuota(namespace string, requiredMap map[string]int64, resourceQuotaSlice []control.ResourceQuota) error {
+	for _, resourceQuota := range resourceQuotaSlice {
+		resourceNameSlice := make([]string, 0)
+		for resourceName := range resourceQuota.HardMap {
+			resourceNameSlice = append(resourceNameSlice, resourceName)
+		}
+		sort.Strings(resourceNameSlice)
+
+		for _, resourceName := range resourceNameSlice {
+			required, ok := requiredMap[resourceName]
+			if ok == false {
+				if isComputeResourceName(resourceName) {
+					return &ResourceQuotaExceededError{"The resource quota " + resourceQuota.Name + " of namespace " + namespace +
+						" limits " + resourceName + " so it needs to be specified in the resource map or the default of the limit range"}
+				}
+				// The other kinds of objects are not created by the deployment
+				continue
+			}
+
+			hard, err := control.ParseQuantityToMilli(resourceQuota.HardMap[resourceName])
+			if err != nil {
+				log.Error("Parse hard %s of resource quota %s in namespace %s error: %s", resourceName, resourceQuota.Name, namespace, err)
+				return err
+			}
+			used := int64(0)
+			if usedText, ok := resourceQuota.UsedMap[resourceName]; ok {
+				used, err = control.ParseQuantityToMilli(usedText)
+				if err != nil {
+					log.Error("Parse used %s of resource quota %s in namespace %s error: %s", resourceName, resourceQuota.Name, namespace, err)
+					return err
+				}
+			}
+
+			remaining := hard - used
+			if remaining < 0 {
+				remaining = 0
+			}
+			if required > remaining {
+				return &ResourceQuotaExceededError{"The deployment requires " + resourceName + " " +
+					control.FormatMilliQuantity(resourceName, required) + " but only " +
+					control.FormatMilliQuantity(resourceName, remaining) + " of " +
+					control.FormatMilliQuantity(resourceName, hard) + " remains in the resource quota " +
+					resourceQuota.Name + " of namespace " + namespace}
+			}
+		}
+	}
+
+	return nil
+}
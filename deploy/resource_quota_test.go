@@ -0,0 +1,104 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"github.com/cloudawan/cloudone/control"
+	"testing"
+)
+
+func TestGetDeploymentRequiredResource(t *testing.T) {
+	limitRangeSlice := []control.LimitRange{
+		control.LimitRange{
+			"default",
+			"default",
+			[]control.LimitRangeItem{
+				control.LimitRangeItem{
+					control.LimitRangeTypeContainer,
+					nil,
+					nil,
+					map[string]string{"cpu": "500m", "memory": "256Mi"},
+					map[string]string{"cpu": "100m"},
+					nil,
+				},
+			},
+		},
+	}
+	resourceMap := map[string]interface{}{
+		"limits": map[string]interface{}{
+			"memory": "128Mi",
+		},
+	}
+
+	requiredMap, err := getDeploymentRequiredResource(2, resourceMap, limitRangeSlice, WorkloadKindReplicationController)
+	if err != nil {
+		t.Fatalf("Get required resource error %s", err)
+	}
+
+	expectedMap := map[string]int64{
+		"pods":                   2000,
+		"replicationcontrollers": 1000,
+		"services":               1000,
+		"cpu":                    200,
+		"requests.cpu":           200,
+		"limits.cpu":             1000,
+		// The request falls back to the specified limit instead of the default limit
+		"memory":          2 * 128 * 1024 * 1024 * 1000,
+		"requests.memory": 2 * 128 * 1024 * 1024 * 1000,
+		"limits.memory":   2 * 128 * 1024 * 1024 * 1000,
+	}
+	for resourceName, expected := range expectedMap {
+		if requiredMap[resourceName] != expected {
+			t.Errorf("Resource %s expect %d but get %d", resourceName, expected, requiredMap[resourceName])
+		}
+	}
+
+	requiredMap, err = getDeploymentRequiredResource(2, resourceMap, limitRangeSlice, WorkloadKindDeployment)
+	if err != nil {
+		t.Fatalf("Get required resource error %s", err)
+	}
+	if _, ok := requiredMap["replicationcontrollers"]; ok {
+		t.Errorf("The Deployment should not require the replicationcontrollers quota")
+	}
+	if requiredMap["pods"] != 2000 {
+		t.Errorf("Resource pods expect 2000 but get %d", requiredMap["pods"])
+	}
+}
+
+func TestCheckRequiredResourceWithResourceQuota(t *testing.T) {
+	resourceQuotaSlice := []control.ResourceQuota{
+		control.ResourceQuota{
+			"quota",
+			"default",
+			map[string]string{"pods": "4", "requests.cpu": "1", "configmaps": "10"},
+			map[string]string{"pods": "2", "requests.cpu": "500m"},
+		},
+	}
+
+	requiredMap := map[string]int64{"pods": 2000, "requests.cpu": 500}
+	if err := checkRequiredResourceWithResourceQuota("default", requiredMap, resourceQuotaSlice); err != nil {
+		t.Errorf("The deployment within the remaining quota should be allowed but get error %s", err)
+	}
+
+	requiredMap = map[string]int64{"pods": 3000, "requests.cpu": 500}
+	if _, ok := checkRequiredResourceWithResourceQuota("default", requiredMap, resourceQuotaSlice).(*ResourceQuotaExceededError); ok == false {
+		t.Errorf("The deployment exceeding the pod quota should be rejected")
+	}
+
+	requiredMap = map[string]int64{"pods": 1000}
+	if _, ok := checkRequiredResourceWithResourceQuota("default", requiredMap, resourceQuotaSlice).(*ResourceQuotaExceededError); ok == false {
+		t.Errorf("The deployment without the cpu request should be rejected when the quota limits it")
+	}
+}
@@ -95,4 +95,8 @@ type Storage interface {
 	SaveDeployClusterApplication(deployClusterApplication *DeployClusterApplication) error
 	LoadDeployClusterApplication(namespace string, name string) (*DeployClusterApplication, error)
 	LoadAllDeployClusterApplication() ([]DeployClusterApplication, error)
+	DeleteImagePolicy(namespace string) error
+	SaveImagePolicy(imagePolicy *ImagePolicy) error
+	LoadImagePolicy(namespace string) (*ImagePolicy, error)
+	LoadAllImagePolicy() ([]ImagePolicy, error)
 }
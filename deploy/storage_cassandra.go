@@ -16,6 +16,7 @@ package deploy
 
 import (
 	"github.com/cloudawan/cloudone/utility/database/cassandra"
+	"github.com/coreos/etcd/client"
 	"time"
 )
 
@@ -245,3 +246,20 @@ func (storageCassandra *StorageCassandra) LoadDeployClusterApplication(namespace
 func (storageCassandra *StorageCassandra) LoadAllDeployClusterApplication() ([]DeployClusterApplication, error) {
 	return nil, &storageCassandra.dummyError
 }
+
+func (storageCassandra *StorageCassandra) DeleteImagePolicy(namespace string) error {
+	return &storageCassandra.dummyError
+}
+
+func (storageCassandra *StorageCassandra) SaveImagePolicy(imagePolicy *ImagePolicy) error {
+	return &storageCassandra.dummyError
+}
+
+// No image policy is supported so it is reported as not found which means all images are allowed
+func (storageCassandra *StorageCassandra) LoadImagePolicy(namespace string) (*ImagePolicy, error) {
+	return nil, client.Error{client.ErrorCodeKeyNotFound, "Image policy is not supported by cassandra", namespace, 0}
+}
+
+func (storageCassandra *StorageCassandra) LoadAllImagePolicy() ([]ImagePolicy, error) {
+	return nil, &storageCassandra.dummyError
+}
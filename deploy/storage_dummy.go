@@ -97,3 +97,19 @@ func (storageDummy *StorageDummy) LoadDeployClusterApplication(namespace string,
 func (storageDummy *StorageDummy) LoadAllDeployClusterApplication() ([]DeployClusterApplication, error) {
 	return nil, &storageDummy.dummyError
 }
+
+func (storageDummy *StorageDummy) DeleteImagePolicy(namespace string) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveImagePolicy(imagePolicy *ImagePolicy) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadImagePolicy(namespace string) (*ImagePolicy, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadAllImagePolicy() ([]ImagePolicy, error) {
+	return nil, &storageDummy.dummyError
+}
@@ -40,6 +40,11 @@ func (storageEtcd *StorageEtcd) initialize() error {
 		return err
 	}
 
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/deploy_image_policy"); err != nil {
+		log.Error("Create if not existing deploy image policy directory error: %s", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -362,3 +367,105 @@ func (storageEtcd *StorageEtcd) LoadAllDeployClusterApplication() ([]DeployClust
 
 	return deployClusterApplicationSlice, nil
 }
+
+func (storageEtcd *StorageEtcd) DeleteImagePolicy(namespace string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/deploy_image_policy/"+namespace, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		log.Debug(response)
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete image policy with namespace %s error: %s", namespace, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveImagePolicy(imagePolicy *ImagePolicy) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(imagePolicy)
+	if err != nil {
+		log.Error("Marshal image policy %v error %s", imagePolicy, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/deploy_image_policy/"+imagePolicy.Namespace, string(byteSlice), nil)
+	if err != nil {
+		log.Error("Save image policy %v error: %s", imagePolicy, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadImagePolicy(namespace string) (*ImagePolicy, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/deploy_image_policy/"+namespace, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, etcdError
+	}
+	if err != nil {
+		log.Error("Load image policy with namespace %s error: %s", namespace, err)
+		log.Error(response)
+		return nil, err
+	}
+
+	imagePolicy := new(ImagePolicy)
+	err = json.Unmarshal([]byte(response.Node.Value), &imagePolicy)
+	if err != nil {
+		log.Error("Unmarshal image policy %v error %s", response.Node.Value, err)
+		return nil, err
+	}
+
+	return imagePolicy, nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAllImagePolicy() ([]ImagePolicy, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/deploy_image_policy", nil)
+	if err != nil {
+		log.Error("Load all image policy error: %s", err)
+		log.Error(response)
+		return nil, err
+	}
+
+	imagePolicySlice := make([]ImagePolicy, 0)
+	for _, node := range response.Node.Nodes {
+		imagePolicy := ImagePolicy{}
+		err := json.Unmarshal([]byte(node.Value), &imagePolicy)
+		if err != nil {
+			log.Error("Unmarshal image policy %v error %s", node.Value, err)
+			return nil, err
+		}
+		imagePolicySlice = append(imagePolicySlice, imagePolicy)
+	}
+
+	return imagePolicySlice, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	KindBuildPhase       = "buildPhase"
+	KindBuildOutput      = "buildOutput"
+	KindDeployProgress   = "deployProgress"
+	KindAutoScalerResize = "autoScalerResize"
+	KindNotifierAlert    = "notifierAlert"
+	KindPodStatus        = "podStatus"
+)
+
+const (
+	// The recent events kept for the subscriber reconnecting with the id of the last received event
+	HistorySize = 1000
+	// The subscriber not reading fast enough is closed and it could subscribe again with the id of the last received event
+	subscriberChannelSize = 256
+)
+
+type Event struct {
+	ID          int64
+	Kind        string
+	Namespace   string // Empty for the objects not in any namespace such as the image information
+	Name        string // The image information, deployment, replication controller or pod
+	Message     string
+	DataMap     map[string]interface{} // Shared by all subscribers so it should not be modified
+	CreatedTime time.Time
+}
+
+type Subscriber struct {
+	eventChannel chan Event
+}
+
+var mutex = &sync.Mutex{}
+var lastEventID int64 = 0
+var historySlice = make([]Event, 0)
+var subscriberMap = make(map[*Subscriber]bool)
+
+func Publish(kind string, namespace string, name string, message string, dataMap map[string]interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	lastEventID++
+	event := Event{
+		lastEventID,
+		kind,
+		namespace,
+		name,
+		message,
+		dataMap,
+		time.Now(),
+	}
+
+	historySlice = append(historySlice, event)
+	if len(historySlice) > HistorySize {
+		historySlice = historySlice[len(historySlice)-HistorySize:]
+	}
+
+	for subscriber := range subscriberMap {
+		select {
+		case subscriber.eventChannel <- event:
+		default:
+			log.Info("Close the subscriber not reading fast enough")
+			delete(subscriberMap, subscriber)
+			close(subscriber.eventChannel)
+		}
+	}
+}
+
+// The kept events after the last event id are received first. Zero is used to receive the new events only.
+func Subscribe(lastReceivedEventID int64) *Subscriber {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	missedEventSlice := make([]Event, 0)
+	// The id larger than the current one is issued before the restart so the kept events are not related
+	if lastReceivedEventID > 0 && lastReceivedEventID <= lastEventID {
+		for _, event := range historySlice {
+			if event.ID > lastReceivedEventID {
+				missedEventSlice = append(missedEventSlice, event)
+			}
+		}
+	}
+
+	subscriber := &Subscriber{
+		make(chan Event, len(missedEventSlice)+subscriberChannelSize),
+	}
+	for _, event := range missedEventSlice {
+		subscriber.eventChannel <- event
+	}
+	subscriberMap[subscriber] = true
+
+	return subscriber
+}
+
+// The channel is closed after unsubscribed or closed for not reading fast enough
+func (subscriber *Subscriber) GetEventChannel() <-chan Event {
+	return subscriber.eventChannel
+}
+
+func (subscriber *Subscriber) Unsubscribe() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if subscriberMap[subscriber] {
+		delete(subscriberMap, subscriber)
+		close(subscriber.eventChannel)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+)
+
+func TestSubscribeAfterLastReceivedEvent(t *testing.T) {
+	Publish(KindBuildOutput, "", "test", "line 1", nil)
+	Publish(KindBuildOutput, "", "test", "line 2", nil)
+
+	subscriber := Subscribe(0)
+	defer subscriber.Unsubscribe()
+	Publish(KindDeployProgress, "default", "test", "started", nil)
+	event := <-subscriber.GetEventChannel()
+	if event.Kind != KindDeployProgress || event.Namespace != "default" {
+		t.Errorf("The new subscriber should receive the new events only but get %v", event)
+	}
+
+	reconnectedSubscriber := Subscribe(event.ID - 2)
+	defer reconnectedSubscriber.Unsubscribe()
+	for _, expectedMessage := range []string{"line 2", "started"} {
+		event := <-reconnectedSubscriber.GetEventChannel()
+		if event.Message != expectedMessage {
+			t.Errorf("Expect the missed event %s but get %v", expectedMessage, event)
+		}
+	}
+
+	// The id before the restart
+	restartedSubscriber := Subscribe(event.ID + 100)
+	defer restartedSubscriber.Unsubscribe()
+	if len(restartedSubscriber.GetEventChannel()) != 0 {
+		t.Error("The kept events should not be received with the id larger than the current one")
+	}
+}
+
+func TestCloseSlowSubscriber(t *testing.T) {
+	subscriber := Subscribe(0)
+	for i := 0; i <= subscriberChannelSize; i++ {
+		Publish(KindPodStatus, "default", "test", "Running", nil)
+	}
+
+	amount := 0
+	for range subscriber.GetEventChannel() {
+		amount++
+	}
+	if amount != subscriberChannelSize {
+		t.Errorf("Expect %d events before closed but get %d", subscriberChannelSize, amount)
+	}
+
+	// Unsubscribe after closed is allowed
+	subscriber.Unsubscribe()
+}
+
+func TestHistorySize(t *testing.T) {
+	for i := 0; i < HistorySize+10; i++ {
+		Publish(KindBuildOutput, "", "test", "line", nil)
+	}
+	if len(historySlice) != HistorySize {
+		t.Errorf("Expect %d kept events but get %d", HistorySize, len(historySlice))
+	}
+}
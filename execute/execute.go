@@ -15,6 +15,7 @@
 package execute
 
 import (
+	"github.com/cloudawan/cloudone/control"
 	"time"
 )
 
@@ -22,11 +23,18 @@ var quitChannel = make(chan struct{})
 
 func Close() {
 	close(quitChannel)
+	control.StopInformer()
 }
 
 func init() {
+	control.AddKubernetesEventListener(publishPodStatusEvent)
+	control.StartInformer()
 	loop(1*time.Second, loopAutoScaler)
 	loop(1*time.Second, loopNotifier)
+	loop(1*time.Hour, loopImageRetention)
+	loop(10*time.Second, loopSLBHealth)
+	loop(1*time.Second, loopSLBReconfiguration)
+	loop(1*time.Minute, loopDeployReconciliation)
 }
 
 type functionLoop func(ticker *time.Ticker, checkingInterval time.Duration)
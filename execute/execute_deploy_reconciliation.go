@@ -0,0 +1,62 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone/deploy"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"time"
+)
+
+func loopDeployReconciliation(ticker *time.Ticker, checkingInterval time.Duration) {
+	for {
+		select {
+		case <-ticker.C:
+			periodicalReconcileDeployment()
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop deploy reconciliation quit")
+			return
+		}
+	}
+}
+
+func periodicalReconcileDeployment() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("Reconcile deployment error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		log.Error("Get kube apiserver endpoint and token error: %s", err)
+		return
+	}
+
+	// Only report the drifts unless the self heal is enabled in the configuration
+	selfHeal, _ := configuration.LocalConfiguration.GetNative("deployReconciliationSelfHeal").(bool)
+
+	status, err := deploy.ReconcileAllDeployment(kubeApiServerEndPoint, kubeApiServerToken, selfHeal)
+	if err != nil {
+		log.Error("Reconcile deployment error: %s", err)
+		return
+	}
+	if len(status.DriftSlice) > 0 {
+		log.Debug("Deployment drifts %v", status.DriftSlice)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"bytes"
+	"errors"
+	"github.com/cloudawan/cloudone/deploy"
+	"github.com/cloudawan/cloudone/image"
+	"github.com/cloudawan/cloudone/utility/lock"
+	"time"
+)
+
+func loopImageRetention(ticker *time.Ticker, checkingInterval time.Duration) {
+	for {
+		select {
+		case <-ticker.C:
+			periodicalCheckImageRetention()
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop image retention quit")
+			return
+		}
+	}
+}
+
+func periodicalCheckImageRetention() {
+	retentionPolicySlice, err := image.GetStorage().LoadAllRetentionPolicy()
+	if err != nil {
+		log.Error("Load all retention policy error: %s", err)
+		return
+	}
+
+	for _, retentionPolicy := range retentionPolicySlice {
+		removedVersionSlice, err := ExecuteImageRetentionPolicy(retentionPolicy.ImageInformation)
+		if err != nil {
+			log.Error("Execute retention policy %v error: %s", retentionPolicy, err)
+		}
+		if len(removedVersionSlice) > 0 {
+			log.Info("Image information %s removed versions %v by retention policy", retentionPolicy.ImageInformation, removedVersionSlice)
+		}
+	}
+}
+
+// The versions used by any deployment are kept
+func ExecuteImageRetentionPolicy(imageInformationName string) ([]string, error) {
+	// Share the lock with build so the records are not removed during building
+	imageLock, err := lock.AcquireLock(image.LockKind, imageInformationName, 0)
+	if err != nil {
+		log.Error("Image information %s is under another operation: %s", imageInformationName, err)
+		return nil, errors.New("Image information " + imageInformationName + " is under another operation")
+	}
+	defer imageLock.Release()
+
+	imageRecordSlice, err := image.GetImageRecordOutOfRetentionPolicy(imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	hasError := false
+	buffer := bytes.Buffer{}
+	removedVersionSlice := make([]string, 0)
+	for _, imageRecord := range imageRecordSlice {
+		used, err := deploy.IsImageRecordUsed(imageInformationName, imageRecord.Version)
+		if err != nil {
+			hasError = true
+			buffer.WriteString(err.Error())
+			continue
+		}
+		if used {
+			continue
+		}
+
+		// Remove the tag in the private registry, the images on the hosts and the record
+		err = image.DeleteImageRecord(imageInformationName, imageRecord.Version)
+		if err != nil {
+			hasError = true
+			buffer.WriteString(err.Error())
+		} else {
+			removedVersionSlice = append(removedVersionSlice, imageRecord.Version)
+		}
+	}
+
+	if hasError {
+		log.Error(buffer.String())
+		return removedVersionSlice, errors.New(buffer.String())
+	} else {
+		return removedVersionSlice, nil
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone/control"
+	"github.com/cloudawan/cloudone/event"
+	"github.com/cloudawan/cloudone_utility/jsonparse"
+	"strconv"
+	"sync"
+)
+
+const (
+	podPhaseDeleted = "Deleted"
+)
+
+// The status published last time for each pod so the pod is published only if the status is changed
+var podStatusMap = make(map[string]string)
+var podStatusMutex = &sync.Mutex{}
+
+func publishPodStatusEvent(kubernetesEvent control.KubernetesEvent) {
+	if kubernetesEvent.Resource != control.InformerResourcePod {
+		return
+	}
+
+	podStatusMutex.Lock()
+	defer podStatusMutex.Unlock()
+
+	key := kubernetesEvent.Namespace + "/" + kubernetesEvent.Name
+
+	dataMap := make(map[string]interface{})
+	if kubernetesEvent.Type == control.KubernetesEventTypeDeleted {
+		delete(podStatusMap, key)
+		dataMap["Phase"] = podPhaseDeleted
+		event.Publish(event.KindPodStatus, kubernetesEvent.Namespace, kubernetesEvent.Name,
+			"Pod "+kubernetesEvent.Name+" is deleted", dataMap)
+		return
+	}
+
+	statusJsonMap, _ := kubernetesEvent.Object["status"].(map[string]interface{})
+	phase, _ := statusJsonMap["phase"].(string)
+	containerStatusSlice, _ := statusJsonMap["containerStatuses"].([]interface{})
+	readyContainerAmount := 0
+	restartCount := int64(0)
+	for _, containerStatus := range containerStatusSlice {
+		containerStatusJsonMap, _ := containerStatus.(map[string]interface{})
+		if ready, _ := containerStatusJsonMap["ready"].(bool); ready {
+			readyContainerAmount++
+		}
+		containerRestartCount, _ := jsonparse.ConvertToInt64(containerStatusJsonMap["restartCount"])
+		restartCount += containerRestartCount
+	}
+
+	status := phase + " " + strconv.Itoa(readyContainerAmount) + "/" + strconv.Itoa(len(containerStatusSlice)) + " " + strconv.FormatInt(restartCount, 10)
+	if podStatusMap[key] == status {
+		return
+	}
+	podStatusMap[key] = status
+
+	dataMap["Phase"] = phase
+	dataMap["ReadyContainerAmount"] = readyContainerAmount
+	dataMap["ContainerAmount"] = len(containerStatusSlice)
+	dataMap["RestartCount"] = restartCount
+	event.Publish(event.KindPodStatus, kubernetesEvent.Namespace, kubernetesEvent.Name,
+		"Pod "+kubernetesEvent.Name+" is "+phase+" with "+strconv.Itoa(readyContainerAmount)+"/"+strconv.Itoa(len(containerStatusSlice))+" ready containers", dataMap)
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone/slb"
+	"time"
+)
+
+func loopSLBReconfiguration(ticker *time.Ticker, checkingInterval time.Duration) {
+	// Have the expected command since start so the drift of the slb daemons could be detected
+	slb.RequestReconfiguration()
+	for {
+		select {
+		case <-ticker.C:
+			slb.ReconfigureSLBDaemon()
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop slb reconfiguration quit")
+			return
+		}
+	}
+}
@@ -15,6 +15,9 @@
 package glusterfs
 
 import (
+	"github.com/cloudawan/cloudone/utility/secret"
+	"github.com/cloudawan/cloudone/utility/sshclient"
+	"sync"
 	"time"
 )
 
@@ -27,6 +30,12 @@ type GlusterfsCluster struct {
 	SSHPort           int
 	SSHUser           string
 	SSHPassword       string
+	// The key based authentication, host key pinning and passwordless sudo. See host.SSH.
+	SSHPrivateKey           string
+	SSHPrivateKeyPassphrase string
+	SSHCertificate          string
+	SSHHostKeySlice         []string
+	SSHPasswordlessSudo     bool
 }
 
 func CreateGlusterfsCluster(name string, hostSlice []string, path string,
@@ -42,7 +51,79 @@ func CreateGlusterfsCluster(name string, hostSlice []string, path string,
 		sSHPort,
 		sSHUser,
 		sSHPassword,
+		"",
+		"",
+		"",
+		nil,
+		false,
 	}
 
 	return glusterfsCluster
 }
+
+func (glusterfsCluster *GlusterfsCluster) getSSHClientCredential() sshclient.Credential {
+	return sshclient.Credential{
+		glusterfsCluster.SSHUser,
+		glusterfsCluster.SSHPassword,
+		glusterfsCluster.SSHPrivateKey,
+		glusterfsCluster.SSHPrivateKeyPassphrase,
+		glusterfsCluster.SSHCertificate,
+		glusterfsCluster.SSHHostKeySlice,
+		glusterfsCluster.SSHPasswordlessSudo,
+		glusterfsCluster.recordHostKey,
+	}
+}
+
+var recordHostKeyMutex = &sync.Mutex{}
+
+// Pin the host keys on the first use so the clusters saved before the host key pinning keep working.
+// The hosts of the cluster share the pinned keys so the key of each host is added.
+func (glusterfsCluster *GlusterfsCluster) recordHostKey(hostKey string) error {
+	recordHostKeyMutex.Lock()
+	defer recordHostKeyMutex.Unlock()
+
+	storedGlusterfsCluster, err := GetStorage().LoadGlusterfsCluster(glusterfsCluster.Name)
+	if err != nil {
+		return err
+	}
+	for _, storedHostKey := range storedGlusterfsCluster.SSHHostKeySlice {
+		if storedHostKey == hostKey {
+			return nil
+		}
+	}
+
+	storedGlusterfsCluster.SSHHostKeySlice = append(storedGlusterfsCluster.SSHHostKeySlice, hostKey)
+	return GetStorage().SaveGlusterfsCluster(storedGlusterfsCluster)
+}
+
+// Return a copy with the password and private key encrypted for the storage
+func getEncryptedGlusterfsCluster(glusterfsCluster *GlusterfsCluster) (*GlusterfsCluster, error) {
+	encryptedGlusterfsCluster := *glusterfsCluster
+	for _, field := range []*string{
+		&encryptedGlusterfsCluster.SSHPassword,
+		&encryptedGlusterfsCluster.SSHPrivateKey,
+		&encryptedGlusterfsCluster.SSHPrivateKeyPassphrase,
+	} {
+		encrypted, err := secret.Encrypt(*field)
+		if err != nil {
+			return nil, err
+		}
+		*field = encrypted
+	}
+	return &encryptedGlusterfsCluster, nil
+}
+
+func decryptGlusterfsCluster(glusterfsCluster *GlusterfsCluster) error {
+	for _, field := range []*string{
+		&glusterfsCluster.SSHPassword,
+		&glusterfsCluster.SSHPrivateKey,
+		&glusterfsCluster.SSHPrivateKeyPassphrase,
+	} {
+		decrypted, err := secret.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = decrypted
+	}
+	return nil
+}
@@ -68,15 +68,21 @@ func (storageEtcd *StorageEtcd) SaveGlusterfsCluster(glusterfsCluster *Glusterfs
 		return err
 	}
 
-	byteSlice, err := json.Marshal(glusterfsCluster)
+	encryptedGlusterfsCluster, err := getEncryptedGlusterfsCluster(glusterfsCluster)
 	if err != nil {
-		log.Error("Marshal glusterfs cluster %v error %s", glusterfsCluster, err)
+		log.Error("Encrypt glusterfs cluster %s error %s", glusterfsCluster.Name, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedGlusterfsCluster)
+	if err != nil {
+		log.Error("Marshal glusterfs cluster %s error %s", glusterfsCluster.Name, err)
 		return err
 	}
 
 	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/glusterfs_cluster/"+glusterfsCluster.Name, string(byteSlice), nil)
 	if err != nil {
-		log.Error("Save glusterfs cluster %v error: %s", glusterfsCluster, err)
+		log.Error("Save glusterfs cluster %s error: %s", glusterfsCluster.Name, err)
 		log.Error(response)
 		return err
 	}
@@ -105,7 +111,12 @@ func (storageEtcd *StorageEtcd) LoadGlusterfsCluster(name string) (*GlusterfsClu
 	glusterfsCluster := new(GlusterfsCluster)
 	err = json.Unmarshal([]byte(response.Node.Value), &glusterfsCluster)
 	if err != nil {
-		log.Error("Unmarshal glusterfs cluster %v error %s", response.Node.Value, err)
+		log.Error("Unmarshal glusterfs cluster %s error %s", name, err)
+		return nil, err
+	}
+	err = decryptGlusterfsCluster(glusterfsCluster)
+	if err != nil {
+		log.Error("Decrypt glusterfs cluster %s error %s", name, err)
 		return nil, err
 	}
 
@@ -131,7 +142,12 @@ func (storageEtcd *StorageEtcd) LoadAllGlusterfsCluster() ([]GlusterfsCluster, e
 		glusterfsCluster := GlusterfsCluster{}
 		err := json.Unmarshal([]byte(node.Value), &glusterfsCluster)
 		if err != nil {
-			log.Error("Unmarshal glusterfs cluster %v error %s", node.Value, err)
+			log.Error("Unmarshal glusterfs cluster %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptGlusterfsCluster(&glusterfsCluster)
+		if err != nil {
+			log.Error("Decrypt glusterfs cluster %s error %s", node.Key, err)
 			return nil, err
 		}
 		glusterfsClusterSlice = append(glusterfsClusterSlice, glusterfsCluster)
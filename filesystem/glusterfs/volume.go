@@ -18,9 +18,9 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"github.com/cloudawan/cloudone/utility/sshclient"
 	"github.com/cloudawan/cloudone_utility/logger"
 	"github.com/cloudawan/cloudone_utility/random"
-	"github.com/cloudawan/cloudone_utility/sshclient"
 	"strconv"
 	"strings"
 )
@@ -141,8 +141,7 @@ func (glusterfsCluster *GlusterfsCluster) getAvailableHost() (*string, error) {
 			glusterfsCluster.SSHSessionTimeout,
 			host,
 			glusterfsCluster.SSHPort,
-			glusterfsCluster.SSHUser,
-			glusterfsCluster.SSHPassword,
+			glusterfsCluster.getSSHClientCredential(),
 			commandSlice,
 			nil)
 		if err == nil {
@@ -167,8 +166,7 @@ func (glusterfsCluster *GlusterfsCluster) GetHostStatus() map[string]bool {
 			glusterfsCluster.SSHSessionTimeout,
 			host,
 			glusterfsCluster.SSHPort,
-			glusterfsCluster.SSHUser,
-			glusterfsCluster.SSHPassword,
+			glusterfsCluster.getSSHClientCredential(),
 			commandSlice,
 			nil)
 		if err == nil {
@@ -191,19 +189,26 @@ func (glusterfsCluster *GlusterfsCluster) GetAllVolume() ([]GlusterfsVolume, err
 	commandSlice := make([]string, 0)
 	commandSlice = append(commandSlice, "sudo gluster volume info\n")
 
-	interactiveMap := make(map[string]string)
-	interactiveMap["[sudo]"] = glusterfsCluster.SSHPassword + "\n"
+	interactiveMap, err := glusterfsCluster.getSSHClientCredential().GetSudoInteractiveMap()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
 
 	resultSlice, err := sshclient.InteractiveSSH(
 		glusterfsCluster.SSHDialTimeout,
 		glusterfsCluster.SSHSessionTimeout,
 		*host,
 		glusterfsCluster.SSHPort,
-		glusterfsCluster.SSHUser,
-		glusterfsCluster.SSHPassword,
+		glusterfsCluster.getSSHClientCredential(),
 		commandSlice,
 		interactiveMap)
 
+	if err != nil {
+		log.Error("Get volume info error %s resultSlice %v", err, resultSlice)
+		return nil, err
+	}
+
 	glusterfsVolumeSlice, err := glusterfsCluster.parseVolumeInfo(resultSlice[0])
 	if err != nil {
 		log.Error("Parse volume info error %s", err)
@@ -222,19 +227,26 @@ func (glusterfsCluster *GlusterfsCluster) GetVolume(name string) (*GlusterfsVolu
 	commandSlice := make([]string, 0)
 	commandSlice = append(commandSlice, "sudo gluster volume info "+name+"\n")
 
-	interactiveMap := make(map[string]string)
-	interactiveMap["[sudo]"] = glusterfsCluster.SSHPassword + "\n"
+	interactiveMap, err := glusterfsCluster.getSSHClientCredential().GetSudoInteractiveMap()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
 
 	resultSlice, err := sshclient.InteractiveSSH(
 		glusterfsCluster.SSHDialTimeout,
 		glusterfsCluster.SSHSessionTimeout,
 		*host,
 		glusterfsCluster.SSHPort,
-		glusterfsCluster.SSHUser,
-		glusterfsCluster.SSHPassword,
+		glusterfsCluster.getSSHClientCredential(),
 		commandSlice,
 		interactiveMap)
 
+	if err != nil {
+		log.Error("Get volume info error %s resultSlice %v", err, resultSlice)
+		return nil, err
+	}
+
 	glusterfsVolumeSlice, err := glusterfsCluster.parseVolumeInfo(resultSlice[0])
 	if err != nil {
 		log.Error("Parse volume info error %s", err)
@@ -297,16 +309,18 @@ func (glusterfsCluster *GlusterfsCluster) CreateVolume(glusterfsVolumeCreatePara
 	commandSlice := make([]string, 0)
 	commandSlice = append(commandSlice, commandBuffer.String())
 
-	interactiveMap := make(map[string]string)
-	interactiveMap["[sudo]"] = glusterfsCluster.SSHPassword + "\n"
+	interactiveMap, err := glusterfsCluster.getSSHClientCredential().GetSudoInteractiveMap()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
 	resultSlice, err := sshclient.InteractiveSSH(
 		glusterfsCluster.SSHDialTimeout,
 		glusterfsCluster.SSHSessionTimeout,
 		*host,
 		glusterfsCluster.SSHPort,
-		glusterfsCluster.SSHUser,
-		glusterfsCluster.SSHPassword,
+		glusterfsCluster.getSSHClientCredential(),
 		commandSlice,
 		interactiveMap)
 
@@ -343,16 +357,18 @@ func (glusterfsCluster *GlusterfsCluster) StartVolume(name string) error {
 	commandSlice := make([]string, 0)
 	commandSlice = append(commandSlice, commandBuffer.String())
 
-	interactiveMap := make(map[string]string)
-	interactiveMap["[sudo]"] = glusterfsCluster.SSHPassword + "\n"
+	interactiveMap, err := glusterfsCluster.getSSHClientCredential().GetSudoInteractiveMap()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
 	resultSlice, err := sshclient.InteractiveSSH(
 		glusterfsCluster.SSHDialTimeout,
 		glusterfsCluster.SSHSessionTimeout,
 		*host,
 		glusterfsCluster.SSHPort,
-		glusterfsCluster.SSHUser,
-		glusterfsCluster.SSHPassword,
+		glusterfsCluster.getSSHClientCredential(),
 		commandSlice,
 		interactiveMap)
 
@@ -383,16 +399,18 @@ func (glusterfsCluster *GlusterfsCluster) StopVolume(name string) error {
 	commandSlice := make([]string, 0)
 	commandSlice = append(commandSlice, commandBuffer.String())
 
-	interactiveMap := make(map[string]string)
-	interactiveMap["[sudo]"] = glusterfsCluster.SSHPassword + "\n"
+	interactiveMap, err := glusterfsCluster.getSSHClientCredential().GetSudoInteractiveMap()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
 	resultSlice, err := sshclient.InteractiveSSH(
 		glusterfsCluster.SSHDialTimeout,
 		glusterfsCluster.SSHSessionTimeout,
 		*host,
 		glusterfsCluster.SSHPort,
-		glusterfsCluster.SSHUser,
-		glusterfsCluster.SSHPassword,
+		glusterfsCluster.getSSHClientCredential(),
 		commandSlice,
 		interactiveMap)
 
@@ -423,16 +441,18 @@ func (glusterfsCluster *GlusterfsCluster) DeleteVolume(name string) error {
 	commandSlice := make([]string, 0)
 	commandSlice = append(commandSlice, commandBuffer.String())
 
-	interactiveMap := make(map[string]string)
-	interactiveMap["[sudo]"] = glusterfsCluster.SSHPassword + "\n"
+	interactiveMap, err := glusterfsCluster.getSSHClientCredential().GetSudoInteractiveMap()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
 	resultSlice, err := sshclient.InteractiveSSH(
 		glusterfsCluster.SSHDialTimeout,
 		glusterfsCluster.SSHSessionTimeout,
 		*host,
 		glusterfsCluster.SSHPort,
-		glusterfsCluster.SSHUser,
-		glusterfsCluster.SSHPassword,
+		glusterfsCluster.getSSHClientCredential(),
 		commandSlice,
 		interactiveMap)
 
@@ -474,16 +494,18 @@ func (glusterfsCluster *GlusterfsCluster) CleanDataOnDisk(glusterfsVolume *Glust
 			commandSlice := make([]string, 0)
 			commandSlice = append(commandSlice, commandBuffer.String())
 
-			interactiveMap := make(map[string]string)
-			interactiveMap["[sudo]"] = glusterfsCluster.SSHPassword + "\n"
+			interactiveMap, err := glusterfsCluster.getSSHClientCredential().GetSudoInteractiveMap()
+			if err != nil {
+				log.Error(err)
+				return err
+			}
 
 			resultSlice, err := sshclient.InteractiveSSH(
 				glusterfsCluster.SSHDialTimeout,
 				glusterfsCluster.SSHSessionTimeout,
 				brickHost,
 				glusterfsCluster.SSHPort,
-				glusterfsCluster.SSHUser,
-				glusterfsCluster.SSHPassword,
+				glusterfsCluster.getSSHClientCredential(),
 				commandSlice,
 				interactiveMap)
 
@@ -219,6 +219,12 @@ func (hostControl *HostControl) GetSLBHostStatus() (map[string]interface{}, erro
 		}
 	}
 
+	// The result of polling the endpoints directly
+	endPointHealthMap := make(map[string]slb.SLBDaemonEndPointHealth)
+	for _, endPointHealth := range slb.GetAllSLBDaemonEndPointHealth() {
+		endPointHealthMap[endPointHealth.Name+" "+endPointHealth.EndPoint] = endPointHealth
+	}
+
 	allSLBDaemonSetJsonMap := make(map[string]interface{})
 	for _, slbDaemon := range slbDaemonSlice {
 		slbDaemonSetJsonMap := make(map[string]interface{})
@@ -229,12 +235,21 @@ func (hostControl *HostControl) GetSLBHostStatus() (map[string]interface{}, erro
 				return nil, err
 			}
 
+			hostJsonMap := make(map[string]interface{})
 			if slbDaemonJsonMap[host] == nil {
-				slbDaemonSetJsonMap[host] = make(map[string]interface{})
-				slbDaemonSetJsonMap[host].(map[string]interface{})["active"] = false
+				hostJsonMap["active"] = false
 			} else {
-				slbDaemonSetJsonMap[host] = slbDaemonJsonMap[host]
+				// Copy since the same host could be used by more than one slb daemon
+				for key, value := range slbDaemonJsonMap[host].(map[string]interface{}) {
+					hostJsonMap[key] = value
+				}
+			}
+			endPointHealth, ok := endPointHealthMap[slbDaemon.Name+" "+endPoint]
+			if ok {
+				hostJsonMap["reachable"] = endPointHealth.Alive
+				hostJsonMap["drift"] = endPointHealth.Drift
 			}
+			slbDaemonSetJsonMap[host] = hostJsonMap
 		}
 		allSLBDaemonSetJsonMap[slbDaemon.Name] = slbDaemonSetJsonMap
 	}
@@ -14,6 +14,13 @@
 
 package host
 
+import (
+	"errors"
+	"github.com/cloudawan/cloudone/utility/secret"
+	"github.com/cloudawan/cloudone/utility/sshclient"
+	"sync"
+)
+
 type Credential struct {
 	IP       string
 	SSH      SSH
@@ -21,7 +28,82 @@ type Credential struct {
 }
 
 type SSH struct {
-	Port     int
-	User     string
-	Password string
+	Port                 int
+	User                 string
+	Password             string
+	PrivateKey           string   // PEM encoded private key used instead of or in addition to the password
+	PrivateKeyPassphrase string   // Only for the encrypted private key
+	Certificate          string   // OpenSSH certificate of the private key in the authorized_keys format
+	HostKeySlice         []string // Pinned host keys in the authorized_keys format or SHA256 fingerprints
+	PasswordlessSudo     bool     // The sudo is configured with NOPASSWD so the prompt is not answered
+}
+
+func (credential *Credential) GetSSHClientCredential() sshclient.Credential {
+	return sshclient.Credential{
+		credential.SSH.User,
+		credential.SSH.Password,
+		credential.SSH.PrivateKey,
+		credential.SSH.PrivateKeyPassphrase,
+		credential.SSH.Certificate,
+		credential.SSH.HostKeySlice,
+		credential.SSH.PasswordlessSudo,
+		credential.recordHostKey,
+	}
+}
+
+var recordHostKeyMutex = &sync.Mutex{}
+
+// Pin the host key on the first use so the credentials saved before the host key pinning keep working
+func (credential *Credential) recordHostKey(hostKey string) error {
+	recordHostKeyMutex.Lock()
+	defer recordHostKeyMutex.Unlock()
+
+	storedCredential, err := GetStorage().LoadCredential(credential.IP)
+	if err != nil {
+		return err
+	}
+	for _, storedHostKey := range storedCredential.SSH.HostKeySlice {
+		if storedHostKey == hostKey {
+			return nil
+		}
+	}
+	// Pinned by the other request after this one started
+	if len(storedCredential.SSH.HostKeySlice) > 0 {
+		return errors.New("Host key of " + credential.IP + " doesn't match the pinned keys")
+	}
+
+	storedCredential.SSH.HostKeySlice = []string{hostKey}
+	return GetStorage().SaveCredential(storedCredential)
+}
+
+// Return a copy with the password and private key encrypted for the storage
+func getEncryptedCredential(credential *Credential) (*Credential, error) {
+	encryptedCredential := *credential
+	for _, field := range []*string{
+		&encryptedCredential.SSH.Password,
+		&encryptedCredential.SSH.PrivateKey,
+		&encryptedCredential.SSH.PrivateKeyPassphrase,
+	} {
+		encrypted, err := secret.Encrypt(*field)
+		if err != nil {
+			return nil, err
+		}
+		*field = encrypted
+	}
+	return &encryptedCredential, nil
+}
+
+func decryptCredential(credential *Credential) error {
+	for _, field := range []*string{
+		&credential.SSH.Password,
+		&credential.SSH.PrivateKey,
+		&credential.SSH.PrivateKeyPassphrase,
+	} {
+		decrypted, err := secret.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = decrypted
+	}
+	return nil
 }
@@ -63,15 +63,21 @@ func (storageEtcd *StorageEtcd) SaveCredential(credential *Credential) error {
 		return err
 	}
 
-	byteSlice, err := json.Marshal(credential)
+	encryptedCredential, err := getEncryptedCredential(credential)
 	if err != nil {
-		log.Error("Marshal host credential %v error %s", credential, err)
+		log.Error("Encrypt host credential %s error %s", credential.IP, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedCredential)
+	if err != nil {
+		log.Error("Marshal host credential %s error %s", credential.IP, err)
 		return err
 	}
 
 	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/host_credential/"+credential.IP, string(byteSlice), nil)
 	if err != nil {
-		log.Error("Save host credential %v error: %s", credential, err)
+		log.Error("Save host credential %s error: %s", credential.IP, err)
 		log.Error(response)
 		return err
 	}
@@ -100,7 +106,12 @@ func (storageEtcd *StorageEtcd) LoadCredential(ip string) (*Credential, error) {
 	credential := new(Credential)
 	err = json.Unmarshal([]byte(response.Node.Value), &credential)
 	if err != nil {
-		log.Error("Unmarshal host credential %v error %s", response.Node.Value, err)
+		log.Error("Unmarshal host credential %s error %s", ip, err)
+		return nil, err
+	}
+	err = decryptCredential(credential)
+	if err != nil {
+		log.Error("Decrypt host credential %s error %s", ip, err)
 		return nil, err
 	}
 
@@ -126,7 +137,12 @@ func (storageEtcd *StorageEtcd) LoadAllCredential() ([]Credential, error) {
 		credential := Credential{}
 		err := json.Unmarshal([]byte(node.Value), &credential)
 		if err != nil {
-			log.Error("Unmarshal host credential %v error %s", node.Value, err)
+			log.Error("Unmarshal host credential %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptCredential(&credential)
+		if err != nil {
+			log.Error("Decrypt host credential %s error %s", node.Key, err)
 			return nil, err
 		}
 		credentialSlice = append(credentialSlice, credential)
@@ -0,0 +1,111 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"github.com/cloudawan/cloudone/event"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	BuildPhaseStarted   = "started"
+	BuildPhaseSucceeded = "succeeded"
+	BuildPhaseFailed    = "failed"
+)
+
+// The output file for the external tail which also publishes each output line as an event
+type buildOutputFile struct {
+	file                 *os.File // Nil if the file can't be created but the events are still published
+	imageInformationName string
+	mutex                *sync.Mutex
+	lineBuffer           *bytes.Buffer
+}
+
+func createBuildOutputFile(imageInformationName string) (*buildOutputFile, error) {
+	file, err := os.Create(GetProcessingOutMessageFilePathAndName(imageInformationName))
+	if err != nil {
+		log.Error("Create build output file for %s error: %s", imageInformationName, err)
+		file = nil
+	}
+	return &buildOutputFile{
+		file,
+		imageInformationName,
+		&sync.Mutex{},
+		&bytes.Buffer{},
+	}, err
+}
+
+func (outputFile *buildOutputFile) Write(byteSlice []byte) (int, error) {
+	outputFile.mutex.Lock()
+	defer outputFile.mutex.Unlock()
+
+	outputFile.lineBuffer.Write(byteSlice)
+	for {
+		line, err := outputFile.lineBuffer.ReadString('\n')
+		if err != nil {
+			// Keep the partial line until the rest is written
+			outputFile.lineBuffer.Reset()
+			outputFile.lineBuffer.WriteString(line)
+			break
+		}
+		outputFile.publishOutput(strings.TrimSuffix(line, "\n"))
+	}
+
+	if outputFile.file == nil {
+		return 0, os.ErrInvalid
+	}
+	return outputFile.file.Write(byteSlice)
+}
+
+func (outputFile *buildOutputFile) WriteString(text string) (int, error) {
+	return outputFile.Write([]byte(text))
+}
+
+func (outputFile *buildOutputFile) Close() error {
+	outputFile.mutex.Lock()
+	defer outputFile.mutex.Unlock()
+
+	if outputFile.lineBuffer.Len() > 0 {
+		outputFile.publishOutput(outputFile.lineBuffer.String())
+		outputFile.lineBuffer.Reset()
+	}
+
+	if outputFile.file == nil {
+		return os.ErrInvalid
+	}
+	return outputFile.file.Close()
+}
+
+func (outputFile *buildOutputFile) publishOutput(line string) {
+	event.Publish(event.KindBuildOutput, "", outputFile.imageInformationName, line, nil)
+}
+
+func (outputFile *buildOutputFile) publishPhase(phase string) {
+	publishBuildPhase(outputFile.imageInformationName, phase, "")
+}
+
+func publishBuildPhase(imageInformationName string, phase string, errorMessage string) {
+	dataMap := make(map[string]interface{})
+	dataMap["Phase"] = phase
+	message := "Build phase " + phase
+	if errorMessage != "" {
+		dataMap["Error"] = errorMessage
+		message += " error: " + errorMessage
+	}
+	event.Publish(event.KindBuildPhase, "", imageInformationName, message, dataMap)
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"github.com/cloudawan/cloudone/event"
+	"os"
+	"testing"
+)
+
+func TestBuildOutputFilePublishLine(t *testing.T) {
+	subscriber := event.Subscribe(0)
+	defer subscriber.Unsubscribe()
+
+	outputFile, _ := createBuildOutputFile("buildoutputtest")
+	defer os.Remove(GetProcessingOutMessageFilePathAndName("buildoutputtest"))
+
+	outputFile.Write([]byte("first"))
+	outputFile.WriteString("\nsecond\nthird")
+	outputFile.Close()
+
+	for _, expectedLine := range []string{"first", "second", "third"} {
+		outputEvent := <-subscriber.GetEventChannel()
+		if outputEvent.Kind != event.KindBuildOutput || outputEvent.Name != "buildoutputtest" || outputEvent.Message != expectedLine {
+			t.Errorf("Expect line %s but get %v", expectedLine, outputEvent)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/cloudawan/cloudone/authorization"
 	"github.com/cloudawan/cloudone/utility/configuration"
 	"github.com/cloudawan/cloudone/utility/lock"
+	"github.com/cloudawan/cloudone/utility/secret"
 	"github.com/cloudawan/cloudone_utility/build"
 	"github.com/cloudawan/cloudone_utility/filetransfer/sftp"
 	"github.com/cloudawan/cloudone_utility/logger"
@@ -48,6 +49,40 @@ type ImageInformation struct {
 	BuildParameter map[string]string
 }
 
+// The build parameter keeping the scp and sftp password
+const BuildParameterPassword = "password"
+
+// Return a copy with the build password encrypted for the storage
+func getEncryptedImageInformation(imageInformation *ImageInformation) (*ImageInformation, error) {
+	encryptedImageInformation := *imageInformation
+	if imageInformation.BuildParameter == nil {
+		return &encryptedImageInformation, nil
+	}
+	encryptedImageInformation.BuildParameter = make(map[string]string)
+	for key, value := range imageInformation.BuildParameter {
+		encryptedImageInformation.BuildParameter[key] = value
+	}
+	if password, ok := imageInformation.BuildParameter[BuildParameterPassword]; ok {
+		encryptedPassword, err := secret.Encrypt(password)
+		if err != nil {
+			return nil, err
+		}
+		encryptedImageInformation.BuildParameter[BuildParameterPassword] = encryptedPassword
+	}
+	return &encryptedImageInformation, nil
+}
+
+func decryptImageInformation(imageInformation *ImageInformation) error {
+	if password, ok := imageInformation.BuildParameter[BuildParameterPassword]; ok {
+		decryptedPassword, err := secret.Decrypt(password)
+		if err != nil {
+			return err
+		}
+		imageInformation.BuildParameter[BuildParameterPassword] = decryptedPassword
+	}
+	return nil
+}
+
 type ImageRecord struct {
 	ImageInformation string
 	Version          string
@@ -57,6 +92,7 @@ type ImageRecord struct {
 	Description      string
 	CreatedTime      time.Time
 	Failure          bool
+	ScanResult       *ScanResult
 }
 
 func BuildCreate(imageInformation *ImageInformation) (returnedOutputMessage string, returnedError error) {
@@ -81,6 +117,13 @@ func BuildCreate(imageInformation *ImageInformation) (returnedOutputMessage stri
 		}
 	}
 
+	// Scan the built image if the scanner is configured
+	if buildError == nil {
+		if scanner := GetScanner(); scanner != nil {
+			imageRecord.ScanResult = ScanImageRecord(scanner, imageRecord)
+		}
+	}
+
 	// Save image record
 	err = GetStorage().saveImageRecord(imageRecord)
 	if err != nil {
@@ -134,6 +177,13 @@ func BuildUpgrade(imageInformationName string, description string) (returnedOutp
 		}
 	}
 
+	// Scan the built image if the scanner is configured
+	if buildError == nil {
+		if scanner := GetScanner(); scanner != nil {
+			imageRecord.ScanResult = ScanImageRecord(scanner, imageRecord)
+		}
+	}
+
 	// Save image record
 	err = GetStorage().saveImageRecord(imageRecord)
 	if err != nil {
@@ -160,29 +210,44 @@ func BuildUpgrade(imageInformationName string, description string) (returnedOutp
 }
 
 func Build(imageInformation *ImageInformation, description string) (*ImageRecord, string, error) {
-	if lock.AcquireLock(LockKind, imageInformation.Name, 0) == false {
-		log.Error("Image %s is under construction", imageInformation.Name)
+	// Build may take long so keep the lease short and renew it
+	imageLock, err := lock.AcquireLock(LockKind, imageInformation.Name, lock.LockDefaultRenewalTimeout)
+	if err != nil {
+		log.Error("Image %s is under construction: %s", imageInformation.Name, err)
 		return nil, "", errors.New("Image is under construction")
 	}
-	defer lock.ReleaseLock(LockKind, imageInformation.Name)
+	defer imageLock.Release()
+	imageLock.StartRenewal()
+
+	publishBuildPhase(imageInformation.Name, BuildPhaseStarted, "")
 
+	var imageRecord *ImageRecord = nil
+	outputMessage := ""
 	switch imageInformation.Kind {
 	case "git":
-		return BuildFromGit(imageInformation, description)
+		imageRecord, outputMessage, err = BuildFromGit(imageInformation, description)
 	case "scp":
-		return BuildFromSCP(imageInformation, description)
+		imageRecord, outputMessage, err = BuildFromSCP(imageInformation, description)
 	case "sftp":
-		return BuildFromSFTP(imageInformation, description)
+		imageRecord, outputMessage, err = BuildFromSFTP(imageInformation, description)
 	default:
-		return nil, "", errors.New("No such kind: " + imageInformation.Kind)
+		err = errors.New("No such kind: " + imageInformation.Kind)
 	}
+
+	if err != nil {
+		publishBuildPhase(imageInformation.Name, BuildPhaseFailed, err.Error())
+	} else {
+		publishBuildPhase(imageInformation.Name, BuildPhaseSucceeded, "")
+	}
+
+	return imageRecord, outputMessage, err
 }
 
 func BuildFromGit(imageInformation *ImageInformation, description string) (*ImageRecord, string, error) {
 	// OutputBuffer for the whole result
 	// OutputFile for external tail
 	outputBuffer := &bytes.Buffer{}
-	outputFile, err := os.Create(GetProcessingOutMessageFilePathAndName(imageInformation.Name))
+	outputFile, err := createBuildOutputFile(imageInformation.Name)
 	defer func() {
 		outputFile.Close()
 		// For websocket to have time to read
@@ -407,6 +472,16 @@ func BuildFromGit(imageInformation *ImageInformation, description string) (*Imag
 		return imageRecord, outputBuffer.String(), err
 	}
 
+	err = loginPrivateRegistry(imageRecord.Path)
+	if err != nil {
+		log.Error("Docker login for %s error: %s", imageRecord.Path, err)
+		outputBuffer.WriteString("The error phase: Docker login\n")
+		outputBuffer.WriteString("Docker login for " + imageRecord.Path + " error: " + err.Error() + "\n")
+		outputFile.WriteString("The error phase: Docker login\n")
+		outputFile.WriteString("Docker login for " + imageRecord.Path + " error: " + err.Error() + "\n")
+		return imageRecord, outputBuffer.String(), err
+	}
+
 	command = exec.Command("docker", "push", imageRecord.Path)
 	command.Dir = workingDirectory + string(os.PathSeparator) + sourceCodeProject
 	_, _, err = executeCommandAndTailTheOutput(command, outputBuffer, outputFile)
@@ -470,7 +545,7 @@ func BuildFromSCP(imageInformation *ImageInformation, description string) (*Imag
 	// OutputBuffer for the whole result
 	// OutputFile for external tail
 	outputBuffer := &bytes.Buffer{}
-	outputFile, err := os.Create(GetProcessingOutMessageFilePathAndName(imageInformation.Name))
+	outputFile, err := createBuildOutputFile(imageInformation.Name)
 	defer func() {
 		outputFile.Close()
 		// For websocket to have time to read
@@ -522,7 +597,7 @@ func BuildFromSCP(imageInformation *ImageInformation, description string) (*Imag
 
 	client, err := simplessh.ConnectWithPasswordTimeout(hostAndPort, username, password, scpTimeout)
 	if err != nil {
-		log.Error("Login scp hostAndPort %s, username %s, password %s error: %s", hostAndPort, username, password, err)
+		log.Error("Login scp hostAndPort %s, username %s error: %s", hostAndPort, username, err)
 		outputBuffer.WriteString("The error phase: Login scp\n")
 		outputBuffer.WriteString("Login scp " + hostAndPort + " error: " + err.Error() + "\n")
 		outputFile.WriteString("The error phase: Login scp\n")
@@ -679,6 +754,16 @@ func BuildFromSCP(imageInformation *ImageInformation, description string) (*Imag
 		return imageRecord, outputBuffer.String(), err
 	}
 
+	err = loginPrivateRegistry(imageRecord.Path)
+	if err != nil {
+		log.Error("Docker login for %s error: %s", imageRecord.Path, err)
+		outputBuffer.WriteString("The error phase: Docker login\n")
+		outputBuffer.WriteString("Docker login for " + imageRecord.Path + " error: " + err.Error() + "\n")
+		outputFile.WriteString("The error phase: Docker login\n")
+		outputFile.WriteString("Docker login for " + imageRecord.Path + " error: " + err.Error() + "\n")
+		return imageRecord, outputBuffer.String(), err
+	}
+
 	command = exec.Command("docker", "push", imageRecord.Path)
 	command.Dir = workingDirectory + string(os.PathSeparator) + sourceCodeProject
 	_, _, err = executeCommandAndTailTheOutput(command, outputBuffer, outputFile)
@@ -706,7 +791,7 @@ func BuildFromSFTP(imageInformation *ImageInformation, description string) (*Ima
 	// OutputBuffer for the whole result
 	// OutputFile for external tail
 	outputBuffer := &bytes.Buffer{}
-	outputFile, err := os.Create(GetProcessingOutMessageFilePathAndName(imageInformation.Name))
+	outputFile, err := createBuildOutputFile(imageInformation.Name)
 	defer func() {
 		outputFile.Close()
 		// For websocket to have time to read
@@ -756,8 +841,8 @@ func BuildFromSFTP(imageInformation *ImageInformation, description string) (*Ima
 
 	if err := sftp.DownLoadDirectoryRecurrsively(hostAndPort, username,
 		password, sourcePath, workingDirectory); err != nil {
-		log.Error("Download from sftp hostAndPort %s, username %s, password %s, sourcePath %s, workingDirectory %s error: %s",
-			hostAndPort, username, password, sourcePath, workingDirectory, err)
+		log.Error("Download from sftp hostAndPort %s, username %s, sourcePath %s, workingDirectory %s error: %s",
+			hostAndPort, username, sourcePath, workingDirectory, err)
 		outputBuffer.WriteString("The error phase: Download from sftp\n")
 		outputBuffer.WriteString("Download from sftp " + hostAndPort + " error: " + err.Error() + "\n")
 		outputFile.WriteString("The error phase: Download from sftp\n")
@@ -887,6 +972,16 @@ func BuildFromSFTP(imageInformation *ImageInformation, description string) (*Ima
 		return imageRecord, outputBuffer.String(), err
 	}
 
+	err = loginPrivateRegistry(imageRecord.Path)
+	if err != nil {
+		log.Error("Docker login for %s error: %s", imageRecord.Path, err)
+		outputBuffer.WriteString("The error phase: Docker login\n")
+		outputBuffer.WriteString("Docker login for " + imageRecord.Path + " error: " + err.Error() + "\n")
+		outputFile.WriteString("The error phase: Docker login\n")
+		outputFile.WriteString("Docker login for " + imageRecord.Path + " error: " + err.Error() + "\n")
+		return imageRecord, outputBuffer.String(), err
+	}
+
 	command = exec.Command("docker", "push", imageRecord.Path)
 	command.Dir = workingDirectory + string(os.PathSeparator) + sourceCodeProject
 	_, _, err = executeCommandAndTailTheOutput(command, outputBuffer, outputFile)
@@ -933,7 +1028,7 @@ func SendBuildLog(imageRecord *ImageRecord, outputMessage string) error {
 	url := "https://" + cloudoneAnalysisHost + ":" + strconv.Itoa(cloudoneAnalysisPort) + "/api/v1/buildlogs"
 
 	headerMap := make(map[string]string)
-	headerMap["token"] = authorization.SystemAdminToken
+	headerMap["token"] = authorization.GetSystemAdminToken()
 
 	_, err := restclient.RequestPost(url, buildLog, headerMap, false)
 	if err != nil {
@@ -962,7 +1057,7 @@ func GetProcessingOutMessageFilePathAndName(imageInformationName string) string
 	return processOutMessageFilePathAndNamePrefix + imageInformationName
 }
 
-func executeCommandAndTailTheOutput(command *exec.Cmd, outputBuffer *bytes.Buffer, outputFile *os.File) (string, int, error) {
+func executeCommandAndTailTheOutput(command *exec.Cmd, outputBuffer *bytes.Buffer, outputFile *buildOutputFile) (string, int, error) {
 	if command == nil {
 		log.Error("Command can't be nil")
 		return "", 0, errors.New("Command can't be nil")
@@ -995,6 +1090,15 @@ func executeCommandAndTailTheOutput(command *exec.Cmd, outputBuffer *bytes.Buffe
 		}
 	}()
 
+	if outputFile != nil {
+		// Only the sub-command such as git clone and docker build since the rest may contain the credentials
+		if len(command.Args) > 1 {
+			outputFile.publishPhase(command.Args[0] + " " + command.Args[1])
+		} else {
+			outputFile.publishPhase(command.Args[0])
+		}
+	}
+
 	err = command.Start()
 	if err != nil {
 		log.Error(err)
@@ -22,9 +22,11 @@ import (
 	"github.com/cloudawan/cloudone/host"
 	"github.com/cloudawan/cloudone/registry"
 	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone/utility/sshclient"
 	"github.com/cloudawan/cloudone_utility/restclient"
-	"github.com/cloudawan/cloudone_utility/sshclient"
+	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -48,12 +50,12 @@ func DeleteImageInformationAndRelatedRecord(imageInformationName string) error {
 
 	if len(filteredImageRecordSlice) > 0 {
 		imageRecord := filteredImageRecordSlice[0]
-		privateRegistry, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
+		privateRegistry, repositoryName, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
 		if err != nil {
 			hasError = true
 			buffer.WriteString(err.Error())
 		} else {
-			err := privateRegistry.DeleteAllImageInRepository(imageRecord.ImageInformation)
+			err := privateRegistry.DeleteAllImageInRepository(repositoryName)
 			if err != nil {
 				hasError = true
 				buffer.WriteString(err.Error())
@@ -73,6 +75,12 @@ func DeleteImageInformationAndRelatedRecord(imageInformationName string) error {
 		buffer.WriteString(err.Error())
 	}
 
+	err = GetStorage().DeleteRetentionPolicy(imageInformationName)
+	if err != nil {
+		hasError = true
+		buffer.WriteString(err.Error())
+	}
+
 	err = RequestDeleteBuildLogBelongingToImageInformation(imageInformationName)
 	if err != nil {
 		hasError = true
@@ -87,6 +95,38 @@ func DeleteImageInformationAndRelatedRecord(imageInformationName string) error {
 	}
 }
 
+// The versions whose tags point to the same image in the private registry as the given version, including the given version itself
+func GetImageRecordVersionSharingImage(imageInformationName string, imageRecordVersion string) ([]string, error) {
+	imageRecord, err := GetStorage().LoadImageRecord(imageInformationName, imageRecordVersion)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// Failure means no image is created and pushed to private-registry
+	if imageRecord.Failure {
+		return []string{imageRecordVersion}, nil
+	}
+
+	privateRegistry, repositoryName, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	tagSlice, err := privateRegistry.GetAllImageTagSharingDigest(repositoryName, imageRecord.Version)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if isTagInSlice(imageRecordVersion, tagSlice) == false {
+		tagSlice = append(tagSlice, imageRecordVersion)
+	}
+
+	return tagSlice, nil
+}
+
 func DeleteImageRecord(imageInformationName string, imageRecordVersion string) error {
 	imageRecord, err := GetStorage().LoadImageRecord(imageInformationName, imageRecordVersion)
 	if err != nil {
@@ -100,22 +140,22 @@ func DeleteImageRecord(imageInformationName string, imageRecordVersion string) e
 	deletedTagSlice := make([]string, 0)
 	// Image is successfully built before
 	if imageRecord.Failure == false {
-		privateRegistry, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
+		privateRegistry, repositoryName, err := registry.GetPrivateRegistryFromPathAndTestAvailable(imageRecord.Path)
 		if err != nil {
 			hasError = true
 			buffer.WriteString(err.Error())
 		} else {
-			beforeDeleteTagSlice, err := privateRegistry.GetAllImageTag(imageRecord.ImageInformation)
+			beforeDeleteTagSlice, err := privateRegistry.GetAllImageTag(repositoryName)
 			if err != nil {
 				hasError = true
 				buffer.WriteString(err.Error())
 			} else {
-				err := privateRegistry.DeleteImageInRepository(imageRecord.ImageInformation, imageRecord.Version)
+				err := privateRegistry.DeleteImageInRepository(repositoryName, imageRecord.Version)
 				if err != nil {
 					hasError = true
 					buffer.WriteString(err.Error())
 				} else {
-					afterDeleteTagSlice, err := privateRegistry.GetAllImageTag(imageRecord.ImageInformation)
+					afterDeleteTagSlice, err := privateRegistry.GetAllImageTag(repositoryName)
 					if err != nil {
 						hasError = true
 						buffer.WriteString(err.Error())
@@ -164,6 +204,36 @@ func DeleteImageRecord(imageInformationName string, imageRecordVersion string) e
 	}
 }
 
+// Login with the configured credential of the registry so the image could be pushed
+func loginPrivateRegistry(path string) error {
+	privateRegistry, _, err := registry.GetPrivateRegistryFromPath(path)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// Docker login doesn't support the bearer token directly
+	if privateRegistry.Username == "" {
+		return nil
+	}
+
+	argumentSlice := []string{"login", "--username", privateRegistry.Username, "--password-stdin"}
+	server := privateRegistry.GetServer()
+	if server != "" {
+		argumentSlice = append(argumentSlice, server)
+	}
+
+	command := exec.Command("docker", argumentSlice...)
+	command.Stdin = strings.NewReader(privateRegistry.Password)
+	output, err := command.CombinedOutput()
+	if err != nil {
+		log.Error("Docker login %s with user %s error: %s output: %s", server, privateRegistry.Username, err, string(output))
+		return errors.New("Docker login " + server + " error: " + err.Error() + " " + string(output))
+	}
+
+	return nil
+}
+
 func RemoveImageFromAllHost(imageRecordSlcie []ImageRecord) error {
 	credentialSlice, err := host.GetStorage().LoadAllCredential()
 	if err != nil {
@@ -184,16 +254,23 @@ func RemoveImageFromAllHost(imageRecordSlcie []ImageRecord) error {
 	buffer := bytes.Buffer{}
 	for _, credential := range credentialSlice {
 		if credential.Disabled == false {
-			interactiveMap := make(map[string]string)
-			interactiveMap["[sudo]"] = credential.SSH.Password + "\n"
+			sshClientCredential := credential.GetSSHClientCredential()
+
+			interactiveMap, err := sshClientCredential.GetSudoInteractiveMap()
+			if err != nil {
+				hasError = true
+				errorMessage := fmt.Sprintf("Host %s error message: %v .", credential.IP, err)
+				log.Error(errorMessage)
+				buffer.WriteString(errorMessage)
+				continue
+			}
 
 			resultSlice, err := sshclient.InteractiveSSH(
 				2*time.Second,
 				time.Duration(amount)*time.Minute,
 				credential.IP,
 				credential.SSH.Port,
-				credential.SSH.User,
-				credential.SSH.Password,
+				sshClientCredential,
 				commandSlice,
 				interactiveMap)
 
@@ -230,7 +307,7 @@ func RequestDeleteBuildLogBelongingToImageInformation(imageInformationName strin
 	url := "https://" + cloudoneAnalysisHost + ":" + strconv.Itoa(cloudoneAnalysisPort) + "/api/v1/buildlogs/" + imageInformationName
 
 	headerMap := make(map[string]string)
-	headerMap["token"] = authorization.SystemAdminToken
+	headerMap["token"] = authorization.GetSystemAdminToken()
 
 	_, err := restclient.RequestDelete(url, nil, headerMap, false)
 	if err != nil {
@@ -255,7 +332,7 @@ func RequestDeleteBuildLog(imageInformationName string, imageRecordVersion strin
 	url := "https://" + cloudoneAnalysisHost + ":" + strconv.Itoa(cloudoneAnalysisPort) + "/api/v1/buildlogs/" + imageInformationName + "/" + imageRecordVersion
 
 	headerMap := make(map[string]string)
-	headerMap["token"] = authorization.SystemAdminToken
+	headerMap["token"] = authorization.GetSystemAdminToken()
 
 	_, err := restclient.RequestDelete(url, nil, headerMap, false)
 	if err != nil {
@@ -0,0 +1,141 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"errors"
+	"time"
+)
+
+// Zero means the rule is not used. If both are zero, all the records are kept.
+type RetentionPolicy struct {
+	ImageInformation  string
+	KeepLastAmount    int
+	KeepNewerThanDays int
+}
+
+func CheckRetentionPolicy(retentionPolicy *RetentionPolicy) error {
+	if retentionPolicy.ImageInformation == "" {
+		return errors.New("Image information name can't be empty")
+	}
+	if retentionPolicy.KeepLastAmount < 0 {
+		return errors.New("Keep last amount can't be negative")
+	}
+	if retentionPolicy.KeepNewerThanDays < 0 {
+		return errors.New("Keep newer than days can't be negative")
+	}
+	return nil
+}
+
+// The records used by the deployment are not checked here. The caller needs to filter them out.
+func GetImageRecordOutOfRetentionPolicy(imageInformationName string) ([]ImageRecord, error) {
+	retentionPolicy, err := GetStorage().LoadRetentionPolicy(imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	imageInformation, err := GetStorage().LoadImageInformation(imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	imageRecordSlice, err := GetStorage().LoadImageRecordWithImageInformationName(imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	outOfRetentionImageRecordSlice := getImageRecordOutOfRetentionPolicy(retentionPolicy, imageInformation.CurrentVersion, imageRecordSlice, time.Now())
+	return getImageRecordNotSharingKeptImage(outOfRetentionImageRecordSlice, imageInformation.CurrentVersion, imageRecordSlice,
+		func(version string) ([]string, error) {
+			return GetImageRecordVersionSharingImage(imageInformationName, version)
+		}), nil
+}
+
+// The image is deleted by the digest and the records of all the tags sharing it are removed.
+// So the record sharing the image with the current version or a kept record is kept as well.
+func getImageRecordNotSharingKeptImage(outOfRetentionImageRecordSlice []ImageRecord, currentVersion string, imageRecordSlice []ImageRecord,
+	getVersionSharingImage func(version string) ([]string, error)) []ImageRecord {
+
+	outOfRetentionVersionMap := make(map[string]bool)
+	for _, imageRecord := range outOfRetentionImageRecordSlice {
+		outOfRetentionVersionMap[imageRecord.Version] = true
+	}
+	keptVersionMap := make(map[string]bool)
+	keptVersionMap[currentVersion] = true
+	for _, imageRecord := range imageRecordSlice {
+		if outOfRetentionVersionMap[imageRecord.Version] == false {
+			keptVersionMap[imageRecord.Version] = true
+		}
+	}
+
+	imageRecordToRemoveSlice := make([]ImageRecord, 0)
+	for _, imageRecord := range outOfRetentionImageRecordSlice {
+		versionSlice, err := getVersionSharingImage(imageRecord.Version)
+		if err != nil {
+			// Keep it since the kept image may be deleted together
+			log.Error("Get version sharing image with image record %s version %s error %s", imageRecord.ImageInformation, imageRecord.Version, err)
+			continue
+		}
+		sharingKeptImage := false
+		for _, version := range versionSlice {
+			if keptVersionMap[version] {
+				sharingKeptImage = true
+				break
+			}
+		}
+		if sharingKeptImage == false {
+			imageRecordToRemoveSlice = append(imageRecordToRemoveSlice, imageRecord)
+		}
+	}
+
+	return imageRecordToRemoveSlice
+}
+
+func getImageRecordOutOfRetentionPolicy(retentionPolicy *RetentionPolicy, currentVersion string, imageRecordSlice []ImageRecord, currentTime time.Time) []ImageRecord {
+	outOfRetentionImageRecordSlice := make([]ImageRecord, 0)
+	if retentionPolicy.KeepLastAmount <= 0 && retentionPolicy.KeepNewerThanDays <= 0 {
+		return outOfRetentionImageRecordSlice
+	}
+
+	oldestKeptTime := currentTime.AddDate(0, 0, -retentionPolicy.KeepNewerThanDays)
+	for _, imageRecord := range imageRecordSlice {
+		// The current version is always kept
+		if imageRecord.Version == currentVersion {
+			continue
+		}
+		if retentionPolicy.KeepNewerThanDays > 0 && imageRecord.CreatedTime.After(oldestKeptTime) {
+			continue
+		}
+		if retentionPolicy.KeepLastAmount > 0 && getNewerImageRecordAmount(imageRecord, imageRecordSlice) < retentionPolicy.KeepLastAmount {
+			continue
+		}
+		outOfRetentionImageRecordSlice = append(outOfRetentionImageRecordSlice, imageRecord)
+	}
+
+	return outOfRetentionImageRecordSlice
+}
+
+func getNewerImageRecordAmount(targetImageRecord ImageRecord, imageRecordSlice []ImageRecord) int {
+	amount := 0
+	for _, imageRecord := range imageRecordSlice {
+		if imageRecord.CreatedTime.After(targetImageRecord.CreatedTime) {
+			amount++
+		}
+	}
+	return amount
+}
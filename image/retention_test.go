@@ -0,0 +1,93 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetImageRecordOutOfRetentionPolicy(t *testing.T) {
+	currentTime := time.Now()
+	imageRecordSlice := []ImageRecord{
+		ImageRecord{"test", "1", "", nil, nil, "", currentTime.AddDate(0, 0, -30), false, nil},
+		ImageRecord{"test", "2", "", nil, nil, "", currentTime.AddDate(0, 0, -20), true, nil},
+		ImageRecord{"test", "3", "", nil, nil, "", currentTime.AddDate(0, 0, -10), false, nil},
+		ImageRecord{"test", "4", "", nil, nil, "", currentTime.AddDate(0, 0, -1), false, nil},
+	}
+
+	checkVersion := func(retentionPolicy *RetentionPolicy, currentVersion string, expectedVersionSlice []string) {
+		imageRecordToRemoveSlice := getImageRecordOutOfRetentionPolicy(retentionPolicy, currentVersion, imageRecordSlice, currentTime)
+		if len(imageRecordToRemoveSlice) != len(expectedVersionSlice) {
+			t.Errorf("Policy %v expects %v but get %v", retentionPolicy, expectedVersionSlice, imageRecordToRemoveSlice)
+			return
+		}
+		for i, imageRecord := range imageRecordToRemoveSlice {
+			if imageRecord.Version != expectedVersionSlice[i] {
+				t.Errorf("Policy %v expects %v but get %v", retentionPolicy, expectedVersionSlice, imageRecordToRemoveSlice)
+				return
+			}
+		}
+	}
+
+	checkVersion(&RetentionPolicy{"test", 0, 0}, "4", []string{})
+	checkVersion(&RetentionPolicy{"test", 2, 0}, "4", []string{"1", "2"})
+	checkVersion(&RetentionPolicy{"test", 0, 15}, "4", []string{"1", "2"})
+	checkVersion(&RetentionPolicy{"test", 1, 25}, "4", []string{"1"})
+	// The current version is always kept
+	checkVersion(&RetentionPolicy{"test", 1, 0}, "1", []string{"2", "3"})
+}
+
+func TestGetImageRecordNotSharingKeptImage(t *testing.T) {
+	currentTime := time.Now()
+	imageRecordSlice := []ImageRecord{
+		ImageRecord{"test", "1", "", nil, nil, "", currentTime.AddDate(0, 0, -30), false, nil},
+		ImageRecord{"test", "2", "", nil, nil, "", currentTime.AddDate(0, 0, -20), false, nil},
+		ImageRecord{"test", "3", "", nil, nil, "", currentTime.AddDate(0, 0, -10), false, nil},
+		ImageRecord{"test", "4", "", nil, nil, "", currentTime.AddDate(0, 0, -1), false, nil},
+	}
+	// 1 shares the image with the kept 4 and 2 shares the image with the current version 3
+	sharingMap := map[string][]string{
+		"1": []string{"1", "4"},
+		"2": []string{"2", "3"},
+		"3": []string{"2", "3"},
+		"4": []string{"1", "4"},
+	}
+	getVersionSharingImage := func(version string) ([]string, error) {
+		return sharingMap[version], nil
+	}
+
+	outOfRetentionImageRecordSlice := getImageRecordOutOfRetentionPolicy(&RetentionPolicy{"test", 1, 0}, "3", imageRecordSlice, currentTime)
+	if imageRecordToRemoveSlice := getImageRecordNotSharingKeptImage(outOfRetentionImageRecordSlice, "3", imageRecordSlice, getVersionSharingImage); len(imageRecordToRemoveSlice) != 0 {
+		t.Errorf("Records sharing the kept image should be kept but get %v", imageRecordToRemoveSlice)
+	}
+
+	// Only the ones sharing with each other are removed
+	sharingMap["1"] = []string{"1", "2"}
+	sharingMap["2"] = []string{"1", "2"}
+	imageRecordToRemoveSlice := getImageRecordNotSharingKeptImage(outOfRetentionImageRecordSlice, "3", imageRecordSlice, getVersionSharingImage)
+	if len(imageRecordToRemoveSlice) != 2 || imageRecordToRemoveSlice[0].Version != "1" || imageRecordToRemoveSlice[1].Version != "2" {
+		t.Errorf("Expect 1 and 2 but get %v", imageRecordToRemoveSlice)
+	}
+
+	// Kept when the sharing is unknown
+	imageRecordToRemoveSlice = getImageRecordNotSharingKeptImage(outOfRetentionImageRecordSlice, "3", imageRecordSlice, func(version string) ([]string, error) {
+		return nil, errors.New("registry error")
+	})
+	if len(imageRecordToRemoveSlice) != 0 {
+		t.Errorf("Records should be kept when the sharing is unknown but get %v", imageRecordToRemoveSlice)
+	}
+}
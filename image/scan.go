@@ -0,0 +1,265 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/restclient"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	SeverityNone     = "NONE"
+	SeverityUnknown  = "UNKNOWN"
+	SeverityLow      = "LOW"
+	SeverityMedium   = "MEDIUM"
+	SeverityHigh     = "HIGH"
+	SeverityCritical = "CRITICAL"
+)
+
+var severityLevelMap = map[string]int{
+	SeverityNone:     0,
+	SeverityUnknown:  1,
+	SeverityLow:      2,
+	SeverityMedium:   3,
+	SeverityHigh:     4,
+	SeverityCritical: 5,
+}
+
+const (
+	ScannerDefaultTimeout = time.Minute * 10
+)
+
+type ScanFinding struct {
+	ID           string
+	Package      string
+	Version      string
+	FixedVersion string
+	Severity     string
+	Description  string
+}
+
+type ScanResult struct {
+	Scanner         string
+	ScannedTime     time.Time
+	FindingSlice    []ScanFinding
+	HighestSeverity string
+	ErrorMessage    string
+}
+
+// The scanner outputs a JSON array of findings or an object with the array in the field findings
+type Scanner interface {
+	GetName() string
+	Scan(imageRecord *ImageRecord) ([]ScanFinding, error)
+}
+
+// The image path is appended as the last argument
+type CommandScanner struct {
+	CommandSlice []string
+	Timeout      time.Duration
+}
+
+func (commandScanner *CommandScanner) GetName() string {
+	return strings.Join(commandScanner.CommandSlice, " ")
+}
+
+func (commandScanner *CommandScanner) Scan(imageRecord *ImageRecord) ([]ScanFinding, error) {
+	argumentSlice := append(append([]string{}, commandScanner.CommandSlice[1:]...), imageRecord.Path)
+	command := exec.Command(commandScanner.CommandSlice[0], argumentSlice...)
+	outputBuffer := &bytes.Buffer{}
+	errorBuffer := &bytes.Buffer{}
+	command.Stdout = outputBuffer
+	command.Stderr = errorBuffer
+
+	if err := command.Start(); err != nil {
+		log.Error("Start scanner %s error: %s", commandScanner.GetName(), err)
+		return nil, err
+	}
+
+	doneChannel := make(chan error, 1)
+	go func() {
+		doneChannel <- command.Wait()
+	}()
+
+	var commandError error
+	select {
+	case commandError = <-doneChannel:
+	case <-time.After(commandScanner.Timeout):
+		command.Process.Kill()
+		<-doneChannel
+		return nil, errors.New("Scanner " + commandScanner.GetName() + " timeout")
+	}
+
+	// Some scanners exit with non-zero code when there are findings so the output is parsed first
+	findingSlice, err := parseScanFinding(outputBuffer.Bytes())
+	if err != nil {
+		if commandError != nil {
+			return nil, errors.New("Scanner " + commandScanner.GetName() + " error: " + commandError.Error() + " " + errorBuffer.String())
+		}
+		return nil, err
+	}
+
+	return findingSlice, nil
+}
+
+// Post {"Image": path, "ImageInformation": name, "Version": version} to the endpoint
+type HTTPScanner struct {
+	URL string
+}
+
+func (httpScanner *HTTPScanner) GetName() string {
+	return httpScanner.URL
+}
+
+func (httpScanner *HTTPScanner) Scan(imageRecord *ImageRecord) ([]ScanFinding, error) {
+	jsonMap := make(map[string]interface{})
+	jsonMap["Image"] = imageRecord.Path
+	jsonMap["ImageInformation"] = imageRecord.ImageInformation
+	jsonMap["Version"] = imageRecord.Version
+
+	result, err := restclient.RequestPost(httpScanner.URL, jsonMap, nil, true)
+	if err != nil {
+		log.Error("Request scanner %s error: %s", httpScanner.URL, err)
+		return nil, err
+	}
+
+	byteSlice, err := json.Marshal(result)
+	if err != nil {
+		log.Error("Marshal scanner %s result error: %s", httpScanner.URL, err)
+		return nil, err
+	}
+
+	return parseScanFinding(byteSlice)
+}
+
+func parseScanFinding(byteSlice []byte) ([]ScanFinding, error) {
+	text := strings.TrimSpace(string(byteSlice))
+	if strings.HasPrefix(text, "[") {
+		findingSlice := make([]ScanFinding, 0)
+		err := json.Unmarshal([]byte(text), &findingSlice)
+		if err != nil {
+			log.Error("Unmarshal scan findings %s error: %s", text, err)
+			return nil, err
+		}
+		return findingSlice, nil
+	}
+
+	scanOutput := struct {
+		Findings []ScanFinding
+	}{}
+	err := json.Unmarshal([]byte(text), &scanOutput)
+	if err != nil {
+		log.Error("Unmarshal scan output %s error: %s", text, err)
+		return nil, err
+	}
+	if scanOutput.Findings == nil {
+		return make([]ScanFinding, 0), nil
+	}
+	return scanOutput.Findings, nil
+}
+
+// Return nil if no scanner is configured
+func GetScanner() Scanner {
+	if commandSlice, ok := configuration.LocalConfiguration.GetStringSlice("imageScannerCommand"); ok && len(commandSlice) > 0 {
+		timeout := ScannerDefaultTimeout
+		if timeoutInSecond, ok := configuration.LocalConfiguration.GetInt("imageScannerTimeoutInSecond"); ok && timeoutInSecond > 0 {
+			timeout = time.Duration(timeoutInSecond) * time.Second
+		}
+		return &CommandScanner{commandSlice, timeout}
+	}
+	if url, ok := configuration.LocalConfiguration.GetString("imageScannerURL"); ok && url != "" {
+		return &HTTPScanner{url}
+	}
+	return nil
+}
+
+// The failure of scanning is kept in the result rather than failing the build
+func ScanImageRecord(scanner Scanner, imageRecord *ImageRecord) *ScanResult {
+	scanResult := &ScanResult{}
+	scanResult.Scanner = scanner.GetName()
+	scanResult.ScannedTime = time.Now()
+
+	findingSlice, err := scanner.Scan(imageRecord)
+	if err != nil {
+		log.Error("Scan image %s error: %s", imageRecord.Path, err)
+		scanResult.ErrorMessage = err.Error()
+		scanResult.FindingSlice = make([]ScanFinding, 0)
+		return scanResult
+	}
+
+	scanResult.FindingSlice = findingSlice
+	scanResult.HighestSeverity = GetHighestSeverity(findingSlice)
+	return scanResult
+}
+
+func GetHighestSeverity(findingSlice []ScanFinding) string {
+	highestSeverity := SeverityNone
+	for _, finding := range findingSlice {
+		severity := NormalizeSeverity(finding.Severity)
+		if GetSeverityLevel(severity) > GetSeverityLevel(highestSeverity) {
+			highestSeverity = severity
+		}
+	}
+	return highestSeverity
+}
+
+func NormalizeSeverity(severity string) string {
+	severity = strings.ToUpper(strings.TrimSpace(severity))
+	if _, ok := severityLevelMap[severity]; ok {
+		return severity
+	}
+	return SeverityUnknown
+}
+
+func GetSeverityLevel(severity string) int {
+	return severityLevelMap[NormalizeSeverity(severity)]
+}
+
+func IsValidSeverity(severity string) bool {
+	_, ok := severityLevelMap[severity]
+	return ok
+}
+
+// Scan the existing record again with the configured scanner
+func RescanImageRecord(imageInformationName string, version string) (*ImageRecord, error) {
+	scanner := GetScanner()
+	if scanner == nil {
+		return nil, errors.New("No image scanner is configured")
+	}
+
+	imageRecord, err := GetStorage().LoadImageRecord(imageInformationName, version)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if imageRecord.Failure {
+		return nil, errors.New("The failed build has no image to scan")
+	}
+
+	imageRecord.ScanResult = ScanImageRecord(scanner, imageRecord)
+
+	err = GetStorage().saveImageRecord(imageRecord)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return imageRecord, nil
+}
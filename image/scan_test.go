@@ -0,0 +1,46 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"testing"
+)
+
+func TestParseScanFinding(t *testing.T) {
+	findingSlice, err := parseScanFinding([]byte(`[{"ID": "CVE-1", "Severity": "low"}, {"ID": "CVE-2", "Severity": "HIGH"}]`))
+	if err != nil {
+		t.Error(err)
+	} else if len(findingSlice) != 2 || GetHighestSeverity(findingSlice) != SeverityHigh {
+		t.Errorf("Unexpected findings %v", findingSlice)
+	}
+
+	findingSlice, err = parseScanFinding([]byte(`{"findings": [{"ID": "CVE-3", "Severity": "Critical"}]}`))
+	if err != nil {
+		t.Error(err)
+	} else if len(findingSlice) != 1 || GetHighestSeverity(findingSlice) != SeverityCritical {
+		t.Errorf("Unexpected findings %v", findingSlice)
+	}
+
+	findingSlice, err = parseScanFinding([]byte(`{}`))
+	if err != nil {
+		t.Error(err)
+	} else if len(findingSlice) != 0 || GetHighestSeverity(findingSlice) != SeverityNone {
+		t.Errorf("Unexpected findings %v", findingSlice)
+	}
+
+	if _, err := parseScanFinding([]byte(`not json`)); err == nil {
+		t.Errorf("Invalid output should fail")
+	}
+}
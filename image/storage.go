@@ -92,4 +92,8 @@ type Storage interface {
 	saveImageRecord(imageRecord *ImageRecord) error
 	LoadImageRecord(imageInformationName string, version string) (*ImageRecord, error)
 	LoadImageRecordWithImageInformationName(imageInformationName string) ([]ImageRecord, error)
+	DeleteRetentionPolicy(imageInformationName string) error
+	SaveRetentionPolicy(retentionPolicy *RetentionPolicy) error
+	LoadRetentionPolicy(imageInformationName string) (*RetentionPolicy, error)
+	LoadAllRetentionPolicy() ([]RetentionPolicy, error)
 }
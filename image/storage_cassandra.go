@@ -15,6 +15,7 @@
 package image
 
 import (
+	"encoding/json"
 	"github.com/cloudawan/cloudone/utility/database/cassandra"
 	"github.com/gocql/gocql"
 	"time"
@@ -49,6 +50,23 @@ func (storageCassandra *StorageCassandra) initialize() error {
 	PRIMARY KEY (image_information, version));
 	`
 
+	// The scan result is kept in its own table so the existing image_record table doesn't need to be altered
+	tableSchemaImageRecordScanResult := `
+	CREATE TABLE IF NOT EXISTS image_record_scan_result (
+	image_information varchar,
+	version varchar,
+	scan_result varchar,
+	PRIMARY KEY (image_information, version));
+	`
+
+	tableSchemaImageRetentionPolicy := `
+	CREATE TABLE IF NOT EXISTS image_retention_policy (
+	image_information varchar,
+	keep_last_amount int,
+	keep_newer_than_days int,
+	PRIMARY KEY (image_information));
+	`
+
 	err := cassandra.CassandraClient.CreateTableIfNotExist(tableSchemaImageInformation, 3, time.Second*5)
 	if err != nil {
 		log.Critical("Fail to create table with schema %s", tableSchemaImageInformation)
@@ -59,6 +77,16 @@ func (storageCassandra *StorageCassandra) initialize() error {
 		log.Critical("Fail to create table with schema %s", tableSchemaImageRecord)
 		return err
 	}
+	err = cassandra.CassandraClient.CreateTableIfNotExist(tableSchemaImageRecordScanResult, 3, time.Second*5)
+	if err != nil {
+		log.Critical("Fail to create table with schema %s", tableSchemaImageRecordScanResult)
+		return err
+	}
+	err = cassandra.CassandraClient.CreateTableIfNotExist(tableSchemaImageRetentionPolicy, 3, time.Second*5)
+	if err != nil {
+		log.Critical("Fail to create table with schema %s", tableSchemaImageRetentionPolicy)
+		return err
+	}
 
 	return nil
 }
@@ -82,14 +110,19 @@ func (storageCassandra *StorageCassandra) SaveImageInformation(imageInformation
 		log.Error("Get session error %s", err)
 		return err
 	}
+	encryptedImageInformation, err := getEncryptedImageInformation(imageInformation)
+	if err != nil {
+		log.Error("Encrypt ImageInformation %s error: %s", imageInformation.Name, err)
+		return err
+	}
 	if err := session.Query("INSERT INTO image_information (name, kind, description, current_version, build_parameter) VALUES (?, ?, ?, ?, ?)",
-		imageInformation.Name,
-		imageInformation.Kind,
-		imageInformation.Description,
-		imageInformation.CurrentVersion,
-		imageInformation.BuildParameter,
+		encryptedImageInformation.Name,
+		encryptedImageInformation.Kind,
+		encryptedImageInformation.Description,
+		encryptedImageInformation.CurrentVersion,
+		encryptedImageInformation.BuildParameter,
 	).Exec(); err != nil {
-		log.Error("Save ImageInformation %s error: %s", imageInformation, err)
+		log.Error("Save ImageInformation %s error: %s", imageInformation.Name, err)
 		return err
 	}
 	return nil
@@ -112,9 +145,13 @@ func (storageCassandra *StorageCassandra) LoadImageInformation(name string) (*Im
 	if err != nil {
 		log.Error("Load ImageInformation %s error: %s", name, err)
 		return nil, err
-	} else {
-		return imageInformation, nil
 	}
+	err = decryptImageInformation(imageInformation)
+	if err != nil {
+		log.Error("Decrypt ImageInformation %s error: %s", name, err)
+		return nil, err
+	}
+	return imageInformation, nil
 }
 
 func (storageCassandra *StorageCassandra) LoadAllImageInformation() ([]ImageInformation, error) {
@@ -135,6 +172,11 @@ func (storageCassandra *StorageCassandra) LoadAllImageInformation() ([]ImageInfo
 		&imageInformation.CurrentVersion,
 		&imageInformation.BuildParameter,
 	) {
+		if err := decryptImageInformation(imageInformation); err != nil {
+			log.Error("Decrypt ImageInformation %s error: %s", imageInformation.Name, err)
+			iter.Close()
+			return nil, err
+		}
 		imageInformationSlice = append(imageInformationSlice, *imageInformation)
 		imageInformation = new(ImageInformation)
 	}
@@ -158,6 +200,10 @@ func (storageCassandra *StorageCassandra) DeleteImageRecord(imageInformationName
 		log.Error("Delete ImageRecord with image information name %s, version %s error: %s", imageInformationName, version, err)
 		return err
 	}
+	if err := session.Query("DELETE FROM image_record_scan_result WHERE image_information = ? AND version = ?", imageInformationName, version).Exec(); err != nil {
+		log.Error("Delete ScanResult with image information name %s, version %s error: %s", imageInformationName, version, err)
+		return err
+	}
 	return nil
 }
 
@@ -171,6 +217,10 @@ func (storageCassandra *StorageCassandra) deleteImageRecordWithImageInformationN
 		log.Error("Delete ImageRecord with image information name %s error: %s", imageInformationName, err)
 		return err
 	}
+	if err := session.Query("DELETE FROM image_record_scan_result WHERE image_information = ?", imageInformationName).Exec(); err != nil {
+		log.Error("Delete ScanResult with image information name %s error: %s", imageInformationName, err)
+		return err
+	}
 	return nil
 }
 
@@ -185,9 +235,55 @@ func (storageCassandra *StorageCassandra) saveImageRecord(imageRecord *ImageReco
 		log.Error("Save ImageRecord %s error: %s", imageRecord, err)
 		return err
 	}
+
+	if imageRecord.ScanResult == nil {
+		if err := session.Query("DELETE FROM image_record_scan_result WHERE image_information = ? AND version = ?", imageRecord.ImageInformation, imageRecord.Version).Exec(); err != nil {
+			log.Error("Delete ScanResult with image information name %s, version %s error: %s", imageRecord.ImageInformation, imageRecord.Version, err)
+			return err
+		}
+		return nil
+	}
+
+	byteSlice, err := json.Marshal(imageRecord.ScanResult)
+	if err != nil {
+		log.Error("Marshal ScanResult %v error %s", imageRecord.ScanResult, err)
+		return err
+	}
+	if err := session.Query("INSERT INTO image_record_scan_result (image_information, version, scan_result) VALUES (?, ?, ?)",
+		imageRecord.ImageInformation, imageRecord.Version, string(byteSlice)).Exec(); err != nil {
+		log.Error("Save ScanResult of ImageRecord %s error: %s", imageRecord, err)
+		return err
+	}
 	return nil
 }
 
+// Key is the version
+func (storageCassandra *StorageCassandra) loadScanResultMap(session *gocql.Session, imageInformationName string) (map[string]*ScanResult, error) {
+	iter := session.Query("SELECT version, scan_result FROM image_record_scan_result WHERE image_information = ?", imageInformationName).Iter()
+
+	scanResultMap := make(map[string]*ScanResult)
+	var version string
+	var text string
+	for iter.Scan(&version, &text) {
+		scanResult := new(ScanResult)
+		err := json.Unmarshal([]byte(text), scanResult)
+		if err != nil {
+			log.Error("Unmarshal ScanResult %s error %s", text, err)
+			iter.Close()
+			return nil, err
+		}
+		scanResultMap[version] = scanResult
+	}
+
+	err := iter.Close()
+	if err != nil {
+		log.Error("Load ScanResult %s error: %s", imageInformationName, err)
+		return nil, err
+	}
+
+	return scanResultMap, nil
+}
+
 func (storageCassandra *StorageCassandra) LoadImageRecord(imageInformationName string, version string) (*ImageRecord, error) {
 	session, err := cassandra.CassandraClient.GetSession()
 	if err != nil {
@@ -208,10 +304,26 @@ func (storageCassandra *StorageCassandra) LoadImageRecord(imageInformationName s
 	if err != nil {
 		log.Error("Load ImageRecord %s version %s error: %s", imageInformationName, version, err)
 		return nil, err
-	} else {
-		imageRecord.CreatedTime = uuid.Time()
+	}
+	imageRecord.CreatedTime = uuid.Time()
+
+	var text string
+	err = session.Query("SELECT scan_result FROM image_record_scan_result WHERE image_information = ? AND version = ?", imageInformationName, version).Scan(&text)
+	if err == gocql.ErrNotFound {
 		return imageRecord, nil
 	}
+	if err != nil {
+		log.Error("Load ScanResult %s version %s error: %s", imageInformationName, version, err)
+		return nil, err
+	}
+	imageRecord.ScanResult = new(ScanResult)
+	err = json.Unmarshal([]byte(text), imageRecord.ScanResult)
+	if err != nil {
+		log.Error("Unmarshal ScanResult %s error %s", text, err)
+		return nil, err
+	}
+
+	return imageRecord, nil
 }
 
 func (storageCassandra *StorageCassandra) LoadImageRecordWithImageInformationName(imageInformationName string) ([]ImageRecord, error) {
@@ -236,7 +348,91 @@ func (storageCassandra *StorageCassandra) LoadImageRecordWithImageInformationNam
 	if err != nil {
 		log.Error("Load ImageRecord %s error: %s", imageInformationName, err)
 		return nil, err
+	}
+
+	scanResultMap, err := storageCassandra.loadScanResultMap(session, imageInformationName)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	for i := range imageRecordSlice {
+		imageRecordSlice[i].ScanResult = scanResultMap[imageRecordSlice[i].Version]
+	}
+
+	return imageRecordSlice, nil
+}
+
+func (storageCassandra *StorageCassandra) DeleteRetentionPolicy(imageInformationName string) error {
+	session, err := cassandra.CassandraClient.GetSession()
+	if err != nil {
+		log.Error("Get session error %s", err)
+		return err
+	}
+	if err := session.Query("DELETE FROM image_retention_policy WHERE image_information = ?", imageInformationName).Exec(); err != nil {
+		log.Error("Delete RetentionPolicy with image information name %s error: %s", imageInformationName, err)
+		return err
+	}
+	return nil
+}
+
+func (storageCassandra *StorageCassandra) SaveRetentionPolicy(retentionPolicy *RetentionPolicy) error {
+	session, err := cassandra.CassandraClient.GetSession()
+	if err != nil {
+		log.Error("Get session error %s", err)
+		return err
+	}
+	if err := session.Query("INSERT INTO image_retention_policy (image_information, keep_last_amount, keep_newer_than_days) VALUES (?, ?, ?)",
+		retentionPolicy.ImageInformation,
+		retentionPolicy.KeepLastAmount,
+		retentionPolicy.KeepNewerThanDays,
+	).Exec(); err != nil {
+		log.Error("Save RetentionPolicy %v error: %s", retentionPolicy, err)
+		return err
+	}
+	return nil
+}
+
+func (storageCassandra *StorageCassandra) LoadRetentionPolicy(imageInformationName string) (*RetentionPolicy, error) {
+	session, err := cassandra.CassandraClient.GetSession()
+	if err != nil {
+		log.Error("Get session error %s", err)
+		return nil, err
+	}
+	retentionPolicy := new(RetentionPolicy)
+	err = session.Query("SELECT image_information, keep_last_amount, keep_newer_than_days FROM image_retention_policy WHERE image_information = ?", imageInformationName).Scan(
+		&retentionPolicy.ImageInformation,
+		&retentionPolicy.KeepLastAmount,
+		&retentionPolicy.KeepNewerThanDays,
+	)
+	if err != nil {
+		log.Error("Load RetentionPolicy %s error: %s", imageInformationName, err)
+		return nil, err
+	} else {
+		return retentionPolicy, nil
+	}
+}
+
+func (storageCassandra *StorageCassandra) LoadAllRetentionPolicy() ([]RetentionPolicy, error) {
+	session, err := cassandra.CassandraClient.GetSession()
+	if err != nil {
+		log.Error("Get session error %s", err)
+		return nil, err
+	}
+	iter := session.Query("SELECT image_information, keep_last_amount, keep_newer_than_days FROM image_retention_policy").Iter()
+
+	retentionPolicySlice := make([]RetentionPolicy, 0)
+	retentionPolicy := new(RetentionPolicy)
+
+	for iter.Scan(&retentionPolicy.ImageInformation, &retentionPolicy.KeepLastAmount, &retentionPolicy.KeepNewerThanDays) {
+		retentionPolicySlice = append(retentionPolicySlice, *retentionPolicy)
+		retentionPolicy = new(RetentionPolicy)
+	}
+
+	err = iter.Close()
+	if err != nil {
+		log.Error("Load all RetentionPolicy error: %s", err)
+		return nil, err
 	} else {
-		return imageRecordSlice, nil
+		return retentionPolicySlice, nil
 	}
 }
@@ -85,3 +85,19 @@ func (storageDummy *StorageDummy) LoadImageRecord(imageInformationName string, v
 func (storageDummy *StorageDummy) LoadImageRecordWithImageInformationName(imageInformationName string) ([]ImageRecord, error) {
 	return nil, &storageDummy.dummyError
 }
+
+func (storageDummy *StorageDummy) DeleteRetentionPolicy(imageInformationName string) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveRetentionPolicy(retentionPolicy *RetentionPolicy) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadRetentionPolicy(imageInformationName string) (*RetentionPolicy, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadAllRetentionPolicy() ([]RetentionPolicy, error) {
+	return nil, &storageDummy.dummyError
+}
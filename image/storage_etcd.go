@@ -40,6 +40,11 @@ func (storageEtcd *StorageEtcd) initialize() error {
 		return err
 	}
 
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/image_retention_policy"); err != nil {
+		log.Error("Create if not existing image retention policy directory error: %s", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -73,15 +78,21 @@ func (storageEtcd *StorageEtcd) SaveImageInformation(imageInformation *ImageInfo
 		return err
 	}
 
-	byteSlice, err := json.Marshal(imageInformation)
+	encryptedImageInformation, err := getEncryptedImageInformation(imageInformation)
+	if err != nil {
+		log.Error("Encrypt image information %s error %s", imageInformation.Name, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedImageInformation)
 	if err != nil {
-		log.Error("Marshal image information %v error %s", imageInformation, err)
+		log.Error("Marshal image information %s error %s", imageInformation.Name, err)
 		return err
 	}
 
 	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/image_information/"+imageInformation.Name, string(byteSlice), nil)
 	if err != nil {
-		log.Error("Save image information %v error: %s", imageInformation, err)
+		log.Error("Save image information %s error: %s", imageInformation.Name, err)
 		log.Error(response)
 		return err
 	}
@@ -110,7 +121,12 @@ func (storageEtcd *StorageEtcd) LoadImageInformation(name string) (*ImageInforma
 	imageInformation := new(ImageInformation)
 	err = json.Unmarshal([]byte(response.Node.Value), &imageInformation)
 	if err != nil {
-		log.Error("Unmarshal image information %v error %s", response.Node.Value, err)
+		log.Error("Unmarshal image information %s error %s", name, err)
+		return nil, err
+	}
+	err = decryptImageInformation(imageInformation)
+	if err != nil {
+		log.Error("Decrypt image information %s error %s", name, err)
 		return nil, err
 	}
 
@@ -136,7 +152,12 @@ func (storageEtcd *StorageEtcd) LoadAllImageInformation() ([]ImageInformation, e
 		imageInformation := ImageInformation{}
 		err := json.Unmarshal([]byte(node.Value), &imageInformation)
 		if err != nil {
-			log.Error("Unmarshal image information %v error %s", node.Value, err)
+			log.Error("Unmarshal image information %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptImageInformation(&imageInformation)
+		if err != nil {
+			log.Error("Decrypt image information %s error %s", node.Key, err)
 			return nil, err
 		}
 		imageInformationSlice = append(imageInformationSlice, imageInformation)
@@ -275,3 +296,105 @@ func (storageEtcd *StorageEtcd) LoadImageRecordWithImageInformationName(imageInf
 }
 
 // If Load all image record is used, the second level directory may have empty issue and need to be solved
+
+func (storageEtcd *StorageEtcd) DeleteRetentionPolicy(imageInformationName string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/image_retention_policy/"+imageInformationName, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		log.Debug(response)
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete retention policy with image information name %s error: %s", imageInformationName, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveRetentionPolicy(retentionPolicy *RetentionPolicy) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(retentionPolicy)
+	if err != nil {
+		log.Error("Marshal retention policy %v error %s", retentionPolicy, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/image_retention_policy/"+retentionPolicy.ImageInformation, string(byteSlice), nil)
+	if err != nil {
+		log.Error("Save retention policy %v error: %s", retentionPolicy, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadRetentionPolicy(imageInformationName string) (*RetentionPolicy, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/image_retention_policy/"+imageInformationName, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, etcdError
+	}
+	if err != nil {
+		log.Error("Load retention policy with image information name %s error: %s", imageInformationName, err)
+		log.Error(response)
+		return nil, err
+	}
+
+	retentionPolicy := new(RetentionPolicy)
+	err = json.Unmarshal([]byte(response.Node.Value), &retentionPolicy)
+	if err != nil {
+		log.Error("Unmarshal retention policy %v error %s", response.Node.Value, err)
+		return nil, err
+	}
+
+	return retentionPolicy, nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAllRetentionPolicy() ([]RetentionPolicy, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/image_retention_policy", nil)
+	if err != nil {
+		log.Error("Load all retention policy error: %s", err)
+		log.Error(response)
+		return nil, err
+	}
+
+	retentionPolicySlice := make([]RetentionPolicy, 0)
+	for _, node := range response.Node.Nodes {
+		retentionPolicy := RetentionPolicy{}
+		err := json.Unmarshal([]byte(node.Value), &retentionPolicy)
+		if err != nil {
+			log.Error("Unmarshal retention policy %v error %s", node.Value, err)
+			return nil, err
+		}
+		retentionPolicySlice = append(retentionPolicySlice, retentionPolicy)
+	}
+
+	return retentionPolicySlice, nil
+}
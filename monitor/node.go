@@ -15,6 +15,7 @@
 package monitor
 
 import (
+	"github.com/cloudawan/cloudone/control"
 	"github.com/cloudawan/cloudone_utility/jsonparse"
 	"github.com/cloudawan/cloudone_utility/logger"
 	"github.com/cloudawan/cloudone_utility/restclient"
@@ -43,11 +44,7 @@ func MonitorNode(kubeApiServerEndPoint string, kubeApiServerToken string) (retur
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/nodes", headerMap, true)
-	jsonMap, _ := result.(map[string]interface{})
+	jsonMap, err := control.GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, control.InformerResourceNode, "")
 	if err != nil {
 		log.Error("Fail to get node inofrmation with endpoint: %s, token: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, err.Error())
 		return nil, err
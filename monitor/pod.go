@@ -16,6 +16,7 @@ package monitor
 
 import (
 	"errors"
+	"github.com/cloudawan/cloudone/control"
 	"github.com/cloudawan/cloudone_utility/jsonparse"
 	"github.com/cloudawan/cloudone_utility/logger"
 	"github.com/cloudawan/cloudone_utility/restclient"
@@ -51,11 +52,7 @@ func MonitorPod(kubeApiServerEndPoint string, kubeApiServerToken string, namespa
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/"+podName+"/", headerMap, true)
-	jsonMap, _ := result.(map[string]interface{})
+	jsonMap, err := control.GetResourceObject(kubeApiServerEndPoint, kubeApiServerToken, control.InformerResourcePod, namespace, podName)
 	if err != nil {
 		log.Error("Fail to get pod inofrmation with endpoint: %s, token: %s, namespace: %s, pod name: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, podName, err.Error())
 		return nil, err
@@ -18,7 +18,6 @@ import (
 	"errors"
 	"github.com/cloudawan/cloudone/control"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 )
 
 type ReplicationControllerMetric struct {
@@ -39,10 +38,7 @@ func ExistReplicationController(kubeApiServerEndPoint string, kubeApiServerToken
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	_, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/replicationcontrollers/"+replicationControllerName, headerMap, true)
+	_, err := control.GetResourceObject(kubeApiServerEndPoint, kubeApiServerToken, control.InformerResourceReplicationController, namespace, replicationControllerName)
 	if err != nil {
 		log.Error("Fail to detect replication controller existence with endpoint: %s, token: %s, namespace: %s, replication controller name: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName, err.Error())
 		return false, err
@@ -71,6 +67,25 @@ func MonitorReplicationController(kubeApiServerEndPoint string, kubeApiServerTok
 		return nil, err
 	}
 
+	return monitorPodOwner(kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName)
+}
+
+// The replica set is found from the revisions of its deployment so the existence is not checked again
+func MonitorReplicaSet(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, replicaSetName string) (returnedReplicationControllerMetric *ReplicationControllerMetric, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("MonitorReplicaSet Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedReplicationControllerMetric = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	return monitorPodOwner(kubeApiServerEndPoint, kubeApiServerToken, namespace, replicaSetName)
+}
+
+// The pods of both the replication controller and the replica set are generated with the owner name as the prefix
+func monitorPodOwner(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, replicationControllerName string) (*ReplicationControllerMetric, error) {
 	podNameSlice, err := control.GetAllPodNameBelongToReplicationController(kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName)
 	if err != nil {
 		log.Error("Fail to get all pod name belong to the replication controller with endpoint: %s, token: %s, namespace: %s, replication controller name: %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName)
@@ -115,11 +130,7 @@ func GetReplicationControllerNameFromSelector(kubeApiServerEndPoint, kubeApiServ
 		}
 	}()
 
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = kubeApiServerToken
-
-	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/replicationcontrollers/", headerMap, true)
-	jsonMap, _ := result.(map[string]interface{})
+	jsonMap, err := control.GetResourceList(kubeApiServerEndPoint, kubeApiServerToken, control.InformerResourceReplicationController, namespace)
 	if err != nil {
 		log.Error("Fail to get all replication controller with endpoint: %s, token: %s, namespace: %s, selector name: %s",
 			kubeApiServerEndPoint, kubeApiServerToken, namespace, targetSelectorName)
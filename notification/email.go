@@ -15,6 +15,7 @@
 package notification
 
 import (
+	"github.com/cloudawan/cloudone/utility/secret"
 	"net/smtp"
 	"strconv"
 )
@@ -76,3 +77,23 @@ func (notifierEmail NotifierEmail) notify(message string) error {
 			notifierEmail.ReceiverAccountSlice, "Abnormal Notification", message)
 	}
 }
+
+// Return a copy with the password encrypted for the storage
+func getEncryptedEmailServerSMTP(emailServerSMTP *EmailServerSMTP) (*EmailServerSMTP, error) {
+	encryptedEmailServerSMTP := *emailServerSMTP
+	password, err := secret.Encrypt(emailServerSMTP.Password)
+	if err != nil {
+		return nil, err
+	}
+	encryptedEmailServerSMTP.Password = password
+	return &encryptedEmailServerSMTP, nil
+}
+
+func decryptEmailServerSMTP(emailServerSMTP *EmailServerSMTP) error {
+	password, err := secret.Decrypt(emailServerSMTP.Password)
+	if err != nil {
+		return err
+	}
+	emailServerSMTP.Password = password
+	return nil
+}
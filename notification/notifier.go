@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/cloudawan/cloudone/deploy"
+	"github.com/cloudawan/cloudone/event"
 	"github.com/cloudawan/cloudone/monitor"
 	"strconv"
 	"time"
@@ -77,8 +78,16 @@ func CheckAndExecuteNotifier(replicationControllerNotifier *ReplicationControlle
 			log.Error("Load deploy information failure: %s where replicationControllerNotifier %v", err, replicationControllerNotifier)
 			return false, err
 		}
-		replicationControllerName := deployInformation.ImageInformationName + deployInformation.CurrentVersion
-		return CheckAndExecuteNotifierOnReplicationController(replicationControllerNotifier, replicationControllerName)
+		podOwnerName, err := deploy.GetPodOwnerName(replicationControllerNotifier.KubeApiServerEndPoint, replicationControllerNotifier.KubeApiServerToken, deployInformation)
+		if err != nil {
+			log.Error("Get pod owner name failure: %s where replicationControllerNotifier %v", err, replicationControllerNotifier)
+			return false, err
+		}
+		if deployInformation.GetWorkloadKind() == deploy.WorkloadKindDeployment {
+			replicationControllerMetric, err := monitor.MonitorReplicaSet(replicationControllerNotifier.KubeApiServerEndPoint, replicationControllerNotifier.KubeApiServerToken, replicationControllerNotifier.Namespace, podOwnerName)
+			return checkAndExecuteNotifierOnMetric(replicationControllerNotifier, podOwnerName, replicationControllerMetric, err)
+		}
+		return CheckAndExecuteNotifierOnReplicationController(replicationControllerNotifier, podOwnerName)
 	case "selector":
 		nameSlice, err := monitor.GetReplicationControllerNameFromSelector(
 			replicationControllerNotifier.KubeApiServerEndPoint,
@@ -115,6 +124,10 @@ func CheckAndExecuteNotifier(replicationControllerNotifier *ReplicationControlle
 
 func CheckAndExecuteNotifierOnReplicationController(replicationControllerNotifier *ReplicationControllerNotifier, replicationControllerName string) (bool, error) {
 	replicationControllerMetric, err := monitor.MonitorReplicationController(replicationControllerNotifier.KubeApiServerEndPoint, replicationControllerNotifier.KubeApiServerToken, replicationControllerNotifier.Namespace, replicationControllerName)
+	return checkAndExecuteNotifierOnMetric(replicationControllerNotifier, replicationControllerName, replicationControllerMetric, err)
+}
+
+func checkAndExecuteNotifierOnMetric(replicationControllerNotifier *ReplicationControllerNotifier, replicationControllerName string, replicationControllerMetric *monitor.ReplicationControllerMetric, err error) (bool, error) {
 	if err != nil {
 		log.Error("Get ReplicationController %s data failure: %s where replicationControllerNotifier %v", replicationControllerName, err, replicationControllerNotifier)
 	}
@@ -139,6 +152,10 @@ func CheckAndExecuteNotifierOnReplicationController(replicationControllerNotifie
 
 	errorBuffer := bytes.Buffer{}
 	if toNotify {
+		dataMap := make(map[string]interface{})
+		dataMap["Kind"] = replicationControllerNotifier.Kind
+		event.Publish(event.KindNotifierAlert, replicationControllerNotifier.Namespace, replicationControllerName, message.String(), dataMap)
+
 		for _, notifier := range replicationControllerNotifier.NotifierSlice {
 			err := notifier.notify(message.String())
 			if err != nil {
@@ -244,3 +261,43 @@ func ConvertFromSerializable(replicationControllerNotifierSerializable Replicati
 
 	return replicationControllerNotifier, err
 }
+
+// Notify with the notifiers which are not bound to any replication controller such as the ones of the slb daemons
+func Notify(notifierSerializableSlice []NotifierSerializable, message string) error {
+	errorBuffer := bytes.Buffer{}
+	for _, notifierSerializable := range notifierSerializableSlice {
+		var notifier Notifier = nil
+		switch notifierSerializable.Kind {
+		case "email":
+			notifierEmail := NotifierEmail{}
+			err := json.Unmarshal([]byte(notifierSerializable.Data), &notifierEmail)
+			if err != nil {
+				errorBuffer.WriteString(err.Error())
+				continue
+			}
+			notifier = notifierEmail
+		case "smsNexmo":
+			notifierSMSNexmo := NotifierSMSNexmo{}
+			err := json.Unmarshal([]byte(notifierSerializable.Data), &notifierSMSNexmo)
+			if err != nil {
+				errorBuffer.WriteString(err.Error())
+				continue
+			}
+			notifier = notifierSMSNexmo
+		default:
+			errorBuffer.WriteString("No such kind " + notifierSerializable.Kind)
+			continue
+		}
+
+		err := notifier.notify(message)
+		if err != nil {
+			errorBuffer.WriteString(err.Error())
+		}
+	}
+
+	if errorBuffer.Len() > 0 {
+		return errors.New(errorBuffer.String())
+	} else {
+		return nil
+	}
+}
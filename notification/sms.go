@@ -17,6 +17,7 @@ package notification
 import (
 	"bytes"
 	"errors"
+	"github.com/cloudawan/cloudone/utility/secret"
 	"github.com/cloudawan/cloudone_utility/restclient"
 	"net/url"
 )
@@ -82,3 +83,23 @@ func (notifierSMSNexmo NotifierSMSNexmo) notify(message string) error {
 			notifierSMSNexmo.Sender, notifierSMSNexmo.ReceiverNumberSlice, message)
 	}
 }
+
+// Return a copy with the api secret encrypted for the storage
+func getEncryptedSMSNexmo(smsNexmo *SMSNexmo) (*SMSNexmo, error) {
+	encryptedSMSNexmo := *smsNexmo
+	apiSecret, err := secret.Encrypt(smsNexmo.APISecret)
+	if err != nil {
+		return nil, err
+	}
+	encryptedSMSNexmo.APISecret = apiSecret
+	return &encryptedSMSNexmo, nil
+}
+
+func decryptSMSNexmo(smsNexmo *SMSNexmo) error {
+	apiSecret, err := secret.Decrypt(smsNexmo.APISecret)
+	if err != nil {
+		return err
+	}
+	smsNexmo.APISecret = apiSecret
+	return nil
+}
@@ -182,15 +182,21 @@ func (storageEtcd *StorageEtcd) SaveEmailServerSMTP(emailServerSMTP *EmailServer
 		return err
 	}
 
-	byteSlice, err := json.Marshal(emailServerSMTP)
+	encryptedEmailServerSMTP, err := getEncryptedEmailServerSMTP(emailServerSMTP)
 	if err != nil {
-		log.Error("Marshal email server smtp %v error %s", emailServerSMTP, err)
+		log.Error("Encrypt email server smtp %s error %s", emailServerSMTP.Name, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedEmailServerSMTP)
+	if err != nil {
+		log.Error("Marshal email server smtp %s error %s", emailServerSMTP.Name, err)
 		return err
 	}
 
 	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/email_server_smtp/"+emailServerSMTP.Name, string(byteSlice), nil)
 	if err != nil {
-		log.Error("Save email server smtp %v error: %s", emailServerSMTP, err)
+		log.Error("Save email server smtp %s error: %s", emailServerSMTP.Name, err)
 		log.Error(response)
 		return err
 	}
@@ -219,7 +225,12 @@ func (storageEtcd *StorageEtcd) LoadEmailServerSMTP(name string) (*EmailServerSM
 	emailServerSMTP := new(EmailServerSMTP)
 	err = json.Unmarshal([]byte(response.Node.Value), &emailServerSMTP)
 	if err != nil {
-		log.Error("Unmarshal email server smtp %v error %s", response.Node.Value, err)
+		log.Error("Unmarshal email server smtp %s error %s", name, err)
+		return nil, err
+	}
+	err = decryptEmailServerSMTP(emailServerSMTP)
+	if err != nil {
+		log.Error("Decrypt email server smtp %s error %s", name, err)
 		return nil, err
 	}
 
@@ -245,7 +256,12 @@ func (storageEtcd *StorageEtcd) LoadAllEmailServerSMTP() ([]EmailServerSMTP, err
 		emailServerSMTP := EmailServerSMTP{}
 		err := json.Unmarshal([]byte(node.Value), &emailServerSMTP)
 		if err != nil {
-			log.Error("Unmarshal email server smtp %v error %s", node.Value, err)
+			log.Error("Unmarshal email server smtp %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptEmailServerSMTP(&emailServerSMTP)
+		if err != nil {
+			log.Error("Decrypt email server smtp %s error %s", node.Key, err)
 			return nil, err
 		}
 		emailServerSMTPSlice = append(emailServerSMTPSlice, emailServerSMTP)
@@ -284,15 +300,21 @@ func (storageEtcd *StorageEtcd) SaveSMSNexmo(smsNexmo *SMSNexmo) error {
 		return err
 	}
 
-	byteSlice, err := json.Marshal(smsNexmo)
+	encryptedSMSNexmo, err := getEncryptedSMSNexmo(smsNexmo)
 	if err != nil {
-		log.Error("Marshal sms nexmo %v error %s", smsNexmo, err)
+		log.Error("Encrypt sms nexmo %s error %s", smsNexmo.Name, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedSMSNexmo)
+	if err != nil {
+		log.Error("Marshal sms nexmo %s error %s", smsNexmo.Name, err)
 		return err
 	}
 
 	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/sms_nexmo/"+smsNexmo.Name, string(byteSlice), nil)
 	if err != nil {
-		log.Error("Save sms nexmo %v error: %s", smsNexmo, err)
+		log.Error("Save sms nexmo %s error: %s", smsNexmo.Name, err)
 		log.Error(response)
 		return err
 	}
@@ -321,7 +343,12 @@ func (storageEtcd *StorageEtcd) LoadSMSNexmo(name string) (*SMSNexmo, error) {
 	smsNexmo := new(SMSNexmo)
 	err = json.Unmarshal([]byte(response.Node.Value), &smsNexmo)
 	if err != nil {
-		log.Error("Unmarshal sms nexmo %v error %s", response.Node.Value, err)
+		log.Error("Unmarshal sms nexmo %s error %s", name, err)
+		return nil, err
+	}
+	err = decryptSMSNexmo(smsNexmo)
+	if err != nil {
+		log.Error("Decrypt sms nexmo %s error %s", name, err)
 		return nil, err
 	}
 
@@ -347,7 +374,12 @@ func (storageEtcd *StorageEtcd) LoadAllSMSNexmo() ([]SMSNexmo, error) {
 		smsNexmo := SMSNexmo{}
 		err := json.Unmarshal([]byte(node.Value), &smsNexmo)
 		if err != nil {
-			log.Error("Unmarshal sms nexmo %v error %s", node.Value, err)
+			log.Error("Unmarshal sms nexmo %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptSMSNexmo(&smsNexmo)
+		if err != nil {
+			log.Error("Decrypt sms nexmo %s error %s", node.Key, err)
 			return nil, err
 		}
 		smsNexmoSlice = append(smsNexmoSlice, smsNexmo)
@@ -0,0 +1,244 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	RequestTimeoutDuration = time.Second * 30
+)
+
+type RequestError struct {
+	StatusCode int
+	Message    string
+}
+
+func (requestError RequestError) Error() string {
+	return requestError.Message
+}
+
+func (privateRegistry *PrivateRegistry) getHTTPClient(timeout time.Duration) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if privateRegistry.CACertificate != "" {
+		certificatePool := x509.NewCertPool()
+		if certificatePool.AppendCertsFromPEM([]byte(privateRegistry.CACertificate)) == false {
+			return nil, errors.New("Fail to parse the CA certificate of the private registry " + privateRegistry.Name)
+		}
+		tlsConfig.RootCAs = certificatePool
+	}
+
+	if privateRegistry.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+	} else if privateRegistry.CACertificate == "" && privateRegistry.isDockerHub() == false && privateRegistry.hasCredential() == false {
+		// Nothing secret is sent so the self-signed certificate of the anonymous private registry is accepted as before
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+func (privateRegistry *PrivateRegistry) hasCredential() bool {
+	return privateRegistry.Username != "" || privateRegistry.Password != "" || privateRegistry.BearerToken != ""
+}
+
+// Send the request with the configured credential. If the registry asks for a bearer token, get the token from the indicated realm and retry.
+func (privateRegistry *PrivateRegistry) request(method string, path string, headerMap map[string]string, timeout time.Duration) (*http.Response, []byte, error) {
+	httpClient, err := privateRegistry.getHTTPClient(timeout)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	url := privateRegistry.getPrivateRegistryEndpoint() + path
+
+	authorization := ""
+	if privateRegistry.BearerToken != "" {
+		authorization = "Bearer " + privateRegistry.BearerToken
+	}
+
+	response, body, err := sendRequest(httpClient, method, url, headerMap, authorization, privateRegistry.Username, privateRegistry.Password)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	challenge := response.Header.Get("Www-Authenticate")
+	if response.StatusCode == http.StatusUnauthorized && privateRegistry.BearerToken == "" && strings.HasPrefix(challenge, "Bearer ") {
+		token, err := privateRegistry.getBearerToken(httpClient, challenge)
+		if err != nil {
+			log.Error(err)
+			return nil, nil, err
+		}
+		response, body, err = sendRequest(httpClient, method, url, headerMap, "Bearer "+token, "", "")
+		if err != nil {
+			log.Error(err)
+			return nil, nil, err
+		}
+	}
+
+	if response.StatusCode >= 400 {
+		return response, body, RequestError{response.StatusCode, method + " " + url + " status " + response.Status + " body " + string(body)}
+	}
+
+	return response, body, nil
+}
+
+func (privateRegistry *PrivateRegistry) requestJson(path string) (map[string]interface{}, error) {
+	_, body, err := privateRegistry.request("GET", path, nil, RequestTimeoutDuration)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonMap := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonMap)
+	if err != nil {
+		log.Error("Unmarshal response %s error: %s", string(body), err)
+		return nil, err
+	}
+
+	return jsonMap, nil
+}
+
+func sendRequest(httpClient *http.Client, method string, url string, headerMap map[string]string, authorization string, username string, password string) (*http.Response, []byte, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range headerMap {
+		request.Header.Add(key, value)
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	} else if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return response, body, nil
+}
+
+// Docker registry v2 token flow. The credential is sent to the token service only.
+func (privateRegistry *PrivateRegistry) getBearerToken(httpClient *http.Client, challenge string) (string, error) {
+	parameterMap := parseAuthenticateChallenge(challenge)
+	realm := parameterMap["realm"]
+	if realm == "" {
+		return "", errors.New("No realm in the authenticate challenge " + challenge)
+	}
+
+	query := url.Values{}
+	if parameterMap["service"] != "" {
+		query.Set("service", parameterMap["service"])
+	}
+	if parameterMap["scope"] != "" {
+		query.Set("scope", parameterMap["scope"])
+	}
+	tokenURL := realm
+	if len(query) > 0 {
+		tokenURL = realm + "?" + query.Encode()
+	}
+
+	response, body, err := sendRequest(httpClient, "GET", tokenURL, nil, "", privateRegistry.Username, privateRegistry.Password)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", RequestError{response.StatusCode, "Fail to get the token from " + realm + " with status " + response.Status}
+	}
+
+	jsonMap := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonMap)
+	if err != nil {
+		return "", err
+	}
+
+	// Docker Hub returns both while some token services return only one of them
+	if token, ok := jsonMap["token"].(string); ok && token != "" {
+		return token, nil
+	}
+	if token, ok := jsonMap["access_token"].(string); ok && token != "" {
+		return token, nil
+	}
+
+	return "", errors.New("No token in the response of " + realm)
+}
+
+// Parse `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:team/app:pull"`
+func parseAuthenticateChallenge(challenge string) map[string]string {
+	parameterMap := make(map[string]string)
+
+	text := challenge
+	if index := strings.Index(text, " "); index >= 0 {
+		text = text[index+1:]
+	}
+
+	for len(text) > 0 {
+		text = strings.TrimLeft(text, " ,")
+		index := strings.Index(text, "=")
+		if index < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(text[:index]))
+		text = text[index+1:]
+
+		value := ""
+		if strings.HasPrefix(text, "\"") {
+			// The quoted value may contain the comma
+			end := strings.Index(text[1:], "\"")
+			if end < 0 {
+				value = text[1:]
+				text = ""
+			} else {
+				value = text[1 : end+1]
+				text = text[end+2:]
+			}
+		} else {
+			end := strings.Index(text, ",")
+			if end < 0 {
+				value = text
+				text = ""
+			} else {
+				value = text[:end]
+				text = text[end:]
+			}
+		}
+		parameterMap[key] = value
+	}
+
+	return parameterMap
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetHTTPClientVerifyCertificateWithCredential(t *testing.T) {
+	testCaseSlice := []struct {
+		privateRegistry    PrivateRegistry
+		insecureSkipVerify bool
+	}{
+		{PrivateRegistry{"anonymous", "private-registry", 31000, "", "", "", "", false}, true},
+		{PrivateRegistry{"password", "private-registry", 31000, "user", "password", "", "", false}, false},
+		{PrivateRegistry{"token", "private-registry", 31000, "", "", "token", "", false}, false},
+		{PrivateRegistry{"insecure", "private-registry", 31000, "user", "password", "", "", true}, true},
+		{PrivateRegistry{"dockerhub", DockerHubHost, DefaultPort, "", "", "", "", false}, false},
+	}
+
+	for _, testCase := range testCaseSlice {
+		httpClient, err := testCase.privateRegistry.getHTTPClient(time.Second)
+		if err != nil {
+			t.Errorf("Private registry %s get error %s", testCase.privateRegistry.Name, err)
+			continue
+		}
+		transport, _ := httpClient.Transport.(*http.Transport)
+		if transport.TLSClientConfig.InsecureSkipVerify != testCase.insecureSkipVerify {
+			t.Errorf("Private registry %s expects InsecureSkipVerify %v", testCase.privateRegistry.Name, testCase.insecureSkipVerify)
+		}
+	}
+}
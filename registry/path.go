@@ -0,0 +1,102 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	DockerHubHost        = "docker.io"
+	dockerHubAPIHost     = "registry-1.docker.io"
+	dockerHubLibraryPath = "library/"
+	DefaultPort          = 443
+)
+
+type ImagePath struct {
+	Registry       string // "private-repository:31000" as written in the path. Empty for Docker Hub.
+	Host           string
+	Port           int
+	RepositoryName string // "team/app"
+	Tag            string
+}
+
+// Supported formats: "host:port/team/app:tag", "host/app:tag", "user/app:tag" and "app" for Docker Hub
+func ParseImagePath(path string) (*ImagePath, error) {
+	if path == "" {
+		return nil, errors.New("Invalid path format: " + path)
+	}
+
+	imagePath := &ImagePath{}
+
+	// The digest is used as the tag
+	remaining := path
+	if index := strings.Index(remaining, "@"); index >= 0 {
+		imagePath.Tag = remaining[index+1:]
+		remaining = remaining[:index]
+	}
+
+	// The first part is the registry only if it looks like a host name
+	splitSlice := strings.SplitN(remaining, "/", 2)
+	if len(splitSlice) == 2 && (strings.ContainsAny(splitSlice[0], ".:") || splitSlice[0] == "localhost") {
+		imagePath.Registry = splitSlice[0]
+		remaining = splitSlice[1]
+
+		hostAndPortSlice := strings.Split(imagePath.Registry, ":")
+		switch len(hostAndPortSlice) {
+		case 1:
+			imagePath.Host = hostAndPortSlice[0]
+			imagePath.Port = DefaultPort
+		case 2:
+			port, err := strconv.Atoi(hostAndPortSlice[1])
+			if err != nil {
+				log.Error(err)
+				return nil, errors.New("Can't parse port: " + hostAndPortSlice[1])
+			}
+			imagePath.Host = hostAndPortSlice[0]
+			imagePath.Port = port
+		default:
+			return nil, errors.New("Invalid registry format: " + imagePath.Registry)
+		}
+	} else {
+		imagePath.Host = DockerHubHost
+		imagePath.Port = DefaultPort
+	}
+
+	// The tag is after the last colon of the last component
+	if index := strings.LastIndex(remaining, ":"); index > strings.LastIndex(remaining, "/") {
+		if imagePath.Tag == "" {
+			imagePath.Tag = remaining[index+1:]
+		}
+		remaining = remaining[:index]
+	}
+
+	if remaining == "" || strings.HasPrefix(remaining, "/") || strings.HasSuffix(remaining, "/") {
+		return nil, errors.New("Invalid repository name in path: " + path)
+	}
+
+	if imagePath.isDockerHub() && strings.Contains(remaining, "/") == false {
+		remaining = dockerHubLibraryPath + remaining
+	}
+	imagePath.RepositoryName = remaining
+
+	return imagePath, nil
+}
+
+func (imagePath *ImagePath) isDockerHub() bool {
+	return imagePath.Host == DockerHubHost || imagePath.Host == dockerHubAPIHost
+}
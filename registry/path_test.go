@@ -0,0 +1,62 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+)
+
+func TestParseImagePath(t *testing.T) {
+	expectedMap := map[string]ImagePath{
+		"private-repository:31000/test:1":         ImagePath{"private-repository:31000", "private-repository", 31000, "test", "1"},
+		"private-repository:31000/team/app:1.0":   ImagePath{"private-repository:31000", "private-repository", 31000, "team/app", "1.0"},
+		"registry.example.com/team/app":           ImagePath{"registry.example.com", "registry.example.com", DefaultPort, "team/app", ""},
+		"localhost/app@sha256:abc":                ImagePath{"localhost", "localhost", DefaultPort, "app", "sha256:abc"},
+		"user/app:latest":                         ImagePath{"", DockerHubHost, DefaultPort, "user/app", "latest"},
+		"nginx":                                   ImagePath{"", DockerHubHost, DefaultPort, "library/nginx", ""},
+		"docker.io/nginx:1.9":                     ImagePath{"docker.io", DockerHubHost, DefaultPort, "library/nginx", "1.9"},
+		"private-repository:31000/a/b/c:20160101": ImagePath{"private-repository:31000", "private-repository", 31000, "a/b/c", "20160101"},
+	}
+
+	for path, expected := range expectedMap {
+		imagePath, err := ParseImagePath(path)
+		if err != nil {
+			t.Errorf("Path %s get error %s", path, err)
+			continue
+		}
+		if *imagePath != expected {
+			t.Errorf("Path %s expects %v but get %v", path, expected, *imagePath)
+		}
+	}
+
+	for _, path := range []string{"", "private-repository:31000/", "private-repository:abc/test", "a:1:2/test"} {
+		if _, err := ParseImagePath(path); err == nil {
+			t.Errorf("Path %s should be invalid", path)
+		}
+	}
+}
+
+func TestParseAuthenticateChallenge(t *testing.T) {
+	parameterMap := parseAuthenticateChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:team/app:pull,push"`)
+	if parameterMap["realm"] != "https://auth.docker.io/token" {
+		t.Errorf("Unexpected realm %s", parameterMap["realm"])
+	}
+	if parameterMap["service"] != "registry.docker.io" {
+		t.Errorf("Unexpected service %s", parameterMap["service"])
+	}
+	if parameterMap["scope"] != "repository:team/app:pull,push" {
+		t.Errorf("Unexpected scope %s", parameterMap["scope"])
+	}
+}
@@ -17,7 +17,7 @@ package registry
 import (
 	"bytes"
 	"errors"
-	"github.com/cloudawan/cloudone_utility/restclient"
+	"github.com/cloudawan/cloudone/utility/secret"
 	"net/http"
 	"strconv"
 	"strings"
@@ -25,51 +25,110 @@ import (
 )
 
 type PrivateRegistry struct {
-	Name string
-	Host string
-	Port int
+	Name          string
+	Host          string
+	Port          int
+	Username      string // Used for the basic authentication and the token flow
+	Password      string
+	BearerToken   string // Used directly instead of the token flow if configured
+	CACertificate string // PEM bundle. If empty, the system CA is used.
+	Insecure      bool   // Skip the certificate verification. Without it, the certificate is only skipped for the registry without any credential.
+}
+
+// Return a copy with the password and token encrypted for the storage
+func getEncryptedPrivateRegistry(privateRegistry *PrivateRegistry) (*PrivateRegistry, error) {
+	encryptedPrivateRegistry := *privateRegistry
+	password, err := secret.Encrypt(privateRegistry.Password)
+	if err != nil {
+		return nil, err
+	}
+	bearerToken, err := secret.Encrypt(privateRegistry.BearerToken)
+	if err != nil {
+		return nil, err
+	}
+	encryptedPrivateRegistry.Password = password
+	encryptedPrivateRegistry.BearerToken = bearerToken
+	return &encryptedPrivateRegistry, nil
+}
+
+func decryptPrivateRegistry(privateRegistry *PrivateRegistry) error {
+	password, err := secret.Decrypt(privateRegistry.Password)
+	if err != nil {
+		return err
+	}
+	bearerToken, err := secret.Decrypt(privateRegistry.BearerToken)
+	if err != nil {
+		return err
+	}
+	privateRegistry.Password = password
+	privateRegistry.BearerToken = bearerToken
+	return nil
 }
 
 const (
 	AvailableTimeoutDuration = time.Second * 1
 )
 
-func GetPrivateRegistryFromPathAndTestAvailable(path string) (*PrivateRegistry, error) {
-	splitSlice := strings.Split(path, "/")
-	if len(splitSlice) != 2 {
-		return nil, errors.New("Invalid path format: " + path)
-	}
-	registry := splitSlice[0]
-	splitSlice = strings.Split(registry, ":")
-	if len(splitSlice) != 2 {
-		return nil, errors.New("Invalid registry format: " + registry)
+var manifestAcceptSlice = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// Use the configured registry with the same host and port to have the credential. Otherwise, access anonymously.
+func GetPrivateRegistryFromPath(path string) (*PrivateRegistry, string, error) {
+	imagePath, err := ParseImagePath(path)
+	if err != nil {
+		log.Error(err)
+		return nil, "", err
 	}
-	host := splitSlice[0]
-	portText := splitSlice[1]
 
-	port, err := strconv.Atoi(portText)
+	privateRegistrySlice, err := GetStorage().LoadAllPrivateRegistry()
 	if err != nil {
 		log.Error(err)
-		return nil, errors.New("Can't parse port: " + portText)
+		return nil, "", err
+	}
+
+	for _, privateRegistry := range privateRegistrySlice {
+		if privateRegistry.isSameHost(imagePath.Host) && privateRegistry.Port == imagePath.Port {
+			returnedPrivateRegistry := privateRegistry
+			return &returnedPrivateRegistry, imagePath.RepositoryName, nil
+		}
 	}
 
 	privateRegistry := &PrivateRegistry{
 		"",
-		host,
-		port,
+		imagePath.Host,
+		imagePath.Port,
+		"",
+		"",
+		"",
+		"",
+		false,
+	}
+
+	return privateRegistry, imagePath.RepositoryName, nil
+}
+
+func GetPrivateRegistryFromPathAndTestAvailable(path string) (*PrivateRegistry, string, error) {
+	privateRegistry, repositoryName, err := GetPrivateRegistryFromPath(path)
+	if err != nil {
+		log.Error(err)
+		return nil, "", err
 	}
 
 	err = privateRegistry.IsAvailable()
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, "", err
 	}
 
-	return privateRegistry, nil
+	return privateRegistry, repositoryName, nil
 }
 
 func (privateRegistry *PrivateRegistry) IsAvailable() error {
-	_, err := restclient.HealthCheck(privateRegistry.getPrivateRegistryEndpoint()+"/v2/", nil, AvailableTimeoutDuration)
+	_, _, err := privateRegistry.request("GET", "/v2/", nil, AvailableTimeoutDuration)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -78,21 +137,49 @@ func (privateRegistry *PrivateRegistry) IsAvailable() error {
 }
 
 func (privateRegistry *PrivateRegistry) GetRepositoryPath(repositoryName string) string {
-	return privateRegistry.Host + ":" + strconv.Itoa(privateRegistry.Port) + "/" + repositoryName
+	if privateRegistry.isDockerHub() {
+		return strings.TrimPrefix(repositoryName, dockerHubLibraryPath)
+	}
+	return privateRegistry.GetServer() + "/" + repositoryName
+}
+
+// The server name used by docker login
+func (privateRegistry *PrivateRegistry) GetServer() string {
+	if privateRegistry.isDockerHub() {
+		return ""
+	}
+	return privateRegistry.Host + ":" + strconv.Itoa(privateRegistry.Port)
+}
+
+func (privateRegistry *PrivateRegistry) HasCredential() bool {
+	return privateRegistry.Username != "" || privateRegistry.BearerToken != ""
+}
+
+func (privateRegistry *PrivateRegistry) isDockerHub() bool {
+	return privateRegistry.Host == DockerHubHost || privateRegistry.Host == dockerHubAPIHost
+}
+
+func (privateRegistry *PrivateRegistry) isSameHost(host string) bool {
+	if privateRegistry.isDockerHub() {
+		return host == DockerHubHost || host == dockerHubAPIHost
+	}
+	return privateRegistry.Host == host
 }
 
 func (privateRegistry *PrivateRegistry) getPrivateRegistryEndpoint() string {
+	if privateRegistry.isDockerHub() {
+		return "https://" + dockerHubAPIHost
+	}
 	return "https://" + privateRegistry.Host + ":" + strconv.Itoa(privateRegistry.Port)
 }
 
 func (privateRegistry *PrivateRegistry) GetAllRepository() ([]string, error) {
-	result, err := restclient.RequestGet(privateRegistry.getPrivateRegistryEndpoint()+"/v2/_catalog", nil, false)
+	jsonMap, err := privateRegistry.requestJson("/v2/_catalog")
 	if err != nil {
-		log.Error("Fail to get all repository with private registry: %v, error: %s", privateRegistry, err)
+		log.Error("Fail to get all repository with private registry: %s, error: %s", privateRegistry.Name, err)
 		return nil, err
 	}
 
-	jsonMap, _ := result.(map[string]interface{})
 	repositoryJsonSlice, _ := jsonMap["repositories"].([]interface{})
 	repositorySlice := make([]string, 0)
 	for _, repositoryJsonInterface := range repositoryJsonSlice {
@@ -130,33 +217,61 @@ func (privateRegistry *PrivateRegistry) DeleteAllImageInRepository(repositoryNam
 }
 
 func (privateRegistry *PrivateRegistry) GetAllImageTag(repositoryName string) ([]string, error) {
-	result, err := restclient.RequestGet(privateRegistry.getPrivateRegistryEndpoint()+"/v2/"+repositoryName+"/tags/list", nil, false)
+	jsonMap, err := privateRegistry.requestJson("/v2/" + repositoryName + "/tags/list")
 	if err != nil {
-		log.Error("Fail to get all image tags with repository %s and private registry: %v, error: %s", repositoryName, privateRegistry, err)
+		log.Error("Fail to get all image tags with repository %s and private registry: %s, error: %s", repositoryName, privateRegistry.Name, err)
 		return nil, err
 	}
 
-	jsonMap, _ := result.(map[string]interface{})
 	tagJsonSlice, _ := jsonMap["tags"].([]interface{})
 	tagSlice := make([]string, 0)
 	for _, tagJsonInterface := range tagJsonSlice {
 		if tag, ok := tagJsonInterface.(string); ok {
-			request, err := http.NewRequest("GET", privateRegistry.getPrivateRegistryEndpoint()+"/v2/"+repositoryName+"/manifests/"+tag, nil)
+			digest, err := privateRegistry.getManifestDigest(repositoryName, tag)
 			if err != nil {
 				log.Error(err)
 				return nil, err
 			}
 
-			// For registry version 2.3 and later
-			request.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-			response, err := restclient.GetInsecureHTTPSClient().Do(request)
+			if len(digest) > 0 {
+				tagSlice = append(tagSlice, tag)
+			}
+		}
+	}
+
+	return tagSlice, nil
+}
+
+// Deleting a manifest by digest removes every tag pointing to it, so all of them are returned including the target tag
+func (privateRegistry *PrivateRegistry) GetAllImageTagSharingDigest(repositoryName string, targetTag string) ([]string, error) {
+	targetDigest, err := privateRegistry.getManifestDigest(repositoryName, targetTag)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if len(targetDigest) == 0 {
+		// The tag has no image
+		return []string{}, nil
+	}
+
+	jsonMap, err := privateRegistry.requestJson("/v2/" + repositoryName + "/tags/list")
+	if err != nil {
+		log.Error("Fail to get all image tags with repository %s and private registry: %s, error: %s", repositoryName, privateRegistry.Name, err)
+		return nil, err
+	}
+
+	tagJsonSlice, _ := jsonMap["tags"].([]interface{})
+	tagSlice := make([]string, 0)
+	for _, tagJsonInterface := range tagJsonSlice {
+		if tag, ok := tagJsonInterface.(string); ok {
+			digest, err := privateRegistry.getManifestDigest(repositoryName, tag)
 			if err != nil {
 				log.Error(err)
 				return nil, err
 			}
-			digest := response.Header.Get("Docker-Content-Digest")
 
-			if len(digest) > 0 {
+			if digest == targetDigest {
 				tagSlice = append(tagSlice, tag)
 			}
 		}
@@ -165,30 +280,40 @@ func (privateRegistry *PrivateRegistry) GetAllImageTag(repositoryName string) ([
 	return tagSlice, nil
 }
 
-func (privateRegistry *PrivateRegistry) DeleteImageInRepository(repositoryName string, tag string) error {
-	request, err := http.NewRequest("GET", privateRegistry.getPrivateRegistryEndpoint()+"/v2/"+repositoryName+"/manifests/"+tag, nil)
+// Empty digest means the tag has no image
+func (privateRegistry *PrivateRegistry) getManifestDigest(repositoryName string, tag string) (string, error) {
+	headerMap := make(map[string]string)
+	// For registry version 2.3 and later
+	headerMap["Accept"] = strings.Join(manifestAcceptSlice, ", ")
+
+	response, _, err := privateRegistry.request("HEAD", "/v2/"+repositoryName+"/manifests/"+tag, headerMap, RequestTimeoutDuration)
+	requestError, _ := err.(RequestError)
+	if requestError.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
 	if err != nil {
 		log.Error(err)
-		return err
+		return "", err
 	}
 
-	// For registry version 2.3 and later
-	request.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	response, err := restclient.GetInsecureHTTPSClient().Do(request)
+	return response.Header.Get("Docker-Content-Digest"), nil
+}
+
+func (privateRegistry *PrivateRegistry) DeleteImageInRepository(repositoryName string, tag string) error {
+	digest, err := privateRegistry.getManifestDigest(repositoryName, tag)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	digest := response.Header.Get("Docker-Content-Digest")
 
 	if len(digest) == 0 {
 		// The tag has no image
 		return nil
 	}
 
-	_, err = restclient.RequestDelete(privateRegistry.getPrivateRegistryEndpoint()+"/v2/"+repositoryName+"/manifests/"+digest, nil, nil, false)
-	requestError, _ := err.(restclient.RequestError)
-	if requestError.StatusCode == 404 {
+	_, _, err = privateRegistry.request("DELETE", "/v2/"+repositoryName+"/manifests/"+digest, nil, RequestTimeoutDuration)
+	requestError, _ := err.(RequestError)
+	if requestError.StatusCode == http.StatusNotFound {
 		// Not found so the target doesn't exist
 		return nil
 	}
@@ -201,17 +326,11 @@ func (privateRegistry *PrivateRegistry) DeleteImageInRepository(repositoryName s
 }
 
 func (privateRegistry *PrivateRegistry) IsImageTagAvailable(repositoryName string, targetTag string) bool {
-	tagSlice, err := privateRegistry.GetAllImageTag(repositoryName)
+	digest, err := privateRegistry.getManifestDigest(repositoryName, targetTag)
 	if err != nil {
 		log.Error(err)
 		return false
 	}
 
-	for _, tag := range tagSlice {
-		if tag == targetTag {
-			return true
-		}
-	}
-
-	return false
+	return len(digest) > 0
 }
@@ -21,12 +21,12 @@ import (
 )
 
 func TestListAllRepository(t *testing.T) {
-	privateRegistry := PrivateRegistry{"private-registry", "private-registry", 31000}
+	privateRegistry := PrivateRegistry{"private-registry", "private-registry", 31000, "", "", "", "", false}
 	fmt.Println(privateRegistry.GetAllRepository())
 }
 
 func TestListAllImageTag(t *testing.T) {
-	privateRegistry := PrivateRegistry{"private-registry", "private-registry", 31000}
+	privateRegistry := PrivateRegistry{"private-registry", "private-registry", 31000, "", "", "", "", false}
 	fmt.Println(privateRegistry.GetAllImageTag("test"))
 }
 */
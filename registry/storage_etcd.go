@@ -63,15 +63,21 @@ func (storageEtcd *StorageEtcd) SavePrivateRegistry(privateRegistry *PrivateRegi
 		return err
 	}
 
-	byteSlice, err := json.Marshal(privateRegistry)
+	encryptedPrivateRegistry, err := getEncryptedPrivateRegistry(privateRegistry)
 	if err != nil {
-		log.Error("Marshal private registry %v error %s", privateRegistry, err)
+		log.Error("Encrypt private registry %s error %s", privateRegistry.Name, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedPrivateRegistry)
+	if err != nil {
+		log.Error("Marshal private registry %s error %s", privateRegistry.Name, err)
 		return err
 	}
 
 	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/private_registry/"+privateRegistry.Name, string(byteSlice), nil)
 	if err != nil {
-		log.Error("Save private registry %v error: %s", privateRegistry, err)
+		log.Error("Save private registry %s error: %s", privateRegistry.Name, err)
 		log.Error(response)
 		return err
 	}
@@ -100,7 +106,12 @@ func (storageEtcd *StorageEtcd) LoadPrivateRegistry(name string) (*PrivateRegist
 	privateRegistry := new(PrivateRegistry)
 	err = json.Unmarshal([]byte(response.Node.Value), &privateRegistry)
 	if err != nil {
-		log.Error("Unmarshal private registry %v error %s", response.Node.Value, err)
+		log.Error("Unmarshal private registry with name %s error %s", name, err)
+		return nil, err
+	}
+	err = decryptPrivateRegistry(privateRegistry)
+	if err != nil {
+		log.Error("Decrypt private registry %s error %s", name, err)
 		return nil, err
 	}
 
@@ -126,7 +137,12 @@ func (storageEtcd *StorageEtcd) LoadAllPrivateRegistry() ([]PrivateRegistry, err
 		privateRegistry := PrivateRegistry{}
 		err := json.Unmarshal([]byte(node.Value), &privateRegistry)
 		if err != nil {
-			log.Error("Unmarshal private registry %v error %s", node.Value, err)
+			log.Error("Unmarshal private registry %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptPrivateRegistry(&privateRegistry)
+		if err != nil {
+			log.Error("Decrypt private registry %s error %s", node.Key, err)
 			return nil, err
 		}
 		privateRegistrySlice = append(privateRegistrySlice, privateRegistry)
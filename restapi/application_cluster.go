@@ -86,7 +86,14 @@ func getAllClusterApplication(request *restful.Request, response *restful.Respon
 		return
 	}
 
-	response.WriteJson(clusterSlice, "[]Cluster")
+	authorizedClusterSlice := make([]application.Cluster, 0)
+	for _, cluster := range clusterSlice {
+		if isResourceAuthorizedForRequest(request, resourcePathClusterApplication, cluster.Name) {
+			authorizedClusterSlice = append(authorizedClusterSlice, cluster)
+		}
+	}
+
+	response.WriteJson(authorizedClusterSlice, "[]Cluster")
 }
 
 func getClusterApplication(request *restful.Request, response *restful.Response) {
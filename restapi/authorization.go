@@ -26,6 +26,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type UserData struct {
@@ -37,6 +38,50 @@ type TokenData struct {
 	Token string
 }
 
+type PasswordChangeInput struct {
+	OldPassword string
+	NewPassword string
+}
+
+type OIDCAuthorizationData struct {
+	URL string
+}
+
+type OIDCTokenInput struct {
+	IDToken string
+	// The state of the login url. The id token must be requested with the nonce of the same login url.
+	State string
+}
+
+// The route modifying the user. The permission of it is required to create the API key for the other user.
+const userRoutePath = "/api/v1/authorizations/users/{name}"
+
+// Keep the binding of the oidc state in the browser starting the login
+const (
+	oidcBindingCookieName = "cloudone_oidc_binding"
+	oidcBindingCookiePath = "/api/v1/authorizations/oidc"
+)
+
+type APIKeyInput struct {
+	Name string
+	// Optional. If empty, the key has all permissions of the user.
+	PermissionSlice []*rbac.Permission
+	// Optional. If empty, the key has all namespaces of the user.
+	NamespaceSlice []string
+	// Optional. If empty, the key never expires.
+	ExpiredTime *time.Time
+}
+
+type APIKeyData struct {
+	Key    string // Only returned here
+	APIKey *authorization.APIKey
+}
+
+type SigningKeyRotateInput struct {
+	Algorithm  string
+	PrivateKey string // Optional. If empty, a new key is generated.
+}
+
 func registerWebServiceAuthorization() {
 	ws := new(restful.WebService)
 	ws.Path("/api/v1/authorizations")
@@ -55,9 +100,13 @@ func registerWebServiceAuthorization() {
 	// Used for authorization token so don't need to be check authorization
 	ws.Route(ws.POST("/tokens/").Filter(auditLogWithoutVerified).To(postToken).
 		Doc("Create the token").
-		Do(returns200Token, returns400, returns422, returns500).
+		Do(returns200Token, returns400, returns403, returns422, returns429, returns500).
 		Reads(UserData{}))
 
+	ws.Route(ws.DELETE("/tokens/").Filter(authorize).Filter(auditLog).To(deleteToken).
+		Doc("Logout by revoking the token in the header").
+		Do(returns200, returns422, returns500))
+
 	ws.Route(ws.GET("/tokens/expired").Filter(authorize).Filter(auditLog).To(getAllTokenExpiredTime).
 		Doc("Get all token's expired time").
 		Do(returns200AllTokenExpiredTime, returns500))
@@ -87,6 +136,40 @@ func registerWebServiceAuthorization() {
 		Param(ws.PathParameter("name", "Name").DataType("string")).
 		Do(returns200User, returns404, returns500))
 
+	// Used when the password change is required so don't need to be check authorization
+	ws.Route(ws.PUT("/users/{name}/password").Filter(auditLogWithoutBody).To(putUserPassword).
+		Doc("Change the password with the current one").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200, returns400, returns422, returns429).
+		Reads(PasswordChangeInput{}))
+
+	ws.Route(ws.GET("/users/{name}/tokens").Filter(authorize).Filter(auditLog).To(getAllTokenForUser).
+		Doc("Get all of the issued tokens of the user").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200AllTokenRecord, returns422, returns500))
+
+	ws.Route(ws.DELETE("/users/{name}/tokens").Filter(authorize).Filter(auditLog).To(deleteAllTokenForUser).
+		Doc("Revoke all of the issued tokens of the user").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200, returns422, returns500))
+
+	ws.Route(ws.GET("/users/{name}/apikeys").Filter(authorize).Filter(auditLog).To(getAllAPIKeyForUser).
+		Doc("Get all of the API keys of the user without the secrets").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200AllAPIKey, returns422, returns500))
+
+	ws.Route(ws.POST("/users/{name}/apikeys").Filter(authorize).Filter(auditLog).To(postAPIKey).
+		Doc("Create the API key for the user. The key is used in the header token and only returned here.").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200APIKeyData, returns400, returns422, returns500).
+		Reads(APIKeyInput{}))
+
+	ws.Route(ws.DELETE("/users/{name}/apikeys/{id}").Filter(authorize).Filter(auditLog).To(deleteAPIKey).
+		Doc("Revoke the API key of the user").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Param(ws.PathParameter("id", "API key id").DataType("string")).
+		Do(returns200, returns422, returns500))
+
 	ws.Route(ws.PUT("/users/{name}/metadata").Filter(authorize).Filter(auditLogWithoutBody).To(putUserMetaData).
 		Doc("Modify the user metadata").
 		Param(ws.PathParameter("name", "Name").DataType("string")).
@@ -117,6 +200,36 @@ func registerWebServiceAuthorization() {
 		Doc("Get all of the roles").
 		Param(ws.PathParameter("name", "Name").DataType("string")).
 		Do(returns200Role, returns404, returns500))
+
+	ws.Route(ws.GET("/signingkeys/").Filter(authorize).Filter(auditLog).To(getAllSigningKey).
+		Doc("Get all of the token signing keys without the private keys").
+		Do(returns200AllSigningKey, returns500))
+
+	ws.Route(ws.POST("/signingkeys/rotate").Filter(authorize).Filter(auditLogWithoutBody).To(postSigningKeyRotate).
+		Doc("Rotate the token signing key. The tokens signed by the previous key are valid until they expire.").
+		Do(returns200SigningKey, returns400, returns422, returns500).
+		Reads(SigningKeyRotateInput{}))
+
+	ws.Route(ws.DELETE("/signingkeys/{id}").Filter(authorize).Filter(auditLog).To(deleteSigningKey).
+		Doc("Delete the retired token signing key so the tokens signed by it are invalid immediately").
+		Param(ws.PathParameter("id", "Signing key id").DataType("string")).
+		Do(returns200, returns422, returns500))
+
+	// Used for the single sign-on so don't need to be check authorization
+	ws.Route(ws.GET("/oidc/login").Filter(auditLogWithoutVerified).To(getOIDCLogin).
+		Doc("Redirect to the login page of the OpenID Connect provider").
+		Do(returns302OIDCAuthorization, returns500))
+
+	ws.Route(ws.GET("/oidc/callback").Filter(auditLogWithoutVerified).To(getOIDCCallback).
+		Doc("Create the token with the authorization code returned by the OpenID Connect provider").
+		Param(ws.QueryParameter("code", "Authorization code").DataType("string")).
+		Param(ws.QueryParameter("state", "State").DataType("string")).
+		Do(returns200Token, returns400, returns422))
+
+	ws.Route(ws.POST("/oidc/tokens").Filter(auditLogWithoutVerified).To(postOIDCToken).
+		Doc("Create the token with the id token issued by the OpenID Connect provider").
+		Do(returns200Token, returns400, returns422).
+		Reads(OIDCTokenInput{}))
 }
 
 func getUserFromToken(request *restful.Request, response *restful.Response) {
@@ -154,21 +267,36 @@ func postToken(request *restful.Request, response *restful.Response) {
 		return
 	}
 
-	token, err := authorization.CreateToken(userData.Username, userData.Password)
+	token, err := authorization.CreateToken(userData.Username, userData.Password, request.Request.RemoteAddr)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Create token failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["userData"] = userData
+		jsonMap["username"] = userData.Username
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
-		response.WriteErrorString(422, string(errorMessageByteSlice))
+		response.WriteErrorString(getLoginErrorStatusCode(response, err), string(errorMessageByteSlice))
 		return
 	}
 
 	response.WriteJson(TokenData{token}, "[]TokenData")
 }
 
+func deleteToken(request *restful.Request, response *restful.Response) {
+	token := request.Request.Header.Get("token")
+
+	err := authorization.RevokeToken(token)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Revoke token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
 func getAllTokenExpiredTime(request *restful.Request, response *restful.Response) {
 	expiredMap := authorization.GetAllTokenExpiredTime()
 
@@ -207,7 +335,6 @@ func postUser(request *restful.Request, response *restful.Response) {
 	if oldUser != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "The user to create already exists"
-		jsonMap["ErrorMessage"] = err.Error()
 		jsonMap["name"] = user.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
@@ -215,6 +342,19 @@ func postUser(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	// The field EncodedPassword in the body is the password before encoded
+	err = authorization.CheckPasswordPolicy(user.Name, user.EncodedPassword)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Password policy violation"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = user.Name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
 	createdUser := rbac.CreateUser(user.Name, user.EncodedPassword, user.RoleSlice, user.ResourceSlice, user.Description, user.MetaDataMap, user.ExpiredTime, user.Disabled)
 
 	err = authorization.GetStorage().SaveUser(createdUser)
@@ -222,7 +362,7 @@ func postUser(request *restful.Request, response *restful.Response) {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save user failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["user"] = user
+		jsonMap["name"] = user.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -261,7 +401,6 @@ func putUser(request *restful.Request, response *restful.Response) {
 	if oldUser == nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "The user to update deosn't exist"
-		jsonMap["ErrorMessage"] = err.Error()
 		jsonMap["name"] = name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
@@ -269,14 +408,32 @@ func putUser(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	// The field EncodedPassword in the body is the password before encoded. If empty, the old password is kept.
+	if user.EncodedPassword != "" {
+		err = authorization.CheckPasswordPolicy(user.Name, user.EncodedPassword)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Password policy violation"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["name"] = name
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(400, string(errorMessageByteSlice))
+			return
+		}
+	}
+
 	createdUser := rbac.CreateUser(user.Name, user.EncodedPassword, user.RoleSlice, user.ResourceSlice, user.Description, user.MetaDataMap, user.ExpiredTime, user.Disabled)
+	if user.EncodedPassword == "" {
+		createdUser.EncodedPassword = oldUser.EncodedPassword
+	}
 
 	err = authorization.GetStorage().SaveUser(createdUser)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save user failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["user"] = user
+		jsonMap["name"] = name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -298,6 +455,14 @@ func deleteUser(request *restful.Request, response *restful.Response) {
 		response.WriteErrorString(404, string(errorMessageByteSlice))
 		return
 	}
+
+	// The credentials would be valid again if the user with the same name is created
+	if err := authorization.RevokeAllTokenForUser(name); err != nil {
+		log.Error("Revoke all token of deleted user %s error: %s", name, err)
+	}
+	if err := authorization.RevokeAllAPIKeyForUser(name); err != nil {
+		log.Error("Revoke all API key of deleted user %s error: %s", name, err)
+	}
 }
 
 func getUser(request *restful.Request, response *restful.Response) {
@@ -318,6 +483,150 @@ func getUser(request *restful.Request, response *restful.Response) {
 	response.WriteJson(user, "User")
 }
 
+func putUserPassword(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	passwordChangeInput := PasswordChangeInput{}
+	err := request.ReadEntity(&passwordChangeInput)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = authorization.ChangePassword(name, passwordChangeInput.OldPassword, passwordChangeInput.NewPassword, request.Request.RemoteAddr)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Change password failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(getLoginErrorStatusCode(response, err), string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getAllTokenForUser(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	tokenRecordSlice, err := authorization.GetAllTokenRecordForUser(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all token of user failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(tokenRecordSlice, "[]TokenRecord")
+}
+
+func deleteAllTokenForUser(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	err := authorization.RevokeAllTokenForUser(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Revoke all token of user failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getAllAPIKeyForUser(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	apiKeySlice, err := authorization.GetAllAPIKeyForUser(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all API key of user failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(apiKeySlice, "[]APIKey")
+}
+
+func postAPIKey(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	apiKeyInput := APIKeyInput{}
+	err := request.ReadEntity(&apiKeyInput)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	// Only the user or the one allowed to modify the user could create the key
+	creator := getCache(request.Request.Header.Get("token"))
+	if creator == nil || (creator.Name != name && creator.HasPermission(componentName, "PUT", userRoutePath) == false) {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Not Authorized"
+		jsonMap["ErrorMessage"] = "Only the user or the one with the permission to modify the user could create the API key"
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(401, string(errorMessageByteSlice))
+		return
+	}
+
+	key, apiKey, err := authorization.CreateAPIKey(creator, name, apiKeyInput.Name, apiKeyInput.PermissionSlice, apiKeyInput.NamespaceSlice, apiKeyInput.ExpiredTime)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Create API key failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		jsonMap["apiKeyInput"] = apiKeyInput
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(APIKeyData{key, apiKey}, "APIKeyData")
+}
+
+func deleteAPIKey(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+	id := request.PathParameter("id")
+
+	err := authorization.RevokeAPIKey(name, id)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Revoke API key failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		jsonMap["id"] = id
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
 func putUserMetaData(request *restful.Request, response *restful.Response) {
 	name := request.PathParameter("name")
 
@@ -338,7 +647,6 @@ func putUserMetaData(request *restful.Request, response *restful.Response) {
 	if user == nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "The user to update deosn't exist"
-		jsonMap["ErrorMessage"] = err.Error()
 		jsonMap["name"] = name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
@@ -353,7 +661,7 @@ func putUserMetaData(request *restful.Request, response *restful.Response) {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save user metadata failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["user"] = user
+		jsonMap["name"] = name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -500,6 +808,56 @@ func getRole(request *restful.Request, response *restful.Response) {
 	response.WriteJson(role, "Role")
 }
 
+func getAllSigningKey(request *restful.Request, response *restful.Response) {
+	signingKeySlice := authorization.GetAllSigningKey()
+
+	response.WriteJson(signingKeySlice, "[]SigningKey")
+}
+
+func postSigningKeyRotate(request *restful.Request, response *restful.Response) {
+	signingKeyRotateInput := SigningKeyRotateInput{}
+	err := request.ReadEntity(&signingKeyRotateInput)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	signingKey, err := authorization.RotateSigningKey(signingKeyRotateInput.Algorithm, signingKeyRotateInput.PrivateKey)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Rotate signing key failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["algorithm"] = signingKeyRotateInput.Algorithm
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(signingKey, "SigningKey")
+}
+
+func deleteSigningKey(request *restful.Request, response *restful.Response) {
+	id := request.PathParameter("id")
+
+	err := authorization.DeleteSigningKey(id)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete signing key failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["id"] = id
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
 func returns200Token(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", TokenData{})
 }
@@ -529,6 +887,11 @@ func auditLogWithoutVerified(req *restful.Request, resp *restful.Response, chain
 	method := req.Request.Method
 	path := req.SelectedRoutePath()
 	queryParameterMap := req.Request.URL.Query()
+	// Don't record the authorization code of the oidc callback
+	if queryParameterMap.Get("code") != "" {
+		queryParameterMap.Del("code")
+		requestURI = req.Request.URL.Path + "?" + queryParameterMap.Encode()
+	}
 	pathParameterMap := req.PathParameters()
 	remoteAddress := req.Request.RemoteAddr
 
@@ -536,10 +899,14 @@ func auditLogWithoutVerified(req *restful.Request, resp *restful.Response, chain
 	// Write data back for the later use
 	req.Request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
 
+	userData := UserData{}
+	json.Unmarshal(requestBody, &userData)
+	userName := userData.Username
+	// Don't record the password
+	userData.Password = ""
+	recordedRequestBody, _ := json.Marshal(userData)
+
 	go func() {
-		userData := UserData{}
-		req.ReadEntity(&userData)
-		userName := userData.Username
 
 		cloudoneAnalysisHost, ok := configuration.LocalConfiguration.GetString("cloudoneAnalysisHost")
 		if ok == false {
@@ -553,12 +920,12 @@ func auditLogWithoutVerified(req *restful.Request, resp *restful.Response, chain
 		}
 
 		// Header is not used since the header has no useful information for now
-		auditLog := audit.CreateAuditLog(componentName, path, userName, remoteAddress, queryParameterMap, pathParameterMap, method, requestURI, string(requestBody), nil)
+		auditLog := audit.CreateAuditLog(componentName, path, userName, remoteAddress, queryParameterMap, pathParameterMap, method, requestURI, string(recordedRequestBody), nil)
 
 		url := "https://" + cloudoneAnalysisHost + ":" + strconv.Itoa(cloudoneAnalysisPort) + "/api/v1/auditlogs"
 
 		headerMap := make(map[string]string)
-		headerMap["token"] = authorization.SystemAdminToken
+		headerMap["token"] = authorization.GetSystemAdminToken()
 
 		_, err := restclient.RequestPost(url, auditLog, headerMap, false)
 		if err != nil {
@@ -568,3 +935,141 @@ func auditLogWithoutVerified(req *restful.Request, resp *restful.Response, chain
 
 	chain.ProcessFilter(req, resp)
 }
+
+func returns200AllSigningKey(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []authorization.SigningKey{})
+}
+
+func returns200SigningKey(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", authorization.SigningKey{})
+}
+
+func returns200AllTokenRecord(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []authorization.TokenRecord{})
+}
+
+func getOIDCLogin(request *restful.Request, response *restful.Response) {
+	url, binding, err := authorization.GetOIDCAuthorizationURL()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get OpenID Connect authorization url failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(500, string(errorMessageByteSlice))
+		return
+	}
+
+	http.SetCookie(response.ResponseWriter, &http.Cookie{
+		Name:     oidcBindingCookieName,
+		Value:    binding,
+		Path:     oidcBindingCookiePath,
+		MaxAge:   int(authorization.OIDCStateTTL / time.Second),
+		Secure:   request.Request.TLS != nil,
+		HttpOnly: true,
+		// The callback is the top-level redirect from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// The url is also in the body for the client not following the redirect
+	response.AddHeader("Location", url)
+	response.WriteHeaderAndJson(http.StatusFound, OIDCAuthorizationData{url}, "{}")
+}
+
+func getOIDCCallback(request *restful.Request, response *restful.Response) {
+	code := request.QueryParameter("code")
+	state := request.QueryParameter("state")
+	providerError := request.QueryParameter("error")
+
+	if providerError != "" || code == "" || state == "" {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "OpenID Connect login failure"
+		jsonMap["ErrorMessage"] = providerError
+		jsonMap["ErrorDescription"] = request.QueryParameter("error_description")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	token, err := authorization.CreateTokenWithOIDCAuthorizationCode(code, state, getOIDCBinding(request))
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Create token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(TokenData{token}, "TokenData")
+}
+
+func postOIDCToken(request *restful.Request, response *restful.Response) {
+	oidcTokenInput := OIDCTokenInput{}
+	err := request.ReadEntity(&oidcTokenInput)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	if oidcTokenInput.IDToken == "" || oidcTokenInput.State == "" {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Input is incorrect. The fields IDToken and State are required."
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	token, err := authorization.CreateTokenWithOIDCIDToken(oidcTokenInput.IDToken, oidcTokenInput.State, getOIDCBinding(request))
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Create token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(TokenData{token}, "TokenData")
+}
+
+func getOIDCBinding(request *restful.Request) string {
+	cookie, err := request.Request.Cookie(oidcBindingCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func returns302OIDCAuthorization(b *restful.RouteBuilder) {
+	b.Returns(http.StatusFound, "Found", OIDCAuthorizationData{})
+}
+
+func returns200AllAPIKey(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []authorization.APIKey{})
+}
+
+func returns200APIKeyData(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", APIKeyData{})
+}
+
+func getLoginErrorStatusCode(response *restful.Response, err error) int {
+	switch err.(type) {
+	case *authorization.LoginLockedError:
+		response.AddHeader("Retry-After", strconv.Itoa(int(err.(*authorization.LoginLockedError).RetryAfter.Seconds())+1))
+		return 429
+	case *authorization.PasswordChangeRequiredError:
+		return 403
+	default:
+		return 422
+	}
+}
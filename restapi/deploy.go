@@ -35,6 +35,12 @@ type DeployCreateInput struct {
 	ResourceMap           map[string]interface{}
 	ExtraJsonMap          map[string]interface{}
 	AutoUpdateForNewBuild bool
+	WorkloadKind          string // replicationController or deployment. If empty, replicationController is used.
+}
+
+type DeployRoutingInput struct {
+	HostNameSlice []string
+	PathRuleSlice []deploy.DeployPathRule
 }
 
 type DeployUpdateInput struct {
@@ -75,7 +81,7 @@ func registerWebServiceDeploy() {
 	ws.Route(ws.POST("/create/{namespace}").Filter(authorize).Filter(auditLog).To(postDeployCreate).
 		Doc("Create dployment from selected image build and version").
 		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
-		Do(returns200, returns400, returns404, returns422, returns500).
+		Do(returns200, returns400, returns403, returns404, returns422, returns500).
 		Reads(DeployCreateInput{}))
 
 	ws.Route(ws.PUT("/update/{namespace}").Filter(authorize).Filter(auditLog).To(putDeployUpdate).
@@ -90,6 +96,48 @@ func registerWebServiceDeploy() {
 		Param(ws.PathParameter("imageinformation", "Image information").DataType("string")).
 		Param(ws.QueryParameter("size", "Size").DataType("int")).
 		Do(returns200, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/rollout/{namespace}/{imageinformation}").Filter(authorize).Filter(auditLog).To(getDeployRollout).
+		Doc("Get the rollout status and the revisions of the workload running the deployment").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("imageinformation", "Image information").DataType("string")).
+		Do(returns200WorkloadStatus, returns404, returns422, returns500))
+
+	ws.Route(ws.PUT("/rollback/{namespace}/{imageinformation}").Filter(authorize).Filter(auditLog).To(putDeployRollback).
+		Doc("Roll the deployment running on the Kubernetes deployment back to the revision").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("imageinformation", "Image information").DataType("string")).
+		Param(ws.QueryParameter("revision", "Revision").DataType("int")).
+		Do(returns200, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.PUT("/migrate/{namespace}/{imageinformation}").Filter(authorize).Filter(auditLog).To(putDeployMigrate).
+		Doc("Migrate the deployment from the replication controller to the Kubernetes deployment without downtime").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("imageinformation", "Image information").DataType("string")).
+		Do(returns200, returns404, returns422, returns500))
+
+	ws.Route(ws.PUT("/routing/{namespace}/{imageinformation}").Filter(authorize).Filter(auditLog).To(putDeployRouting).
+		Doc("Configure the virtual hosts and the path rules the slb routes to the deployment").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("imageinformation", "Image information").DataType("string")).
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(DeployRoutingInput{}))
+
+	ws.Route(ws.GET("/inconsistencies").Filter(authorize).Filter(auditLog).To(getDeployInconsistency).
+		Doc("Get the inconsistencies between the deployments and the services in Kubernetes").
+		Do(returns200AllDeployInconsistency, returns404, returns422, returns500))
+
+	ws.Route(ws.PUT("/inconsistencies/repair").Filter(authorize).Filter(auditLog).To(putDeployInconsistencyRepair).
+		Doc("Repair all the repairable inconsistencies and get the result of each one").
+		Do(returns200AllDeployInconsistency, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/drifts").Filter(authorize).Filter(auditLog).To(getDeployDrift).
+		Doc("Get the drifts between the deployments and Kubernetes found by the latest periodic reconciliation").
+		Do(returns200ReconciliationStatus, returns500))
+
+	ws.Route(ws.PUT("/drifts/reconcile").Filter(authorize).Filter(auditLog).To(putDeployDriftReconcile).
+		Doc("Reconcile now and heal the drifts by applying the stored spec again").
+		Do(returns200ReconciliationStatus, returns404, returns422, returns500))
 }
 
 func getAllDeployInformation(request *restful.Request, response *restful.Response) {
@@ -175,17 +223,6 @@ func deleteDeployInformation(request *restful.Request, response *restful.Respons
 		response.WriteErrorString(422, string(errorMessageByteSlice))
 		return
 	}
-
-	err = slb.SendCommandToAllSLBDaemon()
-	if err != nil {
-		jsonMap := make(map[string]interface{})
-		jsonMap["Error"] = "Configure SLB failure"
-		jsonMap["ErrorMessage"] = err.Error()
-		errorMessageByteSlice, _ := json.Marshal(jsonMap)
-		log.Error(jsonMap)
-		response.WriteErrorString(422, string(errorMessageByteSlice))
-		return
-	}
 }
 
 func postDeployCreate(request *restful.Request, response *restful.Response) {
@@ -231,6 +268,35 @@ func postDeployCreate(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	// The https ports terminated on the slb need the existing certificates the user is allowed to use
+	for _, deployContainerPort := range deployCreateInput.PortSlice {
+		if deployContainerPort.Protocol == deploy.ProtocolTypeHTTPS && deployContainerPort.CertificateName != "" {
+			if isResourceAuthorizedForRequest(request, resourcePathSLBCertificate, deployContainerPort.CertificateName) == false {
+				jsonMap := make(map[string]interface{})
+				jsonMap["Error"] = "Not authorized to use the slb certificate"
+				jsonMap["certificateName"] = deployContainerPort.CertificateName
+				jsonMap["namespace"] = namespace
+				errorMessageByteSlice, _ := json.Marshal(jsonMap)
+				log.Error(jsonMap)
+				response.WriteErrorString(401, string(errorMessageByteSlice))
+				return
+			}
+
+			certificate, _ := slb.GetStorage().LoadCertificate(deployContainerPort.CertificateName)
+			if certificate == nil {
+				jsonMap := make(map[string]interface{})
+				jsonMap["Error"] = "The slb certificate doesn't exist"
+				jsonMap["certificateName"] = deployContainerPort.CertificateName
+				jsonMap["namespace"] = namespace
+				jsonMap["deployCreateInput"] = deployCreateInput
+				errorMessageByteSlice, _ := json.Marshal(jsonMap)
+				log.Error(jsonMap)
+				response.WriteErrorString(400, string(errorMessageByteSlice))
+				return
+			}
+		}
+	}
+
 	err = deploy.DeployCreate(
 		kubeApiServerEndPoint,
 		kubeApiServerToken,
@@ -244,9 +310,14 @@ func postDeployCreate(request *restful.Request, response *restful.Response) {
 		deployCreateInput.ResourceMap,
 		deployCreateInput.ExtraJsonMap,
 		deployCreateInput.AutoUpdateForNewBuild,
+		deployCreateInput.WorkloadKind,
 	)
 
 	if err != nil {
+		statusCode := 422
+		if _, ok := err.(*deploy.ResourceQuotaExceededError); ok {
+			statusCode = 403
+		}
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Create deployment failure"
 		jsonMap["ErrorMessage"] = err.Error()
@@ -255,18 +326,7 @@ func postDeployCreate(request *restful.Request, response *restful.Response) {
 		jsonMap["deployCreateInput"] = deployCreateInput
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
-		response.WriteErrorString(422, string(errorMessageByteSlice))
-		return
-	}
-
-	err = slb.SendCommandToAllSLBDaemon()
-	if err != nil {
-		jsonMap := make(map[string]interface{})
-		jsonMap["Error"] = "Configure SLB failure"
-		jsonMap["ErrorMessage"] = err.Error()
-		errorMessageByteSlice, _ := json.Marshal(jsonMap)
-		log.Error(jsonMap)
-		response.WriteErrorString(422, string(errorMessageByteSlice))
+		response.WriteErrorString(statusCode, string(errorMessageByteSlice))
 		return
 	}
 }
@@ -324,6 +384,86 @@ func putDeployUpdate(request *restful.Request, response *restful.Response) {
 	}
 }
 
+func putDeployRouting(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	imageinformation := request.PathParameter("imageinformation")
+
+	deployRoutingInput := DeployRoutingInput{}
+	err := request.ReadEntity(&deployRoutingInput)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	deployInformation, err := deploy.GetStorage().LoadDeployInformation(namespace, imageinformation)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get deploy information failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	// The certificates terminating TLS on the slb need to cover all the virtual hosts
+	for _, deployContainerPort := range deployInformation.ContainerPortSlice {
+		if deployContainerPort.Protocol != deploy.ProtocolTypeHTTPS || deployContainerPort.CertificateName == "" {
+			continue
+		}
+		certificate, err := slb.GetStorage().LoadCertificate(deployContainerPort.CertificateName)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Get slb certificate failure"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["certificateName"] = deployContainerPort.CertificateName
+			jsonMap["namespace"] = namespace
+			jsonMap["imageinformation"] = imageinformation
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(422, string(errorMessageByteSlice))
+			return
+		}
+		for _, hostName := range deployRoutingInput.HostNameSlice {
+			if certificate.IsHostNameCovered(hostName) == false {
+				jsonMap := make(map[string]interface{})
+				jsonMap["Error"] = "The slb certificate doesn't cover the host name"
+				jsonMap["certificateName"] = deployContainerPort.CertificateName
+				jsonMap["hostName"] = hostName
+				jsonMap["namespace"] = namespace
+				jsonMap["imageinformation"] = imageinformation
+				errorMessageByteSlice, _ := json.Marshal(jsonMap)
+				log.Error(jsonMap)
+				response.WriteErrorString(400, string(errorMessageByteSlice))
+				return
+			}
+		}
+	}
+
+	err = deploy.UpdateDeployRouting(namespace, imageinformation, deployRoutingInput.HostNameSlice, deployRoutingInput.PathRuleSlice)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Update deployment routing failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		jsonMap["deployRoutingInput"] = deployRoutingInput
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
 func putDeployResize(request *restful.Request, response *restful.Response) {
 	sizeText := request.QueryParameter("size")
 	namespace := request.PathParameter("namespace")
@@ -379,6 +519,217 @@ func putDeployResize(request *restful.Request, response *restful.Response) {
 	}
 }
 
+func getDeployRollout(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	imageinformation := request.PathParameter("imageinformation")
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	workloadStatus, err := deploy.GetWorkloadStatus(kubeApiServerEndPoint, kubeApiServerToken, namespace, imageinformation)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get rollout status failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(workloadStatus, "WorkloadStatus")
+}
+
+func putDeployRollback(request *restful.Request, response *restful.Response) {
+	revisionText := request.QueryParameter("revision")
+	namespace := request.PathParameter("namespace")
+	imageinformation := request.PathParameter("imageinformation")
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	revision, err := strconv.Atoi(revisionText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse revisionText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["revisionText"] = revisionText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = deploy.DeployRollback(kubeApiServerEndPoint, kubeApiServerToken, namespace, imageinformation, revision)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Rollback deployment failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		jsonMap["revision"] = revision
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func putDeployMigrate(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	imageinformation := request.PathParameter("imageinformation")
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	err = deploy.DeployMigrateToDeployment(kubeApiServerEndPoint, kubeApiServerToken, namespace, imageinformation)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Migrate deployment failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		jsonMap["imageinformation"] = imageinformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getDeployInconsistency(request *restful.Request, response *restful.Response) {
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	deployInconsistencySlice, err := deploy.ValidateDeployment(kubeApiServerEndPoint, kubeApiServerToken)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Validate deployment failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	authorizedDeployInconsistencySlice := make([]deploy.DeployInconsistency, 0)
+	for _, deployInconsistency := range deployInconsistencySlice {
+		if isResourceAuthorizedForRequest(request, resourcePathNamespace, deployInconsistency.Namespace) {
+			authorizedDeployInconsistencySlice = append(authorizedDeployInconsistencySlice, deployInconsistency)
+		}
+	}
+
+	response.WriteJson(authorizedDeployInconsistencySlice, "[]DeployInconsistency")
+}
+
+func putDeployInconsistencyRepair(request *restful.Request, response *restful.Response) {
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	// Only the inconsistencies in the namespaces of the user are repaired
+	isNamespaceAllowed := func(namespace string) bool {
+		return isResourceAuthorizedForRequest(request, resourcePathNamespace, namespace)
+	}
+
+	deployInconsistencySlice, err := deploy.RepairDeployment(kubeApiServerEndPoint, kubeApiServerToken, isNamespaceAllowed)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Repair deployment failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(deployInconsistencySlice, "[]DeployInconsistency")
+}
+
+func getDeployDrift(request *restful.Request, response *restful.Response) {
+	reconciliationStatus := deploy.GetReconciliationStatus()
+
+	response.WriteJson(reconciliationStatus, "ReconciliationStatus")
+}
+
+func putDeployDriftReconcile(request *restful.Request, response *restful.Response) {
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	reconciliationStatus, err := deploy.ReconcileAllDeployment(kubeApiServerEndPoint, kubeApiServerToken, true)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Reconcile deployment failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(reconciliationStatus, "ReconciliationStatus")
+}
+
 func returns200AllDeployInformation(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []deploy.DeployInformation{})
 }
@@ -386,3 +737,15 @@ func returns200AllDeployInformation(b *restful.RouteBuilder) {
 func returns200DeployInformation(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", deploy.DeployInformation{})
 }
+
+func returns200AllDeployInconsistency(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []deploy.DeployInconsistency{})
+}
+
+func returns200ReconciliationStatus(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", deploy.ReconciliationStatus{})
+}
+
+func returns200WorkloadStatus(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", deploy.WorkloadStatus{})
+}
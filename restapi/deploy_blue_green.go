@@ -17,7 +17,6 @@ package restapi
 import (
 	"encoding/json"
 	"github.com/cloudawan/cloudone/deploy"
-	"github.com/cloudawan/cloudone/slb"
 	"github.com/cloudawan/cloudone/utility/configuration"
 	"github.com/emicklei/go-restful"
 	"net/http"
@@ -107,17 +106,6 @@ func putDeployBlueGreen(request *restful.Request, response *restful.Response) {
 		response.WriteErrorString(422, string(errorMessageByteSlice))
 		return
 	}
-
-	err = slb.SendCommandToAllSLBDaemon()
-	if err != nil {
-		jsonMap := make(map[string]interface{})
-		jsonMap["Error"] = "Configure SLB failure"
-		jsonMap["ErrorMessage"] = err.Error()
-		errorMessageByteSlice, _ := json.Marshal(jsonMap)
-		log.Error(jsonMap)
-		response.WriteErrorString(422, string(errorMessageByteSlice))
-		return
-	}
 }
 
 func deleteDeployBlueGreen(request *restful.Request, response *restful.Response) {
@@ -159,17 +147,6 @@ func deleteDeployBlueGreen(request *restful.Request, response *restful.Response)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
 		return
 	}
-
-	err = slb.SendCommandToAllSLBDaemon()
-	if err != nil {
-		jsonMap := make(map[string]interface{})
-		jsonMap["Error"] = "Configure SLB failure"
-		jsonMap["ErrorMessage"] = err.Error()
-		errorMessageByteSlice, _ := json.Marshal(jsonMap)
-		log.Error(jsonMap)
-		response.WriteErrorString(422, string(errorMessageByteSlice))
-		return
-	}
 }
 
 func getDeployBlueGreen(request *restful.Request, response *restful.Response) {
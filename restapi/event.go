@@ -0,0 +1,219 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone/authorization"
+	"github.com/cloudawan/cloudone/event"
+	"github.com/cloudawan/cloudone_utility/rbac"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The comment sent periodically keeps the connection through the proxies and checks the token is still valid
+	eventStreamHeartbeatInterval = 30 * time.Second
+	eventStreamRoutePath         = "/api/v1/events/stream"
+)
+
+func registerWebServiceEvent() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/events")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces("text/event-stream", restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.POST("/tickets").Filter(auditLog).To(postEventStreamTicket).
+		Doc("Get the ticket used once in the query to open the stream by the browser which can't set the header token").
+		Do(returns200StreamTicket, returns422, returns500))
+
+	ws.Route(ws.GET("/stream").Filter(authorizeStreamTicket).Filter(authorize).Filter(auditLog).To(getEventStream).
+		Doc("Stream the build, deployment, auto scaler, notifier and pod events as server-sent events").
+		Param(ws.QueryParameter("ticket", "The stream ticket used instead of the header token").DataType("string")).
+		Param(ws.QueryParameter("kind", "Comma separated event kinds. All kinds if empty").DataType("string")).
+		Param(ws.QueryParameter("namespace", "Only the events in the namespace and the ones not in any namespace. All authorized namespaces if empty").DataType("string")).
+		Param(ws.HeaderParameter("Last-Event-ID", "Receive the kept events after this id first when reconnecting").DataType("int")).
+		Do(returns200Event, returns500))
+}
+
+// Anyone allowed to open the stream could get the ticket without the extra permission
+func postEventStreamTicket(request *restful.Request, response *restful.Response) {
+	token := request.Request.Header.Get("token")
+	user := getCache(token)
+	if user == nil || user.HasPermission(componentName, "GET", eventStreamRoutePath) == false {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Not Authorized"
+		jsonMap["ErrorMessage"] = "Token or API key is incorrect, expired or not allowed to open the event stream"
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(401, string(errorMessageByteSlice))
+		return
+	}
+
+	streamTicket, err := authorization.CreateStreamTicket(token)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Create stream ticket failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(streamTicket, "StreamTicket")
+}
+
+// Replace the ticket in the query with the token it stands for before the authorization.
+// The ticket is removed from the query so it is not recorded by the audit log.
+func authorizeStreamTicket(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	queryValues := req.Request.URL.Query()
+	ticket := queryValues.Get("ticket")
+	if ticket == "" || req.Request.Header.Get("token") != "" {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+
+	queryValues.Del("ticket")
+	req.Request.URL.RawQuery = queryValues.Encode()
+
+	token, err := authorization.RedeemStreamTicket(ticket)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Stream ticket doesn't exist"
+		jsonMap["ErrorMessage"] = err.Error()
+		resp.WriteHeaderAndJson(401, jsonMap, "{}")
+		return
+	}
+
+	req.Request.Header.Set("token", token)
+	chain.ProcessFilter(req, resp)
+}
+
+func getEventStream(request *restful.Request, response *restful.Response) {
+	token := request.Request.Header.Get("token")
+	user := getCache(token)
+	if user == nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Token doesn't exist"
+		jsonMap["ErrorMessage"] = "Token or API key is incorrect or expired"
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(401, string(errorMessageByteSlice))
+		return
+	}
+
+	flusher, ok := response.ResponseWriter.(http.Flusher)
+	if ok == false {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Streaming is not supported"
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(500, string(errorMessageByteSlice))
+		return
+	}
+
+	kindMap := make(map[string]bool)
+	for _, kind := range strings.Split(request.QueryParameter("kind"), ",") {
+		if kind != "" {
+			kindMap[kind] = true
+		}
+	}
+	namespace := request.QueryParameter("namespace")
+
+	// Zero if not reconnecting
+	lastEventID, _ := strconv.ParseInt(request.HeaderParameter("Last-Event-ID"), 10, 64)
+
+	subscriber := event.Subscribe(lastEventID)
+	defer subscriber.Unsubscribe()
+
+	response.AddHeader("Content-Type", "text/event-stream")
+	response.AddHeader("Cache-Control", "no-cache")
+	response.AddHeader("Connection", "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventStreamHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case streamEvent, ok := <-subscriber.GetEventChannel():
+			if ok == false {
+				// Closed for not reading fast enough so the client reconnects with the last event id
+				return
+			}
+			if len(kindMap) > 0 && kindMap[streamEvent.Kind] == false {
+				continue
+			}
+			if namespace != "" && streamEvent.Namespace != "" && streamEvent.Namespace != namespace {
+				continue
+			}
+			if isEventAuthorized(user, streamEvent) == false {
+				continue
+			}
+
+			byteSlice, err := json.Marshal(streamEvent)
+			if err != nil {
+				log.Error("Marshal event %v error: %s", streamEvent, err)
+				continue
+			}
+			_, err = response.Write([]byte("id: " + strconv.FormatInt(streamEvent.ID, 10) + "\nevent: " + streamEvent.Kind + "\ndata: " + string(byteSlice) + "\n\n"))
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			// Apply the change of the user resources and stop if the token is revoked or expired
+			user = getCache(token)
+			if user == nil {
+				return
+			}
+			_, err := response.Write([]byte(": heartbeat\n\n"))
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-request.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// The same namespace rule as the requests and the builds are restricted by the image information resources
+func isEventAuthorized(user *rbac.User, streamEvent event.Event) bool {
+	if streamEvent.Namespace != "" && user.HasResource(componentName, resourcePathNamespace+streamEvent.Namespace) == false {
+		return false
+	}
+
+	switch streamEvent.Kind {
+	case event.KindBuildPhase, event.KindBuildOutput:
+		return isResourceAuthorized(user, resourcePathImageInformation, streamEvent.Name)
+	default:
+		return true
+	}
+}
+
+func returns200Event(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", event.Event{})
+}
+
+func returns200StreamTicket(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", authorization.StreamTicket{})
+}
@@ -30,6 +30,11 @@ type GlusterfsClusterInput struct {
 	SSHPort                        int
 	SSHUser                        string
 	SSHPassword                    string
+	SSHPrivateKey                  string
+	SSHPrivateKeyPassphrase        string
+	SSHCertificate                 string
+	SSHHostKeySlice                []string
+	SSHPasswordlessSudo            bool
 }
 
 func registerWebServiceGlusterfs() {
@@ -100,7 +105,15 @@ func getAllGlusterfsCluster(request *restful.Request, response *restful.Response
 		return
 	}
 
-	response.WriteJson(glusterfsClusterSlice, "[]GlusterfsCluster")
+	authorizedGlusterfsClusterSlice := make([]glusterfs.GlusterfsCluster, 0)
+	for _, glusterfsCluster := range glusterfsClusterSlice {
+		if isResourceAuthorizedForRequest(request, resourcePathGlusterfsCluster, glusterfsCluster.Name) {
+			redactGlusterfsCluster(&glusterfsCluster)
+			authorizedGlusterfsClusterSlice = append(authorizedGlusterfsClusterSlice, glusterfsCluster)
+		}
+	}
+
+	response.WriteJson(authorizedGlusterfsClusterSlice, "[]GlusterfsCluster")
 }
 
 func postGlusterfsCluster(request *restful.Request, response *restful.Response) {
@@ -136,13 +149,14 @@ func postGlusterfsCluster(request *restful.Request, response *restful.Response)
 		glusterfsClusterInput.SSHPort,
 		glusterfsClusterInput.SSHUser,
 		glusterfsClusterInput.SSHPassword)
+	setGlusterfsClusterSSHKey(glusterfsCluster, &glusterfsClusterInput)
 
 	err = glusterfs.GetStorage().SaveGlusterfsCluster(glusterfsCluster)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save glusterfs cluster failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["glusterfsCluster"] = glusterfsCluster
+		jsonMap["name"] = glusterfsCluster.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -193,8 +207,8 @@ func putGlusterfsCluster(request *restful.Request, response *restful.Response) {
 		return
 	}
 
-	glusterfsCluster, _ := glusterfs.GetStorage().LoadGlusterfsCluster(cluster)
-	if glusterfsCluster == nil {
+	oldGlusterfsCluster, _ := glusterfs.GetStorage().LoadGlusterfsCluster(cluster)
+	if oldGlusterfsCluster == nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "The glusterfs cluster to update doesn't exist"
 		jsonMap["name"] = cluster
@@ -204,7 +218,18 @@ func putGlusterfsCluster(request *restful.Request, response *restful.Response) {
 		return
 	}
 
-	glusterfsCluster = glusterfs.CreateGlusterfsCluster(
+	// The secrets are redacted in the response so keep the stored ones if not given
+	if glusterfsClusterInput.SSHUser == oldGlusterfsCluster.SSHUser {
+		if glusterfsClusterInput.SSHPassword == "" {
+			glusterfsClusterInput.SSHPassword = oldGlusterfsCluster.SSHPassword
+		}
+		if glusterfsClusterInput.SSHPrivateKey == "" {
+			glusterfsClusterInput.SSHPrivateKey = oldGlusterfsCluster.SSHPrivateKey
+			glusterfsClusterInput.SSHPrivateKeyPassphrase = oldGlusterfsCluster.SSHPrivateKeyPassphrase
+		}
+	}
+
+	glusterfsCluster := glusterfs.CreateGlusterfsCluster(
 		glusterfsClusterInput.Name,
 		glusterfsClusterInput.HostSlice,
 		glusterfsClusterInput.Path,
@@ -213,13 +238,14 @@ func putGlusterfsCluster(request *restful.Request, response *restful.Response) {
 		glusterfsClusterInput.SSHPort,
 		glusterfsClusterInput.SSHUser,
 		glusterfsClusterInput.SSHPassword)
+	setGlusterfsClusterSSHKey(glusterfsCluster, &glusterfsClusterInput)
 
 	err = glusterfs.GetStorage().SaveGlusterfsCluster(glusterfsCluster)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save glusterfs cluster failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["glusterfsCluster"] = glusterfsCluster
+		jsonMap["name"] = glusterfsCluster.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -242,9 +268,25 @@ func getGlusterfsCluster(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	redactGlusterfsCluster(glusterfsCluster)
+
 	response.WriteJson(glusterfsCluster, "GlusterfsCluster")
 }
 
+func setGlusterfsClusterSSHKey(glusterfsCluster *glusterfs.GlusterfsCluster, glusterfsClusterInput *GlusterfsClusterInput) {
+	glusterfsCluster.SSHPrivateKey = glusterfsClusterInput.SSHPrivateKey
+	glusterfsCluster.SSHPrivateKeyPassphrase = glusterfsClusterInput.SSHPrivateKeyPassphrase
+	glusterfsCluster.SSHCertificate = glusterfsClusterInput.SSHCertificate
+	glusterfsCluster.SSHHostKeySlice = glusterfsClusterInput.SSHHostKeySlice
+	glusterfsCluster.SSHPasswordlessSudo = glusterfsClusterInput.SSHPasswordlessSudo
+}
+
+func redactGlusterfsCluster(glusterfsCluster *glusterfs.GlusterfsCluster) {
+	glusterfsCluster.SSHPassword = ""
+	glusterfsCluster.SSHPrivateKey = ""
+	glusterfsCluster.SSHPrivateKeyPassphrase = ""
+}
+
 func getAllGlusterfsVolume(request *restful.Request, response *restful.Response) {
 	cluster := request.PathParameter("cluster")
 
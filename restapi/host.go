@@ -17,10 +17,18 @@ package restapi
 import (
 	"encoding/json"
 	"github.com/cloudawan/cloudone/host"
+	"github.com/cloudawan/cloudone/utility/sshclient"
 	"github.com/emicklei/go-restful"
 	"net/http"
+	"time"
 )
 
+// Verify the fingerprint out of band before putting the host key to SSH.HostKeySlice
+type HostKey struct {
+	HostKey     string
+	Fingerprint string
+}
+
 func registerWebServiceHost() {
 	ws := new(restful.WebService)
 	ws.Path("/api/v1/hosts")
@@ -52,6 +60,11 @@ func registerWebServiceHost() {
 		Doc("Get all of the credentials").
 		Param(ws.PathParameter("ip", "IP").DataType("string")).
 		Do(returns200Credential, returns422, returns500))
+
+	ws.Route(ws.GET("/hostkeys/{ip}").Filter(authorize).Filter(auditLog).To(getHostKey).
+		Doc("Get the ssh host key of the stored credential to pin").
+		Param(ws.PathParameter("ip", "IP").DataType("string")).
+		Do(returns200HostKey, returns404, returns422, returns500))
 }
 
 func getAllCredential(request *restful.Request, response *restful.Response) {
@@ -66,7 +79,15 @@ func getAllCredential(request *restful.Request, response *restful.Response) {
 		return
 	}
 
-	response.WriteJson(credentialClusterSlice, "[]Credential")
+	authorizedCredentialClusterSlice := make([]host.Credential, 0)
+	for _, credential := range credentialClusterSlice {
+		if isResourceAuthorizedForRequest(request, resourcePathHostCredential, credential.IP) {
+			redactCredential(&credential)
+			authorizedCredentialClusterSlice = append(authorizedCredentialClusterSlice, credential)
+		}
+	}
+
+	response.WriteJson(authorizedCredentialClusterSlice, "[]Credential")
 }
 
 func postCredential(request *restful.Request, response *restful.Response) {
@@ -98,7 +119,7 @@ func postCredential(request *restful.Request, response *restful.Response) {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save credential failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["credential"] = credential
+		jsonMap["ip"] = credential.IP
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -144,12 +165,23 @@ func putCredential(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	// The secrets are redacted in the response so keep the stored ones if not given
+	if credential.SSH.User == oldCredential.SSH.User {
+		if credential.SSH.Password == "" {
+			credential.SSH.Password = oldCredential.SSH.Password
+		}
+		if credential.SSH.PrivateKey == "" {
+			credential.SSH.PrivateKey = oldCredential.SSH.PrivateKey
+			credential.SSH.PrivateKeyPassphrase = oldCredential.SSH.PrivateKeyPassphrase
+		}
+	}
+
 	err = host.GetStorage().SaveCredential(&credential)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save credential failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["credential"] = credential
+		jsonMap["ip"] = credential.IP
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -188,9 +220,50 @@ func getCredential(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	redactCredential(credential)
+
 	response.WriteJson(credential, "Credential")
 }
 
+func getHostKey(request *restful.Request, response *restful.Response) {
+	ip := request.PathParameter("ip")
+
+	// Only the host of the stored credential is allowed so the endpoint can't be used to probe arbitrary addresses
+	credential, err := host.GetStorage().LoadCredential(ip)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get credential failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["ip"] = ip
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	port := credential.SSH.Port
+	hostKey, fingerprint, err := sshclient.GetHostKey(2*time.Second, ip, port)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get host key failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["ip"] = ip
+		jsonMap["port"] = port
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(HostKey{hostKey, fingerprint}, "HostKey")
+}
+
+func redactCredential(credential *host.Credential) {
+	credential.SSH.Password = ""
+	credential.SSH.PrivateKey = ""
+	credential.SSH.PrivateKeyPassphrase = ""
+}
+
 func returns200AllCredential(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []host.Credential{})
 }
@@ -198,3 +271,7 @@ func returns200AllCredential(b *restful.RouteBuilder) {
 func returns200Credential(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", host.Credential{})
 }
+
+func returns200HostKey(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", HostKey{})
+}
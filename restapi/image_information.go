@@ -53,7 +53,7 @@ func registerWebServiceImageInformation() {
 		Param(ws.PathParameter("imageinformationname", "Image information name").DataType("string")).
 		Do(returns200, returns400, returns422, returns500))
 
-	ws.Route(ws.POST("/create").Filter(authorize).Filter(auditLog).To(postImageInformationCreate).
+	ws.Route(ws.POST("/create").Filter(authorize).Filter(auditLogWithoutBody).To(postImageInformationCreate).
 		Doc("Create image build from source code").
 		Do(returns200, returns400, returns403, returns422, returns500).
 		Reads(ImageInformationCreateInput{}))
@@ -76,7 +76,15 @@ func getAllImageInformation(request *restful.Request, response *restful.Response
 		return
 	}
 
-	response.WriteJson(imageInformationSlice, "[]InformationSlice")
+	authorizedImageInformationSlice := make([]image.ImageInformation, 0)
+	for _, imageInformation := range imageInformationSlice {
+		if isResourceAuthorizedForRequest(request, resourcePathImageInformation, imageInformation.Name) {
+			redactImageInformation(&imageInformation)
+			authorizedImageInformationSlice = append(authorizedImageInformationSlice, imageInformation)
+		}
+	}
+
+	response.WriteJson(authorizedImageInformationSlice, "[]InformationSlice")
 }
 
 func deleteImageInformationAndRelatedRecords(request *restful.Request, response *restful.Response) {
@@ -134,7 +142,7 @@ func postImageInformationCreate(request *restful.Request, response *restful.Resp
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Duplicated repository error"
 		jsonMap["ErrorMessage"] = "Already exists"
-		jsonMap["imageInformation"] = imageInformation
+		jsonMap["imageInformationName"] = imageInformation.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(401, string(errorMessageByteSlice))
@@ -279,6 +287,12 @@ func putImageInformationUpgrade(request *restful.Request, response *restful.Resp
 	*/
 }
 
+func redactImageInformation(imageInformation *image.ImageInformation) {
+	if _, ok := imageInformation.BuildParameter[image.BuildParameterPassword]; ok {
+		imageInformation.BuildParameter[image.BuildParameterPassword] = ""
+	}
+}
+
 func returns200AllImageInformation(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []image.ImageInformation{})
 }
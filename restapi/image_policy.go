@@ -0,0 +1,159 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone/deploy"
+	"github.com/emicklei/go-restful"
+	"net/http"
+)
+
+func registerWebServiceImagePolicy() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/imagepolicies")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/").Filter(authorize).Filter(auditLog).To(getAllImagePolicy).
+		Doc("Get all of the image policy").
+		Do(returns200AllImagePolicy, returns422, returns500))
+
+	ws.Route(ws.GET("/{namespace}").Filter(authorize).Filter(auditLog).To(getImagePolicy).
+		Doc("Get the image policy of the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200ImagePolicy, returns404, returns500))
+
+	ws.Route(ws.PUT("/{namespace}").Filter(authorize).Filter(auditLog).To(putImagePolicy).
+		Doc("Configure the image policy of the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200, returns400, returns422, returns500).
+		Reads(deploy.ImagePolicy{}))
+
+	ws.Route(ws.DELETE("/{namespace}").Filter(authorize).Filter(auditLog).To(deleteImagePolicy).
+		Doc("Delete the image policy of the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200, returns422, returns500))
+}
+
+func getAllImagePolicy(request *restful.Request, response *restful.Response) {
+	imagePolicySlice, err := deploy.GetStorage().LoadAllImagePolicy()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all image policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(imagePolicySlice, "[]ImagePolicy")
+}
+
+func getImagePolicy(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+
+	imagePolicy, err := deploy.GetStorage().LoadImagePolicy(namespace)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get image policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(imagePolicy, "ImagePolicy")
+}
+
+func putImagePolicy(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+
+	imagePolicy := &deploy.ImagePolicy{}
+	err := request.ReadEntity(&imagePolicy)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	if namespace != imagePolicy.Namespace {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Path parameter namespace is different from namespace in the body"
+		jsonMap["path"] = namespace
+		jsonMap["body"] = imagePolicy.Namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = deploy.CheckImagePolicy(imagePolicy)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Invalid image policy"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imagePolicy"] = imagePolicy
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = deploy.GetStorage().SaveImagePolicy(imagePolicy)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Save image policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imagePolicy"] = imagePolicy
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func deleteImagePolicy(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+
+	err := deploy.GetStorage().DeleteImagePolicy(namespace)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete image policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func returns200AllImagePolicy(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []deploy.ImagePolicy{})
+}
+
+func returns200ImagePolicy(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", deploy.ImagePolicy{})
+}
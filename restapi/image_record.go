@@ -39,6 +39,12 @@ func registerWebServiceImageRecord() {
 		Param(ws.PathParameter("imageinformationname", "Image information name").DataType("string")).
 		Param(ws.PathParameter("imagerecordversion", "Image record version").DataType("string")).
 		Do(returns200, returns400, returns422, returns500))
+
+	ws.Route(ws.PUT("/{imageinformationname}/{imagerecordversion}/scan").Filter(authorize).Filter(auditLog).To(putImageRecordScan).
+		Doc("Scan the image of the image record again with the configured scanner").
+		Param(ws.PathParameter("imageinformationname", "Image information name").DataType("string")).
+		Param(ws.PathParameter("imagerecordversion", "Image record version").DataType("string")).
+		Do(returns200ImageRecord, returns422, returns500))
 }
 
 func getImageRecordBelongToImageInformation(request *restful.Request, response *restful.Response) {
@@ -100,6 +106,30 @@ func deleteImageRecordBelongToImageInformation(request *restful.Request, respons
 	}
 }
 
+func putImageRecordScan(request *restful.Request, response *restful.Response) {
+	imageInformationName := request.PathParameter("imageinformationname")
+	imageRecordVersion := request.PathParameter("imagerecordversion")
+
+	imageRecord, err := image.RescanImageRecord(imageInformationName, imageRecordVersion)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Scan image record failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imageInformationName"] = imageInformationName
+		jsonMap["imageRecordVersion"] = imageRecordVersion
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(imageRecord, "ImageRecord")
+}
+
+func returns200ImageRecord(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", image.ImageRecord{})
+}
+
 func returns200ImageRecordSlice(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []image.ImageRecord{})
 }
@@ -0,0 +1,213 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone/execute"
+	"github.com/cloudawan/cloudone/image"
+	"github.com/emicklei/go-restful"
+	"net/http"
+)
+
+func registerWebServiceImageRetentionPolicy() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/imageretentionpolicies")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/").Filter(authorize).Filter(auditLog).To(getAllImageRetentionPolicy).
+		Doc("Get all of the image retention policy").
+		Do(returns200AllImageRetentionPolicy, returns422, returns500))
+
+	ws.Route(ws.GET("/{imageinformationname}").Filter(authorize).Filter(auditLog).To(getImageRetentionPolicy).
+		Doc("Get the retention policy of the image information").
+		Param(ws.PathParameter("imageinformationname", "Image information name").DataType("string")).
+		Do(returns200ImageRetentionPolicy, returns404, returns500))
+
+	ws.Route(ws.PUT("/{imageinformationname}").Filter(authorize).Filter(auditLog).To(putImageRetentionPolicy).
+		Doc("Configure the retention policy of the image information").
+		Param(ws.PathParameter("imageinformationname", "Image information name").DataType("string")).
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(image.RetentionPolicy{}))
+
+	ws.Route(ws.DELETE("/{imageinformationname}").Filter(authorize).Filter(auditLog).To(deleteImageRetentionPolicy).
+		Doc("Delete the retention policy of the image information").
+		Param(ws.PathParameter("imageinformationname", "Image information name").DataType("string")).
+		Do(returns200, returns422, returns500))
+
+	ws.Route(ws.PUT("/{imageinformationname}/execute").Filter(authorize).Filter(auditLog).To(putImageRetentionPolicyExecute).
+		Doc("Remove the image records out of the retention policy now and return the removed versions").
+		Param(ws.PathParameter("imageinformationname", "Image information name").DataType("string")).
+		Do(returns200StringSlice, returns404, returns422, returns500))
+}
+
+func getAllImageRetentionPolicy(request *restful.Request, response *restful.Response) {
+	retentionPolicySlice, err := image.GetStorage().LoadAllRetentionPolicy()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all image retention policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	authorizedRetentionPolicySlice := make([]image.RetentionPolicy, 0)
+	for _, retentionPolicy := range retentionPolicySlice {
+		if isResourceAuthorizedForRequest(request, resourcePathImageInformation, retentionPolicy.ImageInformation) {
+			authorizedRetentionPolicySlice = append(authorizedRetentionPolicySlice, retentionPolicy)
+		}
+	}
+
+	response.WriteJson(authorizedRetentionPolicySlice, "[]RetentionPolicy")
+}
+
+func getImageRetentionPolicy(request *restful.Request, response *restful.Response) {
+	imageInformationName := request.PathParameter("imageinformationname")
+
+	retentionPolicy, err := image.GetStorage().LoadRetentionPolicy(imageInformationName)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get image retention policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imageInformationName"] = imageInformationName
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(retentionPolicy, "RetentionPolicy")
+}
+
+func putImageRetentionPolicy(request *restful.Request, response *restful.Response) {
+	imageInformationName := request.PathParameter("imageinformationname")
+
+	retentionPolicy := &image.RetentionPolicy{}
+	err := request.ReadEntity(&retentionPolicy)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imageInformationName"] = imageInformationName
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	if imageInformationName != retentionPolicy.ImageInformation {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Path parameter name is different from name in the body"
+		jsonMap["path"] = imageInformationName
+		jsonMap["body"] = retentionPolicy.ImageInformation
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = image.CheckRetentionPolicy(retentionPolicy)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Invalid image retention policy"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["retentionPolicy"] = retentionPolicy
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	imageInformation, _ := image.GetStorage().LoadImageInformation(imageInformationName)
+	if imageInformation == nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "The image information doesn't exist"
+		jsonMap["imageInformationName"] = imageInformationName
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	err = image.GetStorage().SaveRetentionPolicy(retentionPolicy)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Save image retention policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["retentionPolicy"] = retentionPolicy
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func deleteImageRetentionPolicy(request *restful.Request, response *restful.Response) {
+	imageInformationName := request.PathParameter("imageinformationname")
+
+	err := image.GetStorage().DeleteRetentionPolicy(imageInformationName)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete image retention policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imageInformationName"] = imageInformationName
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func putImageRetentionPolicyExecute(request *restful.Request, response *restful.Response) {
+	imageInformationName := request.PathParameter("imageinformationname")
+
+	retentionPolicy, _ := image.GetStorage().LoadRetentionPolicy(imageInformationName)
+	if retentionPolicy == nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "The image retention policy doesn't exist"
+		jsonMap["imageInformationName"] = imageInformationName
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	removedVersionSlice, err := execute.ExecuteImageRetentionPolicy(imageInformationName)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Execute image retention policy failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imageInformationName"] = imageInformationName
+		jsonMap["removedVersionSlice"] = removedVersionSlice
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(removedVersionSlice, "[]string")
+}
+
+func returns200AllImageRetentionPolicy(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []image.RetentionPolicy{})
+}
+
+func returns200ImageRetentionPolicy(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", image.RetentionPolicy{})
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone/utility/lock"
+	"github.com/emicklei/go-restful"
+	"net/http"
+)
+
+func registerWebServiceLock() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/locks")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/").Filter(authorize).Filter(auditLog).To(getAllHeldLock).
+		Doc("Get all of the held locks").
+		Do(returns200AllLock, returns422, returns500))
+
+	ws.Route(ws.DELETE("/{lock}").Filter(authorize).Filter(auditLog).To(deleteLock).
+		Doc("Release the lock by force regardless of the owner").
+		Param(ws.PathParameter("lock", "Lock name like deploy.namespace.image").DataType("string")).
+		Do(returns200, returns422, returns500))
+}
+
+func getAllHeldLock(request *restful.Request, response *restful.Response) {
+	lockSlice, err := lock.GetAllHeldLock()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all held lock failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(lockSlice, "[]Lock")
+}
+
+func deleteLock(request *restful.Request, response *restful.Response) {
+	lockName := request.PathParameter("lock")
+
+	err := lock.ForceReleaseLock(lockName)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Release lock failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["lockName"] = lockName
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func returns200AllLock(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []lock.Lock{})
+}
@@ -23,7 +23,22 @@ import (
 )
 
 type Namesapce struct {
-	Name string
+	Name                 string
+	ResourceQuotaHardMap map[string]string        // Optional. Resource name like pods, requests.cpu or limits.memory to the quantity
+	LimitRangeItemSlice  []control.LimitRangeItem // Optional
+}
+
+type ResourceQuotaInput struct {
+	HardMap map[string]string
+}
+
+type LimitRangeInput struct {
+	LimitRangeItemSlice []control.LimitRangeItem
+}
+
+type ResourceQuotaStatus struct {
+	Name       string
+	UsageSlice []control.ResourceQuotaUsage
 }
 
 func registerWebServiceNamespace() {
@@ -46,6 +61,38 @@ func registerWebServiceNamespace() {
 		Doc("Delete the kubernetes namespace").
 		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
 		Do(returns200, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/{namespace}/resourcequotas").Filter(authorize).Filter(auditLog).To(getAllResourceQuotaStatus).
+		Doc("Get the usage and the hard limit of the resource quotas in the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200AllResourceQuotaStatus, returns404, returns422, returns500))
+
+	ws.Route(ws.PUT("/{namespace}/resourcequota").Filter(authorize).Filter(auditLog).To(putResourceQuota).
+		Doc("Create or update the resource quota of the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(ResourceQuotaInput{}))
+
+	ws.Route(ws.DELETE("/{namespace}/resourcequota").Filter(authorize).Filter(auditLog).To(deleteResourceQuota).
+		Doc("Delete the resource quota of the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/{namespace}/limitranges").Filter(authorize).Filter(auditLog).To(getAllLimitRange).
+		Doc("Get the limit ranges in the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200AllLimitRange, returns404, returns422, returns500))
+
+	ws.Route(ws.PUT("/{namespace}/limitrange").Filter(authorize).Filter(auditLog).To(putLimitRange).
+		Doc("Create or update the limit range of the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(LimitRangeInput{}))
+
+	ws.Route(ws.DELETE("/{namespace}/limitrange").Filter(authorize).Filter(auditLog).To(deleteLimitRange).
+		Doc("Delete the limit range of the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200, returns404, returns422, returns500))
 }
 
 func getAllKubernetesNamespaceName(request *restful.Request, response *restful.Response) {
@@ -100,6 +147,19 @@ func postKubernetesNamespace(request *restful.Request, response *restful.Respons
 		return
 	}
 
+	// Validate before creating the namespace so an invalid quota doesn't leave the namespace without the quota
+	err = control.ValidateResourceQuotaHardMap(namespace.ResourceQuotaHardMap)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Invalid resource quota"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
 	err = control.CreateNamespace(kubeApiServerEndPoint, kubeApiServerToken, namespace.Name)
 
 	if err != nil {
@@ -113,6 +173,46 @@ func postKubernetesNamespace(request *restful.Request, response *restful.Respons
 		response.WriteErrorString(422, string(errorMessageByteSlice))
 		return
 	}
+
+	if len(namespace.ResourceQuotaHardMap) > 0 {
+		err = control.SaveResourceQuota(kubeApiServerEndPoint, kubeApiServerToken, namespace.Name, control.DefaultResourceQuotaName, namespace.ResourceQuotaHardMap)
+		if err != nil {
+			deleteNamespaceCreatedWithoutLimitation(kubeApiServerEndPoint, kubeApiServerToken, namespace.Name)
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Create resource quota failure"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+			jsonMap["namespace"] = namespace
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(422, string(errorMessageByteSlice))
+			return
+		}
+	}
+
+	if len(namespace.LimitRangeItemSlice) > 0 {
+		err = control.SaveLimitRange(kubeApiServerEndPoint, kubeApiServerToken, namespace.Name, control.DefaultLimitRangeName, namespace.LimitRangeItemSlice)
+		if err != nil {
+			deleteNamespaceCreatedWithoutLimitation(kubeApiServerEndPoint, kubeApiServerToken, namespace.Name)
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Create limit range failure"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+			jsonMap["namespace"] = namespace
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(422, string(errorMessageByteSlice))
+			return
+		}
+	}
+}
+
+// The namespace is removed so it is not left usable without the requested quota or limit range
+func deleteNamespaceCreatedWithoutLimitation(kubeApiServerEndPoint string, kubeApiServerToken string, name string) {
+	err := control.DeleteNamespace(kubeApiServerEndPoint, kubeApiServerToken, name)
+	if err != nil {
+		log.Error("Delete namespace %s created without the limitation error: %s", name, err)
+	}
 }
 
 func deleteKubernetesNamespace(request *restful.Request, response *restful.Response) {
@@ -144,6 +244,220 @@ func deleteKubernetesNamespace(request *restful.Request, response *restful.Respo
 	}
 }
 
+func getAllResourceQuotaStatus(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	resourceQuotaSlice, err := control.GetAllResourceQuota(kubeApiServerEndPoint, kubeApiServerToken, namespace)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all resource quota failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	resourceQuotaStatusSlice := make([]ResourceQuotaStatus, 0)
+	for _, resourceQuota := range resourceQuotaSlice {
+		resourceQuotaStatusSlice = append(resourceQuotaStatusSlice, ResourceQuotaStatus{
+			resourceQuota.Name,
+			resourceQuota.GetUsageSlice(),
+		})
+	}
+
+	response.WriteJson(resourceQuotaStatusSlice, "[]ResourceQuotaStatus")
+}
+
+func putResourceQuota(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	resourceQuotaInput := new(ResourceQuotaInput)
+	err = request.ReadEntity(&resourceQuotaInput)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = control.SaveResourceQuota(kubeApiServerEndPoint, kubeApiServerToken, namespace, control.DefaultResourceQuotaName, resourceQuotaInput.HardMap)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Save resource quota failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func deleteResourceQuota(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	err = control.DeleteResourceQuota(kubeApiServerEndPoint, kubeApiServerToken, namespace, control.DefaultResourceQuotaName)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete resource quota failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getAllLimitRange(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	limitRangeSlice, err := control.GetAllLimitRange(kubeApiServerEndPoint, kubeApiServerToken, namespace)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all limit range failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(limitRangeSlice, "[]LimitRange")
+}
+
+func putLimitRange(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	limitRangeInput := new(LimitRangeInput)
+	err = request.ReadEntity(&limitRangeInput)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = control.SaveLimitRange(kubeApiServerEndPoint, kubeApiServerToken, namespace, control.DefaultLimitRangeName, limitRangeInput.LimitRangeItemSlice)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Save limit range failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func deleteLimitRange(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	err = control.DeleteLimitRange(kubeApiServerEndPoint, kubeApiServerToken, namespace, control.DefaultLimitRangeName)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete limit range failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
 func returns200AllKubernetesNamesapceName(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []string{})
 }
+
+func returns200AllResourceQuotaStatus(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []ResourceQuotaStatus{})
+}
+
+func returns200AllLimitRange(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []control.LimitRange{})
+}
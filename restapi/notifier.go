@@ -317,6 +317,10 @@ func getAllEmailServerSMTP(request *restful.Request, response *restful.Response)
 		return
 	}
 
+	for i := range emailServerSMTPSlice {
+		redactEmailServerSMTP(&emailServerSMTPSlice[i])
+	}
+
 	response.WriteJson(emailServerSMTPSlice, "[]EmailServerSMTP")
 }
 
@@ -337,7 +341,6 @@ func postEmailServerSMTP(request *restful.Request, response *restful.Response) {
 	if existingEmailServerSMTP != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "The smtp email server to create already exists"
-		jsonMap["ErrorMessage"] = err.Error()
 		jsonMap["name"] = emailServerSMTP.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
@@ -350,7 +353,7 @@ func postEmailServerSMTP(request *restful.Request, response *restful.Response) {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save smtp email server failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["emailServerSMTP"] = emailServerSMTP
+		jsonMap["name"] = emailServerSMTP.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -373,6 +376,8 @@ func getEmailServerSMTP(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	redactEmailServerSMTP(emailServerSMTP)
+
 	response.WriteJson(emailServerSMTP, "EmailServerSMTP")
 }
 
@@ -404,6 +409,10 @@ func getAllSMSNexmo(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	for i := range smsNexmoSlice {
+		redactSMSNexmo(&smsNexmoSlice[i])
+	}
+
 	response.WriteJson(smsNexmoSlice, "[]SMSNexmo")
 }
 
@@ -424,7 +433,6 @@ func postSMSNexmo(request *restful.Request, response *restful.Response) {
 	if existingSMSNexmo != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "The sms nexmo to create already exists"
-		jsonMap["ErrorMessage"] = err.Error()
 		jsonMap["name"] = smsNexmo.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
@@ -437,7 +445,7 @@ func postSMSNexmo(request *restful.Request, response *restful.Response) {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save sms nexmo failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["smsNexmo"] = smsNexmo
+		jsonMap["name"] = smsNexmo.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -460,6 +468,8 @@ func getSMSNexmo(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	redactSMSNexmo(smsNexmo)
+
 	response.WriteJson(smsNexmo, "SMSNexmo")
 }
 
@@ -479,6 +489,14 @@ func deleteSMSNexmo(request *restful.Request, response *restful.Response) {
 	}
 }
 
+func redactEmailServerSMTP(emailServerSMTP *notification.EmailServerSMTP) {
+	emailServerSMTP.Password = ""
+}
+
+func redactSMSNexmo(smsNexmo *notification.SMSNexmo) {
+	smsNexmo.APISecret = ""
+}
+
 func returns200AllReplicationControllerNotifier(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []notification.ReplicationControllerNotifierSerializable{})
 }
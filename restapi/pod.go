@@ -18,10 +18,23 @@ import (
 	"encoding/json"
 	"github.com/cloudawan/cloudone/control"
 	"github.com/cloudawan/cloudone/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/rbac"
 	"github.com/emicklei/go-restful"
+	"golang.org/x/net/websocket"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
+const (
+	// The exec and the port forward are closed once the token expires or is revoked
+	podStreamTokenCheckInterval = time.Minute
+)
+
+var podExecDefaultCommandSlice = []string{"/bin/sh"}
+
 func registerWebServicePod() {
 	ws := new(restful.WebService)
 	ws.Path("/api/v1/pods")
@@ -40,6 +53,34 @@ func registerWebServicePod() {
 		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
 		Param(ws.PathParameter("pod", "Kubernetes pod").DataType("string")).
 		Do(returns200PodLog, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/{namespace}/{pod}/logs/stream").Filter(authorize).Filter(auditLog).To(getPodLogStream).
+		Doc("Stream the log of the container as plain text").
+		Produces("text/plain", restful.MIME_JSON).
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("pod", "Kubernetes pod").DataType("string")).
+		Param(ws.QueryParameter("container", "Container name. Could be empty if the pod has only one container").DataType("string")).
+		Param(ws.QueryParameter("follow", "Keep streaming the new log").DataType("boolean")).
+		Param(ws.QueryParameter("sinceSeconds", "Only the log in the recent seconds").DataType("int")).
+		Param(ws.QueryParameter("tailLines", "Only the last lines").DataType("int")).
+		Param(ws.QueryParameter("previous", "The log of the previous terminated container").DataType("boolean")).
+		Do(returns200, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/{namespace}/{pod}/exec").Filter(authorize).Filter(auditLog).To(getPodExec).
+		Doc("Exec the command in the container through the websocket. The first byte of each binary message is the channel, 0 stdin and 4 terminal resize from the client and 1 stdout, 2 stderr and 3 error from the server.").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("pod", "Kubernetes pod").DataType("string")).
+		Param(ws.QueryParameter("container", "Container name. Could be empty if the pod has only one container").DataType("string")).
+		Param(ws.QueryParameter("command", "Command and the arguments. Repeat for each argument. /bin/sh if empty").DataType("string")).
+		Param(ws.QueryParameter("tty", "Allocate the terminal. True if empty").DataType("boolean")).
+		Do(returns200, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/{namespace}/{pod}/portforward").Filter(authorize).Filter(auditLog).To(getPodPortForward).
+		Doc("Forward the port of the pod through the websocket. The binary messages are the TCP stream.").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("pod", "Kubernetes pod").DataType("string")).
+		Param(ws.QueryParameter("port", "Port of the pod").DataType("int")).
+		Do(returns200, returns400, returns404, returns422, returns500))
 }
 
 func deletePod(request *restful.Request, response *restful.Response) {
@@ -108,6 +149,333 @@ func getPodLog(request *restful.Request, response *restful.Response) {
 	response.WriteJson(logJsonMap, "{}")
 }
 
+func getPodLogStream(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	pod := request.PathParameter("pod")
+
+	podLogOption := control.PodLogOption{request.QueryParameter("container"), false, 0, -1, false}
+	var err error
+	if followText := request.QueryParameter("follow"); followText != "" {
+		podLogOption.Follow, err = strconv.ParseBool(followText)
+	}
+	if sinceSecondsText := request.QueryParameter("sinceSeconds"); err == nil && sinceSecondsText != "" {
+		podLogOption.SinceSeconds, err = strconv.Atoi(sinceSecondsText)
+	}
+	if tailLinesText := request.QueryParameter("tailLines"); err == nil && tailLinesText != "" {
+		podLogOption.TailLines, err = strconv.Atoi(tailLinesText)
+	}
+	if previousText := request.QueryParameter("previous"); err == nil && previousText != "" {
+		podLogOption.Previous, err = strconv.ParseBool(previousText)
+	}
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse the log option"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["pod"] = pod
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["pod"] = pod
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	flusher, ok := response.ResponseWriter.(http.Flusher)
+	if ok == false {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Streaming is not supported"
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(500, string(errorMessageByteSlice))
+		return
+	}
+
+	// Open before sending the status so the failure like the missing pod or container is responded with the status
+	cancelChannel := request.Request.Context().Done()
+	podLog, err := control.OpenPodLog(kubeApiServerEndPoint, kubeApiServerToken, namespace, pod, podLogOption, cancelChannel)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get log failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		jsonMap["pod"] = pod
+		jsonMap["container"] = podLogOption.ContainerName
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+	defer podLog.Close()
+
+	response.AddHeader("Content-Type", "text/plain; charset=utf-8")
+	response.AddHeader("Cache-Control", "no-cache")
+	response.AddHeader("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The status is sent already so the error is only logged
+	err = control.CopyPodLog(podLog, &flushWriter{response.ResponseWriter, flusher}, cancelChannel)
+	if err != nil {
+		log.Error("Stream log with namespace %s pod %s option %v error: %s", namespace, pod, podLogOption, err)
+	}
+}
+
+// Flush each write so the log is received as soon as it is written
+type flushWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+}
+
+func (flushWriter *flushWriter) Write(byteSlice []byte) (int, error) {
+	length, err := flushWriter.writer.Write(byteSlice)
+	flushWriter.flusher.Flush()
+	return length, err
+}
+
+// The exec and the port forward change the pod like POST although they are opened with GET for the websocket
+func getPodStreamUser(request *restful.Request, response *restful.Response) *rbac.User {
+	user := getCache(request.Request.Header.Get("token"))
+	if user == nil || user.HasPermission(componentName, "POST", request.SelectedRoutePath()) == false {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Not Authorized"
+		jsonMap["ErrorMessage"] = "The permission of POST is required to exec or forward the port"
+		jsonMap["path"] = request.SelectedRoutePath()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(401, string(errorMessageByteSlice))
+		return nil
+	}
+	return user
+}
+
+func getPodExec(request *restful.Request, response *restful.Response) {
+	user := getPodStreamUser(request, response)
+	if user == nil {
+		return
+	}
+
+	namespace := request.PathParameter("namespace")
+	pod := request.PathParameter("pod")
+	container := request.QueryParameter("container")
+	commandSlice := request.Request.URL.Query()["command"]
+	if len(commandSlice) == 0 {
+		commandSlice = podExecDefaultCommandSlice
+	}
+
+	tty := true
+	if ttyText := request.QueryParameter("tty"); ttyText != "" {
+		var err error
+		tty, err = strconv.ParseBool(ttyText)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Could not parse ttyText"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["ttyText"] = ttyText
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(400, string(errorMessageByteSlice))
+			return
+		}
+	}
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["pod"] = pod
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	// Connect before upgrading so the failure could still be responded with the status
+	podStreamConnection, err := control.DialPodExec(kubeApiServerEndPoint, kubeApiServerToken, namespace, pod, container, commandSlice, tty)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Exec in pod failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		jsonMap["pod"] = pod
+		jsonMap["container"] = container
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+	defer podStreamConnection.Close()
+
+	log.Info("Exec session of user %s starts with namespace %s pod %s container %s command %v from %s", user.Name, namespace, pod, container, commandSlice, request.Request.RemoteAddr)
+	defer log.Info("Exec session of user %s ends with namespace %s pod %s container %s from %s", user.Name, namespace, pod, container, request.Request.RemoteAddr)
+
+	servePodStreamWebsocket(request, response, podStreamConnection, func(clientConnection *websocket.Conn) {
+		go func() {
+			// Closing the pod side ends the relay to the client
+			defer podStreamConnection.Close()
+			for {
+				byteSlice := make([]byte, 0)
+				if err := websocket.Message.Receive(clientConnection, &byteSlice); err != nil {
+					return
+				}
+				if len(byteSlice) == 0 {
+					continue
+				}
+				// The client could only write the input and resize the terminal
+				channel := byteSlice[0]
+				if channel != control.PodStreamChannelStdin && channel != control.PodStreamChannelResize {
+					log.Error("Exec with namespace %s pod %s receives the unexpected channel %d from the client", namespace, pod, channel)
+					return
+				}
+				if err := podStreamConnection.WriteChannel(channel, byteSlice[1:]); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			channel, byteSlice, err := podStreamConnection.ReadChannel()
+			if err != nil {
+				return
+			}
+			message := append([]byte{channel}, byteSlice...)
+			if err := websocket.Message.Send(clientConnection, message); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func getPodPortForward(request *restful.Request, response *restful.Response) {
+	user := getPodStreamUser(request, response)
+	if user == nil {
+		return
+	}
+
+	namespace := request.PathParameter("namespace")
+	pod := request.PathParameter("pod")
+	portText := request.QueryParameter("port")
+
+	port, err := strconv.Atoi(portText)
+	if err != nil || port <= 0 || port > 65535 {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Input is incorrect. The field port is required and should be between 1 and 65535."
+		jsonMap["portText"] = portText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["pod"] = pod
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	// Connect before upgrading so the failure could still be responded with the status
+	podPortForwardConnection, err := control.DialPodPortForward(kubeApiServerEndPoint, kubeApiServerToken, namespace, pod, port)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Port forward to pod failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
+		jsonMap["namespace"] = namespace
+		jsonMap["pod"] = pod
+		jsonMap["port"] = port
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+	defer podPortForwardConnection.Close()
+
+	log.Info("Port forward of user %s starts with namespace %s pod %s port %d from %s", user.Name, namespace, pod, port, request.Request.RemoteAddr)
+	defer log.Info("Port forward of user %s ends with namespace %s pod %s port %d from %s", user.Name, namespace, pod, port, request.Request.RemoteAddr)
+
+	servePodStreamWebsocket(request, response, podPortForwardConnection, func(clientConnection *websocket.Conn) {
+		clientConnection.PayloadType = websocket.BinaryFrame
+		go func() {
+			// Closing the pod side ends the relay to the client
+			defer podPortForwardConnection.Close()
+			io.Copy(podPortForwardConnection, clientConnection)
+		}()
+
+		_, err := io.Copy(clientConnection, podPortForwardConnection)
+		if err != nil {
+			log.Debug("Port forward with namespace %s pod %s port %d ends with error: %s", namespace, pod, port, err)
+		}
+	})
+}
+
+// Upgrade to the websocket and close both sides once either side or the relay ends or the token is no longer valid
+func servePodStreamWebsocket(request *restful.Request, response *restful.Response, podCloser io.Closer, relay func(clientConnection *websocket.Conn)) {
+	token := request.Request.Header.Get("token")
+
+	server := websocket.Server{
+		// The origin is not checked since the token header which the browsers couldn't send across the sites is required
+		Handshake: func(config *websocket.Config, httpRequest *http.Request) error {
+			return nil
+		},
+		Handler: func(clientConnection *websocket.Conn) {
+			defer clientConnection.Close()
+
+			doneChannel := make(chan struct{})
+			closeOnce := &sync.Once{}
+			closeAll := func() {
+				closeOnce.Do(func() {
+					close(doneChannel)
+					podCloser.Close()
+					clientConnection.Close()
+				})
+			}
+			defer closeAll()
+
+			go func() {
+				ticker := time.NewTicker(podStreamTokenCheckInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-doneChannel:
+						return
+					case <-ticker.C:
+						if getCache(token) == nil {
+							log.Info("Close the pod stream from %s since the token is no longer valid", request.Request.RemoteAddr)
+							closeAll()
+							return
+						}
+					}
+				}
+			}()
+
+			relay(clientConnection)
+		},
+	}
+	server.ServeHTTP(response.ResponseWriter, request.Request)
+}
+
 func returns200PodLog(b *restful.RouteBuilder) {
 	jsonMap := make(map[string]interface{})
 	b.Returns(http.StatusOK, "OK", jsonMap)
@@ -32,7 +32,7 @@ func registerWebServicePrivateRegistry() {
 		Doc("Get all of the private registry server configuration").
 		Do(returns200AllPrivateRegistry, returns404, returns500))
 
-	ws.Route(ws.POST("/servers/").Filter(authorize).Filter(auditLog).To(postPrivateRegistry).
+	ws.Route(ws.POST("/servers/").Filter(authorize).Filter(auditLogWithoutBody).To(postPrivateRegistry).
 		Doc("Create private registry server configuration").
 		Do(returns200, returns400, returns409, returns422, returns500).
 		Reads(registry.PrivateRegistry{}))
@@ -42,7 +42,7 @@ func registerWebServicePrivateRegistry() {
 		Param(ws.PathParameter("server", "Server name").DataType("string")).
 		Do(returns200, returns422, returns500))
 
-	ws.Route(ws.PUT("/servers/{server}").Filter(authorize).Filter(auditLog).To(putPrivateRegistry).
+	ws.Route(ws.PUT("/servers/{server}").Filter(authorize).Filter(auditLogWithoutBody).To(putPrivateRegistry).
 		Doc("Modify private registry server configuration").
 		Param(ws.PathParameter("server", "Server name").DataType("string")).
 		Do(returns200, returns400, returns404, returns422, returns500).
@@ -76,6 +76,26 @@ func registerWebServicePrivateRegistry() {
 		Param(ws.PathParameter("repository", "Repository name").DataType("string")).
 		Param(ws.PathParameter("tag", "Tag name").DataType("string")).
 		Do(returns200, returns404, returns422, returns500))
+
+	// The repository names with the slash like team/app are passed with the query parameter
+	ws.Route(ws.DELETE("/servers/{server}/images").Filter(authorize).Filter(auditLog).To(deleteAllImageInPrivateRegistryRepository).
+		Doc("Delete all the images in the repository in the private registry server").
+		Param(ws.PathParameter("server", "Server name").DataType("string")).
+		Param(ws.QueryParameter("repository", "Repository name").DataType("string")).
+		Do(returns200, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/servers/{server}/images/tags").Filter(authorize).Filter(auditLog).To(getAllImageTagInPrivateRegistryRepository).
+		Doc("Get all the image tags in the repository in the private registry server").
+		Param(ws.PathParameter("server", "Server name").DataType("string")).
+		Param(ws.QueryParameter("repository", "Repository name").DataType("string")).
+		Do(returns200StringSlice, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.DELETE("/servers/{server}/images/tags/{tag}").Filter(authorize).Filter(auditLog).To(deleteImageInPrivateRegistryRepository).
+		Doc("Delete the image with the tag in the repository in the private registry server").
+		Param(ws.PathParameter("server", "Server name").DataType("string")).
+		Param(ws.QueryParameter("repository", "Repository name").DataType("string")).
+		Param(ws.PathParameter("tag", "Tag name").DataType("string")).
+		Do(returns200, returns400, returns404, returns422, returns500))
 }
 
 func getAllPrivateRegistry(request *restful.Request, response *restful.Response) {
@@ -90,7 +110,18 @@ func getAllPrivateRegistry(request *restful.Request, response *restful.Response)
 		return
 	}
 
-	response.WriteJson(privateRegistrySlice, "[]PrivateRegistry")
+	authorizedPrivateRegistrySlice := make([]registry.PrivateRegistry, 0)
+	for _, privateRegistry := range privateRegistrySlice {
+		if isResourceAuthorizedForRequest(request, resourcePathPrivateRegistry, privateRegistry.Name) {
+			authorizedPrivateRegistrySlice = append(authorizedPrivateRegistrySlice, privateRegistry)
+		}
+	}
+
+	for i := range authorizedPrivateRegistrySlice {
+		redactPrivateRegistry(&authorizedPrivateRegistrySlice[i])
+	}
+
+	response.WriteJson(authorizedPrivateRegistrySlice, "[]PrivateRegistry")
 }
 
 func postPrivateRegistry(request *restful.Request, response *restful.Response) {
@@ -122,7 +153,7 @@ func postPrivateRegistry(request *restful.Request, response *restful.Response) {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save private registry server configuration failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["privateRegistry"] = privateRegistry
+		jsonMap["name"] = privateRegistry.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -184,12 +215,20 @@ func putPrivateRegistry(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	// The credential is not returned by get so keep the old one if not given
+	if privateRegistry.Password == "" && privateRegistry.Username == oldPrivateRegistry.Username {
+		privateRegistry.Password = oldPrivateRegistry.Password
+	}
+	if privateRegistry.BearerToken == "" {
+		privateRegistry.BearerToken = oldPrivateRegistry.BearerToken
+	}
+
 	err = registry.GetStorage().SavePrivateRegistry(privateRegistry)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Save private registry server configuration failure"
 		jsonMap["ErrorMessage"] = err.Error()
-		jsonMap["privateRegistry"] = privateRegistry
+		jsonMap["name"] = privateRegistry.Name
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
 		response.WriteErrorString(422, string(errorMessageByteSlice))
@@ -212,6 +251,8 @@ func getPrivateRegistry(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	redactPrivateRegistry(privateRegistry)
+
 	response.WriteJson(privateRegistry, "PrivateRegistry")
 }
 
@@ -247,7 +288,17 @@ func getAllPrivateRegistryRepository(request *restful.Request, response *restful
 
 func deleteAllImageInPrivateRegistryRepository(request *restful.Request, response *restful.Response) {
 	server := request.PathParameter("server")
-	repository := request.PathParameter("repository")
+	repository := getRepositoryParameter(request)
+
+	if repository == "" {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Repository name is required"
+		jsonMap["server"] = server
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
 
 	privateRegistry, err := registry.GetStorage().LoadPrivateRegistry(server)
 	if err != nil {
@@ -277,7 +328,17 @@ func deleteAllImageInPrivateRegistryRepository(request *restful.Request, respons
 
 func getAllImageTagInPrivateRegistryRepository(request *restful.Request, response *restful.Response) {
 	server := request.PathParameter("server")
-	repository := request.PathParameter("repository")
+	repository := getRepositoryParameter(request)
+
+	if repository == "" {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Repository name is required"
+		jsonMap["server"] = server
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
 
 	privateRegistry, err := registry.GetStorage().LoadPrivateRegistry(server)
 	if err != nil {
@@ -309,9 +370,19 @@ func getAllImageTagInPrivateRegistryRepository(request *restful.Request, respons
 
 func deleteImageInPrivateRegistryRepository(request *restful.Request, response *restful.Response) {
 	server := request.PathParameter("server")
-	repository := request.PathParameter("repository")
+	repository := getRepositoryParameter(request)
 	tag := request.PathParameter("tag")
 
+	if repository == "" {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Repository name is required"
+		jsonMap["server"] = server
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
 	privateRegistry, err := registry.GetStorage().LoadPrivateRegistry(server)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
@@ -339,6 +410,20 @@ func deleteImageInPrivateRegistryRepository(request *restful.Request, response *
 	}
 }
 
+// Path parameter for the old routes and query parameter for the nested repository names
+func getRepositoryParameter(request *restful.Request) string {
+	repository := request.PathParameter("repository")
+	if repository == "" {
+		repository = request.QueryParameter("repository")
+	}
+	return repository
+}
+
+func redactPrivateRegistry(privateRegistry *registry.PrivateRegistry) {
+	privateRegistry.Password = ""
+	privateRegistry.BearerToken = ""
+}
+
 func returns200AllPrivateRegistry(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []registry.PrivateRegistry{})
 }
@@ -30,6 +30,8 @@ func StartRestAPIServer() {
 	registerWebServiceReplicationController()
 	registerWebServiceImageInformation()
 	registerWebServiceImageRecord()
+	registerWebServiceImageRetentionPolicy()
+	registerWebServiceImagePolicy()
 	registerWebServiceDeploy()
 	registerWebServiceDeployBlueGreen()
 	registerWebServiceDeployClusterApplication()
@@ -48,6 +50,9 @@ func StartRestAPIServer() {
 	registerWebServiceWebhook()
 	registerWebServicePrivateRegistry()
 	registerWebServiceSLB()
+	registerWebServiceSecret()
+	registerWebServiceLock()
+	registerWebServiceEvent()
 
 	// Place the method+path to description mapping to map for audit
 	for _, rws := range restful.DefaultContainer.RegisteredWebServices() {
@@ -114,6 +119,10 @@ func returns422(b *restful.RouteBuilder) {
 	b.Returns(422, "Unprocessable Entity", nil)
 }
 
+func returns429(b *restful.RouteBuilder) {
+	b.Returns(429, "Too Many Requests", nil)
+}
+
 func returns500(b *restful.RouteBuilder) {
 	b.Returns(http.StatusInternalServerError, "Internal error", nil)
 }
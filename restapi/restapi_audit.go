@@ -89,7 +89,7 @@ func sendAuditLog(token string, requestURI string, method string, path string, r
 	url := "https://" + cloudoneAnalysisHost + ":" + strconv.Itoa(cloudoneAnalysisPort) + "/api/v1/auditlogs"
 
 	headerMap := make(map[string]string)
-	headerMap["token"] = authorization.SystemAdminToken
+	headerMap["token"] = authorization.GetSystemAdminToken()
 
 	_, err := restclient.RequestPost(url, auditLog, headerMap, false)
 	if err != nil {
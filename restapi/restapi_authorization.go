@@ -15,17 +15,64 @@
 package restapi
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone/authorization"
 	"github.com/cloudawan/cloudone_utility/rbac"
 	"github.com/emicklei/go-restful"
+	"io/ioutil"
+	"strings"
 )
 
 const (
 	componentName = "cloudone"
 )
 
+const (
+	resourcePathNamespace          = "/namespaces/"
+	resourcePathImageInformation   = "/imageinformations/"
+	resourcePathClusterApplication = "/clusterapplications/"
+	resourcePathGlusterfsCluster   = "/glusterfsclusters/"
+	resourcePathSLBDaemon          = "/slbdaemons/"
+	resourcePathHostCredential     = "/hostcredentials/"
+	resourcePathPrivateRegistry    = "/privateregistries/"
+	resourcePathSLBCertificate     = "/slbcertificates/"
+)
+
+// The object identified by the path parameter and by the body fields.
+// If the path parameter isn't the name of the object, it is converted to the name of the object.
+type resourceRule struct {
+	routePathPrefix    string
+	parameterName      string
+	bodyFieldNameSlice []string
+	resourcePathPrefix string
+	convertParameter   func(parameter string) (string, error)
+}
+
+var resourceRuleSlice = []resourceRule{
+	resourceRule{"/api/v1/imageinformations/", "imageinformationname", []string{"Name", "ImageInformationName"}, resourcePathImageInformation, nil},
+	resourceRule{"/api/v1/imagerecords/", "imageinformationname", nil, resourcePathImageInformation, nil},
+	resourceRule{"/api/v1/imageretentionpolicies/", "imageinformationname", nil, resourcePathImageInformation, nil},
+	resourceRule{"/api/v1/clusterapplications/", "clusterapplication", []string{"Name"}, resourcePathClusterApplication, nil},
+	resourceRule{"/api/v1/glusterfs/clusters/", "cluster", []string{"Name"}, resourcePathGlusterfsCluster, nil},
+	resourceRule{"/api/v1/slbs/daemons/", "name", []string{"Name"}, resourcePathSLBDaemon, nil},
+	resourceRule{"/api/v1/slbs/certificates/", "name", []string{"Name"}, resourcePathSLBCertificate, nil},
+	resourceRule{"/api/v1/hosts/credentials/", "ip", []string{"IP"}, resourcePathHostCredential, nil},
+	resourceRule{"/api/v1/privateregistries/servers/", "server", []string{"Name"}, resourcePathPrivateRegistry, nil},
+	resourceRule{"/api/v1/webhooks/deliveries/", "id", nil, resourcePathImageInformation, getWebhookDeliveryImageInformation},
+}
+
 func getCache(token string) *rbac.User {
 	// This is special case since cloudone own the authorization server so it doesn't need to ask authorization server and cache but just get data.
-	return rbac.GetCache(token)
+	// The token issued by the other instance or before the restart is loaded from the storage.
+	// The API key is also accepted as the token and restricted to its scope.
+	user, err := authorization.GetUserFromToken(token)
+	if err != nil {
+		log.Debug("Get user from token error: %s", err)
+		return nil
+	}
+	return user
 }
 
 func authorize(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
@@ -36,21 +83,19 @@ func authorize(req *restful.Request, resp *restful.Response, chain *restful.Filt
 
 	// Verify
 	if user != nil {
+		bodyJsonMap, err := getRequestBodyJsonMap(req)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Read body failure"
+			jsonMap["ErrorMessage"] = err.Error()
+			log.Error(jsonMap)
+			resp.WriteHeaderAndJson(400, jsonMap, "{}")
+			return
+		}
+
 		authorized := false
 		if user.HasPermission(componentName, req.Request.Method, req.SelectedRoutePath()) {
-			// Resource check
-			namespace := req.PathParameter("namespace")
-			namespacePass := false
-			if namespace != "" {
-				if user.HasResource(componentName, "/namespaces/"+namespace) {
-					namespacePass = true
-				}
-			} else {
-				namespacePass = true
-			}
-			if namespacePass {
-				authorized = true
-			}
+			authorized = isRequestResourceAuthorized(req, user, bodyJsonMap)
 		}
 
 		if authorized {
@@ -65,7 +110,135 @@ func authorize(req *restful.Request, resp *restful.Response, chain *restful.Filt
 		// Cache doesn't exist
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Token doesn't exist"
-		jsonMap["ErrorMessage"] = "Token is incorrect or expired. Please get token with username and password again."
+		jsonMap["ErrorMessage"] = "Token or API key is incorrect or expired. Please get token with username and password again."
 		resp.WriteHeaderAndJson(401, jsonMap, "{}")
 	}
 }
+
+// Check the namespace and the objects the request refers to with the path parameters or the body
+func isRequestResourceAuthorized(req *restful.Request, user *rbac.User, bodyJsonMap map[string]interface{}) bool {
+	// Namespace is always checked. The body could refer to the other namespace than the path.
+	namespaceSlice := make([]string, 0)
+	if namespace := req.PathParameter("namespace"); namespace != "" {
+		namespaceSlice = append(namespaceSlice, namespace)
+	}
+	if namespace, ok := bodyJsonMap[getFoldedFieldName("Namespace")].(string); ok && namespace != "" {
+		namespaceSlice = append(namespaceSlice, namespace)
+	}
+	for _, namespace := range namespaceSlice {
+		if user.HasResource(componentName, resourcePathNamespace+namespace) == false {
+			return false
+		}
+	}
+
+	path := req.SelectedRoutePath()
+	for _, resourceRule := range resourceRuleSlice {
+		if strings.HasPrefix(path, resourceRule.routePathPrefix) == false {
+			continue
+		}
+
+		nameSlice := make([]string, 0)
+		if strings.Contains(path, "{"+resourceRule.parameterName+"}") {
+			name := req.PathParameter(resourceRule.parameterName)
+			if resourceRule.convertParameter != nil {
+				convertedName, err := resourceRule.convertParameter(name)
+				if err != nil {
+					log.Error("Convert parameter %s %s of route %s error: %s", resourceRule.parameterName, name, path, err)
+					return false
+				}
+				name = convertedName
+			}
+			nameSlice = append(nameSlice, name)
+		}
+		// The body could refer to the other object than the path
+		for _, bodyFieldName := range resourceRule.bodyFieldNameSlice {
+			if name, ok := bodyJsonMap[getFoldedFieldName(bodyFieldName)].(string); ok && name != "" {
+				nameSlice = append(nameSlice, name)
+			}
+		}
+
+		for _, name := range nameSlice {
+			if isResourceAuthorized(user, resourceRule.resourcePathPrefix, name) == false {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// The top level fields of the json body with the folded field names. Empty if the body is not a json object.
+// The handlers decode the body matching the field names case-insensitively so the field names are folded the same way
+// and the body having the same field more than once is rejected since the checked value may not be the used one.
+func getRequestBodyJsonMap(req *restful.Request) (map[string]interface{}, error) {
+	bodyJsonMap := make(map[string]interface{})
+	if req.Request.Body == nil || (req.Request.Method != "POST" && req.Request.Method != "PUT") {
+		return bodyJsonMap, nil
+	}
+
+	requestBody, _ := ioutil.ReadAll(req.Request.Body)
+	// Write data back for the later use
+	req.Request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+
+	// Not a json object so no field is referred
+	rawJsonMap := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(requestBody, &rawJsonMap); err != nil {
+		return bodyJsonMap, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(requestBody))
+	// The opening delimiter
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		fieldName, _ := token.(string)
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		foldedFieldName := getFoldedFieldName(fieldName)
+		if _, ok := bodyJsonMap[foldedFieldName]; ok {
+			return nil, errors.New("Field " + fieldName + " is duplicated or ambiguous")
+		}
+		bodyJsonMap[foldedFieldName] = value
+	}
+
+	return bodyJsonMap, nil
+}
+
+// Fold like encoding/json matching the field names so the special case letters such as the Kelvin sign are the same
+func getFoldedFieldName(fieldName string) string {
+	return strings.ToLower(strings.ToUpper(fieldName))
+}
+
+// The kind of the object is restricted only if the user has any resource of the kind so the existing users without such resources keep working
+func isResourceAuthorized(user *rbac.User, resourcePathPrefix string, name string) bool {
+	restricted := false
+	for _, resource := range user.ResourceSlice {
+		if strings.HasPrefix(resource.Path, resourcePathPrefix) {
+			restricted = true
+			break
+		}
+	}
+	if restricted == false {
+		return true
+	}
+
+	return user.HasResource(componentName, resourcePathPrefix+name)
+}
+
+// Used to filter the list so the objects the user can't access are not shown
+func isResourceAuthorizedForRequest(request *restful.Request, resourcePathPrefix string, name string) bool {
+	user := getCache(request.Request.Header.Get("token"))
+	if user == nil {
+		return false
+	}
+	return isResourceAuthorized(user, resourcePathPrefix, name)
+}
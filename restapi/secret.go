@@ -0,0 +1,236 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone/authorization"
+	"github.com/cloudawan/cloudone/filesystem/glusterfs"
+	"github.com/cloudawan/cloudone/host"
+	"github.com/cloudawan/cloudone/image"
+	"github.com/cloudawan/cloudone/notification"
+	"github.com/cloudawan/cloudone/registry"
+	"github.com/cloudawan/cloudone/slb"
+	"github.com/cloudawan/cloudone/utility/secret"
+	"github.com/emicklei/go-restful"
+	"net/http"
+)
+
+type MasterKeyStatus struct {
+	Enabled          bool
+	PrimaryMasterKey string
+	MasterKeySlice   []string
+}
+
+func registerWebServiceSecret() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/secrets")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/masterkeys").Filter(authorize).Filter(auditLog).To(getMasterKeyStatus).
+		Doc("Get the ids of the loaded master keys").
+		Do(returns200MasterKeyStatus, returns500))
+
+	ws.Route(ws.PUT("/masterkeys/reload").Filter(authorize).Filter(auditLog).To(putMasterKeyReload).
+		Doc("Reload the master key file").
+		Do(returns200MasterKeyStatus, returns422, returns500))
+
+	ws.Route(ws.PUT("/reencrypt").Filter(authorize).Filter(auditLog).To(putReencrypt).
+		Doc("Encrypt all of the stored secrets again with the primary master key").
+		Do(returns200Map, returns422, returns500))
+}
+
+func getMasterKeyStatus(request *restful.Request, response *restful.Response) {
+	response.WriteJson(getCurrentMasterKeyStatus(), "MasterKeyStatus")
+}
+
+func putMasterKeyReload(request *restful.Request, response *restful.Response) {
+	err := secret.Reload()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Reload master key failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(getCurrentMasterKeyStatus(), "MasterKeyStatus")
+}
+
+// Load and save again so the plain and the old key encrypted secrets are encrypted with the primary key.
+// Run after a new key is put on the first line of the master key file and reloaded on every instance.
+func putReencrypt(request *restful.Request, response *restful.Response) {
+	if secret.IsEnabled() == false {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Reencrypt failure"
+		jsonMap["ErrorMessage"] = "No master key is loaded"
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	resultJsonMap := make(map[string]interface{})
+	for _, reencrypt := range []struct {
+		kind     string
+		function func() (int, error)
+	}{
+		{"hostCredential", reencryptCredential},
+		{"glusterfsCluster", reencryptGlusterfsCluster},
+		{"emailServerSMTP", reencryptEmailServerSMTP},
+		{"smsNexmo", reencryptSMSNexmo},
+		{"imageInformation", reencryptImageInformation},
+		{"privateRegistry", reencryptPrivateRegistry},
+		{"slbCertificate", reencryptSLBCertificate},
+		{"signingKey", reencryptSigningKey},
+	} {
+		amount, err := reencrypt.function()
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Reencrypt failure"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["kind"] = reencrypt.kind
+			jsonMap["reencrypted"] = resultJsonMap
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(422, string(errorMessageByteSlice))
+			return
+		}
+		resultJsonMap[reencrypt.kind] = amount
+	}
+
+	response.WriteJson(resultJsonMap, "{}")
+}
+
+func getCurrentMasterKeyStatus() MasterKeyStatus {
+	masterKeySlice, primaryMasterKey := secret.GetMasterKeyID()
+	return MasterKeyStatus{
+		secret.IsEnabled(),
+		primaryMasterKey,
+		masterKeySlice,
+	}
+}
+
+func reencryptCredential() (int, error) {
+	credentialSlice, err := host.GetStorage().LoadAllCredential()
+	if err != nil {
+		return 0, err
+	}
+	for i := range credentialSlice {
+		if err := host.GetStorage().SaveCredential(&credentialSlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(credentialSlice), nil
+}
+
+func reencryptGlusterfsCluster() (int, error) {
+	glusterfsClusterSlice, err := glusterfs.GetStorage().LoadAllGlusterfsCluster()
+	if err != nil {
+		return 0, err
+	}
+	for i := range glusterfsClusterSlice {
+		if err := glusterfs.GetStorage().SaveGlusterfsCluster(&glusterfsClusterSlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(glusterfsClusterSlice), nil
+}
+
+func reencryptEmailServerSMTP() (int, error) {
+	emailServerSMTPSlice, err := notification.GetStorage().LoadAllEmailServerSMTP()
+	if err != nil {
+		return 0, err
+	}
+	for i := range emailServerSMTPSlice {
+		if err := notification.GetStorage().SaveEmailServerSMTP(&emailServerSMTPSlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(emailServerSMTPSlice), nil
+}
+
+func reencryptSMSNexmo() (int, error) {
+	smsNexmoSlice, err := notification.GetStorage().LoadAllSMSNexmo()
+	if err != nil {
+		return 0, err
+	}
+	for i := range smsNexmoSlice {
+		if err := notification.GetStorage().SaveSMSNexmo(&smsNexmoSlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(smsNexmoSlice), nil
+}
+
+func reencryptImageInformation() (int, error) {
+	imageInformationSlice, err := image.GetStorage().LoadAllImageInformation()
+	if err != nil {
+		return 0, err
+	}
+	for i := range imageInformationSlice {
+		if err := image.GetStorage().SaveImageInformation(&imageInformationSlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(imageInformationSlice), nil
+}
+
+func reencryptPrivateRegistry() (int, error) {
+	privateRegistrySlice, err := registry.GetStorage().LoadAllPrivateRegistry()
+	if err != nil {
+		return 0, err
+	}
+	for i := range privateRegistrySlice {
+		if err := registry.GetStorage().SavePrivateRegistry(&privateRegistrySlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(privateRegistrySlice), nil
+}
+
+func reencryptSLBCertificate() (int, error) {
+	certificateSlice, err := slb.GetStorage().LoadAllCertificate()
+	if err != nil {
+		return 0, err
+	}
+	for i := range certificateSlice {
+		if err := slb.GetStorage().SaveCertificate(&certificateSlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(certificateSlice), nil
+}
+
+func reencryptSigningKey() (int, error) {
+	signingKeySlice, err := authorization.GetStorage().LoadAllSigningKey()
+	if err != nil {
+		return 0, err
+	}
+	for i := range signingKeySlice {
+		if err := authorization.GetStorage().SaveSigningKey(&signingKeySlice[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(signingKeySlice), nil
+}
+
+func returns200MasterKeyStatus(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", MasterKeyStatus{})
+}
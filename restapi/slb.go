@@ -16,6 +16,7 @@ package restapi
 
 import (
 	"encoding/json"
+	"github.com/cloudawan/cloudone/deploy"
 	"github.com/cloudawan/cloudone/slb"
 	"github.com/emicklei/go-restful"
 	"net/http"
@@ -57,6 +58,39 @@ func registerWebServiceSLB() {
 		Doc("Configure the slb daemon with the current status").
 		Param(ws.PathParameter("name", "Name").DataType("string")).
 		Do(returns200, returns400, returns404, returns422, returns500))
+
+	ws.Route(ws.GET("/configurationstatus").Filter(authorize).Filter(auditLog).To(getSLBConfigurationStatus).
+		Doc("Get the generation of the command pushed automatically and the applied generation of each slb daemon").
+		Do(returns200SLBConfigurationStatus, returns500))
+
+	ws.Route(ws.GET("/health").Filter(authorize).Filter(auditLog).To(getAllSLBDaemonEndPointHealth).
+		Doc("Get the health and the applied command of each slb daemon endpoint polled periodically").
+		Do(returns200AllSLBDaemonEndPointHealth, returns500))
+
+	ws.Route(ws.GET("/certificates/").Filter(authorize).Filter(auditLog).To(getAllSLBCertificate).
+		Doc("Get all of the slb certificates without the private keys").
+		Do(returns200AllSLBCertificate, returns422, returns500))
+
+	ws.Route(ws.POST("/certificates/").Filter(authorize).Filter(auditLogWithoutBody).To(postSLBCertificate).
+		Doc("Create the slb certificate").
+		Do(returns200, returns400, returns409, returns422, returns500).
+		Reads(slb.Certificate{}))
+
+	ws.Route(ws.DELETE("/certificates/{name}").Filter(authorize).Filter(auditLog).To(deleteSLBCertificate).
+		Doc("Delete the slb certificate").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200, returns409, returns422, returns500))
+
+	ws.Route(ws.PUT("/certificates/{name}").Filter(authorize).Filter(auditLogWithoutBody).To(putSLBCertificate).
+		Doc("Modify the slb certificate. The stored private key is kept if it is empty.").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(slb.Certificate{}))
+
+	ws.Route(ws.GET("/certificates/{name}").Filter(authorize).Filter(auditLog).To(getSLBCertificate).
+		Doc("Get the slb certificate without the private key").
+		Param(ws.PathParameter("name", "Name").DataType("string")).
+		Do(returns200SLBCertificate, returns422, returns500))
 }
 
 func getAllSLBDaemon(request *restful.Request, response *restful.Response) {
@@ -71,7 +105,14 @@ func getAllSLBDaemon(request *restful.Request, response *restful.Response) {
 		return
 	}
 
-	response.WriteJson(slbDaemonClusterSlice, "[]SLBDaemon")
+	authorizedSlbDaemonClusterSlice := make([]slb.SLBDaemon, 0)
+	for _, slbDaemon := range slbDaemonClusterSlice {
+		if isResourceAuthorizedForRequest(request, resourcePathSLBDaemon, slbDaemon.Name) {
+			authorizedSlbDaemonClusterSlice = append(authorizedSlbDaemonClusterSlice, slbDaemon)
+		}
+	}
+
+	response.WriteJson(authorizedSlbDaemonClusterSlice, "[]SLBDaemon")
 }
 
 func postSLBDaemon(request *restful.Request, response *restful.Response) {
@@ -109,6 +150,9 @@ func postSLBDaemon(request *restful.Request, response *restful.Response) {
 		response.WriteErrorString(422, string(errorMessageByteSlice))
 		return
 	}
+
+	// Configure the new or changed one
+	slb.RequestReconfiguration()
 }
 
 func putSLBDaemon(request *restful.Request, response *restful.Response) {
@@ -160,6 +204,9 @@ func putSLBDaemon(request *restful.Request, response *restful.Response) {
 		response.WriteErrorString(422, string(errorMessageByteSlice))
 		return
 	}
+
+	// Configure the new or changed one
+	slb.RequestReconfiguration()
 }
 
 func deleteSLBDaemon(request *restful.Request, response *restful.Response) {
@@ -235,6 +282,249 @@ func putSLBDaemonConfigure(request *restful.Request, response *restful.Response)
 	}
 }
 
+func getSLBConfigurationStatus(request *restful.Request, response *restful.Response) {
+	configurationStatus := slb.GetConfigurationStatus()
+
+	authorizedSLBDaemonConfigurationStatusSlice := make([]slb.SLBDaemonConfigurationStatus, 0)
+	for _, slbDaemonConfigurationStatus := range configurationStatus.SLBDaemonConfigurationStatusSlice {
+		if isResourceAuthorizedForRequest(request, resourcePathSLBDaemon, slbDaemonConfigurationStatus.Name) {
+			authorizedSLBDaemonConfigurationStatusSlice = append(authorizedSLBDaemonConfigurationStatusSlice, slbDaemonConfigurationStatus)
+		}
+	}
+	configurationStatus.SLBDaemonConfigurationStatusSlice = authorizedSLBDaemonConfigurationStatusSlice
+
+	authorizedSkippedEntrySlice := make([]slb.CommandSkippedEntry, 0)
+	for _, skippedEntry := range configurationStatus.SkippedEntrySlice {
+		if isResourceAuthorizedForRequest(request, resourcePathNamespace, skippedEntry.Namespace) {
+			authorizedSkippedEntrySlice = append(authorizedSkippedEntrySlice, skippedEntry)
+		}
+	}
+	configurationStatus.SkippedEntrySlice = authorizedSkippedEntrySlice
+
+	response.WriteJson(configurationStatus, "ConfigurationStatus")
+}
+
+func getAllSLBDaemonEndPointHealth(request *restful.Request, response *restful.Response) {
+	authorizedSLBDaemonEndPointHealthSlice := make([]slb.SLBDaemonEndPointHealth, 0)
+	for _, slbDaemonEndPointHealth := range slb.GetAllSLBDaemonEndPointHealth() {
+		if isResourceAuthorizedForRequest(request, resourcePathSLBDaemon, slbDaemonEndPointHealth.Name) {
+			authorizedSLBDaemonEndPointHealthSlice = append(authorizedSLBDaemonEndPointHealthSlice, slbDaemonEndPointHealth)
+		}
+	}
+
+	response.WriteJson(authorizedSLBDaemonEndPointHealthSlice, "[]SLBDaemonEndPointHealth")
+}
+
+func getAllSLBCertificate(request *restful.Request, response *restful.Response) {
+	certificateSlice, err := slb.GetStorage().LoadAllCertificate()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all slb certificate failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	authorizedCertificateSlice := make([]slb.Certificate, 0)
+	for _, certificate := range certificateSlice {
+		if isResourceAuthorizedForRequest(request, resourcePathSLBCertificate, certificate.Name) {
+			redactSLBCertificate(&certificate)
+			authorizedCertificateSlice = append(authorizedCertificateSlice, certificate)
+		}
+	}
+
+	response.WriteJson(authorizedCertificateSlice, "[]Certificate")
+}
+
+func postSLBCertificate(request *restful.Request, response *restful.Response) {
+	certificate := slb.Certificate{}
+	err := request.ReadEntity(&certificate)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	oldCertificate, _ := slb.GetStorage().LoadCertificate(certificate.Name)
+	if oldCertificate != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "The slb certificate to create already exists"
+		jsonMap["name"] = certificate.Name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(409, string(errorMessageByteSlice))
+		return
+	}
+
+	err = certificate.Parse()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Parse slb certificate failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = certificate.Name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = slb.GetStorage().SaveCertificate(&certificate)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Save slb certificate failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = certificate.Name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func putSLBCertificate(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	certificate := slb.Certificate{}
+	err := request.ReadEntity(&certificate)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	if name != certificate.Name {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Path parameter name is different from name in the body"
+		jsonMap["path"] = name
+		jsonMap["body"] = certificate.Name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	oldCertificate, _ := slb.GetStorage().LoadCertificate(name)
+	if oldCertificate == nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "The slb certificate to update doesn't exist"
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	// The private key is redacted in the response so keep the stored one if not given
+	if certificate.PrivateKey == "" {
+		certificate.PrivateKey = oldCertificate.PrivateKey
+	}
+
+	err = certificate.Parse()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Parse slb certificate failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = slb.GetStorage().SaveCertificate(&certificate)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Save slb certificate failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	// Push the renewed certificate
+	slb.RequestReconfiguration()
+}
+
+func deleteSLBCertificate(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	deployInformationSlice, err := deploy.GetStorage().LoadAllDeployInformation()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all deployment failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+	for _, deployInformation := range deployInformationSlice {
+		for _, containerPort := range deployInformation.ContainerPortSlice {
+			if containerPort.CertificateName == name {
+				jsonMap := make(map[string]interface{})
+				jsonMap["Error"] = "The slb certificate is used by the deployment"
+				jsonMap["name"] = name
+				jsonMap["namespace"] = deployInformation.Namespace
+				jsonMap["imageInformation"] = deployInformation.ImageInformationName
+				errorMessageByteSlice, _ := json.Marshal(jsonMap)
+				log.Error(jsonMap)
+				response.WriteErrorString(409, string(errorMessageByteSlice))
+				return
+			}
+		}
+	}
+
+	err = slb.GetStorage().DeleteCertificate(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete slb certificate failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getSLBCertificate(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	certificate, err := slb.GetStorage().LoadCertificate(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get slb certificate failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+
+	redactSLBCertificate(certificate)
+
+	response.WriteJson(certificate, "Certificate")
+}
+
+func redactSLBCertificate(certificate *slb.Certificate) {
+	certificate.PrivateKey = ""
+}
+
 func returns200AllSLBDaemon(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []slb.SLBDaemon{})
 }
@@ -242,3 +532,19 @@ func returns200AllSLBDaemon(b *restful.RouteBuilder) {
 func returns200SLBDaemon(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", slb.SLBDaemon{})
 }
+
+func returns200SLBConfigurationStatus(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", slb.ConfigurationStatus{})
+}
+
+func returns200AllSLBDaemonEndPointHealth(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []slb.SLBDaemonEndPointHealth{})
+}
+
+func returns200AllSLBCertificate(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []slb.Certificate{})
+}
+
+func returns200SLBCertificate(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", slb.Certificate{})
+}
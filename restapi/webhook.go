@@ -19,11 +19,41 @@ import (
 	"github.com/cloudawan/cloudone/utility/configuration"
 	"github.com/cloudawan/cloudone/webhook"
 	"github.com/emicklei/go-restful"
+	"net/http"
 )
 
 type GithubPost struct {
 	User             string
 	ImageInformation string
+	DeliveryID       string
+	HeaderMap        map[string]string
+	Signature        string
+	Payload          string
+}
+
+type GitlabPost struct {
+	User             string
+	ImageInformation string
+	DeliveryID       string
+	HeaderMap        map[string]string
+	Token            string
+	Payload          string
+}
+
+type BitbucketPost struct {
+	User             string
+	ImageInformation string
+	DeliveryID       string
+	HeaderMap        map[string]string
+	Signature        string
+	Payload          string
+}
+
+type GiteaPost struct {
+	User             string
+	ImageInformation string
+	DeliveryID       string
+	HeaderMap        map[string]string
 	Signature        string
 	Payload          string
 }
@@ -39,23 +69,85 @@ func registerWebServiceWebhook() {
 	ws.Route(ws.POST("/github/").Filter(auditLog).To(postGithub).
 		Doc("Trigger image build from github webhook data").
 		Do(returns200, returns400, returns404, returns422, returns500).
-		Reads(Namesapce{}))
+		Reads(GithubPost{}))
+
+	// The body has the secret token
+	ws.Route(ws.POST("/gitlab/").Filter(auditLogWithoutBody).To(postGitlab).
+		Doc("Trigger image build from gitlab webhook data").
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(GitlabPost{}))
+
+	ws.Route(ws.POST("/bitbucket/").Filter(auditLog).To(postBitbucket).
+		Doc("Trigger image build from bitbucket webhook data").
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(BitbucketPost{}))
+
+	ws.Route(ws.POST("/gitea/").Filter(auditLog).To(postGitea).
+		Doc("Trigger image build from gitea webhook data").
+		Do(returns200, returns400, returns404, returns422, returns500).
+		Reads(GiteaPost{}))
+
+	ws.Route(ws.GET("/deliveries/").Filter(authorize).Filter(auditLog).To(getAllWebhookDelivery).
+		Doc("Get all of the webhook deliveries").
+		Do(returns200AllWebhookDelivery, returns404, returns500))
+
+	ws.Route(ws.GET("/deliveries/{id}").Filter(authorize).Filter(auditLog).To(getWebhookDelivery).
+		Doc("Get the webhook delivery").
+		Param(ws.PathParameter("id", "ID").DataType("string")).
+		Do(returns200WebhookDelivery, returns404, returns500))
 }
 
 func postGithub(request *restful.Request, response *restful.Response) {
-	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	githubPost := GithubPost{}
+	err := request.ReadEntity(&githubPost)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
-		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["Error"] = "Read body failure"
 		jsonMap["ErrorMessage"] = err.Error()
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
-		response.WriteErrorString(404, string(errorMessageByteSlice))
+		response.WriteErrorString(400, string(errorMessageByteSlice))
 		return
 	}
 
-	githubPost := GithubPost{}
-	err = request.ReadEntity(&githubPost)
+	notifyWebhook(request, response, webhook.ProviderGithub, githubPost.User, githubPost.ImageInformation, githubPost.DeliveryID, githubPost.HeaderMap, githubPost.Signature, githubPost.Payload)
+}
+
+func postGitlab(request *restful.Request, response *restful.Response) {
+	gitlabPost := GitlabPost{}
+	err := request.ReadEntity(&gitlabPost)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	notifyWebhook(request, response, webhook.ProviderGitlab, gitlabPost.User, gitlabPost.ImageInformation, gitlabPost.DeliveryID, gitlabPost.HeaderMap, gitlabPost.Token, gitlabPost.Payload)
+}
+
+func postBitbucket(request *restful.Request, response *restful.Response) {
+	bitbucketPost := BitbucketPost{}
+	err := request.ReadEntity(&bitbucketPost)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	notifyWebhook(request, response, webhook.ProviderBitbucket, bitbucketPost.User, bitbucketPost.ImageInformation, bitbucketPost.DeliveryID, bitbucketPost.HeaderMap, bitbucketPost.Signature, bitbucketPost.Payload)
+}
+
+func postGitea(request *restful.Request, response *restful.Response) {
+	giteaPost := GiteaPost{}
+	err := request.ReadEntity(&giteaPost)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Read body failure"
@@ -66,11 +158,28 @@ func postGithub(request *restful.Request, response *restful.Response) {
 		return
 	}
 
-	err = webhook.Notify(githubPost.User, githubPost.ImageInformation, githubPost.Signature, githubPost.Payload, kubeApiServerEndPoint, kubeApiServerToken)
+	notifyWebhook(request, response, webhook.ProviderGitea, giteaPost.User, giteaPost.ImageInformation, giteaPost.DeliveryID, giteaPost.HeaderMap, giteaPost.Signature, giteaPost.Payload)
+}
+
+func notifyWebhook(request *restful.Request, response *restful.Response, provider string, user string, imageInformation string, deliveryID string, headerMap map[string]string, signature string, payload string) {
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get kube apiserver endpoint and token failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	err = webhook.Notify(provider, user, imageInformation, deliveryID, headerMap, signature, payload, kubeApiServerEndPoint, kubeApiServerToken)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Notify webhook failure"
 		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["provider"] = provider
+		jsonMap["deliveryID"] = deliveryID
 		jsonMap["kubeApiServerEndPoint"] = kubeApiServerEndPoint
 		errorMessageByteSlice, _ := json.Marshal(jsonMap)
 		log.Error(jsonMap)
@@ -78,3 +187,60 @@ func postGithub(request *restful.Request, response *restful.Response) {
 		return
 	}
 }
+
+func getAllWebhookDelivery(request *restful.Request, response *restful.Response) {
+	deliverySlice, err := webhook.GetStorage().LoadAllDelivery()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all webhook delivery failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	filteredDeliverySlice := make([]webhook.Delivery, 0)
+	for _, delivery := range deliverySlice {
+		if isResourceAuthorizedForRequest(request, resourcePathImageInformation, delivery.ImageInformation) {
+			filteredDeliverySlice = append(filteredDeliverySlice, delivery)
+		}
+	}
+
+	response.WriteJson(filteredDeliverySlice, "[]Delivery")
+}
+
+// Used by the authorization so the delivery is only shown to the user with the image information
+func getWebhookDeliveryImageInformation(id string) (string, error) {
+	delivery, err := webhook.GetStorage().LoadDelivery(id)
+	if err != nil {
+		return "", err
+	}
+	return delivery.ImageInformation, nil
+}
+
+func getWebhookDelivery(request *restful.Request, response *restful.Response) {
+	id := request.PathParameter("id")
+
+	delivery, err := webhook.GetStorage().LoadDelivery(id)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get webhook delivery failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["id"] = id
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(delivery, "Delivery")
+}
+
+func returns200AllWebhookDelivery(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []webhook.Delivery{})
+}
+
+func returns200WebhookDelivery(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", webhook.Delivery{})
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/secret"
+	"strings"
+	"time"
+)
+
+// The certificate the slb daemon uses to terminate TLS for the https ports
+type Certificate struct {
+	Name          string
+	Certificate   string   // PEM including the intermediate certificates
+	PrivateKey    string   // PEM
+	HostNameSlice []string // The DNS names in the certificate. Filled when saved.
+	ExpiredTime   time.Time
+}
+
+// Check the key pair and fill the names and expiration from the certificate
+func (certificate *Certificate) Parse() error {
+	keyPair, err := tls.X509KeyPair([]byte(certificate.Certificate), []byte(certificate.PrivateKey))
+	if err != nil {
+		return err
+	}
+	if len(keyPair.Certificate) == 0 {
+		return errors.New("No certificate is found in the PEM")
+	}
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	hostNameSlice := make([]string, 0)
+	hostNameSlice = append(hostNameSlice, leaf.DNSNames...)
+	if len(hostNameSlice) == 0 && leaf.Subject.CommonName != "" {
+		hostNameSlice = append(hostNameSlice, leaf.Subject.CommonName)
+	}
+	certificate.HostNameSlice = hostNameSlice
+	certificate.ExpiredTime = leaf.NotAfter
+	return nil
+}
+
+// The wildcard name only covers the single leftmost label like the browsers do
+func (certificate *Certificate) IsHostNameCovered(hostName string) bool {
+	hostName = strings.ToLower(hostName)
+	for _, certificateHostName := range certificate.HostNameSlice {
+		certificateHostName = strings.ToLower(certificateHostName)
+		if certificateHostName == hostName {
+			return true
+		}
+		if strings.HasPrefix(certificateHostName, "*.") {
+			index := strings.Index(hostName, ".")
+			if index > 0 && hostName[index:] == certificateHostName[1:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return a copy with the private key encrypted for the storage
+func getEncryptedCertificate(certificate *Certificate) (*Certificate, error) {
+	encryptedCertificate := *certificate
+	privateKey, err := secret.Encrypt(certificate.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptedCertificate.PrivateKey = privateKey
+	return &encryptedCertificate, nil
+}
+
+func decryptCertificate(certificate *Certificate) error {
+	privateKey, err := secret.Decrypt(certificate.PrivateKey)
+	if err != nil {
+		return err
+	}
+	certificate.PrivateKey = privateKey
+	return nil
+}
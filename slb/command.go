@@ -15,10 +15,13 @@
 package slb
 
 import (
+	"bytes"
+	"errors"
 	"github.com/cloudawan/cloudone/control"
 	"github.com/cloudawan/cloudone/deploy"
 	"github.com/cloudawan/cloudone/utility/configuration"
 	"github.com/cloudawan/cloudone_utility/slb"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -27,131 +30,419 @@ const (
 	BlueGreenDeploymentPrefix = "bg."
 )
 
-func CreateCommand() (*slb.Command, error) {
+// The command sent to the slb daemon. It extends the one of cloudone_utility with the TCP and TLS terminated services
+// and the virtual hosts in the same json so the slb daemon not knowing them still applies the HTTP services.
+type Command struct {
+	slb.Command
+	KubernetesServiceHTTPSSlice []KubernetesServiceHTTPS
+	KubernetesServiceTCPSlice   []KubernetesServiceTCP
+	VirtualHostSlice            []VirtualHost
+}
+
+// TLS is terminated on the slb and the request is forwarded to the node port as http
+type KubernetesServiceHTTPS struct {
+	Namespace       string
+	Name            string
+	Port            int
+	NodePort        int
+	CertificateName string
+	Certificate     string // PEM
+	PrivateKey      string // PEM
+}
+
+// Passed through without looking into the content
+type KubernetesServiceTCP struct {
+	Namespace  string
+	Name       string
+	Port       int
+	NodePort   int
+	ListenPort int // The node port is used since it is unique in the cluster
+}
+
+type VirtualHost struct {
+	HostName      string
+	PathRuleSlice []PathRule // Sorted with the longest path prefix first
+}
+
+type PathRule struct {
+	PathPrefix string
+	Namespace  string
+	Name       string
+	Protocol   string // http or https
+	Port       int
+	NodePort   int
+}
+
+type pathRuleSorter []PathRule
+
+func (pathRuleSlice pathRuleSorter) Len() int {
+	return len(pathRuleSlice)
+}
+
+func (pathRuleSlice pathRuleSorter) Less(i, j int) bool {
+	if len(pathRuleSlice[i].PathPrefix) != len(pathRuleSlice[j].PathPrefix) {
+		return len(pathRuleSlice[i].PathPrefix) > len(pathRuleSlice[j].PathPrefix)
+	}
+	return pathRuleSlice[i].PathPrefix < pathRuleSlice[j].PathPrefix
+}
+
+func (pathRuleSlice pathRuleSorter) Swap(i, j int) {
+	pathRuleSlice[i], pathRuleSlice[j] = pathRuleSlice[j], pathRuleSlice[i]
+}
+
+func (command *Command) hasPrivateKey() bool {
+	for _, kubernetesServiceHTTPS := range command.KubernetesServiceHTTPSSlice {
+		if kubernetesServiceHTTPS.PrivateKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	CommandSkippedEntryKindDeployment          = "deployment"
+	CommandSkippedEntryKindBlueGreenDeployment = "blueGreenDeployment"
+)
+
+// The broken deployment left out of the command so the others are still configured
+type CommandSkippedEntry struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Reason    string
+}
+
+// The state shared while creating a command
+type commandContext struct {
+	kubeApiServerEndPoint string
+	kubeApiServerToken    string
+	// The certificates are loaded once for all the services using them
+	certificateMap map[string]*Certificate
+	// The services in each namespace are listed once
+	serviceMapMap     map[string]map[string]control.Service
+	namespaceErrorMap map[string]error
+	skippedEntrySlice []CommandSkippedEntry
+}
+
+func (context *commandContext) getService(namespace string, name string) (*control.Service, error) {
+	if err, ok := context.namespaceErrorMap[namespace]; ok {
+		return nil, err
+	}
+
+	serviceMap, ok := context.serviceMapMap[namespace]
+	if ok == false {
+		serviceSlice, err := control.GetAllService(context.kubeApiServerEndPoint, context.kubeApiServerToken, namespace)
+		if err != nil {
+			log.Error("Get all service in namespace %s error: %s", namespace, err)
+			context.namespaceErrorMap[namespace] = err
+			return nil, err
+		}
+		serviceMap = make(map[string]control.Service)
+		for _, service := range serviceSlice {
+			serviceMap[service.Name] = service
+		}
+		context.serviceMapMap[namespace] = serviceMap
+	}
+
+	service, ok := serviceMap[name]
+	if ok == false {
+		return nil, errors.New("Service " + name + " doesn't exist in namespace " + namespace)
+	}
+	return &service, nil
+}
+
+func (context *commandContext) skip(kind string, namespace string, name string, err error) {
+	log.Error("Skip %s %s in namespace %s from the slb command with error: %s", kind, name, namespace, err)
+	context.skippedEntrySlice = append(context.skippedEntrySlice, CommandSkippedEntry{
+		kind,
+		namespace,
+		name,
+		err.Error(),
+	})
+}
+
+// Fail if no namespace could be listed since Kubernetes is broken rather than the deployments and
+// the slb daemons shouldn't be configured with nothing
+func (context *commandContext) checkKubernetesAvailable() error {
+	if len(context.namespaceErrorMap) == 0 || len(context.serviceMapMap) > 0 {
+		return nil
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString("Fail to get the services in all namespaces:")
+	namespaceSlice := make([]string, 0)
+	for namespace := range context.namespaceErrorMap {
+		namespaceSlice = append(namespaceSlice, namespace)
+	}
+	sort.Strings(namespaceSlice)
+	for _, namespace := range namespaceSlice {
+		buffer.WriteString(" " + namespace + " " + context.namespaceErrorMap[namespace].Error())
+	}
+	return errors.New(buffer.String())
+}
+
+func CreateCommand() (*Command, error) {
+	command, _, err := CreateCommandSkippingBrokenDeployment()
+	return command, err
+}
+
+// The deployments whose services or certificates could not be used are skipped and returned instead of failing the whole command
+func CreateCommandSkippingBrokenDeployment() (*Command, []CommandSkippedEntry, error) {
 	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, nil, err
+	}
+
+	command := &Command{
+		slb.Command{
+			time.Now(),
+			make([]slb.KubernetesServiceHTTP, 0),
+			nil,
+		},
+		make([]KubernetesServiceHTTPS, 0),
+		make([]KubernetesServiceTCP, 0),
+		make([]VirtualHost, 0),
 	}
 
-	command := &slb.Command{
-		time.Now(),
-		nil,
-		nil,
+	context := &commandContext{
+		kubeApiServerEndPoint,
+		kubeApiServerToken,
+		make(map[string]*Certificate),
+		make(map[string]map[string]control.Service),
+		make(map[string]error),
+		make([]CommandSkippedEntry, 0),
 	}
 
-	err = addCommandFromAllDeployInformation(command, kubeApiServerEndPoint, kubeApiServerToken)
+	err = addCommandFromAllDeployInformation(command, context)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	err = addCommandFromAllBlueGreenDeployment(command, kubeApiServerEndPoint, kubeApiServerToken)
+	err = addCommandFromAllBlueGreenDeployment(command, context)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, nil, err
+	}
+
+	err = context.checkKubernetesAvailable()
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
 	}
 
-	return command, nil
+	return command, context.skippedEntrySlice, nil
 }
 
-func addCommandFromAllDeployInformation(command *slb.Command, kubeApiServerEndPoint string, kubeApiServerToken string) error {
+func addCommandFromAllDeployInformation(command *Command, context *commandContext) error {
 	deployInformationSlice, err := deploy.GetStorage().LoadAllDeployInformation()
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	kubernetesServiceHTTPSlice := make([]slb.KubernetesServiceHTTP, 0)
+	pathRuleSliceMap := make(map[string][]PathRule)
 
 	for _, deployInformation := range deployInformationSlice {
-		service, err := control.GetService(kubeApiServerEndPoint, kubeApiServerToken, deployInformation.Namespace, deployInformation.ImageInformationName)
+		service, err := context.getService(deployInformation.Namespace, deployInformation.ImageInformationName)
 		if err != nil {
-			log.Error(err)
-			return err
+			context.skip(CommandSkippedEntryKindDeployment, deployInformation.Namespace, deployInformation.ImageInformationName, err)
+			continue
 		}
 
-		for _, servicePort := range service.PortSlice {
-			// Get protocol
-			protocol := ""
-			for _, containerPort := range deployInformation.ContainerPortSlice {
-				if servicePort.TargetPort == strconv.Itoa(containerPort.ContainerPort) {
-					protocol = containerPort.Protocol
-				}
-			}
-			// HTTP
-			if protocol == deploy.ProtocolTypeHTTP && servicePort.NodePort >= 0 {
-				kubernetesServiceHTTP := slb.KubernetesServiceHTTP{
-					deployInformation.Namespace,
-					deployInformation.ImageInformationName,
-					servicePort.Port,
-					servicePort.NodePort,
-				}
-
-				kubernetesServiceHTTPSlice = append(kubernetesServiceHTTPSlice, kubernetesServiceHTTP)
-			}
+		err = addCommandFromServicePort(command, deployInformation.Namespace, deployInformation.ImageInformationName,
+			service.PortSlice, &deployInformation, context.certificateMap)
+		if err != nil {
+			context.skip(CommandSkippedEntryKindDeployment, deployInformation.Namespace, deployInformation.ImageInformationName, err)
+			continue
 		}
+
+		addPathRuleFromDeployInformation(pathRuleSliceMap, service.PortSlice, &deployInformation)
+	}
+
+	hostNameSlice := make([]string, 0)
+	for hostName := range pathRuleSliceMap {
+		hostNameSlice = append(hostNameSlice, hostName)
 	}
+	sort.Strings(hostNameSlice)
 
-	if command.KubernetesServiceHTTPSlice == nil {
-		command.KubernetesServiceHTTPSlice = kubernetesServiceHTTPSlice
-	} else {
-		command.KubernetesServiceHTTPSlice = append(command.KubernetesServiceHTTPSlice, kubernetesServiceHTTPSlice...)
+	for _, hostName := range hostNameSlice {
+		pathRuleSlice := pathRuleSliceMap[hostName]
+		sort.Sort(pathRuleSorter(pathRuleSlice))
+		command.VirtualHostSlice = append(command.VirtualHostSlice, VirtualHost{
+			hostName,
+			pathRuleSlice,
+		})
 	}
 
 	return nil
 }
 
-func addCommandFromAllBlueGreenDeployment(command *slb.Command, kubeApiServerEndPoint string, kubeApiServerToken string) error {
+func addCommandFromAllBlueGreenDeployment(command *Command, context *commandContext) error {
 	deployBlueGreenSlice, err := deploy.GetStorage().LoadAllDeployBlueGreen()
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	kubernetesServiceHTTPSlice := make([]slb.KubernetesServiceHTTP, 0)
-
 	for _, deployBlueGreen := range deployBlueGreenSlice {
 		deployInformation, err := deploy.GetStorage().LoadDeployInformation(deployBlueGreen.Namespace, deployBlueGreen.ImageInformation)
 		if err != nil {
-			log.Error(err)
-			return err
+			context.skip(CommandSkippedEntryKindBlueGreenDeployment, deployBlueGreen.Namespace, deployBlueGreen.ImageInformation, err)
+			continue
 		}
 
 		serviceName := deploy.GetBlueGreenServiceName(deployBlueGreen.ImageInformation)
-		service, err := control.GetService(kubeApiServerEndPoint, kubeApiServerToken, deployBlueGreen.Namespace, serviceName)
+		service, err := context.getService(deployBlueGreen.Namespace, serviceName)
 		if err != nil {
-			log.Error(err)
-			return err
+			context.skip(CommandSkippedEntryKindBlueGreenDeployment, deployBlueGreen.Namespace, deployBlueGreen.ImageInformation, err)
+			continue
 		}
 
-		for _, servicePort := range service.PortSlice {
-			// Get protocol
-			protocol := ""
-			for _, containerPort := range deployInformation.ContainerPortSlice {
-				if servicePort.TargetPort == strconv.Itoa(containerPort.ContainerPort) {
-					protocol = containerPort.Protocol
-				}
-			}
-			// HTTP
-			if protocol == deploy.ProtocolTypeHTTP && servicePort.NodePort >= 0 {
-				kubernetesServiceHTTP := slb.KubernetesServiceHTTP{
-					deployBlueGreen.Namespace,
-					BlueGreenDeploymentPrefix + deployBlueGreen.ImageInformation,
-					servicePort.Port,
-					servicePort.NodePort,
-				}
+		// The virtual hosts belong to the deployment so the blue green one is reached by the prefixed name only
+		err = addCommandFromServicePort(command, deployBlueGreen.Namespace, BlueGreenDeploymentPrefix+deployBlueGreen.ImageInformation,
+			service.PortSlice, deployInformation, context.certificateMap)
+		if err != nil {
+			context.skip(CommandSkippedEntryKindBlueGreenDeployment, deployBlueGreen.Namespace, deployBlueGreen.ImageInformation, err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+func getDeployContainerPort(deployInformation *deploy.DeployInformation, targetPort string) *deploy.DeployContainerPort {
+	for i, containerPort := range deployInformation.ContainerPortSlice {
+		if targetPort == strconv.Itoa(containerPort.ContainerPort) {
+			return &deployInformation.ContainerPortSlice[i]
+		}
+	}
+	return nil
+}
+
+func getCertificate(certificateMap map[string]*Certificate, name string) (*Certificate, error) {
+	if certificate, ok := certificateMap[name]; ok {
+		return certificate, nil
+	}
+
+	certificate, err := GetStorage().LoadCertificate(name)
+	if err != nil {
+		log.Error("Load slb certificate %s error: %s", name, err)
+		return nil, err
+	}
+	certificateMap[name] = certificate
+	return certificate, nil
+}
 
-				kubernetesServiceHTTPSlice = append(kubernetesServiceHTTPSlice, kubernetesServiceHTTP)
+func addCommandFromServicePort(command *Command, namespace string, name string, servicePortSlice []control.ServicePort,
+	deployInformation *deploy.DeployInformation, certificateMap map[string]*Certificate) error {
+	// Load all the certificates first so the service is either added completely or not at all
+	for _, servicePort := range servicePortSlice {
+		if servicePort.NodePort < 0 {
+			continue
+		}
+		containerPort := getDeployContainerPort(deployInformation, servicePort.TargetPort)
+		if containerPort != nil && containerPort.Protocol == deploy.ProtocolTypeHTTPS && containerPort.CertificateName != "" {
+			_, err := getCertificate(certificateMap, containerPort.CertificateName)
+			if err != nil {
+				return err
 			}
 		}
 	}
 
-	if command.KubernetesServiceHTTPSlice == nil {
-		command.KubernetesServiceHTTPSlice = kubernetesServiceHTTPSlice
-	} else {
-		command.KubernetesServiceHTTPSlice = append(command.KubernetesServiceHTTPSlice, kubernetesServiceHTTPSlice...)
+	for _, servicePort := range servicePortSlice {
+		if servicePort.NodePort < 0 {
+			continue
+		}
+		containerPort := getDeployContainerPort(deployInformation, servicePort.TargetPort)
+		if containerPort == nil {
+			continue
+		}
+
+		switch {
+		case containerPort.Protocol == deploy.ProtocolTypeHTTP:
+			command.KubernetesServiceHTTPSlice = append(command.KubernetesServiceHTTPSlice, slb.KubernetesServiceHTTP{
+				namespace,
+				name,
+				servicePort.Port,
+				servicePort.NodePort,
+			})
+		case containerPort.Protocol == deploy.ProtocolTypeHTTPS && containerPort.CertificateName != "":
+			certificate, err := getCertificate(certificateMap, containerPort.CertificateName)
+			if err != nil {
+				return err
+			}
+			command.KubernetesServiceHTTPSSlice = append(command.KubernetesServiceHTTPSSlice, KubernetesServiceHTTPS{
+				namespace,
+				name,
+				servicePort.Port,
+				servicePort.NodePort,
+				certificate.Name,
+				certificate.Certificate,
+				certificate.PrivateKey,
+			})
+		default:
+			// The other protocols and https without the certificate are passed through
+			command.KubernetesServiceTCPSlice = append(command.KubernetesServiceTCPSlice, KubernetesServiceTCP{
+				namespace,
+				name,
+				servicePort.Port,
+				servicePort.NodePort,
+				servicePort.NodePort,
+			})
+		}
 	}
 
 	return nil
 }
+
+func addPathRuleFromDeployInformation(pathRuleSliceMap map[string][]PathRule, servicePortSlice []control.ServicePort, deployInformation *deploy.DeployInformation) {
+	if len(deployInformation.HostNameSlice) == 0 {
+		return
+	}
+
+	pathRuleSlice := make([]PathRule, 0)
+	for _, servicePort := range servicePortSlice {
+		if servicePort.NodePort < 0 {
+			continue
+		}
+		containerPort := getDeployContainerPort(deployInformation, servicePort.TargetPort)
+		if containerPort == nil {
+			continue
+		}
+		if containerPort.Protocol != deploy.ProtocolTypeHTTP && containerPort.Protocol != deploy.ProtocolTypeHTTPS {
+			continue
+		}
+
+		if len(deployInformation.PathRuleSlice) == 0 {
+			// All paths go to the first http or https port
+			pathRuleSlice = append(pathRuleSlice, PathRule{
+				"/",
+				deployInformation.Namespace,
+				deployInformation.ImageInformationName,
+				containerPort.Protocol,
+				servicePort.Port,
+				servicePort.NodePort,
+			})
+			break
+		}
+
+		for _, deployPathRule := range deployInformation.PathRuleSlice {
+			if deployPathRule.ContainerPort == containerPort.ContainerPort {
+				pathRuleSlice = append(pathRuleSlice, PathRule{
+					deployPathRule.PathPrefix,
+					deployInformation.Namespace,
+					deployInformation.ImageInformationName,
+					containerPort.Protocol,
+					servicePort.Port,
+					servicePort.NodePort,
+				})
+			}
+		}
+	}
+
+	for _, hostName := range deployInformation.HostNameSlice {
+		pathRuleSliceMap[hostName] = append(pathRuleSliceMap[hostName], pathRuleSlice...)
+	}
+}
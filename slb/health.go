@@ -0,0 +1,296 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone/notification"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SLBDaemonHealthCheckTimeout = time.Second * 5
+	// Notify when an endpoint stays unreachable for this long
+	SLBDaemonUnreachableNotificationDuration = time.Minute * 3
+	// Avoid pushing again and again to the endpoint which keeps reporting another command
+	SLBDaemonRepushMinimumInterval = time.Minute
+)
+
+type SLBDaemonEndPointHealth struct {
+	Name                       string // The name of the slb daemon
+	EndPoint                   string
+	Alive                      bool
+	LastCheckTime              time.Time
+	LastAliveTime              time.Time
+	UnreachableSinceTime       time.Time // Zero if alive
+	UnreachableNotified        bool
+	AppliedCommandCreatedTime  time.Time
+	AppliedCommandHash         string
+	ExpectedCommandCreatedTime time.Time // Zero if no command is created yet
+	ExpectedCommandHash        string    // Empty if no command is created yet
+	Drift                      bool
+	LastRepushTime             time.Time
+	LastError                  string
+}
+
+var healthMutex = &sync.Mutex{}
+var slbDaemonEndPointHealthMap = make(map[string]*SLBDaemonEndPointHealth)
+
+func getSLBDaemonEndPointHealthKey(name string, endPoint string) string {
+	return name + " " + endPoint
+}
+
+// The command reported by the slb daemon as the json object so the fields the slb daemon keeps are all compared
+func getAppliedCommand(endPoint string) (map[string]interface{}, error) {
+	httpClient := &http.Client{Timeout: SLBDaemonHealthCheckTimeout}
+	response, err := httpClient.Get(endPoint + "/api/v1/slb")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New("Unexpected status code " + strconv.Itoa(response.StatusCode))
+	}
+
+	jsonMap := make(map[string]interface{})
+	err = json.NewDecoder(response.Body).Decode(&jsonMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonMap, nil
+}
+
+// The hash of the content without the created time which changes every time the same command is created again.
+// The null and the empty values are left out so they are the same no matter how the slb daemon serializes them.
+func getCommandContentHash(jsonMap map[string]interface{}) (string, error) {
+	contentJsonMap := make(map[string]interface{})
+	for key, value := range jsonMap {
+		if key != "CreatedTime" {
+			contentJsonMap[key] = value
+		}
+	}
+
+	byteSlice, err := json.Marshal(removeEmptyJsonValue(contentJsonMap))
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(byteSlice)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func removeEmptyJsonValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		jsonMap := make(map[string]interface{})
+		for key, fieldValue := range typedValue {
+			fieldValue = removeEmptyJsonValue(fieldValue)
+			if fieldValue != nil {
+				jsonMap[key] = fieldValue
+			}
+		}
+		return jsonMap
+	case []interface{}:
+		if len(typedValue) == 0 {
+			return nil
+		}
+		jsonSlice := make([]interface{}, 0)
+		for _, elementValue := range typedValue {
+			jsonSlice = append(jsonSlice, removeEmptyJsonValue(elementValue))
+		}
+		return jsonSlice
+	default:
+		return value
+	}
+}
+
+// The command the endpoint is expected to apply with the node hosts of the slb daemon like SendCommand
+func getExpectedCommandContentHash(slbDaemon SLBDaemon, expectedCommand *Command) (string, error) {
+	slbDaemonCommand := *expectedCommand
+	slbDaemonCommand.NodeHostSlice = slbDaemon.NodeHostSlice
+
+	byteSlice, err := json.Marshal(slbDaemonCommand)
+	if err != nil {
+		return "", err
+	}
+	jsonMap := make(map[string]interface{})
+	err = json.Unmarshal(byteSlice, &jsonMap)
+	if err != nil {
+		return "", err
+	}
+
+	return getCommandContentHash(jsonMap)
+}
+
+// Poll every endpoint of the slb daemons. The latest command is pushed again to the drifted ones and
+// the notifiers of the slb daemon are notified when an endpoint stays unreachable and when it recovers.
+func CheckAllSLBDaemonHealth() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("Check slb daemon health error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	slbDaemonSlice, err := GetStorage().LoadAllSLBDaemon()
+	if err != nil {
+		log.Error("Load all slb daemon error: %s", err)
+		return
+	}
+
+	expectedCommand := getLatestCommand()
+
+	existingKeyMap := make(map[string]bool)
+	for _, slbDaemon := range slbDaemonSlice {
+		for _, endPoint := range slbDaemon.EndPointSlice {
+			key := getSLBDaemonEndPointHealthKey(slbDaemon.Name, endPoint)
+			existingKeyMap[key] = true
+
+			healthMutex.Lock()
+			health := SLBDaemonEndPointHealth{}
+			oldHealth, ok := slbDaemonEndPointHealthMap[key]
+			if ok {
+				health = *oldHealth
+			} else {
+				health.Name = slbDaemon.Name
+				health.EndPoint = endPoint
+			}
+			healthMutex.Unlock()
+
+			checkSLBDaemonEndPointHealth(slbDaemon, &health, expectedCommand)
+
+			healthMutex.Lock()
+			slbDaemonEndPointHealthMap[key] = &health
+			healthMutex.Unlock()
+		}
+	}
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	for key := range slbDaemonEndPointHealthMap {
+		if existingKeyMap[key] == false {
+			// Forget the deleted slb daemons and endpoints
+			delete(slbDaemonEndPointHealthMap, key)
+		}
+	}
+}
+
+func checkSLBDaemonEndPointHealth(slbDaemon SLBDaemon, health *SLBDaemonEndPointHealth, expectedCommand *Command) {
+	appliedCommandJsonMap, err := getAppliedCommand(health.EndPoint)
+	appliedCommandHash := ""
+	if err == nil {
+		appliedCommandHash, err = getCommandContentHash(appliedCommandJsonMap)
+	}
+
+	currentTime := time.Now()
+	health.LastCheckTime = currentTime
+	if err != nil {
+		if health.Alive || health.UnreachableSinceTime.IsZero() {
+			health.UnreachableSinceTime = currentTime
+		}
+		health.Alive = false
+		health.LastError = err.Error()
+
+		unreachableDuration := currentTime.Sub(health.UnreachableSinceTime)
+		if health.UnreachableNotified == false && unreachableDuration >= SLBDaemonUnreachableNotificationDuration {
+			log.Error("Slb daemon %s endpoint %s is unreachable for %s: %s", health.Name, health.EndPoint, unreachableDuration, err)
+			message := "Slb daemon " + health.Name + " endpoint " + health.EndPoint + " is unreachable since " +
+				health.UnreachableSinceTime.Format(time.RFC3339) + " with error " + err.Error() + "\n"
+			err := notification.Notify(slbDaemon.NotifierSlice, message)
+			if err != nil {
+				log.Error("Notify slb daemon %s unreachable error: %s", health.Name, err)
+			}
+			// Notify once until it recovers
+			health.UnreachableNotified = true
+		}
+		return
+	}
+
+	if health.UnreachableNotified {
+		log.Info("Slb daemon %s endpoint %s recovers", health.Name, health.EndPoint)
+		message := "Slb daemon " + health.Name + " endpoint " + health.EndPoint + " recovers after being unreachable since " +
+			health.UnreachableSinceTime.Format(time.RFC3339) + "\n"
+		err := notification.Notify(slbDaemon.NotifierSlice, message)
+		if err != nil {
+			log.Error("Notify slb daemon %s recovery error: %s", health.Name, err)
+		}
+		health.UnreachableNotified = false
+	}
+
+	health.Alive = true
+	health.LastAliveTime = currentTime
+	health.UnreachableSinceTime = time.Time{}
+	health.AppliedCommandCreatedTime = time.Time{}
+	if createdTimeText, ok := appliedCommandJsonMap["CreatedTime"].(string); ok {
+		health.AppliedCommandCreatedTime, _ = time.Parse(time.RFC3339Nano, createdTimeText)
+	}
+	health.AppliedCommandHash = appliedCommandHash
+	health.LastError = ""
+
+	if expectedCommand == nil {
+		// Nothing to compare before the command is created
+		health.Drift = false
+		return
+	}
+
+	expectedCommandHash, err := getExpectedCommandContentHash(slbDaemon, expectedCommand)
+	if err != nil {
+		log.Error("Get the content hash of the expected command for slb daemon %s error: %s", health.Name, err)
+		health.LastError = err.Error()
+		return
+	}
+
+	health.ExpectedCommandCreatedTime = expectedCommand.CreatedTime
+	health.ExpectedCommandHash = expectedCommandHash
+	health.Drift = appliedCommandHash != expectedCommandHash
+	if health.Drift && currentTime.Sub(health.LastRepushTime) >= SLBDaemonRepushMinimumInterval {
+		log.Info("Slb daemon %s endpoint %s applies the command with content hash %s instead of %s. Push again.",
+			health.Name, health.EndPoint, appliedCommandHash, expectedCommandHash)
+		health.LastRepushTime = currentTime
+		err := SendCommandToSLBDaemon(health.EndPoint)
+		if err != nil {
+			log.Error("Push the command to slb daemon %s endpoint %s error: %s", health.Name, health.EndPoint, err)
+			health.LastError = err.Error()
+		}
+	}
+}
+
+func GetAllSLBDaemonEndPointHealth() []SLBDaemonEndPointHealth {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	keySlice := make([]string, 0)
+	for key := range slbDaemonEndPointHealthMap {
+		keySlice = append(keySlice, key)
+	}
+	sort.Strings(keySlice)
+
+	healthSlice := make([]SLBDaemonEndPointHealth, 0)
+	for _, key := range keySlice {
+		healthSlice = append(healthSlice, *slbDaemonEndPointHealthMap[key])
+	}
+
+	return healthSlice
+}
@@ -0,0 +1,263 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slb
+
+import (
+	"github.com/cloudawan/cloudone/control"
+	"github.com/cloudawan/cloudone/deploy"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Wait until the changes stop for a while so a burst of changes is pushed once
+	ReconfigurationDebounceDuration = time.Second * 3
+	// Push anyway if the changes keep coming for this long
+	ReconfigurationMaximumDelay         = time.Second * 30
+	ReconfigurationRetryMinimumInterval = time.Second * 5
+	ReconfigurationRetryMaximumInterval = time.Minute * 5
+)
+
+type SLBDaemonConfigurationStatus struct {
+	Name              string
+	AppliedGeneration uint64 // The generation of the command last applied successfully
+	LastSuccessTime   time.Time
+	LastFailureTime   time.Time
+	LastError         string
+	FailureAmount     int // The consecutive failures since the last success
+	NextRetryTime     time.Time
+}
+
+type ConfigurationStatus struct {
+	Generation                        uint64 // Increases every time the command is created from the current deployments
+	GeneratedTime                     time.Time
+	LastError                         string                // The error to create the command
+	SkippedEntrySlice                 []CommandSkippedEntry // The broken deployments left out of the latest command
+	SLBDaemonConfigurationStatusSlice []SLBDaemonConfigurationStatus
+}
+
+var reconfigurationMutex = &sync.Mutex{}
+
+// Zero if no reconfiguration is requested
+var firstRequestTime time.Time
+var lastRequestTime time.Time
+var latestCommand *Command = nil
+var configurationStatus = ConfigurationStatus{}
+var commandFailureAmount = 0
+var commandNextRetryTime time.Time
+
+// Zero if all the slb daemons apply the latest generation
+var nextSendTime time.Time
+var slbDaemonConfigurationStatusMap = make(map[string]*SLBDaemonConfigurationStatus)
+
+func init() {
+	deploy.AddDeploymentChangeListener(RequestReconfiguration)
+	// The node ports could be changed outside of the deployments
+	control.AddKubernetesEventListener(func(kubernetesEvent control.KubernetesEvent) {
+		if kubernetesEvent.Resource == control.InformerResourceService {
+			RequestReconfiguration()
+		}
+	})
+}
+
+// Ask to push the command created from the current deployments to all the slb daemons.
+// It only records the request and the periodical ReconfigureSLBDaemon pushes it.
+func RequestReconfiguration() {
+	reconfigurationMutex.Lock()
+	defer reconfigurationMutex.Unlock()
+
+	currentTime := time.Now()
+	if firstRequestTime.IsZero() {
+		firstRequestTime = currentTime
+	}
+	lastRequestTime = currentTime
+}
+
+// Called periodically to create the new generation once the requests settle and to retry the failures
+func ReconfigureSLBDaemon() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("Reconfigure slb daemon error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	currentTime := time.Now()
+
+	reconfigurationMutex.Lock()
+	newGeneration := false
+	if firstRequestTime.IsZero() == false {
+		if currentTime.Sub(lastRequestTime) >= ReconfigurationDebounceDuration ||
+			currentTime.Sub(firstRequestTime) >= ReconfigurationMaximumDelay {
+			newGeneration = true
+			firstRequestTime = time.Time{}
+			lastRequestTime = time.Time{}
+		}
+	}
+	commandRetry := commandFailureAmount > 0 && currentTime.After(commandNextRetryTime)
+	sendRetry := nextSendTime.IsZero() == false && currentTime.After(nextSendTime)
+	reconfigurationMutex.Unlock()
+
+	if newGeneration || commandRetry {
+		if createLatestCommand() == false {
+			return
+		}
+	} else if sendRetry == false {
+		return
+	}
+
+	sendLatestCommand()
+}
+
+func getRetryInterval(failureAmount int) time.Duration {
+	retryInterval := ReconfigurationRetryMinimumInterval
+	for i := 1; i < failureAmount; i++ {
+		retryInterval *= 2
+		if retryInterval >= ReconfigurationRetryMaximumInterval {
+			return ReconfigurationRetryMaximumInterval
+		}
+	}
+	return retryInterval
+}
+
+func createLatestCommand() bool {
+	command, skippedEntrySlice, err := CreateCommandSkippingBrokenDeployment()
+
+	reconfigurationMutex.Lock()
+	defer reconfigurationMutex.Unlock()
+
+	currentTime := time.Now()
+	if err != nil {
+		log.Error("Create slb command error: %s", err)
+		commandFailureAmount++
+		commandNextRetryTime = currentTime.Add(getRetryInterval(commandFailureAmount))
+		configurationStatus.LastError = err.Error()
+		return false
+	}
+
+	commandFailureAmount = 0
+	latestCommand = command
+	configurationStatus.Generation++
+	configurationStatus.GeneratedTime = currentTime
+	configurationStatus.LastError = ""
+	configurationStatus.SkippedEntrySlice = skippedEntrySlice
+	return true
+}
+
+// Send to the slb daemons not applying the latest generation yet and due to retry
+func sendLatestCommand() {
+	reconfigurationMutex.Lock()
+	command := latestCommand
+	generation := configurationStatus.Generation
+	reconfigurationMutex.Unlock()
+
+	if command == nil {
+		return
+	}
+
+	slbDaemonSlice, err := GetStorage().LoadAllSLBDaemon()
+	if err != nil {
+		log.Error(err)
+		reconfigurationMutex.Lock()
+		nextSendTime = time.Now().Add(ReconfigurationRetryMinimumInterval)
+		reconfigurationMutex.Unlock()
+		return
+	}
+
+	existingNameMap := make(map[string]bool)
+	for _, slbDaemon := range slbDaemonSlice {
+		existingNameMap[slbDaemon.Name] = true
+
+		reconfigurationMutex.Lock()
+		status, ok := slbDaemonConfigurationStatusMap[slbDaemon.Name]
+		if ok == false {
+			status = &SLBDaemonConfigurationStatus{}
+			status.Name = slbDaemon.Name
+			slbDaemonConfigurationStatusMap[slbDaemon.Name] = status
+		}
+		due := status.AppliedGeneration < generation && time.Now().Before(status.NextRetryTime) == false
+		reconfigurationMutex.Unlock()
+
+		if due == false {
+			continue
+		}
+
+		// Each daemon sets its own node hosts
+		slbDaemonCommand := *command
+		err := slbDaemon.SendCommand(&slbDaemonCommand)
+
+		reconfigurationMutex.Lock()
+		currentTime := time.Now()
+		if err != nil {
+			log.Error("Configure slb daemon %s with generation %d error: %s", slbDaemon.Name, generation, err)
+			status.FailureAmount++
+			status.LastFailureTime = currentTime
+			status.LastError = err.Error()
+			status.NextRetryTime = currentTime.Add(getRetryInterval(status.FailureAmount))
+		} else {
+			status.AppliedGeneration = generation
+			status.FailureAmount = 0
+			status.LastSuccessTime = currentTime
+			status.LastError = ""
+			status.NextRetryTime = time.Time{}
+		}
+		reconfigurationMutex.Unlock()
+	}
+
+	reconfigurationMutex.Lock()
+	defer reconfigurationMutex.Unlock()
+
+	nextSendTime = time.Time{}
+	for name, status := range slbDaemonConfigurationStatusMap {
+		if existingNameMap[name] == false {
+			// Forget the deleted slb daemons
+			delete(slbDaemonConfigurationStatusMap, name)
+		} else if status.AppliedGeneration < generation {
+			if nextSendTime.IsZero() || status.NextRetryTime.Before(nextSendTime) {
+				nextSendTime = status.NextRetryTime
+			}
+		}
+	}
+}
+
+// Nil if the command is never created successfully
+func getLatestCommand() *Command {
+	reconfigurationMutex.Lock()
+	defer reconfigurationMutex.Unlock()
+
+	return latestCommand
+}
+
+func GetConfigurationStatus() ConfigurationStatus {
+	reconfigurationMutex.Lock()
+	defer reconfigurationMutex.Unlock()
+
+	nameSlice := make([]string, 0)
+	for name := range slbDaemonConfigurationStatusMap {
+		nameSlice = append(nameSlice, name)
+	}
+	sort.Strings(nameSlice)
+
+	returnedConfigurationStatus := configurationStatus
+	returnedConfigurationStatus.SLBDaemonConfigurationStatusSlice = make([]SLBDaemonConfigurationStatus, 0)
+	for _, name := range nameSlice {
+		returnedConfigurationStatus.SLBDaemonConfigurationStatusSlice = append(
+			returnedConfigurationStatus.SLBDaemonConfigurationStatusSlice, *slbDaemonConfigurationStatusMap[name])
+	}
+
+	return returnedConfigurationStatus
+}
@@ -17,8 +17,9 @@ package slb
 import (
 	"bytes"
 	"errors"
+	"github.com/cloudawan/cloudone/notification"
 	"github.com/cloudawan/cloudone_utility/restclient"
-	"github.com/cloudawan/cloudone_utility/slb"
+	"strings"
 )
 
 type SLBDaemon struct {
@@ -26,13 +27,22 @@ type SLBDaemon struct {
 	EndPointSlice []string
 	NodeHostSlice []string
 	Description   string
+	NotifierSlice []notification.NotifierSerializable // Notified when an endpoint stays unreachable
 }
 
-func (slbDaemon *SLBDaemon) SendCommand(command *slb.Command) error {
+func (slbDaemon *SLBDaemon) SendCommand(command *Command) error {
 	command.NodeHostSlice = slbDaemon.NodeHostSlice
 
+	// The private keys of the TLS terminated services are never sent in plain
+	hasPrivateKey := command.hasPrivateKey()
+
 	buffer := bytes.Buffer{}
 	for _, endPoint := range slbDaemon.EndPointSlice {
+		if hasPrivateKey && strings.HasPrefix(strings.ToLower(endPoint), "https://") == false {
+			log.Error("Endpoint %s of slb daemon %s is not https to send the private keys", endPoint, slbDaemon.Name)
+			buffer.WriteString("Fail to configure " + endPoint + " with error the endpoint needs to be https to send the private keys\n")
+			continue
+		}
 		url := endPoint + "/api/v1/slb"
 		_, err := restclient.RequestPut(url, command, nil, false)
 		if err != nil {
@@ -77,32 +87,32 @@ func SendCommandToAllSLBDaemon() error {
 	}
 }
 
-// Used for failed slb host to reconfigure
+// Used for failed slb host to reconfigure. The latest command is sent so the daemon applies the same one as the others.
 func SendCommandToSLBDaemon(targetEndPoint string) error {
 	slbDaemonSlice, err := GetStorage().LoadAllSLBDaemon()
 	if err != nil {
 		log.Error(err)
-		return nil
+		return err
 	}
 
-	command, err := CreateCommand()
-	if err != nil {
-		log.Error(err)
-		return nil
+	command := getLatestCommand()
+	if command == nil {
+		command, err = CreateCommand()
+		if err != nil {
+			log.Error(err)
+			return err
+		}
 	}
 
 	for _, slbDaemon := range slbDaemonSlice {
 		for _, endPoint := range slbDaemon.EndPointSlice {
 			if endPoint == targetEndPoint {
-				command.NodeHostSlice = slbDaemon.NodeHostSlice
-				url := endPoint + "/api/v1/slb"
-				_, err := restclient.RequestPut(url, command, nil, false)
-				if err != nil {
-					log.Error(err)
-					return errors.New("Fail to configure " + endPoint + "with error " + err.Error() + "\n")
-				} else {
-					return nil
-				}
+				// The latest command is shared so the node hosts are set on a copy.
+				// Send through the daemon with only the target endpoint so the private keys are checked the same way.
+				slbDaemonCommand := *command
+				targetSLBDaemon := slbDaemon
+				targetSLBDaemon.EndPointSlice = []string{endPoint}
+				return targetSLBDaemon.SendCommand(&slbDaemonCommand)
 			}
 		}
 	}
@@ -82,4 +82,8 @@ type Storage interface {
 	SaveSLBDaemon(slbDaemon *SLBDaemon) error
 	LoadSLBDaemon(name string) (*SLBDaemon, error)
 	LoadAllSLBDaemon() ([]SLBDaemon, error)
+	DeleteCertificate(name string) error
+	SaveCertificate(certificate *Certificate) error
+	LoadCertificate(name string) (*Certificate, error)
+	LoadAllCertificate() ([]Certificate, error)
 }
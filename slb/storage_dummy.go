@@ -65,3 +65,19 @@ func (storageDummy *StorageDummy) LoadSLBDaemon(name string) (*SLBDaemon, error)
 func (storageDummy *StorageDummy) LoadAllSLBDaemon() ([]SLBDaemon, error) {
 	return nil, &storageDummy.dummyError
 }
+
+func (storageDummy *StorageDummy) DeleteCertificate(name string) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) SaveCertificate(certificate *Certificate) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadCertificate(name string) (*Certificate, error) {
+	return nil, &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) LoadAllCertificate() ([]Certificate, error) {
+	return nil, &storageDummy.dummyError
+}
@@ -30,6 +30,11 @@ func (storageEtcd *StorageEtcd) initialize() error {
 		return err
 	}
 
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/slb_certificate"); err != nil {
+		log.Error("Create if not existing slb certificate directory error: %s", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -134,3 +139,121 @@ func (storageEtcd *StorageEtcd) LoadAllSLBDaemon() ([]SLBDaemon, error) {
 
 	return slbDaemonSlice, nil
 }
+
+func (storageEtcd *StorageEtcd) DeleteCertificate(name string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/slb_certificate/"+name, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		log.Debug(response)
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete slb certificate with name %s error: %s", name, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveCertificate(certificate *Certificate) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	encryptedCertificate, err := getEncryptedCertificate(certificate)
+	if err != nil {
+		log.Error("Encrypt slb certificate %s error %s", certificate.Name, err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(encryptedCertificate)
+	if err != nil {
+		log.Error("Marshal slb certificate %s error %s", certificate.Name, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/slb_certificate/"+certificate.Name, string(byteSlice), nil)
+	if err != nil {
+		log.Error("Save slb certificate %s error: %s", certificate.Name, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadCertificate(name string) (*Certificate, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/slb_certificate/"+name, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, etcdError
+	}
+	if err != nil {
+		log.Error("Load slb certificate with name %s error: %s", name, err)
+		log.Error(response)
+		return nil, err
+	}
+
+	certificate := new(Certificate)
+	err = json.Unmarshal([]byte(response.Node.Value), &certificate)
+	if err != nil {
+		log.Error("Unmarshal slb certificate with name %s error %s", name, err)
+		return nil, err
+	}
+	err = decryptCertificate(certificate)
+	if err != nil {
+		log.Error("Decrypt slb certificate %s error %s", name, err)
+		return nil, err
+	}
+
+	return certificate, nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAllCertificate() ([]Certificate, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/slb_certificate", nil)
+	if err != nil {
+		log.Error("Load all slb certificate error: %s", err)
+		log.Error(response)
+		return nil, err
+	}
+
+	certificateSlice := make([]Certificate, 0)
+	for _, node := range response.Node.Nodes {
+		certificate := Certificate{}
+		err := json.Unmarshal([]byte(node.Value), &certificate)
+		if err != nil {
+			log.Error("Unmarshal slb certificate %s error %s", node.Key, err)
+			return nil, err
+		}
+		err = decryptCertificate(&certificate)
+		if err != nil {
+			log.Error("Decrypt slb certificate %s error %s", node.Key, err)
+			return nil, err
+		}
+		certificateSlice = append(certificateSlice, certificate)
+	}
+
+	return certificateSlice, nil
+}
@@ -15,28 +15,92 @@
 package lock
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/cloudawan/cloudone_utility/logger"
 	"github.com/coreos/etcd/client"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 )
 
 const (
-	LockDefaultTimeout       = time.Hour
-	ReleaseLockRetryAmount   = 3
-	ReleaseLockRetryInterval = time.Second * 10
+	LockDefaultTimeout        = time.Hour
+	LockDefaultRenewalTimeout = time.Minute * 5
+	ReleaseLockRetryAmount    = 3
+	ReleaseLockRetryInterval  = time.Second * 10
+	RenewalAmountPerTimeout   = 3
 )
 
+// The owner of the locks acquired by this instance
+var ownerID = getOwnerID()
+
+// The lock is held by the others
+type LockHeldError struct {
+	text string
+}
+
+func (lockHeldError *LockHeldError) Error() string {
+	return lockHeldError.text
+}
+
+// The lock is expired and may be taken by the others so the protected resource should not be changed anymore
+type LockLostError struct {
+	text string
+}
+
+func (lockLostError *LockLostError) Error() string {
+	return lockLostError.text
+}
+
 type Lock struct {
-	Name        string
-	Timeout     time.Duration
-	CreatedTime time.Time
-	ExpiredTime time.Time
-	Deleted     bool
+	Name         string
+	Owner        string
+	FencingToken uint64 // Increases every time the lock is acquired so the stale holder could be told apart
+	Timeout      time.Duration
+	CreatedTime  time.Time
+	RenewedTime  time.Time
+	ExpiredTime  time.Time
+	Deleted      bool // Only used by the releasing of the previous version
+	// The etcd modified index used to compare and swap
+	index              uint64
+	released           bool
+	stopRenewalChannel chan bool
+	mutex              *sync.Mutex
 }
 
 func getLockName(kind string, name string) string {
 	return kind + "." + name
 }
 
+func getOwnerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	byteSlice := make([]byte, 4)
+	rand.Read(byteSlice)
+	return hostname + "-" + strconv.Itoa(os.Getpid()) + "-" + hex.EncodeToString(byteSlice)
+}
+
+func GetOwnerID() string {
+	return ownerID
+}
+
+func isLockFree(lock *Lock, currentTime time.Time) bool {
+	return lock.Deleted || currentTime.Before(lock.ExpiredTime) == false
+}
+
+// The lock is changed or created by the others between the load and the compare and swap
+func isConflictError(err error) bool {
+	etcdError, ok := err.(client.Error)
+	if ok == false {
+		return false
+	}
+	return etcdError.Code == client.ErrorCodeTestFailed || etcdError.Code == client.ErrorCodeNodeExist
+}
+
 func LockAvailable(kind string, name string) bool {
 	lockName := getLockName(kind, name)
 	currentTime := time.Now()
@@ -50,18 +114,17 @@ func LockAvailable(kind string, name string) bool {
 		}
 	}
 	if oldLock != nil {
-		if oldLock.Deleted == false {
-			if currentTime.Before(oldLock.ExpiredTime) {
-				return false
-			}
+		if isLockFree(oldLock, currentTime) == false {
+			return false
 		}
 	}
 
 	return true
 }
 
-// timeout 0 means default time out
-func AcquireLock(kind string, name string, timeout time.Duration) bool {
+// timeout 0 means default time out.
+// The returned lock carries the fencing token and needs to be released by the caller.
+func AcquireLock(kind string, name string, timeout time.Duration) (*Lock, error) {
 	lockName := getLockName(kind, name)
 	currentTime := time.Now()
 
@@ -70,14 +133,22 @@ func AcquireLock(kind string, name string, timeout time.Duration) bool {
 		etcdError, _ := err.(client.Error)
 		if etcdError.Code != client.ErrorCodeKeyNotFound {
 			log.Error(err)
-			return false
+			return nil, err
 		}
 	}
 	if oldLock != nil {
-		if oldLock.Deleted == false {
-			if currentTime.Before(oldLock.ExpiredTime) {
-				return false
-			}
+		if isLockFree(oldLock, currentTime) == false {
+			return nil, &LockHeldError{"Lock " + lockName + " is held by " + oldLock.Owner + " until " + oldLock.ExpiredTime.Format(time.RFC3339)}
+		}
+
+		// Remove the expired or released one only if no one else has changed it in the meanwhile
+		err := GetStorage().deleteLock(lockName, oldLock.index)
+		if isConflictError(err) {
+			return nil, &LockHeldError{"Lock " + lockName + " is acquired by the others"}
+		}
+		if err != nil {
+			log.Error(err)
+			return nil, err
 		}
 	}
 
@@ -85,42 +156,146 @@ func AcquireLock(kind string, name string, timeout time.Duration) bool {
 		timeout = LockDefaultTimeout
 	}
 
-	// Acquire
+	// Acquire. Only one of the concurrent creation succeeds.
 	lock := &Lock{
 		lockName,
+		ownerID,
+		0,
 		timeout,
 		currentTime,
+		currentTime,
 		currentTime.Add(timeout),
 		false,
+		0,
+		false,
+		nil,
+		&sync.Mutex{},
+	}
+	err = GetStorage().createLock(lock)
+	if isConflictError(err) {
+		return nil, &LockHeldError{"Lock " + lockName + " is acquired by the others"}
 	}
-	err = GetStorage().saveLock(lock)
 	if err != nil {
 		log.Error(err)
-		return false
-	} else {
-		return true
+		return nil, err
 	}
+
+	return lock, nil
 }
 
-func ReleaseLock(kind string, name string) error {
-	lockName := getLockName(kind, name)
+// Extend the expiration by the timeout. It fails if the lock is already expired and acquired by the others.
+func (lock *Lock) Renew() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if lock.released {
+		return &LockLostError{"Lock " + lock.Name + " is released"}
+	}
 
+	previousRenewedTime := lock.RenewedTime
+	previousExpiredTime := lock.ExpiredTime
 	currentTime := time.Now()
-	lock := &Lock{
-		lockName,
-		LockDefaultTimeout,
-		currentTime,
-		currentTime.Add(LockDefaultTimeout),
-		true,
+	lock.RenewedTime = currentTime
+	lock.ExpiredTime = currentTime.Add(lock.Timeout)
+
+	err := GetStorage().updateLock(lock)
+	if err != nil {
+		lock.RenewedTime = previousRenewedTime
+		lock.ExpiredTime = previousExpiredTime
+
+		etcdError, _ := err.(client.Error)
+		if isConflictError(err) || etcdError.Code == client.ErrorCodeKeyNotFound {
+			return &LockLostError{"Lock " + lock.Name + " with fencing token " + strconv.FormatUint(lock.FencingToken, 10) + " is expired"}
+		}
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Renew periodically in the background for the long operations like build and rolling update until released
+func (lock *Lock) StartRenewal() {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if lock.released || lock.stopRenewalChannel != nil {
+		return
+	}
+
+	stopRenewalChannel := make(chan bool)
+	lock.stopRenewalChannel = stopRenewalChannel
+
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Error("Renew lock %s error: %s", lock.Name, err)
+				log.Error(logger.GetStackTrace(4096, false))
+			}
+		}()
+
+		ticker := time.NewTicker(lock.Timeout / RenewalAmountPerTimeout)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopRenewalChannel:
+				return
+			case <-ticker.C:
+				err := lock.Renew()
+				if _, ok := err.(*LockLostError); ok {
+					log.Error(err)
+					return
+				}
+				if err != nil {
+					log.Error("Renew lock %s error: %s", lock.Name, err)
+				}
+			}
+		}
+	}()
+}
+
+// Check that the lock is still held before changing the protected resource
+func (lock *Lock) Validate() error {
+	currentLock, err := GetStorage().loadLock(lock.Name)
+	if err != nil {
+		etcdError, _ := err.(client.Error)
+		if etcdError.Code == client.ErrorCodeKeyNotFound {
+			return &LockLostError{"Lock " + lock.Name + " with fencing token " + strconv.FormatUint(lock.FencingToken, 10) + " is expired"}
+		}
+		log.Error(err)
+		return err
+	}
+
+	if currentLock.FencingToken != lock.FencingToken || currentLock.Owner != lock.Owner || isLockFree(currentLock, time.Now()) {
+		return &LockLostError{"Lock " + lock.Name + " with fencing token " + strconv.FormatUint(lock.FencingToken, 10) + " is not held anymore"}
+	}
+
+	return nil
+}
+
+// Release only if it is still held by the caller so the one acquired by the others after expiration is kept
+func (lock *Lock) Release() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if lock.released {
+		return nil
+	}
+	lock.released = true
+	if lock.stopRenewalChannel != nil {
+		close(lock.stopRenewalChannel)
+		lock.stopRenewalChannel = nil
 	}
 
 	var err error = nil
 	for i := 0; i < ReleaseLockRetryAmount; i++ {
 		time.Sleep(ReleaseLockRetryInterval * time.Duration(i))
 
-		err = GetStorage().saveLock(lock)
+		err = GetStorage().deleteLock(lock.Name, lock.index)
 		if err == nil {
 			return nil
+		} else if isConflictError(err) {
+			return &LockLostError{"Lock " + lock.Name + " with fencing token " + strconv.FormatUint(lock.FencingToken, 10) + " is already acquired by the others"}
 		} else {
 			log.Error("The %d time retry to release lock with error %s", i, err)
 		}
@@ -128,3 +303,34 @@ func ReleaseLock(kind string, name string) error {
 
 	return err
 }
+
+// The locks not yet released or expired
+func GetAllHeldLock() ([]Lock, error) {
+	lockSlice, err := GetStorage().LoadAllLock()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	currentTime := time.Now()
+	heldLockSlice := make([]Lock, 0)
+	for _, lock := range lockSlice {
+		if isLockFree(&lock, currentTime) == false {
+			heldLockSlice = append(heldLockSlice, lock)
+		}
+	}
+
+	return heldLockSlice, nil
+}
+
+// Release regardless of the owner. Used by the administrator to clean up the lock left by a crashed instance.
+func ForceReleaseLock(lockName string) error {
+	err := GetStorage().deleteLock(lockName, 0)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	log.Info("Lock %s is released by force", lockName)
+	return nil
+}
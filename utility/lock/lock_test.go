@@ -16,20 +16,60 @@ package lock
 
 import (
 	"testing"
+	"time"
 )
 
 func TestLock(t *testing.T) {
 	for i := 0; i < 10000; i++ {
-		if AcquireLock("build", "aaa", 0) == false {
-			t.Errorf("Iteration %d. The first time acquire lock should not be false", i)
+		acquiredLock, err := AcquireLock("build", "aaa", 0)
+		if err != nil {
+			t.Fatalf("Iteration %d. The first time acquire lock should not fail but get error %s", i, err)
 		}
 
-		if AcquireLock("build", "aaa", 0) == true {
-			t.Errorf("Iteration %d. The second time acquire lock should not be true", i)
+		if _, err := AcquireLock("build", "aaa", 0); err == nil {
+			t.Errorf("Iteration %d. The second time acquire lock should fail", i)
 		}
 
-		if ReleaseLock("build", "aaa") != nil {
+		if acquiredLock.Release() != nil {
 			t.Errorf("Iteration %d. The first time release lock should be nil", i)
 		}
 	}
 }
+
+func TestLockFencingToken(t *testing.T) {
+	firstLock, err := AcquireLock("build", "bbb", time.Second)
+	if err != nil {
+		t.Fatalf("Acquire lock error %s", err)
+	}
+
+	if err := firstLock.Renew(); err != nil {
+		t.Errorf("Renew the held lock should not fail but get error %s", err)
+	}
+	if err := firstLock.Validate(); err != nil {
+		t.Errorf("Validate the held lock should not fail but get error %s", err)
+	}
+
+	time.Sleep(time.Second * 2)
+
+	secondLock, err := AcquireLock("build", "bbb", 0)
+	if err != nil {
+		t.Fatalf("Acquire the expired lock error %s", err)
+	}
+	defer secondLock.Release()
+
+	if secondLock.FencingToken <= firstLock.FencingToken {
+		t.Errorf("The fencing token %d should be larger than the previous one %d", secondLock.FencingToken, firstLock.FencingToken)
+	}
+	if _, ok := firstLock.Validate().(*LockLostError); ok == false {
+		t.Errorf("Validate the expired lock should fail")
+	}
+	if _, ok := firstLock.Renew().(*LockLostError); ok == false {
+		t.Errorf("Renew the expired lock should fail")
+	}
+	if _, ok := firstLock.Release().(*LockLostError); ok == false {
+		t.Errorf("Release the expired lock should not release the one acquired by the others")
+	}
+	if err := secondLock.Validate(); err != nil {
+		t.Errorf("The lock acquired after expiration should be kept but get error %s", err)
+	}
+}
@@ -78,8 +78,9 @@ func ReloadStorage(storageType int) error {
 
 type Storage interface {
 	initialize() error
-	deleteLock(name string) error
-	saveLock(lock *Lock) error
+	deleteLock(name string, index uint64) error
+	createLock(lock *Lock) error
+	updateLock(lock *Lock) error
 	loadLock(name string) (*Lock, error)
 	LoadAllLock() ([]Lock, error)
 }
@@ -50,11 +50,15 @@ func (storageDummy *StorageDummy) initialize() error {
 	return nil
 }
 
-func (storageDummy *StorageDummy) deleteLock(name string) error {
+func (storageDummy *StorageDummy) deleteLock(name string, index uint64) error {
 	return &storageDummy.dummyError
 }
 
-func (storageDummy *StorageDummy) saveLock(lock *Lock) error {
+func (storageDummy *StorageDummy) createLock(lock *Lock) error {
+	return &storageDummy.dummyError
+}
+
+func (storageDummy *StorageDummy) updateLock(lock *Lock) error {
 	return &storageDummy.dummyError
 }
 
@@ -33,14 +33,15 @@ func (storageEtcd *StorageEtcd) initialize() error {
 	return nil
 }
 
-func (storageEtcd *StorageEtcd) deleteLock(name string) error {
+// index 0 deletes unconditionally. Otherwise only if the lock is not changed since the index.
+func (storageEtcd *StorageEtcd) deleteLock(name string, index uint64) error {
 	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
 	if err != nil {
 		log.Error("Get keysAPI error %s", err)
 		return err
 	}
 
-	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/lock/"+name, nil)
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/lock/"+name, &client.DeleteOptions{PrevIndex: index})
 	etcdError, _ := err.(client.Error)
 	if etcdError.Code == client.ErrorCodeKeyNotFound {
 		log.Debug(err)
@@ -48,7 +49,7 @@ func (storageEtcd *StorageEtcd) deleteLock(name string) error {
 		return nil
 	}
 	if err != nil {
-		log.Error("Delete lock with name %s error: %s", name, err)
+		log.Error("Delete lock with name %s and index %d error: %s", name, index, err)
 		log.Error(response)
 		return err
 	}
@@ -56,7 +57,8 @@ func (storageEtcd *StorageEtcd) deleteLock(name string) error {
 	return nil
 }
 
-func (storageEtcd *StorageEtcd) saveLock(lock *Lock) error {
+// Fail with the node exist error if the lock is created by the others
+func (storageEtcd *StorageEtcd) createLock(lock *Lock) error {
 	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
 	if err != nil {
 		log.Error("Get keysAPI error %s", err)
@@ -69,13 +71,52 @@ func (storageEtcd *StorageEtcd) saveLock(lock *Lock) error {
 		return err
 	}
 
-	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/lock/"+lock.Name, string(byteSlice), &client.SetOptions{TTL: lock.Timeout})
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/lock/"+lock.Name, string(byteSlice), &client.SetOptions{TTL: lock.Timeout, PrevExist: client.PrevNoExist})
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeNodeExist {
+		log.Debug(err)
+		return etcdError
+	}
+	if err != nil {
+		log.Error("Create lock %v error: %s", lock, err)
+		log.Error(response)
+		return err
+	}
+
+	lock.FencingToken = response.Node.CreatedIndex
+	lock.index = response.Node.ModifiedIndex
+
+	return nil
+}
+
+// Fail with the test failed error if the lock is changed by the others
+func (storageEtcd *StorageEtcd) updateLock(lock *Lock) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(lock)
+	if err != nil {
+		log.Error("Marshal lock %v error %s", lock, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/lock/"+lock.Name, string(byteSlice), &client.SetOptions{TTL: lock.Timeout, PrevIndex: lock.index})
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeTestFailed || etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		return etcdError
+	}
 	if err != nil {
-		log.Error("Save lock %v error: %s", lock, err)
+		log.Error("Update lock %v error: %s", lock, err)
 		log.Error(response)
 		return err
 	}
 
+	lock.index = response.Node.ModifiedIndex
+
 	return nil
 }
 
@@ -103,6 +144,9 @@ func (storageEtcd *StorageEtcd) loadLock(name string) (*Lock, error) {
 		log.Error("Unmarshal lock %v error %s", response.Node.Value, err)
 		return nil, err
 	}
+	// Compare and swap keeps the created index so it is unique for each acquisition
+	lock.FencingToken = response.Node.CreatedIndex
+	lock.index = response.Node.ModifiedIndex
 
 	return lock, nil
 }
@@ -129,6 +173,8 @@ func (storageEtcd *StorageEtcd) LoadAllLock() ([]Lock, error) {
 			log.Error("Unmarshal lock %v error %s", node.Value, err)
 			return nil, err
 		}
+		lock.FencingToken = node.CreatedIndex
+		lock.index = node.ModifiedIndex
 		lockSlice = append(lockSlice, lock)
 	}
 
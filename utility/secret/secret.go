@@ -0,0 +1,301 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Encrypted values are stored as enc:v1:<master key id>:<wrapped data key>:<ciphertext>
+const encryptedPrefix = "enc:v1:"
+
+const masterKeyLength = 32
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+type keyRing struct {
+	mutex sync.RWMutex
+	// The first key encrypts. The rest are old keys only used to decrypt during the rotation.
+	masterKeySlice []masterKey
+	// The master key file is configured so the secret must not be stored without encryption even if the file fails to load
+	configured bool
+}
+
+var ring = &keyRing{}
+
+func init() {
+	err := Reload()
+	if err != nil {
+		log.Critical("Load secret master key error %s", err)
+	}
+}
+
+// Reload the master key file. Put the new key on the first line and keep the old keys below to rotate.
+func Reload() error {
+	path, ok := configuration.LocalConfiguration.GetString("secretMasterKeyPath")
+	if ok == false || path == "" {
+		log.Critical("secretMasterKeyPath is not configured so the secrets are stored without encryption")
+		setConfigured(false)
+		setMasterKeySlice(nil)
+		return nil
+	}
+	setConfigured(true)
+
+	byteSlice, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Error("Read master key file %s error %s", path, err)
+		return err
+	}
+
+	masterKeySlice, err := parseMasterKeyFile(string(byteSlice))
+	if err != nil {
+		log.Error("Parse master key file %s error %s", path, err)
+		return err
+	}
+
+	setMasterKeySlice(masterKeySlice)
+	return nil
+}
+
+// One key per line in the format id:base64 encoded 32 bytes key. Empty lines and lines starting with # are ignored.
+func parseMasterKeyFile(content string) ([]masterKey, error) {
+	masterKeySlice := make([]masterKey, 0)
+	idMap := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		splitSlice := strings.SplitN(line, ":", 2)
+		if len(splitSlice) != 2 || splitSlice[0] == "" {
+			return nil, errors.New("Master key line should be in the format id:base64key")
+		}
+		id := splitSlice[0]
+		if idMap[id] {
+			return nil, errors.New("Duplicate master key id " + id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(splitSlice[1]))
+		if err != nil {
+			return nil, errors.New("Master key " + id + " is not base64 encoded")
+		}
+		if len(key) != masterKeyLength {
+			return nil, errors.New("Master key " + id + " should be 32 bytes")
+		}
+		idMap[id] = true
+		masterKeySlice = append(masterKeySlice, masterKey{id, key})
+	}
+	if len(masterKeySlice) == 0 {
+		return nil, errors.New("No master key in the file")
+	}
+	return masterKeySlice, nil
+}
+
+func setMasterKeySlice(masterKeySlice []masterKey) {
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+	ring.masterKeySlice = masterKeySlice
+}
+
+func setConfigured(configured bool) {
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+	ring.configured = configured
+}
+
+func isConfigured() bool {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+	return ring.configured
+}
+
+func getPrimaryMasterKey() *masterKey {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+	if len(ring.masterKeySlice) == 0 {
+		return nil
+	}
+	primary := ring.masterKeySlice[0]
+	return &primary
+}
+
+func getMasterKey(id string) *masterKey {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+	for _, key := range ring.masterKeySlice {
+		if key.id == id {
+			found := key
+			return &found
+		}
+	}
+	return nil
+}
+
+// Return the loaded master key ids and the one used to encrypt
+func GetMasterKeyID() ([]string, string) {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+	idSlice := make([]string, 0)
+	for _, key := range ring.masterKeySlice {
+		idSlice = append(idSlice, key.id)
+	}
+	primaryID := ""
+	if len(ring.masterKeySlice) > 0 {
+		primaryID = ring.masterKeySlice[0].id
+	}
+	return idSlice, primaryID
+}
+
+func IsEnabled() bool {
+	return getPrimaryMasterKey() != nil
+}
+
+func IsEncrypted(text string) bool {
+	return strings.HasPrefix(text, encryptedPrefix)
+}
+
+// Encrypt with a new random data key wrapped by the current master key.
+// The text looking encrypted is encrypted again so the ciphertext copied from the other record is never stored as it is.
+// The callers always pass the decrypted text including the reencryption which loads and saves again.
+// Fail if the master key file is configured but not loaded so the secret is never stored in plain by mistake.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return plaintext, nil
+	}
+	primary := getPrimaryMasterKey()
+	if primary == nil {
+		if isConfigured() {
+			log.Error("secretMasterKeyPath is configured but no master key is loaded")
+			return "", errors.New("Master key is configured but not loaded")
+		}
+		// Stored in plain, it would be decrypted as the ciphertext after the encryption is enabled
+		if IsEncrypted(plaintext) {
+			log.Error("Text with the prefix %s can't be stored without master key", encryptedPrefix)
+			return "", errors.New("Text with the prefix " + encryptedPrefix + " can't be stored without master key")
+		}
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, masterKeyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		log.Error("Generate data key error %s", err)
+		return "", err
+	}
+
+	wrappedDataKey, err := seal(primary.key, dataKey)
+	if err != nil {
+		log.Error("Wrap data key error %s", err)
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		log.Error("Encrypt error %s", err)
+		return "", err
+	}
+
+	return encryptedPrefix + primary.id + ":" +
+		base64.StdEncoding.EncodeToString(wrappedDataKey) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt the encrypted text. The plain text stored before the encryption is enabled is returned as it is.
+func Decrypt(text string) (string, error) {
+	if IsEncrypted(text) == false {
+		return text, nil
+	}
+
+	id, wrappedDataKey, ciphertext, err := splitEncrypted(text)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	key := getMasterKey(id)
+	if key == nil {
+		log.Error("Master key %s is not loaded", id)
+		return "", errors.New("Master key " + id + " is not loaded")
+	}
+
+	dataKey, err := open(key.key, wrappedDataKey)
+	if err != nil {
+		log.Error("Unwrap data key with master key %s error %s", id, err)
+		return "", err
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		log.Error("Decrypt with master key %s error %s", id, err)
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func splitEncrypted(text string) (string, []byte, []byte, error) {
+	splitSlice := strings.Split(strings.TrimPrefix(text, encryptedPrefix), ":")
+	if len(splitSlice) != 3 {
+		return "", nil, nil, errors.New("Invalid encrypted format")
+	}
+	wrappedDataKey, err := base64.StdEncoding.DecodeString(splitSlice[1])
+	if err != nil {
+		return "", nil, nil, errors.New("Invalid encrypted data key")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(splitSlice[2])
+	if err != nil {
+		return "", nil, nil, errors.New("Invalid encrypted data")
+	}
+	return splitSlice[0], wrappedDataKey, ciphertext, nil
+}
+
+// AES-256-GCM with the random nonce put before the ciphertext
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("Ciphertext is too short")
+	}
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+}
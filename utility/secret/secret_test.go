@@ -0,0 +1,174 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func createTestKey(b byte) string {
+	key := make([]byte, masterKeyLength)
+	for i := range key {
+		key[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func loadTestKey(t *testing.T, content string) {
+	masterKeySlice, err := parseMasterKeyFile(content)
+	if err != nil {
+		t.Fatalf("Parse master key file error %s", err)
+	}
+	setMasterKeySlice(masterKeySlice)
+}
+
+func TestParseMasterKeyFile(t *testing.T) {
+	masterKeySlice, err := parseMasterKeyFile("# comment\n\nnew:" + createTestKey(1) + "\nold:" + createTestKey(2) + "\n")
+	if err != nil {
+		t.Fatalf("Should not be error %s", err)
+	}
+	if len(masterKeySlice) != 2 || masterKeySlice[0].id != "new" || masterKeySlice[1].id != "old" {
+		t.Errorf("Unexpected master key %v", masterKeySlice)
+	}
+
+	for _, content := range []string{
+		"",
+		"no_separator",
+		"short:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"invalid:!!!",
+		"same:" + createTestKey(1) + "\nsame:" + createTestKey(2),
+	} {
+		if _, err := parseMasterKeyFile(content); err == nil {
+			t.Errorf("Content %q should be error", content)
+		}
+	}
+}
+
+func TestEncryptAndDecrypt(t *testing.T) {
+	loadTestKey(t, "key1:"+createTestKey(1))
+	defer setMasterKeySlice(nil)
+
+	encrypted, err := Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt error %s", err)
+	}
+	if IsEncrypted(encrypted) == false || strings.Contains(encrypted, "password") {
+		t.Errorf("Should be encrypted but get %s", encrypted)
+	}
+	anotherEncrypted, _ := Encrypt("password")
+	if encrypted == anotherEncrypted {
+		t.Errorf("The same plain text should be encrypted with different data keys")
+	}
+
+	decrypted, err := Decrypt(encrypted)
+	if err != nil || decrypted != "password" {
+		t.Errorf("Expect password but get %s error %v", decrypted, err)
+	}
+
+	// The text looking encrypted is encrypted again and kept as it is
+	again, _ := Encrypt(encrypted)
+	if again == encrypted {
+		t.Errorf("Text looking encrypted should be encrypted again")
+	}
+	if decrypted, err := Decrypt(again); err != nil || decrypted != encrypted {
+		t.Errorf("Expect %s but get %s error %v", encrypted, decrypted, err)
+	}
+	if empty, _ := Encrypt(""); empty != "" {
+		t.Errorf("Empty should stay empty but get %s", empty)
+	}
+}
+
+func TestDecryptPlainText(t *testing.T) {
+	loadTestKey(t, "key1:"+createTestKey(1))
+	defer setMasterKeySlice(nil)
+
+	decrypted, err := Decrypt("plain")
+	if err != nil || decrypted != "plain" {
+		t.Errorf("Plain text stored before the encryption should be returned but get %s error %v", decrypted, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	loadTestKey(t, "key1:"+createTestKey(1))
+	defer setMasterKeySlice(nil)
+
+	encrypted, _ := Encrypt("password")
+
+	loadTestKey(t, "key2:"+createTestKey(2)+"\nkey1:"+createTestKey(1))
+	decrypted, err := Decrypt(encrypted)
+	if err != nil || decrypted != "password" {
+		t.Errorf("Old key should still decrypt but get %s error %v", decrypted, err)
+	}
+	reencrypted, _ := Encrypt(decrypted)
+	if strings.HasPrefix(reencrypted, encryptedPrefix+"key2:") == false {
+		t.Errorf("Should be encrypted with the new primary key but get %s", reencrypted)
+	}
+
+	// The old key is removed after all of the secrets are encrypted again
+	loadTestKey(t, "key2:"+createTestKey(2))
+	if _, err := Decrypt(encrypted); err == nil {
+		t.Errorf("Should be error without the old key")
+	}
+	if decrypted, err := Decrypt(reencrypted); err != nil || decrypted != "password" {
+		t.Errorf("Expect password but get %s error %v", decrypted, err)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	loadTestKey(t, "key1:"+createTestKey(1))
+	defer setMasterKeySlice(nil)
+
+	encrypted, _ := Encrypt("password")
+	splitSlice := strings.Split(encrypted, ":")
+	ciphertext, _ := base64.StdEncoding.DecodeString(splitSlice[len(splitSlice)-1])
+	ciphertext[len(ciphertext)-1] ^= 1
+	splitSlice[len(splitSlice)-1] = base64.StdEncoding.EncodeToString(ciphertext)
+	if _, err := Decrypt(strings.Join(splitSlice, ":")); err == nil {
+		t.Errorf("Should be error with the tampered ciphertext")
+	}
+
+	if _, err := Decrypt(encryptedPrefix + "key1:bad"); err == nil {
+		t.Errorf("Should be error with the invalid format")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	setMasterKeySlice(nil)
+
+	if IsEnabled() {
+		t.Errorf("Should be disabled without master key")
+	}
+	if text, _ := Encrypt("password"); text != "password" {
+		t.Errorf("Should store as it is without master key but get %s", text)
+	}
+	if _, err := Encrypt(encryptedPrefix + "key1:a:b"); err == nil {
+		t.Errorf("Text looking encrypted should be error without master key")
+	}
+}
+
+func TestConfiguredButNotLoaded(t *testing.T) {
+	setMasterKeySlice(nil)
+	setConfigured(true)
+	defer setConfigured(false)
+
+	if _, err := Encrypt("password"); err == nil {
+		t.Errorf("Should be error when the configured master key is not loaded")
+	}
+	if text, err := Encrypt(""); err != nil || text != "" {
+		t.Errorf("Empty text should be returned as it is but get %s error %v", text, err)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sshclient
+
+import (
+	"bytes"
+	"errors"
+	"github.com/cloudawan/cloudone/utility/configuration"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The prompt sudo prints when the password is required
+const SudoPrompt = "[sudo]"
+
+type Credential struct {
+	User                 string
+	Password             string
+	PrivateKey           string // PEM encoded private key
+	PrivateKeyPassphrase string
+	Certificate          string // OpenSSH certificate of the private key in the authorized_keys format
+	HostKeySlice         []string
+	PasswordlessSudo     bool
+	// Pin the host key of the host without the pinned keys on the first use in the authorized_keys format
+	HostKeyRecorder func(hostKey string) error
+}
+
+// Answer the sudo prompt with the password unless the sudo is configured without the password.
+// The key only credential can't answer the prompt so the passwordless sudo is required.
+func (credential Credential) GetSudoInteractiveMap() (map[string]string, error) {
+	if credential.PasswordlessSudo {
+		return nil, nil
+	}
+	if credential.Password == "" {
+		return nil, errors.New("Sudo requires the password or the passwordless sudo for user " + credential.User)
+	}
+	interactiveMap := make(map[string]string)
+	interactiveMap[SudoPrompt] = credential.Password + "\n"
+	return interactiveMap, nil
+}
+
+func (credential Credential) getAuthMethodSlice() ([]ssh.AuthMethod, error) {
+	authMethodSlice := make([]ssh.AuthMethod, 0)
+
+	if credential.PrivateKey != "" {
+		signer, err := getSigner(credential.PrivateKey, credential.PrivateKeyPassphrase, credential.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		authMethodSlice = append(authMethodSlice, ssh.PublicKeys(signer))
+	}
+
+	if credential.Password != "" {
+		password := credential.Password
+		authMethodSlice = append(authMethodSlice, ssh.Password(password))
+		authMethodSlice = append(authMethodSlice, ssh.KeyboardInteractive(
+			func(user, instruction string, questionSlice []string, echoSlice []bool) ([]string, error) {
+				answerSlice := make([]string, len(questionSlice))
+				for i := range answerSlice {
+					answerSlice[i] = password
+				}
+				return answerSlice, nil
+			}))
+	}
+
+	if len(authMethodSlice) == 0 {
+		return nil, errors.New("No password or private key is configured")
+	}
+
+	return authMethodSlice, nil
+}
+
+func getSigner(privateKey string, passphrase string, certificate string) (ssh.Signer, error) {
+	var signer ssh.Signer
+	var err error
+	if passphrase == "" {
+		signer, err = ssh.ParsePrivateKey([]byte(privateKey))
+	} else {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if certificate == "" {
+		return signer, nil
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		return nil, err
+	}
+	sshCertificate, ok := publicKey.(*ssh.Certificate)
+	if ok == false {
+		return nil, errors.New("The certificate is not an OpenSSH certificate")
+	}
+	return ssh.NewCertSigner(sshCertificate, signer)
+}
+
+// The pinned host keys are in the authorized_keys format or the SHA256 fingerprints like ssh-keygen -l prints.
+// Without the pinned keys, the key is trusted on the first use and recorded so the existing credentials keep working
+// and the later connections are verified. Configure sshStrictHostKeyChecking to true to reject the hosts without the pinned keys.
+func getHostKeyCallback(hostKeySlice []string, hostKeyRecorder func(hostKey string) error) (ssh.HostKeyCallback, error) {
+	if len(hostKeySlice) == 0 {
+		if strictHostKeyChecking, ok := configuration.LocalConfiguration.GetNative("sshStrictHostKeyChecking").(bool); ok && strictHostKeyChecking {
+			return nil, errors.New("No host key is pinned. Get the host key to pin or configure sshStrictHostKeyChecking to false.")
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			if hostKeyRecorder == nil {
+				log.Info("Host key of %s is not pinned. Fingerprint %s", hostname, fingerprint)
+				return nil
+			}
+			if err := hostKeyRecorder(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))); err != nil {
+				log.Error("Pin host key of %s with fingerprint %s error %s", hostname, fingerprint, err)
+				return err
+			}
+			log.Info("Host key of %s with fingerprint %s is pinned on the first use", hostname, fingerprint)
+			return nil
+		}, nil
+	}
+
+	fingerprintMap := make(map[string]bool)
+	for _, hostKey := range hostKeySlice {
+		hostKey = strings.TrimSpace(hostKey)
+		if strings.HasPrefix(hostKey, "SHA256:") {
+			fingerprintMap[hostKey] = true
+			continue
+		}
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			return nil, errors.New("Invalid host key " + hostKey)
+		}
+		fingerprintMap[ssh.FingerprintSHA256(publicKey)] = true
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		if fingerprintMap[fingerprint] {
+			return nil
+		}
+		log.Error("Host key of %s with fingerprint %s doesn't match the pinned keys", hostname, fingerprint)
+		return errors.New("Host key of " + hostname + " with fingerprint " + fingerprint + " doesn't match the pinned keys")
+	}, nil
+}
+
+func dial(dialTimeout time.Duration, host string, port int, credential Credential) (*ssh.Client, error) {
+	authMethodSlice, err := credential.getAuthMethodSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := getHostKeyCallback(credential.HostKeySlice, credential.HostKeyRecorder)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User:            credential.User,
+		Auth:            authMethodSlice,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	}
+
+	client, err := ssh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Run the commands one by one and return the output of each command.
+// The value in interactiveMap is written to the input once the output contains the key.
+func InteractiveSSH(dialTimeout time.Duration, sessionTimeout time.Duration, host string, port int,
+	credential Credential, commandSlice []string, interactiveMap map[string]string) ([]string, error) {
+
+	client, err := dial(dialTimeout, host, port, credential)
+	if err != nil {
+		log.Error("Connect to host %s port %d with user %s error %s", host, port, credential.User, err)
+		return nil, err
+	}
+	defer client.Close()
+
+	deadline := time.Now().Add(sessionTimeout)
+	resultSlice := make([]string, 0)
+	for _, command := range commandSlice {
+		result, err := runCommand(client, strings.TrimRight(command, "\n"), interactiveMap, deadline.Sub(time.Now()))
+		resultSlice = append(resultSlice, result)
+		if err != nil {
+			log.Error("Run command %s on host %s error %s", command, host, err)
+			return resultSlice, err
+		}
+	}
+
+	return resultSlice, nil
+}
+
+func runCommand(client *ssh.Client, command string, interactiveMap map[string]string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return "", errors.New("Session timeout")
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	writer := &interactiveWriter{interactiveMap: interactiveMap}
+	if len(interactiveMap) > 0 {
+		// Prompts like sudo only read from the terminal
+		if err := session.RequestPty("xterm", 40, 200, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+			return "", err
+		}
+		input, err := session.StdinPipe()
+		if err != nil {
+			return "", err
+		}
+		writer.input = input
+	}
+	session.Stdout = writer
+	session.Stderr = writer
+
+	if err := session.Start(command); err != nil {
+		return "", err
+	}
+
+	waitChannel := make(chan error, 1)
+	go func() {
+		waitChannel <- session.Wait()
+	}()
+
+	select {
+	case err := <-waitChannel:
+		return writer.String(), err
+	case <-time.After(timeout):
+		session.Close()
+		return writer.String(), errors.New("Session timeout")
+	}
+}
+
+type interactiveWriter struct {
+	mutex          sync.Mutex
+	buffer         bytes.Buffer
+	interactiveMap map[string]string
+	input          io.Writer
+	answeredLength int
+}
+
+func (interactiveWriter *interactiveWriter) Write(byteSlice []byte) (int, error) {
+	interactiveWriter.mutex.Lock()
+	defer interactiveWriter.mutex.Unlock()
+
+	n, err := interactiveWriter.buffer.Write(byteSlice)
+	if err != nil || interactiveWriter.input == nil {
+		return n, err
+	}
+
+	// Only answer the prompts shown after the last answer
+	unanswered := interactiveWriter.buffer.String()[interactiveWriter.answeredLength:]
+	for key, value := range interactiveWriter.interactiveMap {
+		if index := strings.Index(unanswered, key); index >= 0 {
+			interactiveWriter.answeredLength += index + len(key)
+			if _, err := io.WriteString(interactiveWriter.input, value); err != nil {
+				return n, err
+			}
+			break
+		}
+	}
+
+	return n, nil
+}
+
+func (interactiveWriter *interactiveWriter) String() string {
+	interactiveWriter.mutex.Lock()
+	defer interactiveWriter.mutex.Unlock()
+	return interactiveWriter.buffer.String()
+}
+
+// Get the host key in the authorized_keys format and its fingerprint to be pinned
+func GetHostKey(dialTimeout time.Duration, host string, port int) (string, string, error) {
+	var hostKey ssh.PublicKey
+	clientConfig := &ssh.ClientConfig{
+		User: "cloudone",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			// Stop after the key exchange
+			return errors.New("Host key is received")
+		},
+		Timeout: dialTimeout,
+	}
+
+	_, err := ssh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), clientConfig)
+	if hostKey == nil {
+		log.Error("Get host key of host %s port %d error %s", host, port, err)
+		return "", "", err
+	}
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey))), ssh.FingerprintSHA256(hostKey), nil
+}
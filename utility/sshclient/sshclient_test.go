@@ -0,0 +1,196 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sshclient
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"testing"
+)
+
+func createTestKey(t *testing.T) (ed25519.PrivateKey, ssh.PublicKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, sshPublicKey
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	_, pinnedKey := createTestKey(t)
+	_, fingerprintKey := createTestKey(t)
+	_, otherKey := createTestKey(t)
+
+	hostKeyCallback, err := getHostKeyCallback([]string{
+		string(ssh.MarshalAuthorizedKey(pinnedKey)),
+		ssh.FingerprintSHA256(fingerprintKey),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hostKeyCallback("host", nil, pinnedKey); err != nil {
+		t.Errorf("Pinned authorized key should be accepted but get %s", err)
+	}
+	if err := hostKeyCallback("host", nil, fingerprintKey); err != nil {
+		t.Errorf("Pinned fingerprint should be accepted but get %s", err)
+	}
+	if err := hostKeyCallback("host", nil, otherKey); err == nil {
+		t.Errorf("Key not pinned should be rejected")
+	}
+
+	if _, err := getHostKeyCallback([]string{"invalid"}, nil); err == nil {
+		t.Errorf("Invalid host key should be error")
+	}
+}
+
+func TestHostKeyCallbackTrustOnFirstUse(t *testing.T) {
+	_, hostKey := createTestKey(t)
+
+	recordedHostKey := ""
+	hostKeyCallback, err := getHostKeyCallback(nil, func(hostKey string) error {
+		recordedHostKey = hostKey
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hostKeyCallback("host", nil, hostKey); err != nil {
+		t.Errorf("Key should be trusted on the first use but get %s", err)
+	}
+
+	// The recorded key is pinned for the later connections
+	hostKeyCallback, err = getHostKeyCallback([]string{recordedHostKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hostKeyCallback("host", nil, hostKey); err != nil {
+		t.Errorf("Recorded key should be accepted but get %s", err)
+	}
+
+	hostKeyCallback, _ = getHostKeyCallback(nil, func(hostKey string) error {
+		return errors.New("storage error")
+	})
+	if err := hostKeyCallback("host", nil, hostKey); err == nil {
+		t.Errorf("Key should be rejected when it can't be recorded")
+	}
+}
+
+func TestGetSigner(t *testing.T) {
+	privateKey, publicKey := createTestKey(t)
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := getSigner(string(pem.EncodeToMemory(block)), "", "")
+	if err != nil {
+		t.Fatalf("Parse private key error %s", err)
+	}
+	if bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal()) == false {
+		t.Errorf("Public key doesn't match")
+	}
+
+	block, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedPrivateKey := string(pem.EncodeToMemory(block))
+	if _, err := getSigner(encryptedPrivateKey, "", ""); err == nil {
+		t.Errorf("Encrypted private key without passphrase should be error")
+	}
+	if _, err := getSigner(encryptedPrivateKey, "passphrase", ""); err != nil {
+		t.Errorf("Parse encrypted private key error %s", err)
+	}
+
+	// Certificate signed by the authority for the key
+	authorityPrivateKey, _ := createTestKey(t)
+	authoritySigner, err := ssh.NewSignerFromKey(authorityPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := &ssh.Certificate{
+		Key:             publicKey,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"cloudone"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := certificate.SignCert(rand.Reader, authoritySigner); err != nil {
+		t.Fatal(err)
+	}
+	signer, err = getSigner(string(pem.EncodeToMemory(block)), "passphrase", string(ssh.MarshalAuthorizedKey(certificate)))
+	if err != nil {
+		t.Fatalf("Certificate signer error %s", err)
+	}
+	if _, ok := signer.PublicKey().(*ssh.Certificate); ok == false {
+		t.Errorf("Signer should present the certificate")
+	}
+	if _, err := getSigner(string(pem.EncodeToMemory(block)), "passphrase", string(ssh.MarshalAuthorizedKey(publicKey))); err == nil {
+		t.Errorf("Plain public key as the certificate should be error")
+	}
+}
+
+func TestGetAuthMethodSlice(t *testing.T) {
+	if _, err := (Credential{User: "cloudone"}).getAuthMethodSlice(); err == nil {
+		t.Errorf("No authentication should be error")
+	}
+	authMethodSlice, err := (Credential{User: "cloudone", Password: "password"}).getAuthMethodSlice()
+	if err != nil || len(authMethodSlice) != 2 {
+		t.Errorf("Password should have password and keyboard interactive methods but get %v error %v", authMethodSlice, err)
+	}
+}
+
+func TestGetSudoInteractiveMap(t *testing.T) {
+	interactiveMap, err := (Credential{User: "cloudone", Password: "password"}).GetSudoInteractiveMap()
+	if err != nil || interactiveMap[SudoPrompt] != "password\n" {
+		t.Errorf("Sudo prompt should be answered with the password but get %v error %v", interactiveMap, err)
+	}
+	if interactiveMap, err := (Credential{User: "cloudone", Password: "password", PasswordlessSudo: true}).GetSudoInteractiveMap(); err != nil || interactiveMap != nil {
+		t.Errorf("Passwordless sudo should not answer the prompt")
+	}
+	if interactiveMap, err := (Credential{User: "cloudone", PrivateKey: "key", PasswordlessSudo: true}).GetSudoInteractiveMap(); err != nil || interactiveMap != nil {
+		t.Errorf("Key with passwordless sudo should not answer the prompt")
+	}
+	if _, err := (Credential{User: "cloudone", PrivateKey: "key"}).GetSudoInteractiveMap(); err == nil {
+		t.Errorf("Key without password nor passwordless sudo should be error")
+	}
+}
+
+func TestInteractiveWriter(t *testing.T) {
+	input := &bytes.Buffer{}
+	writer := &interactiveWriter{interactiveMap: map[string]string{SudoPrompt: "password\n"}, input: input}
+
+	writer.Write([]byte("[sudo] password for cloudone: "))
+	writer.Write([]byte("\nresult\n"))
+	if input.String() != "password\n" {
+		t.Errorf("Prompt should be answered once but get %q", input.String())
+	}
+
+	writer.Write([]byte("[sudo] password for cloudone: "))
+	if input.String() != "password\npassword\n" {
+		t.Errorf("The new prompt should be answered again but get %q", input.String())
+	}
+	if writer.String() != "[sudo] password for cloudone: \nresult\n[sudo] password for cloudone: " {
+		t.Errorf("Unexpected output %q", writer.String())
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Bitbucket signs the payload with HMAC-SHA256 in the header X-Hub-Signature
+type BitbucketProvider struct {
+}
+
+func (bitbucketProvider *BitbucketProvider) GetName() string {
+	return "Bitbucket"
+}
+
+func (bitbucketProvider *BitbucketProvider) GetSecretMetaDataKey() string {
+	return "bitbucketWebhookSecret"
+}
+
+func (bitbucketProvider *BitbucketProvider) Verify(secret string, signature string, payload string) error {
+	return verifyPrefixedHMACSignature(secret, signature, payload)
+}
+
+func (bitbucketProvider *BitbucketProvider) ParsePushEvent(payload string) (*PushEvent, error) {
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal([]byte(payload), &jsonMap)
+	if err != nil {
+		log.Error("Unmarshal payload error %s", err)
+		return nil, err
+	}
+
+	actorJsonMap, _ := jsonMap["actor"].(map[string]interface{})
+	pusherName, _ := actorJsonMap["display_name"].(string)
+
+	// Bitbucket doesn't have the clone url in the payload so use the html link which is the clone url without .git
+	repositoryJsonMap, _ := jsonMap["repository"].(map[string]interface{})
+	linksJsonMap, _ := repositoryJsonMap["links"].(map[string]interface{})
+	htmlJsonMap, _ := linksJsonMap["html"].(map[string]interface{})
+	cloneUrl, _ := htmlJsonMap["href"].(string)
+
+	if len(cloneUrl) == 0 {
+		log.Error("Can't find repository links in bitbucket payload")
+		return nil, errors.New("Can't find repository links in bitbucket payload")
+	}
+
+	// Use the first branch change in the push
+	branch := ""
+	pushJsonMap, _ := jsonMap["push"].(map[string]interface{})
+	changeJsonSlice, _ := pushJsonMap["changes"].([]interface{})
+	for _, changeJsonInterface := range changeJsonSlice {
+		changeJsonMap, _ := changeJsonInterface.(map[string]interface{})
+		newJsonMap, _ := changeJsonMap["new"].(map[string]interface{})
+		kind, _ := newJsonMap["type"].(string)
+		if kind == "branch" {
+			branch, _ = newJsonMap["name"].(string)
+			break
+		}
+	}
+
+	return &PushEvent{
+		cloneUrl,
+		branch,
+		pusherName,
+	}, nil
+}
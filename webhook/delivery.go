@@ -0,0 +1,144 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"github.com/cloudawan/cloudone_utility/random"
+	"github.com/coreos/etcd/client"
+	"strings"
+	"time"
+)
+
+const (
+	// Delivery is kept for the duration which is also the window of replay protection
+	deliveryRetention = 7 * 24 * time.Hour
+)
+
+const (
+	redactedHeaderValue = "******"
+)
+
+// The headers carrying the secrets are not kept in the delivery
+var secretHeaderNameMap = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-gitlab-token":      true,
+}
+
+const (
+	DeliveryResultFailure   = "failure"
+	DeliveryResultIgnored   = "ignored"
+	DeliveryResultTriggered = "triggered"
+)
+
+const (
+	DeliveryBuildResultProcessing = "processing"
+	DeliveryBuildResultSuccess    = "success"
+	DeliveryBuildResultFailure    = "failure"
+)
+
+type Delivery struct {
+	ID                string
+	Provider          string
+	DeliveryID        string
+	User              string
+	ImageInformation  string
+	HeaderMap         map[string]string
+	Verified          bool
+	CloneURL          string
+	Branch            string
+	Pusher            string
+	Result            string
+	Message           string
+	BuildResult       string
+	BuildVersion      string
+	BuildErrorMessage string
+	CreatedTime       time.Time
+	UpdatedTime       time.Time
+}
+
+func getDeliveryID(providerName string, deliveryID string) string {
+	if len(deliveryID) == 0 {
+		// Without the delivery id from the provider, the replay can't be detected
+		return providerName + "_" + random.UUID()
+	} else {
+		return providerName + "_" + deliveryID
+	}
+}
+
+func redactHeaderMap(headerMap map[string]string) map[string]string {
+	redactedHeaderMap := make(map[string]string)
+	for name, value := range headerMap {
+		if secretHeaderNameMap[strings.ToLower(name)] {
+			redactedHeaderMap[name] = redactedHeaderValue
+		} else {
+			redactedHeaderMap[name] = value
+		}
+	}
+	return redactedHeaderMap
+}
+
+// Only the verified delivery is created since the unverified one could be forged to block the real one
+func createDelivery(providerName string, deliveryID string, username string, imageInformationName string, headerMap map[string]string) *Delivery {
+	currentTime := time.Now()
+	return &Delivery{
+		getDeliveryID(providerName, deliveryID),
+		providerName,
+		deliveryID,
+		username,
+		imageInformationName,
+		redactHeaderMap(headerMap),
+		true,
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		currentTime,
+		currentTime,
+	}
+}
+
+func saveDelivery(delivery *Delivery) {
+	delivery.UpdatedTime = time.Now()
+	if err := GetStorage().SaveDelivery(delivery); err != nil {
+		log.Error("Save delivery %v error %s", delivery, err)
+	}
+}
+
+// Delete the delivery created by the replay check so it is not counted as received
+func releaseDelivery(delivery *Delivery) {
+	if err := GetStorage().DeleteDelivery(delivery.ID); err != nil {
+		log.Error("Release delivery %v error %s", delivery, err)
+	}
+}
+
+// The delivery is replayed if it already exists. Creating it is atomic so the concurrent replays couldn't both pass.
+func isReplayedDelivery(delivery *Delivery) bool {
+	delivery.UpdatedTime = time.Now()
+	err := GetStorage().CreateDelivery(delivery)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeNodeExist {
+		return true
+	}
+	if err != nil {
+		log.Error("Create delivery %v error %s", delivery, err)
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"testing"
+)
+
+func TestRedactHeaderMap(t *testing.T) {
+	headerMap := map[string]string{
+		"X-Gitlab-Token": "secret",
+		"X-Gitlab-Event": "Push Hook",
+	}
+	redactedHeaderMap := redactHeaderMap(headerMap)
+	if redactedHeaderMap["X-Gitlab-Token"] != redactedHeaderValue || redactedHeaderMap["X-Gitlab-Event"] != "Push Hook" {
+		t.Errorf("Only the secret header should be redacted but get %v", redactedHeaderMap)
+	}
+	if headerMap["X-Gitlab-Token"] != "secret" {
+		t.Errorf("The original header map should not be changed")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+)
+
+// Gitea signs the payload with HMAC-SHA256 in the header X-Gitea-Signature without any prefix
+type GiteaProvider struct {
+}
+
+func (giteaProvider *GiteaProvider) GetName() string {
+	return "Gitea"
+}
+
+func (giteaProvider *GiteaProvider) GetSecretMetaDataKey() string {
+	return "giteaWebhookSecret"
+}
+
+func (giteaProvider *GiteaProvider) Verify(secret string, signature string, payload string) error {
+	generatedSignature := getHMACSignature(sha256.New, secret, payload)
+	if isSecretEqual(generatedSignature, signature) == false {
+		return errors.New("The signature is invalid")
+	}
+	return nil
+}
+
+func (giteaProvider *GiteaProvider) ParsePushEvent(payload string) (*PushEvent, error) {
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal([]byte(payload), &jsonMap)
+	if err != nil {
+		log.Error("Unmarshal payload error %s", err)
+		return nil, err
+	}
+
+	pusherJsonMap, _ := jsonMap["pusher"].(map[string]interface{})
+	pusherName, _ := pusherJsonMap["login"].(string)
+	if len(pusherName) == 0 {
+		pusherName, _ = pusherJsonMap["username"].(string)
+	}
+
+	repositoryJsonMap, _ := jsonMap["repository"].(map[string]interface{})
+	cloneUrl, _ := repositoryJsonMap["clone_url"].(string)
+
+	if len(cloneUrl) == 0 {
+		log.Error("Can't find clone_url in gitea payload")
+		return nil, errors.New("Can't find clone_url in gitea payload")
+	}
+
+	ref, _ := jsonMap["ref"].(string)
+
+	return &PushEvent{
+		cloneUrl,
+		getBranchFromRef(ref),
+		pusherName,
+	}, nil
+}
@@ -15,62 +15,32 @@
 package webhook
 
 import (
-	"crypto/hmac"
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"github.com/cloudawan/cloudone/authorization"
-	"github.com/cloudawan/cloudone/deploy"
-	"github.com/cloudawan/cloudone/image"
-	"github.com/coreos/etcd/client"
 )
 
-func getGitHashSignature(secret string, message string) string {
-	key := []byte(secret)
-	hash := hmac.New(sha1.New, key)
-	hash.Write([]byte(message))
-
-	return "sha1=" + hex.EncodeToString(hash.Sum(nil))
+// Github signs the payload with HMAC-SHA1 in the header X-Hub-Signature and HMAC-SHA256 in the header X-Hub-Signature-256
+type GithubProvider struct {
 }
 
-func Notify(username string, imageInformationName string, signature string, payload string, kubeApiServerEndPoint string, kubeApiServerToken string) error {
-	if len(username) == 0 {
-		log.Error("User couldn't be empty. Signature %s", signature)
-		log.Debug(payload)
-		return errors.New("User couldn't be empty")
-	}
-
-	if len(signature) == 0 {
-		return errors.New("The secret is required")
-	}
+func (githubProvider *GithubProvider) GetName() string {
+	return "Github"
+}
 
-	user, err := authorization.GetStorage().LoadUser(username)
-	etcdError, _ := err.(client.Error)
-	if etcdError.Code == client.ErrorCodeKeyNotFound {
-		return errors.New("The user " + username + " doesn't exist")
-	}
-	if err != nil {
-		log.Error("Get user error %s. User name %s, signature %s", err, username, signature)
-		log.Debug(payload)
-		return err
-	}
+func (githubProvider *GithubProvider) GetSecretMetaDataKey() string {
+	return "githubWebhookSecret"
+}
 
-	// If secret is used
-	githubWebhookSecret := user.MetaDataMap["githubWebhookSecret"]
-	generatedSignature := getGitHashSignature(githubWebhookSecret, payload)
-	if generatedSignature != signature {
-		log.Error("The signature is invalid. User name %s, signature %s, generated signature %s", username, signature, generatedSignature)
-		log.Debug(payload)
-		return errors.New("The signature is invalid")
-	}
+func (githubProvider *GithubProvider) Verify(secret string, signature string, payload string) error {
+	return verifyPrefixedHMACSignature(secret, signature, payload)
+}
 
+func (githubProvider *GithubProvider) ParsePushEvent(payload string) (*PushEvent, error) {
 	jsonMap := make(map[string]interface{})
-	err = json.Unmarshal([]byte(payload), &jsonMap)
+	err := json.Unmarshal([]byte(payload), &jsonMap)
 	if err != nil {
-		log.Error("Unmarshal payload error %s. User name %s, signature %s", err, username, signature)
-		log.Debug(payload)
-		return err
+		log.Error("Unmarshal payload error %s", err)
+		return nil, err
 	}
 
 	pusherJsonMap, _ := jsonMap["pusher"].(map[string]interface{})
@@ -80,68 +50,15 @@ func Notify(username string, imageInformationName string, signature string, payl
 	cloneUrl, _ := repositoryJsonMap["clone_url"].(string)
 
 	if len(cloneUrl) == 0 {
-		log.Error("Can't find clone_url in github payload. User name %s, signature %s", username, signature)
-		log.Debug(payload)
-		return errors.New("Can't find clone_url in github payload")
-	}
-
-	imageInformation, err := image.GetStorage().LoadImageInformation(imageInformationName)
-	etcdError, _ = err.(client.Error)
-	if etcdError.Code == client.ErrorCodeKeyNotFound {
-		return errors.New("The repository " + imageInformationName + " doesn't exist")
-	}
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-
-	sourceCodeURL := imageInformation.BuildParameter["sourceCodeURL"]
-	if sourceCodeURL != cloneUrl {
-		// Not the target, ignore.
-		return nil
-	}
-
-	if len(imageInformationName) == 0 {
-		log.Error("Can't find image information using the github url %s. User name %s, signature %s", cloneUrl, username, signature)
-		log.Debug(payload)
-		return errors.New("Can't find image information using the github url")
+		log.Error("Can't find clone_url in github payload")
+		return nil, errors.New("Can't find clone_url in github payload")
 	}
 
-	// Asyncronized build
-	go func() {
-		outputMessage, err := image.BuildUpgrade(imageInformationName, "Github webhook. Pusher: "+pusherName)
-		if err != nil {
-			log.Error(err)
-			log.Debug(outputMessage)
-		} else {
-			// Build sccessfully
-			// Auto rolling update the deployment if configured
-			imageInformation, err := image.GetStorage().LoadImageInformation(imageInformationName)
-			if err != nil {
-				log.Error(err)
-			} else {
-				deployInformationSlice, err := deploy.GetDeployInformationWithAutoUpdateForNewBuild(imageInformationName)
-				if err != nil {
-					log.Error(err)
-				} else {
-					for _, deployInformation := range deployInformationSlice {
-						description := "Trigged by version " + imageInformation.CurrentVersion
-						err := deploy.DeployUpdate(
-							kubeApiServerEndPoint,
-							kubeApiServerToken,
-							deployInformation.Namespace,
-							imageInformation.Name,
-							imageInformation.CurrentVersion,
-							description,
-							deployInformation.EnvironmentSlice)
-						if err != nil {
-							log.Error(err)
-						}
-					}
-				}
-			}
-		}
-	}()
+	ref, _ := jsonMap["ref"].(string)
 
-	return nil
+	return &PushEvent{
+		cloneUrl,
+		getBranchFromRef(ref),
+		pusherName,
+	}, nil
 }
@@ -0,0 +1,71 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// GitLab doesn't sign the payload but sends the configured secret token in the header X-Gitlab-Token
+type GitlabProvider struct {
+}
+
+func (gitlabProvider *GitlabProvider) GetName() string {
+	return "GitLab"
+}
+
+func (gitlabProvider *GitlabProvider) GetSecretMetaDataKey() string {
+	return "gitlabWebhookSecret"
+}
+
+func (gitlabProvider *GitlabProvider) Verify(secret string, signature string, payload string) error {
+	if len(secret) == 0 || isSecretEqual(secret, signature) == false {
+		return errors.New("The token is invalid")
+	}
+	return nil
+}
+
+func (gitlabProvider *GitlabProvider) ParsePushEvent(payload string) (*PushEvent, error) {
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal([]byte(payload), &jsonMap)
+	if err != nil {
+		log.Error("Unmarshal payload error %s", err)
+		return nil, err
+	}
+
+	pusherName, _ := jsonMap["user_name"].(string)
+
+	// The old payload only has repository while the new one has project
+	projectJsonMap, _ := jsonMap["project"].(map[string]interface{})
+	cloneUrl, _ := projectJsonMap["git_http_url"].(string)
+	if len(cloneUrl) == 0 {
+		repositoryJsonMap, _ := jsonMap["repository"].(map[string]interface{})
+		cloneUrl, _ = repositoryJsonMap["git_http_url"].(string)
+	}
+
+	if len(cloneUrl) == 0 {
+		log.Error("Can't find git_http_url in gitlab payload")
+		return nil, errors.New("Can't find git_http_url in gitlab payload")
+	}
+
+	ref, _ := jsonMap["ref"].(string)
+
+	return &PushEvent{
+		cloneUrl,
+		getBranchFromRef(ref),
+		pusherName,
+	}, nil
+}
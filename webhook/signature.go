@@ -0,0 +1,62 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+)
+
+const (
+	signaturePrefixSHA1   = "sha1="
+	signaturePrefixSHA256 = "sha256="
+)
+
+func getHMACSignature(hashFunction func() hash.Hash, secret string, message string) string {
+	key := []byte(secret)
+	mac := hmac.New(hashFunction, key)
+	mac.Write([]byte(message))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// The signature is prefixed with the algorithm such as sha1=xxx or sha256=xxx
+func verifyPrefixedHMACSignature(secret string, signature string, payload string) error {
+	var generatedSignature string
+	switch {
+	case strings.HasPrefix(signature, signaturePrefixSHA256):
+		generatedSignature = signaturePrefixSHA256 + getHMACSignature(sha256.New, secret, payload)
+	case strings.HasPrefix(signature, signaturePrefixSHA1):
+		generatedSignature = signaturePrefixSHA1 + getHMACSignature(sha1.New, secret, payload)
+	default:
+		return errors.New("The signature algorithm is not supported")
+	}
+
+	if hmac.Equal([]byte(generatedSignature), []byte(signature)) == false {
+		return errors.New("The signature is invalid")
+	}
+	return nil
+}
+
+// Compare in constant time so the secret can't be guessed with the response time
+func isSecretEqual(secret string, text string) bool {
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(text)) == 1
+}
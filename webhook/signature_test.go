@@ -0,0 +1,42 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"testing"
+)
+
+func TestVerifyPrefixedHMACSignature(t *testing.T) {
+	payload := "{\"ref\":\"refs/heads/master\"}"
+
+	// Generated with: echo -n payload | openssl dgst -sha1 -hmac secret
+	sha1Signature := "sha1=acb0be542e7d080e7e0253bfaa88c5fc95e28fe2"
+	if err := verifyPrefixedHMACSignature("secret", sha1Signature, payload); err != nil {
+		t.Errorf("SHA-1 signature should be valid but get error %s", err)
+	}
+
+	sha256Signature := "sha256=18bd702ca7dab5713101db346ec6cd6768820c090515db9744deff53bc95ff52"
+	if err := verifyPrefixedHMACSignature("secret", sha256Signature, payload); err != nil {
+		t.Errorf("SHA-256 signature should be valid but get error %s", err)
+	}
+
+	if err := verifyPrefixedHMACSignature("wrong", sha256Signature, payload); err == nil {
+		t.Errorf("Signature with the wrong secret should be invalid")
+	}
+
+	if err := verifyPrefixedHMACSignature("secret", "md5=abc", payload); err == nil {
+		t.Errorf("Signature with the unsupported algorithm should be invalid")
+	}
+}
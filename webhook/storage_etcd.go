@@ -0,0 +1,164 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone/utility/database/etcd"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+type StorageEtcd struct {
+}
+
+func (storageEtcd *StorageEtcd) initialize() error {
+	if err := etcd.EtcdClient.CreateDirectoryIfNotExist(etcd.EtcdClient.EtcdBasePath + "/webhook_delivery"); err != nil {
+		log.Error("Create if not existing webhook delivery directory error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) DeleteDelivery(id string) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	response, err := keysAPI.Delete(context.Background(), etcd.EtcdClient.EtcdBasePath+"/webhook_delivery/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		log.Debug(err)
+		log.Debug(response)
+		return nil
+	}
+	if err != nil {
+		log.Error("Delete webhook delivery with id %s error: %s", id, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+// Fail with the node existing error if the delivery exists
+func (storageEtcd *StorageEtcd) CreateDelivery(delivery *Delivery) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(delivery)
+	if err != nil {
+		log.Error("Marshal webhook delivery %v error %s", delivery, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/webhook_delivery/"+delivery.ID, string(byteSlice), &client.SetOptions{TTL: deliveryRetention, PrevExist: client.PrevNoExist})
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeNodeExist {
+		return etcdError
+	}
+	if err != nil {
+		log.Error("Create webhook delivery %v error: %s", delivery, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) SaveDelivery(delivery *Delivery) error {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return err
+	}
+
+	byteSlice, err := json.Marshal(delivery)
+	if err != nil {
+		log.Error("Marshal webhook delivery %v error %s", delivery, err)
+		return err
+	}
+
+	response, err := keysAPI.Set(context.Background(), etcd.EtcdClient.EtcdBasePath+"/webhook_delivery/"+delivery.ID, string(byteSlice), &client.SetOptions{TTL: deliveryRetention})
+	if err != nil {
+		log.Error("Save webhook delivery %v error: %s", delivery, err)
+		log.Error(response)
+		return err
+	}
+
+	return nil
+}
+
+func (storageEtcd *StorageEtcd) LoadDelivery(id string) (*Delivery, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/webhook_delivery/"+id, nil)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, etcdError
+	}
+	if err != nil {
+		log.Error("Load webhook delivery with id %s error: %s", id, err)
+		log.Error(response)
+		return nil, err
+	}
+
+	delivery := new(Delivery)
+	err = json.Unmarshal([]byte(response.Node.Value), &delivery)
+	if err != nil {
+		log.Error("Unmarshal webhook delivery %v error %s", response.Node.Value, err)
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (storageEtcd *StorageEtcd) LoadAllDelivery() ([]Delivery, error) {
+	keysAPI, err := etcd.EtcdClient.GetKeysAPI()
+	if err != nil {
+		log.Error("Get keysAPI error %s", err)
+		return nil, err
+	}
+
+	response, err := keysAPI.Get(context.Background(), etcd.EtcdClient.EtcdBasePath+"/webhook_delivery", nil)
+	if err != nil {
+		log.Error("Load all webhook delivery error: %s", err)
+		log.Error(response)
+		return nil, err
+	}
+
+	deliverySlice := make([]Delivery, 0)
+	for _, node := range response.Node.Nodes {
+		delivery := Delivery{}
+		err := json.Unmarshal([]byte(node.Value), &delivery)
+		if err != nil {
+			log.Error("Unmarshal webhook delivery %v error %s", node.Value, err)
+			return nil, err
+		}
+		deliverySlice = append(deliverySlice, delivery)
+	}
+
+	return deliverySlice, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone/authorization"
+	"github.com/cloudawan/cloudone/deploy"
+	"github.com/cloudawan/cloudone/image"
+	"github.com/coreos/etcd/client"
+	"strings"
+)
+
+const (
+	ProviderGithub    = "github"
+	ProviderGitlab    = "gitlab"
+	ProviderBitbucket = "bitbucket"
+	ProviderGitea     = "gitea"
+)
+
+type PushEvent struct {
+	CloneURL string
+	Branch   string
+	Pusher   string
+}
+
+type Provider interface {
+	GetName() string
+	GetSecretMetaDataKey() string
+	Verify(secret string, signature string, payload string) error
+	ParsePushEvent(payload string) (*PushEvent, error)
+}
+
+var providerMap = map[string]Provider{
+	ProviderGithub:    &GithubProvider{},
+	ProviderGitlab:    &GitlabProvider{},
+	ProviderBitbucket: &BitbucketProvider{},
+	ProviderGitea:     &GiteaProvider{},
+}
+
+func GetProvider(name string) (Provider, error) {
+	provider, ok := providerMap[name]
+	if ok == false {
+		return nil, errors.New("No such webhook provider: " + name)
+	}
+	return provider, nil
+}
+
+// The ref in the push payload is like refs/heads/master
+func getBranchFromRef(ref string) string {
+	return strings.TrimPrefix(ref, "refs/heads/")
+}
+
+// Clone url could be configured with or without the .git suffix
+func isSameRepository(sourceCodeURL string, cloneURL string) bool {
+	return strings.TrimSuffix(sourceCodeURL, ".git") == strings.TrimSuffix(cloneURL, ".git")
+}
+
+func Notify(providerName string, username string, imageInformationName string, deliveryID string, headerMap map[string]string, signature string, payload string, kubeApiServerEndPoint string, kubeApiServerToken string) error {
+	provider, err := GetProvider(providerName)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// The body is not trusted before verified so nothing in it is recorded
+	pushEvent, err := verifyAndParsePushEvent(provider, username, signature, payload)
+	if err != nil {
+		return err
+	}
+
+	delivery := createDelivery(providerName, deliveryID, username, imageInformationName, headerMap)
+	delivery.CloneURL = pushEvent.CloneURL
+	delivery.Branch = pushEvent.Branch
+	delivery.Pusher = pushEvent.Pusher
+
+	if isReplayedDelivery(delivery) {
+		log.Error("The delivery %s from %s is replayed. User name %s", deliveryID, providerName, username)
+		return errors.New("The delivery " + deliveryID + " is already received")
+	}
+
+	toBuild, message, err := isPushEventToBuild(imageInformationName, pushEvent)
+	if err != nil {
+		// Only the triggered and ignored deliveries are consumed so the redelivery with the same id is processed again
+		releaseDelivery(delivery)
+		return err
+	}
+	if toBuild == false {
+		delivery.Result = DeliveryResultIgnored
+		delivery.Message = message
+		saveDelivery(delivery)
+		return nil
+	}
+
+	delivery.Result = DeliveryResultTriggered
+	delivery.BuildResult = DeliveryBuildResultProcessing
+	saveDelivery(delivery)
+
+	// Asyncronized build
+	go func() {
+		outputMessage, err := image.BuildUpgrade(imageInformationName, provider.GetName()+" webhook. Pusher: "+pushEvent.Pusher)
+		if err != nil {
+			log.Error(err)
+			log.Debug(outputMessage)
+			delivery.BuildResult = DeliveryBuildResultFailure
+			delivery.BuildErrorMessage = err.Error()
+			saveDelivery(delivery)
+		} else {
+			// Build sccessfully
+			delivery.BuildResult = DeliveryBuildResultSuccess
+			// Auto rolling update the deployment if configured
+			imageInformation, err := image.GetStorage().LoadImageInformation(imageInformationName)
+			if err != nil {
+				log.Error(err)
+				saveDelivery(delivery)
+			} else {
+				delivery.BuildVersion = imageInformation.CurrentVersion
+				saveDelivery(delivery)
+
+				deployInformationSlice, err := deploy.GetDeployInformationWithAutoUpdateForNewBuild(imageInformationName)
+				if err != nil {
+					log.Error(err)
+				} else {
+					for _, deployInformation := range deployInformationSlice {
+						description := "Trigged by version " + imageInformation.CurrentVersion
+						err := deploy.DeployUpdate(
+							kubeApiServerEndPoint,
+							kubeApiServerToken,
+							deployInformation.Namespace,
+							imageInformation.Name,
+							imageInformation.CurrentVersion,
+							description,
+							deployInformation.EnvironmentSlice)
+						if err != nil {
+							log.Error(err)
+						}
+					}
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func verifyAndParsePushEvent(provider Provider, username string, signature string, payload string) (*PushEvent, error) {
+	if len(username) == 0 {
+		log.Error("User couldn't be empty. Provider %s", provider.GetName())
+		log.Debug(payload)
+		return nil, errors.New("User couldn't be empty")
+	}
+
+	if len(signature) == 0 {
+		return nil, errors.New("The secret is required")
+	}
+
+	user, err := authorization.GetStorage().LoadUser(username)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return nil, errors.New("The user " + username + " doesn't exist")
+	}
+	if err != nil {
+		log.Error("Get user error %s. User name %s", err, username)
+		log.Debug(payload)
+		return nil, err
+	}
+
+	secret := user.MetaDataMap[provider.GetSecretMetaDataKey()]
+	if err := provider.Verify(secret, signature, payload); err != nil {
+		log.Error("Verify %s webhook error %s. User name %s", provider.GetName(), err, username)
+		log.Debug(payload)
+		return nil, err
+	}
+
+	pushEvent, err := provider.ParsePushEvent(payload)
+	if err != nil {
+		log.Error("Parse %s payload error %s. User name %s", provider.GetName(), err, username)
+		log.Debug(payload)
+		return nil, err
+	}
+
+	return pushEvent, nil
+}
+
+// Return whether to build and the reason if not
+func isPushEventToBuild(imageInformationName string, pushEvent *PushEvent) (bool, string, error) {
+	if len(imageInformationName) == 0 {
+		log.Error("Can't find image information using the url %s", pushEvent.CloneURL)
+		return false, "", errors.New("Can't find image information using the url")
+	}
+
+	imageInformation, err := image.GetStorage().LoadImageInformation(imageInformationName)
+	etcdError, _ := err.(client.Error)
+	if etcdError.Code == client.ErrorCodeKeyNotFound {
+		return false, "", errors.New("The repository " + imageInformationName + " doesn't exist")
+	}
+	if err != nil {
+		log.Error(err)
+		return false, "", err
+	}
+
+	sourceCodeURL := imageInformation.BuildParameter["sourceCodeURL"]
+	if isSameRepository(sourceCodeURL, pushEvent.CloneURL) == false {
+		// Not the target, ignore.
+		return false, "The repository " + pushEvent.CloneURL + " is different from the source code url " + sourceCodeURL, nil
+	}
+
+	// If the branch is not configured, push to any branch triggers the build
+	webhookBranch := imageInformation.BuildParameter["webhookBranch"]
+	if len(webhookBranch) > 0 && webhookBranch != pushEvent.Branch {
+		// Not the target branch, ignore.
+		return false, "The branch " + pushEvent.Branch + " is different from the configured branch " + webhookBranch, nil
+	}
+
+	return true, "", nil
+}